@@ -0,0 +1,155 @@
+package spf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Action is what a receiver does with the message depending on the result,
+// see RFC 7208 section 8.
+type Action int
+
+const (
+	// Accept lets the message through
+	Accept Action = iota
+	// MarkOnly lets the message through marking it with the result for
+	// downstream filtering, e.g. in "Received-SPF" header field
+	MarkOnly
+	// Quarantine accepts the message holding it in quarantine
+	Quarantine
+	// Defer rejects the transaction with a temporary failure (4xx reply)
+	Defer
+	// Reject rejects the transaction (5xx reply)
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Accept:
+		return "accept"
+	case MarkOnly:
+		return "mark-only"
+	case Quarantine:
+		return "quarantine"
+	case Defer:
+		return "defer"
+	case Reject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+// ActionPolicy maps results of the checked identities to actions, results
+// not in the maps are accepted.
+type ActionPolicy struct {
+	Helo     map[Result]Action `json:"helo,omitempty"`     // results of HELO identity
+	MailFrom map[Result]Action `json:"mailFrom,omitempty"` // results of MAIL FROM identity
+	Catalog  Catalog           `json:"-"`                  // wording of replies, EnglishCatalog if nil
+}
+
+// DefaultActionPolicy returns the policy RFC 7208 section 8 recommends for
+// both identities:
+//   - "fail" is rejected;
+//   - "temperror" is deferred;
+//   - "softfail" and "permerror" are marked only;
+//   - "pass", "neutral" and "none" are accepted.
+func DefaultActionPolicy() ActionPolicy {
+	m := func() map[Result]Action {
+		return map[Result]Action{
+			Fail:      Reject,
+			Softfail:  MarkOnly,
+			Temperror: Defer,
+			Permerror: MarkOnly,
+		}
+	}
+	return ActionPolicy{Helo: m(), MailFrom: m()}
+}
+
+// Action returns the action for the result of the identity, "helo" or
+// "mailfrom" as Trace.Identity is. Other identities follow MailFrom.
+func (p ActionPolicy) Action(identity string, r Result) Action {
+	if identity == "helo" {
+		return p.Helo[r]
+	}
+	return p.MailFrom[r]
+}
+
+// Decide returns the action for the result in the trace and the SMTP reply
+// to reject or defer the transaction with, the zero Reply for other actions.
+func (p ActionPolicy) Decide(t *Trace) (Action, Reply) {
+	a := p.Action(t.Identity, t.Result)
+	c := p.Catalog
+	if c == nil {
+		c = EnglishCatalog{}
+	}
+	return a, replyFor(a, t, c)
+}
+
+// Reply is SMTP reply with enhanced status code of RFC 3463.
+type Reply struct {
+	Code   int    `json:"code"`   // e.g. 550
+	Status string `json:"status"` // e.g. "5.7.23"
+	Text   string `json:"text"`
+}
+
+func (r Reply) String() string {
+	if r.Code == 0 {
+		return ""
+	}
+	return strconv.Itoa(r.Code) + " " + r.Status + " " + r.Text
+}
+
+// ReplyFor returns the SMTP reply to reject (Reject) or defer (Defer) the
+// transaction with for the result in the trace, using the enhanced status
+// codes of RFC 7372: X.7.23 for "fail" (and other results rejected by local
+// policy) and X.7.24 for "temperror" and "permerror". The explanation of the
+// result is the text if there is one, made safe to use in the reply.
+// The zero Reply is returned for other actions. Texts of replies without
+// explanation are worded by EnglishCatalog, see ActionPolicy.Catalog.
+func ReplyFor(a Action, t *Trace) Reply {
+	return replyFor(a, t, EnglishCatalog{})
+}
+
+func replyFor(a Action, t *Trace, c Catalog) Reply {
+	var r Reply
+	switch a {
+	case Reject:
+		r.Code, r.Status = 550, "5."
+	case Defer:
+		r.Code, r.Status = 451, "4."
+	default:
+		return r
+	}
+	if t.Result == Temperror || t.Result == Permerror {
+		r.Status += "7.24"
+	} else {
+		r.Status += "7.23"
+	}
+
+	if t.Result != Temperror && t.Result != Permerror {
+		r.Text = replyText(t.Explanation)
+	}
+	if r.Text == "" {
+		r.Text = replyText(c.Reply(t.Identity, t.Result))
+	}
+	return r
+}
+
+// maxReplyText keeps reply lines within 512 octets of RFC 5321 section 4.5.3.1.5
+const maxReplyText = 400
+
+// replyText replaces characters not allowed in SMTP reply text and truncates it
+func replyText(s string) string {
+	s = strings.TrimSpace(s)
+	b := []byte(s)
+	for i, c := range b {
+		if c < ' ' || c > '~' {
+			b[i] = '?'
+		}
+	}
+	if len(b) > maxReplyText {
+		b = b[:maxReplyText]
+	}
+	return string(b)
+}
@@ -0,0 +1,67 @@
+package spf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultActionPolicy(t *testing.T) {
+	p := DefaultActionPolicy()
+	tests := []struct {
+		result Result
+		action Action
+	}{
+		{None, Accept},
+		{Neutral, Accept},
+		{Pass, Accept},
+		{Fail, Reject},
+		{Softfail, MarkOnly},
+		{Temperror, Defer},
+		{Permerror, MarkOnly},
+	}
+	for _, tt := range tests {
+		for _, identity := range []string{"helo", "mailfrom"} {
+			if got := p.Action(identity, tt.result); got != tt.action {
+				t.Errorf("Action(%q, %s) = %s; want %s", identity, tt.result, got, tt.action)
+			}
+		}
+	}
+}
+
+func TestActionPolicy_Decide(t *testing.T) {
+	p := ActionPolicy{
+		Helo:     map[Result]Action{Fail: Reject},
+		MailFrom: map[Result]Action{Fail: Reject, Softfail: Defer, Temperror: Defer, Permerror: Reject, Neutral: Quarantine},
+	}
+	tests := []struct {
+		trace  Trace
+		action Action
+		reply  string
+	}{
+		{Trace{Result: Fail, Identity: "mailfrom", Explanation: "192.0.2.1 is not allowed"}, Reject,
+			"550 5.7.23 192.0.2.1 is not allowed"},
+		{Trace{Result: Fail, Identity: "mailfrom"}, Reject, "550 5.7.23 SPF MAIL FROM check failed"},
+		{Trace{Result: Fail, Identity: "helo"}, Reject, "550 5.7.23 SPF HELO check failed"},
+		{Trace{Result: Fail, Identity: "mailfrom", Explanation: "ünicode\r\nline"}, Reject,
+			"550 5.7.23 ??nicode??line"},
+		{Trace{Result: Softfail, Identity: "mailfrom"}, Defer, "451 4.7.23 SPF MAIL FROM check failed"},
+		{Trace{Result: Softfail, Identity: "helo"}, Accept, ""},
+		{Trace{Result: Temperror, Identity: "mailfrom"}, Defer, "451 4.7.24 SPF MAIL FROM check temporary error"},
+		{Trace{Result: Permerror, Identity: "mailfrom"}, Reject, "550 5.7.24 SPF MAIL FROM check permanent error"},
+		{Trace{Result: Neutral, Identity: "mailfrom"}, Quarantine, ""},
+		{Trace{Result: Pass, Identity: "mailfrom"}, Accept, ""},
+	}
+	for _, tt := range tests {
+		a, r := p.Decide(&tt.trace)
+		if a != tt.action || r.String() != tt.reply {
+			t.Errorf("Decide(%s, %s) = %s, %q; want %s, %q", tt.trace.Identity, tt.trace.Result, a, r, tt.action, tt.reply)
+		}
+	}
+}
+
+func TestReplyFor_longExplanation(t *testing.T) {
+	r := ReplyFor(Reject, &Trace{Result: Fail, Explanation: strings.Repeat("x", 1000)})
+	if len(r.String()) > 512 {
+		t.Errorf("len(reply) = %d; want at most 512", len(r.String()))
+	}
+}
@@ -0,0 +1,61 @@
+package spf
+
+import (
+	"time"
+)
+
+// Aggregate is a combined view of ResponseExtras of all the DNS lookups
+// made during evaluation.
+type Aggregate struct {
+	// TTL is the minimal TTL of the answers the result depends on, it is
+	// the time the result could be cached for. The lookup for "exp=" is not
+	// taken into account as it only affects the explanation.
+	// TTL is zero if none of the lookups had answers.
+	TTL time.Duration `json:"ttl"`
+	// Queries is the number of lookups made, including the one for "exp="
+	Queries int `json:"queries"`
+	// ExplanationQueries is the number of lookups made for "exp=", 0 or 1
+	ExplanationQueries int `json:"explanationQueries,omitempty"`
+	// VoidLookups is the number of lookups returned NXDOMAIN or no answers
+	VoidLookups int `json:"voidLookups"`
+	// Answers, Authority and Additional are total numbers of records in
+	// the corresponding sections of all the responses
+	Answers    int `json:"answers"`
+	Authority  int `json:"authority"`
+	Additional int `json:"additional"`
+	// Size is the total wire size of all the responses in bytes
+	Size int `json:"size"`
+
+	hasTTL bool
+}
+
+// WithAggregate makes evaluation to collect Aggregate of the lookups into a.
+// The same Aggregate must not be used by concurrent evaluations.
+func WithAggregate(a *Aggregate) Option {
+	return func(p *parser) {
+		p.aggregate = a
+	}
+}
+
+func (a *Aggregate) add(t *token, e *ResponseExtras) {
+	if a == nil || e == nil {
+		return
+	}
+	a.Queries++
+	if t != nil && t.mechanism == tExp {
+		a.ExplanationQueries++
+	}
+	if e.Void {
+		a.VoidLookups++
+	}
+	a.Answers += e.Answers
+	a.Authority += e.Authority
+	a.Additional += e.Additional
+	a.Size += e.Size
+	if e.Answers == 0 || t != nil && t.mechanism == tExp {
+		return
+	}
+	if !a.hasTTL || e.TTL < a.TTL {
+		a.TTL, a.hasTTL = e.TTL, true
+	}
+}
@@ -0,0 +1,76 @@
+package spf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestAggregate_add(t *testing.T) {
+	var a Aggregate
+	a.add(nil, &ResponseExtras{Answers: 1, TTL: 300 * time.Second, Size: 100})
+	a.add(&token{tA, qPlus, "", 0, 0}, &ResponseExtras{Void: true, Authority: 1, Size: 80})
+	a.add(&token{tMX, qPlus, "", 0, 0}, &ResponseExtras{Answers: 2, Additional: 2, TTL: 120 * time.Second, Size: 200})
+	a.add(&token{tExp, qPlus, "exp.example.com", 0, 0}, &ResponseExtras{Answers: 1, TTL: time.Second, Size: 50})
+	a.add(&token{tA, qPlus, "", 0, 0}, nil) // over the limit
+	var nilAggregate *Aggregate
+	nilAggregate.add(nil, &ResponseExtras{})
+
+	want := Aggregate{
+		TTL:                120 * time.Second,
+		Queries:            4,
+		ExplanationQueries: 1,
+		VoidLookups:        1,
+		Answers:            4,
+		Authority:          1,
+		Additional:         2,
+		Size:               430,
+		hasTTL:             true,
+	}
+	if a != want {
+		t.Errorf("add() = %+v; want %+v", a, want)
+	}
+
+	var zero Aggregate
+	zero.add(nil, &ResponseExtras{Answers: 1})
+	if zero.TTL != 0 || !zero.hasTTL {
+		t.Errorf("add() = %+v; want zero TTL", zero)
+	}
+	zero.add(nil, &ResponseExtras{Answers: 1, TTL: time.Minute})
+	if zero.TTL != 0 {
+		t.Errorf("add() = %+v; want zero TTL kept", zero)
+	}
+}
+
+func TestWithAggregate(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("aggregate.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`aggregate.example. 300 IN TXT "v=spf1 mx a:void.aggregate.example -all"`,
+		},
+		dns.TypeMX: {
+			`aggregate.example. 30 IN MX 10 mx.aggregate.example.`,
+		},
+	}))
+	defer dns.HandleRemove("aggregate.example.")
+
+	dns.HandleFunc("mx.aggregate.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`mx.aggregate.example. 60 IN A 10.0.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("mx.aggregate.example.")
+
+	var a Aggregate
+	r, _, _, _ := CheckHost(net.ParseIP("10.0.0.2"), "aggregate.example", "aggregate.example",
+		WithResolver(testResolver), WithAggregate(&a))
+	if r != Fail {
+		t.Errorf("CheckHost() = %s; want fail", r)
+	}
+	if a.Queries != 3 || a.VoidLookups != 1 || a.TTL != 30*time.Second {
+		t.Errorf("Aggregate = %+v; want 3 queries, 1 void lookup, TTL 30s", a)
+	}
+}
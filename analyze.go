@@ -0,0 +1,202 @@
+package spf
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+)
+
+// RecordAnalysis is the evaluation of SPF policy of a domain for a set of
+// candidate sending IPs made by AnalyzeRecord.
+type RecordAnalysis struct {
+	Domain string       `json:"domain"`
+	IPs    []IPAnalysis `json:"ips"` // in order of the IPs given
+}
+
+// IPAnalysis is the evaluation of the policy for a single IP.
+type IPAnalysis struct {
+	IP      net.IP   `json:"ip"`
+	Result  Result   `json:"result"`
+	Err     error    `json:"error,omitempty"`
+	Matched []string `json:"matched,omitempty"` // terms that lead to the result, see Path.Chain
+	Path    *Path    `json:"path"`
+}
+
+// MarshalJSON implements json.Marshaler, Err is rendered the way
+// SyntaxError.MarshalJSON does.
+func (a IPAnalysis) MarshalJSON() ([]byte, error) {
+	type ipAnalysis IPAnalysis
+	return json.Marshal(struct {
+		ipAnalysis
+		Err *errorJSON `json:"error,omitempty"`
+	}{ipAnalysis(a), newErrorJSON(a.Err)})
+}
+
+// Uncovered returns the IPs the policy doesn't give "pass" to.
+func (a *RecordAnalysis) Uncovered() []net.IP {
+	var ips []net.IP
+	for _, ip := range a.IPs {
+		if ip.Result != Pass {
+			ips = append(ips, ip.IP)
+		}
+	}
+	return ips
+}
+
+// AnalyzeRecord evaluates SPF policy of the domain for every IP the way
+// Explain does and reports the terms each of them matches, e.g. to verify
+// that a new sending service is covered by the policy. DNS answers are
+// looked up with r once and reused by the evaluations, every evaluation is
+// limited to 10 lookups. The options are applied to every evaluation.
+func AnalyzeRecord(domain string, ips []net.IP, r Resolver, opts ...Option) *RecordAnalysis {
+	return analyzeRecord(NormalizeFQDN(domain), ips, newMemoResolver(r), opts)
+}
+
+func analyzeRecord(domain string, ips []net.IP, m *memoResolver, opts []Option) *RecordAnalysis {
+	opts = opts[:len(opts):len(opts)]
+	a := &RecordAnalysis{Domain: domain, IPs: make([]IPAnalysis, 0, len(ips))}
+	for _, ip := range ips {
+		p := Explain(ip, domain, append(opts, WithResolver(NewLimitedResolver(m, MaxDNSLookups, MaxMXNames)))...)
+		ipa := IPAnalysis{IP: ip, Result: p.Result, Err: p.Err, Path: p}
+		for _, s := range p.Chain() {
+			ipa.Matched = append(ipa.Matched, s.Term)
+		}
+		a.IPs = append(a.IPs, ipa)
+	}
+	return a
+}
+
+// memoResolver remembers answers of the wrapped resolver. Address lookups
+// are made once for all the addresses of the name, so the answers could be
+// matched against any IP.
+type memoResolver struct {
+	resolver Resolver
+	mu       sync.Mutex
+	answers  map[memoKey]*memoAnswer
+}
+
+type memoKey struct {
+	kind string
+	name string
+}
+
+type memoAnswer struct {
+	txts   []string
+	found  bool
+	addrs  []memoAddr
+	extras *ResponseExtras
+	err    error
+}
+
+// memoAddr is an address of a name, the name is the MX name for MX lookups
+type memoAddr struct {
+	ip   net.IP
+	name string
+}
+
+func newMemoResolver(r Resolver) *memoResolver {
+	return &memoResolver{resolver: r, answers: make(map[memoKey]*memoAnswer)}
+}
+
+// answer returns the remembered answer or the one looked up,
+// the answer is a copy with extras accounted as cache hits if remembered
+func (m *memoResolver) answer(kind, name string, lookup func() *memoAnswer) *memoAnswer {
+	k := memoKey{kind, name}
+	m.mu.Lock()
+	a, ok := m.answers[k]
+	m.mu.Unlock()
+	if !ok {
+		a = lookup()
+		m.mu.Lock()
+		m.answers[k] = a
+		m.mu.Unlock()
+		return a
+	}
+	reused := *a
+	if a.extras != nil {
+		e := *a.extras
+		e.CacheHits = e.Queries
+		reused.extras = &e
+	}
+	return &reused
+}
+
+// match replays the addresses to the matcher
+func (a *memoAnswer) match(matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	if a.err != nil {
+		return false, a.extras, a.err
+	}
+	for _, addr := range a.addrs {
+		if found, err := matcher(addr.ip, addr.name); found || err != nil {
+			return found, a.extras, err
+		}
+	}
+	return false, a.extras, nil
+}
+
+// addresses looks up all the addresses with the lookup
+func addresses(lookup func(IPMatcherFunc) (bool, *ResponseExtras, error)) *memoAnswer {
+	var (
+		mu sync.Mutex
+		a  memoAnswer
+	)
+	_, a.extras, a.err = lookup(func(ip net.IP, name string) (bool, error) {
+		mu.Lock()
+		a.addrs = append(a.addrs, memoAddr{ip, name})
+		mu.Unlock()
+		return false, nil
+	})
+	return &a
+}
+
+func (m *memoResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	a := m.answer("TXT", name, func() *memoAnswer {
+		var a memoAnswer
+		a.txts, a.extras, a.err = m.resolver.LookupTXT(name)
+		return &a
+	})
+	return a.txts, a.extras, a.err
+}
+
+func (m *memoResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	a := m.answer("TXT:strict", name, func() *memoAnswer {
+		var a memoAnswer
+		a.txts, a.extras, a.err = m.resolver.LookupTXTStrict(name)
+		return &a
+	})
+	return a.txts, a.extras, a.err
+}
+
+func (m *memoResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	a := m.answer("A", name, func() *memoAnswer {
+		var a memoAnswer
+		a.found, a.extras, a.err = m.resolver.Exists(name)
+		return &a
+	})
+	return a.found, a.extras, a.err
+}
+
+func (m *memoResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	return m.answer("ip", name, func() *memoAnswer {
+		return addresses(func(f IPMatcherFunc) (bool, *ResponseExtras, error) {
+			return m.resolver.MatchIP(name, f)
+		})
+	}).match(matcher)
+}
+
+func (m *memoResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	return m.answer("MX", name, func() *memoAnswer {
+		return addresses(func(f IPMatcherFunc) (bool, *ResponseExtras, error) {
+			return m.resolver.MatchMX(name, f)
+		})
+	}).match(matcher)
+}
+
+// LookupPTR depends on the IP, it's passed to the wrapped resolver
+func (m *memoResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	return lookupPTR(m.resolver, ip)
+}
+
+func (m *memoResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	return confirmPTR(m.resolver, name, ip)
+}
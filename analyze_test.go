@@ -0,0 +1,84 @@
+package spf
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countingResolver counts the lookups passed to the wrapped resolver
+type countingResolver struct {
+	Resolver
+	lookups int
+}
+
+func (r *countingResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	r.lookups++
+	return r.Resolver.LookupTXTStrict(name)
+}
+
+func (r *countingResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	r.lookups++
+	return r.Resolver.MatchIP(name, matcher)
+}
+
+func (r *countingResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	r.lookups++
+	return r.Resolver.MatchMX(name, matcher)
+}
+
+func TestAnalyzeRecord(t *testing.T) {
+	o, err := NewOverlayResolver(testResolver, map[string][]string{
+		"analyze.example":       {"v=spf1 ip4:192.0.2.0/24 mx include:_spf.analyze.example -all", "MX 10 mx.analyze.example."},
+		"mx.analyze.example":    {"A 198.51.100.1", "A 198.51.100.2"},
+		"_spf.analyze.example":  {"v=spf1 a:relay.analyze.example ~all"},
+		"relay.analyze.example": {"A 203.0.113.1", "AAAA 2001:db8::1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &countingResolver{Resolver: o}
+
+	ips := []net.IP{
+		net.ParseIP("192.0.2.7"),
+		net.ParseIP("198.51.100.2"),
+		net.ParseIP("2001:db8::1"),
+		net.ParseIP("203.0.113.9"),
+		net.ParseIP("198.51.100.1"),
+	}
+	a := AnalyzeRecord("analyze.example", ips, r)
+
+	want := []struct {
+		result  Result
+		matched []string
+	}{
+		{Pass, []string{"ip4:192.0.2.0/24"}},
+		{Pass, []string{"mx"}},
+		{Pass, []string{"include:_spf.analyze.example", "a:relay.analyze.example"}},
+		{Fail, []string{"-all"}},
+		{Pass, []string{"mx"}},
+	}
+	if a.Domain != "analyze.example." || len(a.IPs) != len(want) {
+		t.Fatalf("AnalyzeRecord() = %+v", a)
+	}
+	for i, w := range want {
+		got := a.IPs[i]
+		if !got.IP.Equal(ips[i]) || got.Result != w.result || got.Err != nil || !reflect.DeepEqual(got.Matched, w.matched) {
+			t.Errorf("IPs[%d] = %s %s %v %q; want %s %q", i, got.IP, got.Result, got.Err, got.Matched, w.result, w.matched)
+		}
+	}
+	if u := a.Uncovered(); len(u) != 1 || !u[0].Equal(ips[3]) {
+		t.Errorf("Uncovered() = %v", u)
+	}
+	// TXT of both records, MX of the domain, addresses of relay
+	if r.lookups != 4 {
+		t.Errorf("lookups = %d; want 4", r.lookups)
+	}
+
+	b, err := json.Marshal(a.IPs[0])
+	if err != nil || !strings.Contains(string(b), `"matched":["ip4:192.0.2.0/24"]`) {
+		t.Errorf("json.Marshal() = %s, %v", b, err)
+	}
+}
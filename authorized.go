@@ -0,0 +1,234 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// AuthorizedNetwork is a network authorized to send mail on behalf of a
+// domain together with the chain of terms contributing it, e.g.
+// ["include:_spf.example.com", "ip4:192.0.2.0/24"].
+// Network is nil when the authorized set of the last term in the chain could
+// not be enumerated: "exists", "ptr" and terms using macros depend on the
+// checked message.
+type AuthorizedNetwork struct {
+	Network *net.IPNet `json:"network,omitempty"`
+	Chain   []string   `json:"chain"`
+}
+
+// AuthorizedNetworks expands SPF policy of the domain into the set of
+// networks that would produce "pass". The policy is walked as it
+// published, earlier terms producing other results are not subtracted from
+// the networks of later ones.
+// Lookups are subject to the same limits as CheckHost, so the function
+// returns networks found before the problem together with the error
+// if the policy could not be fully expanded.
+func AuthorizedNetworks(domain string, r Resolver) ([]AuthorizedNetwork, error) {
+	policy, err := newPolicyWalker(r).walk(NormalizeFQDN(domain))
+	return policy.authorizedNetworks(nil, nil), err
+}
+
+// policyTree is SPF policy of a domain with all the lookups made
+type policyTree struct {
+	domain   string
+	record   string
+	terms    []*policyTerm
+	redirect *policyTerm // nil if there is no "redirect" or it is ignored because of "all"
+}
+
+// policyTerm is a mechanism or "redirect" of policyTree
+type policyTerm struct {
+	token     *token
+	networks  []*net.IPNet // networks the mechanism matches
+	policy    *policyTree  // policy of "include" or "redirect" target
+	unbounded bool         // networks of the term could not be enumerated
+}
+
+func (p *policyTree) authorizedNetworks(chain []string, networks []AuthorizedNetwork) []AuthorizedNetwork {
+	if p == nil {
+		return networks
+	}
+	add := func(n *net.IPNet, t *policyTerm) {
+		c := make([]string, len(chain), len(chain)+1)
+		copy(c, chain)
+		networks = append(networks, AuthorizedNetwork{Network: n, Chain: append(c, t.token.String())})
+	}
+	walk := func(t *policyTerm) {
+		switch {
+		case t.unbounded:
+			add(nil, t)
+		case t.policy != nil:
+			networks = t.policy.authorizedNetworks(append(chain[:len(chain):len(chain)], t.token.String()), networks)
+		default:
+			for _, n := range t.networks {
+				add(n, t)
+			}
+		}
+	}
+	for _, t := range p.terms {
+		if r, _ := matchingResult(t.token.qualifier); r == Pass {
+			walk(t)
+		}
+	}
+	if p.redirect != nil {
+		walk(p.redirect)
+	}
+	return networks
+}
+
+// policyWalker makes all the lookups required by a policy regardless of
+// the checked IP address
+type policyWalker struct {
+	resolver Resolver
+	visited  *stringsStack
+	extras   *ResponseExtras // all lookups made
+}
+
+func newPolicyWalker(r Resolver) *policyWalker {
+	return &policyWalker{
+		resolver: NewLimitedResolver(r, MaxDNSLookups, MaxMXNames),
+		visited:  newStringsStack(),
+	}
+}
+
+// walk returns the policy of the domain. Upon error the policy contains
+// terms walked before the problem.
+func (w *policyWalker) walk(domain string) (*policyTree, error) {
+	if !isDomainName(domain) {
+		return nil, newInvalidDomainError(domain)
+	}
+	if w.visited.has(domain) {
+		return nil, w.visited.loop(domain)
+	}
+	w.visited.push(domain)
+	defer w.visited.pop()
+
+	txts, extras, err := w.resolver.LookupTXTStrict(domain)
+	w.extras = w.extras.merge(extras)
+	if err != nil {
+		return nil, err
+	}
+	spf, err := filterSPF(txts)
+	if err != nil {
+		return nil, err
+	}
+	if spf == "" {
+		return nil, ErrSPFNotFound
+	}
+	mechanisms, redirect, _, _, err := sortTokens(lex(spf))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &policyTree{domain: domain, record: spf}
+	var all bool
+	for _, t := range mechanisms {
+		if t.mechanism == tVersion {
+			continue
+		}
+		term := &policyTerm{token: t}
+		p.terms = append(p.terms, term)
+		if err := w.walkMechanism(domain, term); err != nil {
+			return p, err
+		}
+		if t.mechanism == tAll {
+			// mechanisms after "all" are never reached
+			all = true
+			break
+		}
+	}
+	if redirect == nil || all {
+		return p, nil
+	}
+	p.redirect = &policyTerm{token: redirect}
+	if strings.ContainsRune(redirect.value, '%') {
+		p.redirect.unbounded = true
+		return p, nil
+	}
+	w.visited.via(tRedirect)
+	p.redirect.policy, err = w.walk(NormalizeFQDN(redirect.value))
+	if err != nil {
+		return p, SyntaxError{redirect, err}
+	}
+	return p, nil
+}
+
+func (w *policyWalker) walkMechanism(domain string, term *policyTerm) error {
+	t := term.token
+	if strings.ContainsRune(t.value, '%') {
+		term.unbounded = true
+		return nil
+	}
+	switch t.mechanism {
+	case tAll:
+		term.networks = []*net.IPNet{
+			{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+			{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)},
+		}
+	case tIP4, tIP6:
+		n, err := parseNetwork(t.value)
+		if err != nil || (t.mechanism == tIP4) != (n.IP.To4() != nil) {
+			if t.mechanism == tIP4 {
+				return SyntaxError{t, ErrNotIPv4}
+			}
+			return SyntaxError{t, ErrNotIPv6}
+		}
+		term.networks = []*net.IPNet{n}
+	case tA, tMX:
+		fqdn, ip4Mask, ip6Mask, err := splitDomainDualCIDR(domainSpec(t.value, domain))
+		if err != nil {
+			return SyntaxError{t, err}
+		}
+		fqdn = NormalizeFQDN(fqdn)
+		// resolver may call the matcher concurrently, e.g. for MX hosts
+		var mu sync.Mutex
+		collect := func(ip net.IP, _ string) (bool, error) {
+			n := &net.IPNet{IP: ip, Mask: ip6Mask}
+			if len(ip) == net.IPv4len {
+				n.Mask = ip4Mask
+			}
+			n.IP = n.IP.Mask(n.Mask)
+			mu.Lock()
+			term.networks = append(term.networks, n)
+			mu.Unlock()
+			return false, nil
+		}
+		var extras *ResponseExtras
+		if t.mechanism == tA {
+			_, extras, err = w.resolver.MatchIP(fqdn, collect)
+		} else {
+			_, extras, err = w.resolver.MatchMX(fqdn, collect)
+		}
+		w.extras = w.extras.merge(extras)
+		if err != nil && !errors.Is(err, ErrDNSPermerror) {
+			return SyntaxError{t, err}
+		}
+	case tInclude:
+		var err error
+		w.visited.via(tInclude)
+		term.policy, err = w.walk(NormalizeFQDN(t.value))
+		if err != nil {
+			return SyntaxError{t, err}
+		}
+	default: // exists and ptr
+		term.unbounded = true
+	}
+	return nil
+}
+
+// parseNetwork parses either CIDR or a single address
+func parseNetwork(s string) (*net.IPNet, error) {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, &net.ParseError{Type: "IP address", Text: s}
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
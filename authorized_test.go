@@ -0,0 +1,142 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestAuthorizedNetworks(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("authorized.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`authorized.example. 0 IN TXT "v=spf1 ip4:192.0.2.0/24 -ip4:198.51.100.1 a/30 include:inc.authorized.example exists:%{i}.authorized.example ~all ip4:198.51.100.0/24 redirect=ignored.authorized.example"`,
+		},
+		dns.TypeA: {
+			`authorized.example. 0 IN A 10.0.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("authorized.example.")
+
+	dns.HandleFunc("inc.authorized.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.authorized.example. 0 IN TXT "v=spf1 ip6:2001:db8::/32 mx redirect=red.authorized.example"`,
+		},
+		dns.TypeMX: {
+			`inc.authorized.example. 0 IN MX 10 mx.authorized.example.`,
+		},
+	}))
+	defer dns.HandleRemove("inc.authorized.example.")
+
+	dns.HandleFunc("mx.authorized.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`mx.authorized.example. 0 IN A 172.16.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("mx.authorized.example.")
+
+	dns.HandleFunc("red.authorized.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`red.authorized.example. 0 IN TXT "v=spf1 +ip4:203.0.113.7 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("red.authorized.example.")
+
+	got, err := AuthorizedNetworks("authorized.example", testResolver)
+	if err != nil {
+		t.Fatalf("AuthorizedNetworks() error = %v", err)
+	}
+	want := []string{
+		"192.0.2.0/24 [ip4:192.0.2.0/24]",
+		"10.0.0.0/30 [a/30]",
+		"2001:db8::/32 [include:inc.authorized.example ip6:2001:db8::/32]",
+		"172.16.0.1/32 [include:inc.authorized.example mx]",
+		"203.0.113.7/32 [include:inc.authorized.example redirect=red.authorized.example ip4:203.0.113.7]",
+		"<nil> [exists:%{i}.authorized.example]",
+	}
+	var s []string
+	for _, n := range got {
+		s = append(s, fmt.Sprintf("%v %v", n.Network, n.Chain))
+	}
+	if strings.Join(s, "\n") != strings.Join(want, "\n") {
+		t.Errorf("AuthorizedNetworks() =\n%s\nwant\n%s", strings.Join(s, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAuthorizedNetworks_ParallelMatchers(t *testing.T) {
+	records := map[uint16][]string{
+		dns.TypeTXT: {`parallel.authorized.example. 0 IN TXT "v=spf1 mx -all"`},
+	}
+	for i := 1; i <= 4; i++ {
+		host := fmt.Sprintf("mx%d.parallel.authorized.example.", i)
+		records[dns.TypeMX] = append(records[dns.TypeMX], fmt.Sprintf(`parallel.authorized.example. 0 IN MX 10 %s`, host))
+		dns.HandleFunc(host, zone(map[uint16][]string{
+			dns.TypeA: {fmt.Sprintf(`%s 0 IN A 192.0.2.%d`, host, i)},
+		}))
+		defer dns.HandleRemove(host)
+	}
+	dns.HandleFunc("parallel.authorized.example.", zone(records))
+	defer dns.HandleRemove("parallel.authorized.example.")
+
+	// the resolver calls matchers of MX hosts in parallel
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr, MiekgDNSParallelism(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := AuthorizedNetworks("parallel.authorized.example", r)
+	if err != nil {
+		t.Fatalf("AuthorizedNetworks() error = %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, n := range got {
+		seen[n.Network.String()] = true
+	}
+	for i := 1; i <= 4; i++ {
+		if n := fmt.Sprintf("192.0.2.%d/32", i); !seen[n] {
+			t.Errorf("AuthorizedNetworks() = %v; want %s", got, n)
+		}
+	}
+}
+
+func TestAuthorizedNetworks_Errors(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("loop.authorized.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`loop.authorized.example. 0 IN TXT "v=spf1 ip4:192.0.2.1 include:loop.authorized.example"`,
+		},
+	}))
+	defer dns.HandleRemove("loop.authorized.example.")
+
+	dns.HandleFunc("bad.authorized.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`bad.authorized.example. 0 IN TXT "v=spf1 ip4:2001:db8::1"`,
+		},
+	}))
+	defer dns.HandleRemove("bad.authorized.example.")
+
+	tests := []struct {
+		domain string
+		n      int
+		err    error
+	}{
+		{"loop.authorized.example", 1, ErrLoopDetected},
+		{"bad.authorized.example", 0, ErrNotIPv4},
+		{"none.authorized.example", 0, ErrDNSPermerror},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got, err := AuthorizedNetworks(tt.domain, testResolver)
+			if cause, _ := Cause(err); !errors.Is(cause, tt.err) {
+				t.Errorf("AuthorizedNetworks() error = %v; want %v", err, tt.err)
+			}
+			if len(got) != tt.n {
+				t.Errorf("AuthorizedNetworks() = %v; want %d networks", got, tt.n)
+			}
+		})
+	}
+}
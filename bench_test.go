@@ -0,0 +1,136 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/miekg/dns"
+)
+
+// replayResolver returns Resolver answering from responses made of the
+// records, as if they were cached, so benchmarks measure evaluation rather
+// than DNS. Names having addresses of one family get empty responses for
+// the other one.
+func replayResolver(b *testing.B, records ...string) Resolver {
+	b.Helper()
+	r, err := NewMiekgDNSResolver("127.0.0.1:1",
+		MiekgDNSCache(gcache.New(1000).Simple().Build()),
+		MiekgDNSMinSaneTTL(time.Hour),
+		MiekgDNSParallelism(1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	responses := make(map[dns.Question]*dns.Msg)
+	add := func(name string, qtype uint16, rr dns.RR) {
+		q := dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET}
+		res, ok := responses[q]
+		if !ok {
+			res = new(dns.Msg)
+			res.SetQuestion(name, qtype)
+			responses[q] = res
+		}
+		if rr != nil {
+			res.Answer = append(res.Answer, rr)
+		}
+	}
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			b.Fatal(err)
+		}
+		h := rr.Header()
+		add(h.Name, h.Rrtype, rr)
+		switch h.Rrtype {
+		case dns.TypeA:
+			add(h.Name, dns.TypeAAAA, nil)
+		case dns.TypeAAAA:
+			add(h.Name, dns.TypeA, nil)
+		}
+	}
+	for _, res := range responses {
+		r.CacheResponse(res)
+	}
+	return r
+}
+
+func benchmarkCheckHost(b *testing.B, r Resolver, ip, domain, sender string, want Result, opts ...Option) {
+	b.Helper()
+	addr := net.ParseIP(ip)
+	check := func() (Result, error) {
+		res, _, _, err := CheckHost(addr, domain, sender, append(opts[:len(opts):len(opts)], WithResolver(NewLimitedResolver(r, 10, 10)))...)
+		return res, err
+	}
+	if res, err := check(); res != want {
+		b.Fatalf("CheckHost() = %s, %v; want %s", res, err, want)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		check()
+	}
+}
+
+func BenchmarkCheckHost_Flat(b *testing.B) {
+	benchmarkCheckHostFlat(b)
+}
+
+func BenchmarkCheckHost_FlatRecordCache(b *testing.B) {
+	benchmarkCheckHostFlat(b, WithRecordCache(NewRecordCache(10)))
+}
+
+func benchmarkCheckHostFlat(b *testing.B, opts ...Option) {
+	terms := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		terms = append(terms, fmt.Sprintf("ip4:10.%d.%d.0/24", i/256, i%256))
+	}
+	// TXT strings are limited to 255 characters
+	var chunks []string
+	record := "v=spf1 " + strings.Join(terms, " ") + " -all"
+	for len(record) > 255 {
+		chunks, record = append(chunks, record[:255]), record[255:]
+	}
+	chunks = append(chunks, record)
+	r := replayResolver(b, `flat.bench. 300 IN TXT "`+strings.Join(chunks, `" "`)+`"`)
+	benchmarkCheckHost(b, r, "10.0.199.1", "flat.bench", "", Pass, opts...)
+}
+
+func BenchmarkCheckHost_DeepIncludes(b *testing.B) {
+	var records []string
+	for i := 0; i < 8; i++ {
+		records = append(records, fmt.Sprintf(`inc%d.deep.bench. 300 IN TXT "v=spf1 ip4:192.0.2.%d include:inc%d.deep.bench -all"`, i, i, i+1))
+	}
+	records = append(records, `inc8.deep.bench. 300 IN TXT "v=spf1 ip4:198.51.100.0/24 -all"`)
+	r := replayResolver(b, records...)
+	benchmarkCheckHost(b, r, "198.51.100.1", "inc0.deep.bench", "", Pass)
+}
+
+func BenchmarkCheckHost_Macros(b *testing.B) {
+	r := replayResolver(b,
+		`macro.bench. 300 IN TXT "v=spf1 exists:%{ir}.%{l1r-}._spf.%{d} a:%{l}.users.%{d2} ptr mx:%{o} -exists:%{i}.block.%{d} ~all"`,
+		`1.2.0.192.in-addr.arpa. 300 IN PTR mail.example.bench.`,
+		`mail.example.bench. 300 IN A 192.0.2.10`,
+		`jdoe.users.macro.bench. 300 IN A 192.0.2.20`,
+		`example.bench. 300 IN MX 10 mail.example.bench.`,
+		`192.0.2.1.block.macro.bench. 300 IN A 127.0.0.2`,
+	)
+	benchmarkCheckHost(b, r, "192.0.2.1", "macro.bench", "jdoe@example.bench", Fail)
+}
+
+func BenchmarkCheckHost_Typical(b *testing.B) {
+	r := replayResolver(b,
+		`typical.bench. 300 IN TXT "v=spf1 mx include:_spf.mail.bench include:spf.crm.bench ip4:203.0.113.0/24 ~all"`,
+		`typical.bench. 300 IN MX 10 mx1.typical.bench.`,
+		`typical.bench. 300 IN MX 20 mx2.typical.bench.`,
+		`mx1.typical.bench. 300 IN A 192.0.2.1`,
+		`mx2.typical.bench. 300 IN A 192.0.2.2`,
+		`_spf.mail.bench. 300 IN TXT "v=spf1 include:_netblocks.mail.bench include:_netblocks2.mail.bench ~all"`,
+		`_netblocks.mail.bench. 300 IN TXT "v=spf1 ip4:35.190.247.0/24 ip4:64.233.160.0/19 ip4:66.102.0.0/20 ip6:2001:4860:4000::/36 ~all"`,
+		`_netblocks2.mail.bench. 300 IN TXT "v=spf1 ip6:2001:4860:4000::/36 ip6:2404:6800:4000::/36 ~all"`,
+		`spf.crm.bench. 300 IN TXT "v=spf1 ip4:13.110.208.0/21 ip4:13.111.0.0/16 -all"`,
+	)
+	benchmarkCheckHost(b, r, "203.0.113.7", "typical.bench", "", Pass)
+}
@@ -0,0 +1,91 @@
+package spf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Canonicalize returns normalized form of the SPF record along with the list
+// of changes made to get it. The result is intended for comparing records
+// published at different times, hence semantics of the record is preserved:
+//
+//   - mechanism and modifier names are lowercased;
+//   - redundant "+" qualifiers are removed;
+//   - identical terms are deduplicated, the first occurrence is kept, except
+//     for "redirect" and "exp" modifiers: repeating them is a permerror;
+//   - terms are separated with a single space;
+//   - modifiers are placed after mechanisms, "redirect" goes before "exp",
+//     unknown modifiers go last.
+//
+// Terms with syntax errors are kept verbatim.
+func Canonicalize(record string) (string, []string) {
+	var (
+		changes    []string
+		mechanisms []string
+		redirects  []string
+		exps       []string
+		others     []string
+		seen       = make(map[string]bool)
+	)
+
+	fields := strings.FieldsFunc(record, isWhitespace)
+	if s := strings.Join(fields, " "); s != record {
+		changes = append(changes, "collapsed whitespace")
+	}
+
+	// order keeps track of kinds of terms, so we can tell if a modifier
+	// was moved
+	type term struct {
+		kind tokenType
+		text string
+	}
+	var order []term
+	for _, raw := range fields {
+		t := lex(raw)[0]
+		c := raw
+		if !t.isErr() {
+			c = t.String()
+		}
+		switch {
+		case seen[c] && t.mechanism != tRedirect && t.mechanism != tExp:
+			changes = append(changes, fmt.Sprintf("removed duplicate %q", raw))
+			continue
+		case c == raw:
+		case strings.EqualFold(c, raw):
+			changes = append(changes, fmt.Sprintf("lowercased %q", raw))
+		case raw[0] == '+' && strings.EqualFold(c, raw[1:]):
+			changes = append(changes, fmt.Sprintf("removed redundant qualifier from %q", raw))
+		default:
+			changes = append(changes, fmt.Sprintf("rewrote %q as %q", raw, c))
+		}
+		seen[c] = true
+
+		order = append(order, term{t.mechanism, c})
+		switch t.mechanism {
+		case tRedirect:
+			redirects = append(redirects, c)
+		case tExp:
+			exps = append(exps, c)
+		case tUnknownModifier:
+			others = append(others, c)
+		default:
+			mechanisms = append(mechanisms, c)
+		}
+	}
+
+	for i, m := range order {
+		if !m.kind.isModifier() {
+			continue
+		}
+		for _, n := range order[i+1:] {
+			if !n.kind.isModifier() || m.kind == tExp && n.kind == tRedirect ||
+				m.kind == tUnknownModifier && n.kind != tUnknownModifier {
+				changes = append(changes, fmt.Sprintf("moved %q to the end", m.text))
+				break
+			}
+		}
+	}
+
+	terms := append(append(append(mechanisms, redirects...), exps...), others...)
+	return strings.Join(terms, " "), changes
+}
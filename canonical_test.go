@@ -0,0 +1,56 @@
+package spf
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		record  string
+		want    string
+		changes []string
+	}{
+		{"v=spf1 -all", "v=spf1 -all", nil},
+		{"  v=spf1\t mx  -all ", "v=spf1 mx -all", []string{"collapsed whitespace"}},
+		{"v=spf1 MX IP4:10.0.0.1 -ALL", "v=spf1 mx ip4:10.0.0.1 -all",
+			[]string{`lowercased "MX"`, `lowercased "IP4:10.0.0.1"`, `lowercased "-ALL"`}},
+		{"v=spf1 +mx +A:example.com -all", "v=spf1 mx a:example.com -all",
+			[]string{`removed redundant qualifier from "+mx"`, `removed redundant qualifier from "+A:example.com"`}},
+		{"v=spf1 mx ip4:10.0.0.1 +mx ip4:10.0.0.1 ~mx -all", "v=spf1 mx ip4:10.0.0.1 ~mx -all",
+			[]string{`removed duplicate "+mx"`, `removed duplicate "ip4:10.0.0.1"`}},
+		{"v=spf1 exp=exp.example.com redirect=_spf.example.com mx", "v=spf1 mx redirect=_spf.example.com exp=exp.example.com",
+			[]string{`moved "exp=exp.example.com" to the end`, `moved "redirect=_spf.example.com" to the end`}},
+		{"v=spf1 mx exp=exp.example.com redirect=_spf.example.com", "v=spf1 mx redirect=_spf.example.com exp=exp.example.com",
+			[]string{`moved "exp=exp.example.com" to the end`}},
+		{"v=spf1 explanation=exp.example.com", "v=spf1 exp=exp.example.com",
+			[]string{`rewrote "explanation=exp.example.com" as "exp=exp.example.com"`}},
+		{"v=spf1 A/24//64 include=x.example.com ++mx", "v=spf1 a/24//64 include=x.example.com ++mx",
+			[]string{`lowercased "A/24//64"`}},
+		{"v=spf1 REDIRECT=/spf.example.com", "v=spf1 redirect=/spf.example.com",
+			[]string{`lowercased "REDIRECT=/spf.example.com"`}},
+		{"v=spf1 exists:%{IR}.example.com", "v=spf1 exists:%{IR}.example.com", nil},
+		{"v=spf1 RA=Abuse rp=100 mx redirect=_spf.example.com", "v=spf1 mx redirect=_spf.example.com ra=Abuse rp=100",
+			[]string{`lowercased "RA=Abuse"`, `moved "ra=Abuse" to the end`, `moved "rp=100" to the end`}},
+		{"v=spf1 mx redirect=_spf.example.com redirect=_spf.example.com", "v=spf1 mx redirect=_spf.example.com redirect=_spf.example.com", nil},
+		{"v=spf1 exp=exp.example.com mx exp=exp.example.com", "v=spf1 mx exp=exp.example.com exp=exp.example.com",
+			[]string{`moved "exp=exp.example.com" to the end`}},
+	}
+
+	const skipAllBut = -1
+	for no, test := range tests {
+		if skipAllBut != -1 && skipAllBut != no {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d_%s", no, test.record), func(t *testing.T) {
+			got, changes := Canonicalize(test.record)
+			if got != test.want {
+				t.Errorf("Canonicalize(%q) = %q; want %q", test.record, got, test.want)
+			}
+			if !reflect.DeepEqual(changes, test.changes) {
+				t.Errorf("Canonicalize(%q) changes = %q; want %q", test.record, changes, test.changes)
+			}
+		})
+	}
+}
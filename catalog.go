@@ -0,0 +1,74 @@
+package spf
+
+import "fmt"
+
+// Catalog words the phrases explaining results to humans: the comment of
+// "Received-SPF" header field and the text of SMTP replies, used when the
+// policy gives no explanation of its own. Implement it to localize or
+// re-word the phrases, embedding EnglishCatalog to keep some of them.
+type Catalog interface {
+	// Reason returns the comment of "Received-SPF" header field for the
+	// result of the trace, e.g. "domain of john@example.com designates
+	// 192.0.2.1 as permitted sender". The receiver is prepended to it.
+	Reason(t *Trace) string
+	// Reply returns the text of SMTP reply for the result of the identity,
+	// "helo" or "mailfrom" as Trace.Identity is, e.g. "SPF MAIL FROM check
+	// failed".
+	Reply(identity string, r Result) string
+}
+
+// EnglishCatalog is the default Catalog.
+type EnglishCatalog struct{}
+
+// Reason implements Catalog, the phrases follow RFC 7208 section 9.1
+func (EnglishCatalog) Reason(t *Trace) string {
+	// Pass			The SPF record designates the host to be allowed to send
+	// Fail			The SPF record has designated the host as NOT being allowed to send
+	// SoftFail		The SPF record has designated the host as NOT being allowed to send but is in transition
+	// Neutral		The SPF record specifies explicitly that nothing can be said about validity
+	// None			The domain does not have an SPF record or the SPF record does not evaluate to a result
+	// PermError	A permanent error has occured (eg. badly formatted SPF record)
+	// TempError	A transient error has occured
+	sender := "sender"
+	if t.EnvelopeFrom != "" {
+		sender = t.EnvelopeFrom
+	}
+	host := "the host"
+	if t.ClientIP != nil {
+		host = t.ClientIP.String()
+	}
+	switch t.Result {
+	case Pass:
+		return fmt.Sprintf("domain of %s designates %s as permitted sender", sender, host)
+	case Fail:
+		return fmt.Sprintf("domain of %s does not designate %s as permitted sender", sender, host)
+	case Softfail:
+		return fmt.Sprintf("domain of %s does not designate %s as permitted sender but is in transition", sender, host)
+	case Neutral:
+		return "nothing can be said about validity"
+	case None:
+		return fmt.Sprintf("domain of %s does not have an SPF record or the SPF record does not evaluate to a result", sender)
+	case Permerror:
+		return "a permanent error has occured"
+	case Temperror:
+		return "a transient error has occured"
+	default:
+		return ""
+	}
+}
+
+// Reply implements Catalog
+func (EnglishCatalog) Reply(identity string, r Result) string {
+	name := "MAIL FROM"
+	if identity == "helo" {
+		name = "HELO"
+	}
+	switch r {
+	case Temperror:
+		return "SPF " + name + " check temporary error"
+	case Permerror:
+		return "SPF " + name + " check permanent error"
+	default:
+		return "SPF " + name + " check failed"
+	}
+}
@@ -0,0 +1,60 @@
+package spf
+
+import (
+	"net"
+	"testing"
+)
+
+// germanCatalog re-words some of the phrases
+type germanCatalog struct {
+	EnglishCatalog
+}
+
+func (c germanCatalog) Reason(t *Trace) string {
+	if t.Result == Fail {
+		return "Domain von " + t.EnvelopeFrom + " erlaubt " + t.ClientIP.String() + " nicht"
+	}
+	return c.EnglishCatalog.Reason(t)
+}
+
+func (germanCatalog) Reply(identity string, r Result) string {
+	if r == Fail {
+		return "SPF-Prüfung fehlgeschlagen"
+	}
+	return "SPF-Fehler"
+}
+
+func TestCatalog(t *testing.T) {
+	trace := &Trace{Result: Fail, ClientIP: net.ParseIP("192.0.2.1"), EnvelopeFrom: "john@example.com",
+		Receiver: "mx.example.org", Identity: "mailfrom"}
+
+	want := "fail (mx.example.org: Domain von john@example.com erlaubt 192.0.2.1 nicht) client-ip=192.0.2.1;" +
+		" identity=mailfrom; envelope-from=\"john@example.com\"; receiver=mx.example.org"
+	if got := trace.ReceivedSPF(ReceivedSPFCatalog(germanCatalog{})); got != want {
+		t.Errorf("ReceivedSPF() = %q; want %q", got, want)
+	}
+	if got := trace.ReceivedSPF(ReceivedSPFCatalog(nil)); got != trace.ReceivedSPF() {
+		t.Errorf("ReceivedSPF(nil catalog) = %q; want %q", got, trace.ReceivedSPF())
+	}
+	trace.Result = Pass
+	want = "pass (mx.example.org: domain of john@example.com designates 192.0.2.1 as permitted sender)"
+	if got := trace.ReceivedSPF(ReceivedSPFCatalog(germanCatalog{})); got[:len(want)] != want {
+		t.Errorf("ReceivedSPF() = %q; want prefix %q", got, want)
+	}
+
+	p := DefaultActionPolicy()
+	p.Catalog = germanCatalog{}
+	tests := []struct {
+		trace Trace
+		reply string
+	}{
+		{Trace{Result: Fail, Identity: "mailfrom"}, "550 5.7.23 SPF-Pr??fung fehlgeschlagen"},
+		{Trace{Result: Fail, Identity: "mailfrom", Explanation: "not allowed"}, "550 5.7.23 not allowed"},
+		{Trace{Result: Temperror, Identity: "mailfrom", Explanation: "ignored"}, "451 4.7.24 SPF-Fehler"},
+	}
+	for _, tt := range tests {
+		if _, r := p.Decide(&tt.trace); r.String() != tt.reply {
+			t.Errorf("Decide(%s) = %q; want %q", tt.trace.Result, r, tt.reply)
+		}
+	}
+}
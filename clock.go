@@ -0,0 +1,100 @@
+package spf
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to evaluation and to the components keeping track of
+// time: caches deciding on expiration and resolvers waiting between retries.
+// Replacing the wall clock with FakeClock makes them deterministic, e.g. in
+// tests or when past evaluations are replayed.
+//
+// Clock implements gcache.Clock as well, so it could drive expiration of
+// gcache.Cache given to MiekgDNSCache.
+type Clock interface {
+	Now() time.Time
+	// Sleep pauses the calling goroutine for at least d.
+	Sleep(d time.Duration)
+}
+
+// SystemClock is Clock of the wall clock, used by default.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time        { return time.Now() }
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// sleepContext pauses for d by the clock or until ctx is done, it returns
+// the error of ctx if it is. Only waits of SystemClock are interrupted,
+// Sleep of other clocks returns before ctx is checked.
+func sleepContext(ctx context.Context, c Clock, d time.Duration) error {
+	if c != SystemClock {
+		c.Sleep(d)
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// FakeClock is Clock which time moves only by Advance and Sleep. It is safe
+// for concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns FakeClock set to t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+// Now returns the time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep advances the clock by d instead of pausing.
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance moves the clock by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// WithClock makes evaluation read time from c: the time of evaluation
+// (unless EvaluatedOn is given) and the time lookups take. Timeouts (see
+// WithMechanismTimeout and WithOverallDeadline) are real waits, they keep
+// using the wall clock.
+func WithClock(c Clock) Option {
+	return func(p *parser) {
+		if c == nil {
+			return
+		}
+		p.clock = c
+	}
+}
+
+// now returns the time of the parser's clock
+func (p *parser) now() time.Time {
+	return p.clock.Now()
+}
+
+// since returns the time passed since t by the parser's clock
+func (p *parser) since(t time.Time) time.Duration {
+	return p.clock.Now().Sub(t)
+}
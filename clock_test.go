@@ -0,0 +1,109 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type durationListener struct {
+	recordingListener
+	durations []time.Duration
+}
+
+func (l *durationListener) LookupExtras(qualifier, mechanism, value, fqdn string, extras *ResponseExtras) {
+	l.durations = append(l.durations, extras.Duration)
+}
+
+func TestWithClock(t *testing.T) {
+	dns.HandleFunc("clock.test.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`clock.test. 300 IN TXT "v=spf1 include:inc.clock.test -all exp=exp.clock.test"`,
+			`inc.clock.test. 300 IN TXT "v=spf1 a -all"`,
+			`exp.clock.test. 300 IN TXT "%{t}"`,
+		},
+	}))
+	defer dns.HandleRemove("clock.test.")
+
+	now := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	clock := NewFakeClock(now)
+	l := &durationListener{}
+	r, expl, _, err := CheckHost(net.ParseIP("10.0.0.1"), "clock.test", "", WithResolver(testResolver), WithClock(clock), WithListener(l))
+	if r != Fail || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want fail", r, err)
+	}
+	if want := strconv.FormatInt(now.Unix(), 10); expl != want {
+		t.Errorf("explanation = %q; want %q", expl, want)
+	}
+	if len(l.durations) == 0 {
+		t.Error("no lookups reported")
+	}
+	for _, d := range l.durations {
+		if d != 0 {
+			t.Errorf("lookup took %s; want 0 by the fake clock", d)
+		}
+	}
+
+	// EvaluatedOn takes precedence
+	r, expl, _, _ = CheckHost(net.ParseIP("10.0.0.1"), "clock.test", "", WithResolver(testResolver), EvaluatedOn(time.Unix(1, 0)), WithClock(clock))
+	if r != Fail || expl != "1" {
+		t.Errorf("CheckHost() = %s, %q; want fail, %q", r, expl, "1")
+	}
+}
+
+func TestVerdictCacheClock(t *testing.T) {
+	dns.HandleFunc("verdict.clock.test.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`verdict.clock.test. 300 IN TXT "v=spf1 ip4:10.0.0.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("verdict.clock.test.")
+
+	clock := NewFakeClock(time.Now())
+	c := NewVerdictCache(time.Minute, VerdictCacheClock(clock))
+	check := func(cached bool) {
+		t.Helper()
+		v, ok := c.CheckHost(net.ParseIP("10.0.0.1"), "verdict.clock.test", "", WithResolver(testResolver), WithClock(clock))
+		if v.Result != Pass || ok != cached {
+			t.Errorf("CheckHost() = %s, %t; want pass, %t", v.Result, ok, cached)
+		}
+	}
+	check(false)
+	clock.Advance(299 * time.Second)
+	check(true)
+	clock.Advance(2 * time.Second)
+	check(false)
+}
+
+func TestRetryClock(t *testing.T) {
+	retries := func() (int, time.Duration) {
+		start := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+		clock := NewFakeClock(start)
+		var n int
+		r := NewRetryResolver([]Resolver{&brokenResolver{c: -1}},
+			BackoffTimeout(time.Minute), BackoffDelayMin(time.Second), RetryClock(clock),
+			OnRetry(func(name string, attempt int, err error) {
+				n = attempt
+			}))
+		if _, _, err := r.Exists("retry.clock.test."); !errors.Is(err, ErrDNSTemperror) {
+			t.Errorf("Exists() error = %v; want %v", err, ErrDNSTemperror)
+		}
+		return n, clock.Now().Sub(start)
+	}
+
+	began := time.Now()
+	n, waited := retries()
+	if waited <= time.Minute {
+		t.Errorf("retries waited %s by the clock; want BackoffTimeout", waited)
+	}
+	if time.Since(began) > time.Second {
+		t.Errorf("retries took %s; want no real waits", time.Since(began))
+	}
+	if m, w := retries(); m != n || w != waited {
+		t.Errorf("retries = %d in %s, then %d in %s; want the same", n, waited, m, w)
+	}
+}
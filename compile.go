@@ -0,0 +1,206 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrNotCompilable is returned by CompilePolicy when the result of the
+// policy depends on more than the IP address of the client,
+// e.g. the policy uses "exists", "ptr" or macros.
+var ErrNotCompilable = errors.New("policy could not be compiled")
+
+// Matcher is an immutable compiled SPF policy of a domain. It evaluates
+// the policy for an IP address without DNS lookups and parsing, so it could
+// be used from multiple goroutines on the hot path until it expires.
+type Matcher struct {
+	domain  string
+	policy  *matcherPolicy
+	expires time.Time
+}
+
+// CompileOption sets an optional parameter of CompilePolicy.
+type CompileOption func(*compiler)
+
+// CompileClock makes CompilePolicy tell the expiration of Matcher by the
+// time of c, SystemClock by default.
+func CompileClock(c Clock) CompileOption {
+	return func(cc *compiler) {
+		if c == nil {
+			return
+		}
+		cc.clock = c
+	}
+}
+
+type compiler struct {
+	clock Clock
+}
+
+// CompilePolicy makes all the lookups required by SPF policy of the domain
+// and compiles it into Matcher valid until the minimum TTL of the records
+// involved.
+// Unlike CheckHost, all the lookups are made regardless of the terms an
+// IP address would match, so a policy close to the lookup limits could fail
+// to compile. ErrNotCompilable is returned for policies depending on
+// anything other than the IP address. Callers are expected to fall back
+// to CheckHost in both cases.
+func CompilePolicy(domain string, r Resolver, opts ...CompileOption) (*Matcher, error) {
+	c := &compiler{clock: SystemClock}
+	for _, opt := range opts {
+		opt(c)
+	}
+	domain = NormalizeFQDN(domain)
+	w := newPolicyWalker(r)
+	tree, err := w.walk(domain)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := compilePolicyTree(tree)
+	if err != nil {
+		return nil, err
+	}
+	var ttl time.Duration
+	if w.extras != nil {
+		ttl = w.extras.TTL
+	}
+	return &Matcher{
+		domain:  domain,
+		policy:  policy,
+		expires: c.clock.Now().Add(ttl),
+	}, nil
+}
+
+// Domain returns the domain the Matcher was compiled for
+func (m *Matcher) Domain() string {
+	return m.domain
+}
+
+// Expires returns the time after which the Matcher must not be used
+func (m *Matcher) Expires() time.Time {
+	return m.expires
+}
+
+// Match returns the result of SPF evaluation for the ip.
+func (m *Matcher) Match(ip net.IP) Result {
+	return m.policy.match(ip)
+}
+
+// matcherPolicy is a compiled policyTree, mechanisms matching networks are
+// stored in radix trees keeping the position of the first of them matching
+// an address, positions of "include" are kept aside.
+type matcherPolicy struct {
+	ip4, ip6 *trieNode
+	includes []matcherInclude
+	redirect *matcherPolicy
+}
+
+type matcherInclude struct {
+	pos    int
+	result Result
+	policy *matcherPolicy
+}
+
+func compilePolicyTree(tree *policyTree) (*matcherPolicy, error) {
+	p := &matcherPolicy{ip4: &trieNode{}, ip6: &trieNode{}}
+	for pos, t := range tree.terms {
+		if t.unbounded {
+			return nil, SyntaxError{t.token, ErrNotCompilable}
+		}
+		result, _ := matchingResult(t.token.qualifier)
+		if t.policy != nil {
+			included, err := compilePolicyTree(t.policy)
+			if err != nil {
+				return nil, err
+			}
+			p.includes = append(p.includes, matcherInclude{pos, result, included})
+			continue
+		}
+		for _, n := range t.networks {
+			ones, _ := n.Mask.Size()
+			if ip := n.IP.To4(); ip != nil && len(n.Mask) == net.IPv4len {
+				p.ip4.insert(ip, ones, pos, result)
+			} else {
+				p.ip6.insert(n.IP.To16(), ones, pos, result)
+			}
+		}
+	}
+	if tree.redirect != nil {
+		if tree.redirect.unbounded {
+			return nil, SyntaxError{tree.redirect.token, ErrNotCompilable}
+		}
+		var err error
+		if p.redirect, err = compilePolicyTree(tree.redirect.policy); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *matcherPolicy) match(ip net.IP) Result {
+	var (
+		pos    int
+		result Result
+		found  bool
+	)
+	if ip4 := ip.To4(); ip4 != nil {
+		pos, result, found = p.ip4.lookup(ip4)
+	} else if ip6 := ip.To16(); ip6 != nil {
+		pos, result, found = p.ip6.lookup(ip6)
+	}
+	for _, inc := range p.includes {
+		if found && inc.pos > pos {
+			break
+		}
+		if inc.policy.match(ip) == Pass {
+			return inc.result
+		}
+	}
+	if found {
+		return result
+	}
+	if p.redirect != nil {
+		if r := p.redirect.match(ip); r != None {
+			return r
+		}
+		return Permerror
+	}
+	return Neutral
+}
+
+// trieNode is a node of binary radix tree of network prefixes
+type trieNode struct {
+	child  [2]*trieNode
+	set    bool
+	pos    int // position of the mechanism in the policy
+	result Result
+}
+
+// insert adds the prefix keeping the earliest mechanism on duplicates
+func (n *trieNode) insert(ip net.IP, ones, pos int, result Result) {
+	for i := 0; i < ones; i++ {
+		b := ip[i/8] >> (7 - uint(i%8)) & 1
+		if n.child[b] == nil {
+			n.child[b] = &trieNode{}
+		}
+		n = n.child[b]
+	}
+	if !n.set || pos < n.pos {
+		n.set, n.pos, n.result = true, pos, result
+	}
+}
+
+// lookup returns the earliest mechanism among prefixes containing ip
+func (n *trieNode) lookup(ip net.IP) (pos int, result Result, found bool) {
+	for i := 0; n != nil; i++ {
+		if n.set && (!found || n.pos < pos) {
+			pos, result, found = n.pos, n.result, true
+		}
+		if i == len(ip)*8 {
+			break
+		}
+		n = n.child[ip[i/8]>>(7-uint(i%8))&1]
+	}
+	return
+}
@@ -0,0 +1,147 @@
+package spf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCompilePolicy(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("compile.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`compile.example. 300 IN TXT "v=spf1 -ip4:10.0.0.1 ip4:10.0.0.0/8 -include:inc.compile.example ip6:2001:db8::/32 redirect=red.compile.example"`,
+		},
+	}))
+	defer dns.HandleRemove("compile.example.")
+
+	dns.HandleFunc("inc.compile.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.compile.example. 300 IN TXT "v=spf1 -ip4:192.0.2.1 ip4:192.0.2.0/24 a"`,
+		},
+		dns.TypeA: {
+			`inc.compile.example. 60 IN A 172.16.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("inc.compile.example.")
+
+	dns.HandleFunc("red.compile.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`red.compile.example. 300 IN TXT "v=spf1 ~ip4:198.51.100.0/24 mx/24"`,
+		},
+		dns.TypeMX: {
+			`red.compile.example. 300 IN MX 10 mx.compile.example.`,
+		},
+	}))
+	defer dns.HandleRemove("red.compile.example.")
+
+	dns.HandleFunc("mx.compile.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`mx.compile.example. 300 IN A 203.0.113.5`,
+		},
+	}))
+	defer dns.HandleRemove("mx.compile.example.")
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	m, err := CompilePolicy("compile.example", testResolver, CompileClock(clock))
+	if err != nil {
+		t.Fatalf("CompilePolicy() error = %v", err)
+	}
+	if m.Domain() != "compile.example." {
+		t.Errorf("Domain() = %q", m.Domain())
+	}
+	if e := m.Expires(); !e.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("Expires() = %v; want in a minute", e)
+	}
+
+	tests := []struct {
+		ip   string
+		want Result
+	}{
+		{"10.0.0.1", Fail},
+		{"10.0.0.2", Pass},
+		{"192.0.2.1", Neutral},
+		{"192.0.2.2", Fail},
+		{"172.16.0.1", Fail},
+		{"2001:db8::1", Pass},
+		{"198.51.100.1", Softfail},
+		{"203.0.113.77", Pass},
+		{"8.8.8.8", Neutral},
+		{"2001:db9::1", Neutral},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if got := m.Match(ip); got != tt.want {
+				t.Errorf("Match() = %s; want %s", got, tt.want)
+			}
+			r, _, _, _ := CheckHost(ip, "compile.example", "compile.example", WithResolver(testResolver))
+			if r != tt.want {
+				t.Errorf("CheckHost() = %s; want %s", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompilePolicy_Errors(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("exists.compile.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`exists.compile.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 exists:%{i}.compile.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("exists.compile.example.")
+
+	dns.HandleFunc("redirect.compile.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`redirect.compile.example. 0 IN TXT "v=spf1 redirect=%{l}.compile.example"`,
+		},
+	}))
+	defer dns.HandleRemove("redirect.compile.example.")
+
+	tests := []struct {
+		domain string
+		err    error
+	}{
+		{"exists.compile.example", ErrNotCompilable},
+		{"redirect.compile.example", ErrNotCompilable},
+		{"none.compile.example", ErrDNSPermerror},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			m, err := CompilePolicy(tt.domain, testResolver)
+			if cause, _ := Cause(err); cause != tt.err || m != nil {
+				t.Errorf("CompilePolicy() = %v, %v; want %v", m, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTrieNode(t *testing.T) {
+	root := &trieNode{}
+	root.insert(net.IP{10, 0, 0, 0}, 8, 2, Pass)
+	root.insert(net.IP{10, 1, 0, 0}, 16, 1, Fail)
+	root.insert(net.IP{10, 1, 2, 3}, 32, 3, Softfail)
+	root.insert(net.IP{10, 0, 0, 0}, 8, 4, Neutral) // duplicate never wins
+
+	tests := []struct {
+		ip     net.IP
+		pos    int
+		result Result
+		found  bool
+	}{
+		{net.IP{10, 2, 0, 0}, 2, Pass, true},
+		{net.IP{10, 1, 2, 3}, 1, Fail, true},
+		{net.IP{11, 0, 0, 0}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		pos, result, found := root.lookup(tt.ip)
+		if pos != tt.pos || result != tt.result || found != tt.found {
+			t.Errorf("lookup(%s) = %d, %s, %t; want %d, %s, %t", tt.ip, pos, result, found, tt.pos, tt.result, tt.found)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package spf
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentIncludes makes evaluation of "include" mechanisms of a record
+// to run in parallel using up to n workers per record.
+// Results are consumed in order of the mechanisms, so the first match
+// semantics are preserved and evaluations of the includes following the
+// matched mechanism are canceled. Listener receives exactly the same events
+// as without the option, DNS lookups of canceled evaluations are not counted
+// against the lookup limits.
+func ConcurrentIncludes(n int) Option {
+	return func(p *parser) {
+		p.concurrency = n
+	}
+}
+
+// errCanceled is returned by Resolver of an evaluation no longer needed
+var errCanceled = errors.New("evaluation canceled")
+
+// eventsBuffer keeps events of an include evaluated concurrently until
+// the result is consumed. Events could be added concurrently, e.g. by IP
+// matchers called in parallel by the resolver.
+type eventsBuffer struct {
+	sync.Mutex
+	events []func(*parser)
+}
+
+// buffered adds the event to the buffer of concurrent evaluation, if any,
+// and returns false otherwise.
+func (p *parser) buffered(event func(*parser)) bool {
+	if p.events == nil {
+		return false
+	}
+	p.events.Lock()
+	p.events.events = append(p.events.events, event)
+	p.events.Unlock()
+	return true
+}
+
+type concurrentIncludes struct {
+	done    chan struct{}
+	once    sync.Once
+	pending map[*token]*includeEvaluation
+}
+
+type includeEvaluation struct {
+	done     chan struct{}
+	events   eventsBuffer
+	resolver *LimitedResolver // nil if evaluation is not limited
+	budget   int32            // lookupLimit of the resolver at the start
+	counters counters         // terms and void lookups of the evaluation
+	memo     *includeMemo     // results of includes made by the evaluation
+	matches  bool
+	result   Result
+	err      error
+}
+
+// evaluateIncludes starts evaluation of all "include" mechanisms.
+func (p *parser) evaluateIncludes(mechanisms []*token) *concurrentIncludes {
+	c := &concurrentIncludes{
+		done:    make(chan struct{}),
+		pending: make(map[*token]*includeEvaluation),
+	}
+	workers := make(chan struct{}, p.concurrency)
+	for _, t := range mechanisms {
+		if t.mechanism != tInclude {
+			continue
+		}
+		e := &includeEvaluation{done: make(chan struct{})}
+		c.pending[t] = e
+
+		resolver := Resolver(&canceledResolver{p.resolver, c.done})
+		if l, ok := p.resolver.(*LimitedResolver); ok {
+			e.budget = atomic.LoadInt32(&l.lookupLimit)
+			e.resolver = &LimitedResolver{
+				lookupLimit:    e.budget,
+				mxQueriesLimit: l.mxQueriesLimit,
+				resolver:       &canceledResolver{l.resolver, c.done},
+			}
+			resolver = e.resolver
+		}
+		p.startMechanism()
+		ep := p.nested(p.visited.clone()).with(p.query, p.sender, p.domain, p.ip)
+		ep.resolver, ep.events, ep.deadline = resolver, &e.events, p.deadline
+		ep.counters = &e.counters // accounted by p as well when events are replayed
+		e.memo = p.includeMemo.speculative()
+		ep.includeMemo = e.memo
+
+		go func(t *token) {
+			defer close(e.done)
+			select {
+			case workers <- struct{}{}:
+				defer func() { <-workers }()
+			case <-c.done:
+				return
+			}
+			e.matches, e.result, e.err = ep.parseInclude(t)
+		}(t)
+	}
+	return c
+}
+
+// result waits for the evaluation of the include, replays its events to p
+// and returns its result. If the evaluation was not possible to complete
+// within the lookups limit available to p, the include is evaluated again.
+func (c *concurrentIncludes) result(p *parser, t *token) (bool, Result, error) {
+	e, ok := c.pending[t]
+	if !ok {
+		return p.parseInclude(t)
+	}
+	<-e.done
+	if p.counters.add(e.counters).exceeded(p.spec, p.limits) != nil {
+		// evaluated in order the include would hit the limits
+		return p.parseInclude(t)
+	}
+	if e.resolver != nil && !e.charge(p.resolver.(*LimitedResolver)) {
+		return p.parseInclude(t)
+	}
+	e.memo.commit()
+	for _, event := range e.events.events {
+		event(p)
+	}
+	return e.matches, e.result, e.err
+}
+
+// charge makes lookups of the evaluation counted by l, it fails if the
+// evaluation hit its own limit or l has not enough lookups left.
+func (e *includeEvaluation) charge(l *LimitedResolver) bool {
+	left := atomic.LoadInt32(&e.resolver.lookupLimit)
+	if left <= 0 {
+		return false
+	}
+	used := e.budget - left
+	for {
+		n := atomic.LoadInt32(&l.lookupLimit)
+		if n-used <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&l.lookupLimit, n, n-used) {
+			return true
+		}
+	}
+}
+
+func (c *concurrentIncludes) cancel() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// canceledResolver fails all lookups after done is closed
+type canceledResolver struct {
+	resolver Resolver
+	done     <-chan struct{}
+}
+
+func (r *canceledResolver) canceled() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *canceledResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	if r.canceled() {
+		return nil, nil, errCanceled
+	}
+	return r.resolver.LookupTXT(name)
+}
+
+func (r *canceledResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	if r.canceled() {
+		return nil, nil, errCanceled
+	}
+	return r.resolver.LookupTXTStrict(name)
+}
+
+func (r *canceledResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	if r.canceled() {
+		return false, nil, errCanceled
+	}
+	return r.resolver.Exists(name)
+}
+
+func (r *canceledResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	if r.canceled() {
+		return false, nil, errCanceled
+	}
+	return r.resolver.MatchIP(name, matcher)
+}
+
+func (r *canceledResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	if r.canceled() {
+		return false, nil, errCanceled
+	}
+	return r.resolver.MatchMX(name, matcher)
+}
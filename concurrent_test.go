@@ -0,0 +1,150 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestConcurrentIncludes(t *testing.T) {
+	const latency = 100 * time.Millisecond
+
+	dns.HandleFunc("concurrent.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`concurrent.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 include:a.concurrent.example include:b.concurrent.example ~include:c.concurrent.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("concurrent.example.")
+
+	for _, n := range []string{"a", "b", "c"} {
+		name := n + ".concurrent.example."
+		dns.HandleFunc(name, withLatency(zone(map[uint16][]string{
+			dns.TypeTXT: {
+				fmt.Sprintf(`%s 0 IN TXT "v=spf1 a -ip4:10.0.1.0/24 ip4:10.0.0.0/16 -all"`, name),
+			},
+			dns.TypeA: {
+				fmt.Sprintf(`%s 0 IN A 10.1.0.%d`, name, n[0]),
+			},
+		}), latency))
+		defer dns.HandleRemove(name)
+	}
+
+	tests := []struct {
+		ip   string
+		want Result
+	}{
+		{"10.0.0.1", Pass},
+		{"10.0.0.2", Pass},
+		{"10.0.1.1", Fail},
+		{"10.1.0.98", Pass},
+		{"10.1.0.99", Softfail},
+		{"192.0.2.1", Fail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			eval := func(opts ...Option) (Result, []string, time.Duration) {
+				testResolverCache.Purge()
+				l := &recordingListener{}
+				start := time.Now()
+				r, _, _, _ := CheckHost(ip, "concurrent.example", "concurrent.example",
+					append(opts, WithResolver(NewLimitedResolver(testResolver, 10, 10)), WithListener(l))...)
+				return r, l.events, time.Since(start)
+			}
+
+			want, wantEvents, sequential := eval()
+			got, gotEvents, concurrent := eval(ConcurrentIncludes(3))
+			if want != tt.want || got != tt.want {
+				t.Errorf("CheckHost() = %s (concurrent), %s (sequential); want %s", got, want, tt.want)
+			}
+			if strings.Join(gotEvents, "\n") != strings.Join(wantEvents, "\n") {
+				t.Errorf("events =\n%s\nwant\n%s", strings.Join(gotEvents, "\n"), strings.Join(wantEvents, "\n"))
+			}
+			if sequential >= 9*latency && concurrent > sequential/2 {
+				t.Errorf("concurrent evaluation took %s, sequential %s", concurrent, sequential)
+			}
+		})
+	}
+}
+
+func TestConcurrentIncludes_Limit(t *testing.T) {
+	dns.HandleFunc("limit.concurrent.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`limit.concurrent.example. 0 IN TXT "v=spf1 a include:d.concurrent.example include:e.concurrent.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("limit.concurrent.example.")
+
+	for _, n := range []string{"d", "e"} {
+		name := n + ".concurrent.example."
+		dns.HandleFunc(name, zone(map[uint16][]string{
+			dns.TypeTXT: {
+				fmt.Sprintf(`%s 0 IN TXT "v=spf1 a a a ip4:10.0.0.0/24 -all"`, name),
+			},
+		}))
+		defer dns.HandleRemove(name)
+	}
+
+	for limit := uint16(1); limit < 12; limit++ {
+		t.Run(fmt.Sprint(limit), func(t *testing.T) {
+			ip := net.ParseIP("10.0.0.1")
+			eval := func(opts ...Option) (Result, error) {
+				testResolverCache.Purge()
+				r, _, _, err := CheckHost(ip, "limit.concurrent.example", "limit.concurrent.example",
+					append(opts, WithResolver(NewLimitedResolver(testResolver, limit, 10)))...)
+				return r, err
+			}
+			want, wantErr := eval()
+			got, gotErr := eval(ConcurrentIncludes(2))
+			if got != want || fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+				t.Errorf("CheckHost() = %s, %v; want %s, %v", got, gotErr, want, wantErr)
+			}
+		})
+	}
+}
+
+func TestConcurrentIncludes_ParallelMatchers(t *testing.T) {
+	dns.HandleFunc("parallel.concurrent.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`parallel.concurrent.example. 0 IN TXT "v=spf1 include:f.concurrent.example include:g.concurrent.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("parallel.concurrent.example.")
+
+	for _, n := range []string{"f", "g"} {
+		name := n + ".concurrent.example."
+		records := map[uint16][]string{
+			dns.TypeTXT: {fmt.Sprintf(`%s 0 IN TXT "v=spf1 mx -all"`, name)},
+		}
+		for i := 1; i <= 4; i++ {
+			host := fmt.Sprintf("mx%d.%s", i, name)
+			records[dns.TypeMX] = append(records[dns.TypeMX], fmt.Sprintf(`%s 0 IN MX 10 %s`, name, host))
+			dns.HandleFunc(host, zone(map[uint16][]string{
+				dns.TypeA: {fmt.Sprintf(`%s 0 IN A 10.2.%d.%d`, host, n[0], i)},
+			}))
+			defer dns.HandleRemove(host)
+		}
+		dns.HandleFunc(name, zone(records))
+		defer dns.HandleRemove(name)
+	}
+
+	// the resolver calls matchers of MX hosts in parallel, so do listener
+	// events of the concurrently evaluated includes
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr, MiekgDNSParallelism(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &recordingListener{}
+	res, _, _, err := CheckHost(net.ParseIP("192.0.2.1"), "parallel.concurrent.example", "parallel.concurrent.example",
+		WithResolver(NewLimitedResolver(r, 10, 10)), WithListener(l), ConcurrentIncludes(2))
+	if res != Fail || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want fail", res, err)
+	}
+	if len(l.events) == 0 {
+		t.Errorf("no events")
+	}
+}
@@ -0,0 +1,102 @@
+package spf
+
+import "context"
+
+// WithContext makes the check run within ctx: the deadline of ctx limits the
+// evaluation the way WithOverallDeadline does, lookups of resolvers
+// implementing ContextResolver are made with ctx and listeners implementing
+// ContextListener get it, e.g. to carry request IDs into logs and DNS
+// instrumentation.
+func WithContext(ctx context.Context) Option {
+	return func(p *parser) {
+		p.ctx = ctx
+	}
+}
+
+// WithContextDecorator sets the function deriving the context of the
+// evaluation of a domain reached by "include" or "redirect" from the context
+// of the record it is reached from, e.g. to give nested domains deadlines of
+// their own. depth is the one of NestingListener. The context of the checked
+// domain is the one of WithContext, context.Background() if not given.
+func WithContextDecorator(f func(ctx context.Context, depth int) (context.Context, context.CancelFunc)) Option {
+	return func(p *parser) {
+		p.contextDecorator = f
+	}
+}
+
+// ContextResolver is an optional interface a Resolver could implement to make
+// lookups within the context of the check (see WithContext). WithContext
+// returns the resolver making lookups with ctx, sharing everything else, e.g.
+// limits and caches, with the original one. DNSResolver implements it, as do
+// LimitedResolver, OverlayResolver and RateLimitedResolver binding the
+// resolvers they wrap.
+type ContextResolver interface {
+	WithContext(ctx context.Context) Resolver
+}
+
+// bindContext returns r making lookups with ctx if r supports it
+func bindContext(ctx context.Context, r Resolver) Resolver {
+	if c, ok := r.(ContextResolver); ok && ctx != nil {
+		return c.WithContext(ctx)
+	}
+	return r
+}
+
+// contextDeadline returns the deadline of ctx, zero if there is none
+func contextDeadline(ctx context.Context) deadline {
+	if ctx == nil {
+		return deadline{}
+	}
+	t, ok := ctx.Deadline()
+	if !ok {
+		return deadline{}
+	}
+	return deadline{t, ErrDeadlineExceeded}
+}
+
+// enterContext switches p to the context of the nested domain for the
+// duration of its evaluation, the returned function switches it back.
+func (p *parser) enterContext(depth int) (leave func()) {
+	if p.contextDecorator == nil {
+		return func() {}
+	}
+	parent := p.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := p.contextDecorator(parent, depth)
+	saved, savedDeadline := p.ctx, p.deadline
+	p.ctx, p.deadline = ctx, earliest(p.deadline, contextDeadline(ctx))
+	return func() {
+		p.ctx, p.deadline = saved, savedDeadline
+		cancel()
+	}
+}
+
+// WithContext implements ContextResolver, it replaces the context given with
+// DNSResolverContext.
+func (r *DNSResolver) WithContext(ctx context.Context) Resolver {
+	c := *r
+	c.ctx = ctx
+	return &c
+}
+
+// WithContext implements ContextResolver, the resolver returned shares the
+// limits of r.
+func (r *LimitedResolver) WithContext(ctx context.Context) Resolver {
+	return &LimitedResolver{
+		mxQueriesLimit: r.mxQueriesLimit,
+		resolver:       bindContext(ctx, r.resolver),
+		shared:         r.limits(),
+	}
+}
+
+// WithContext implements ContextResolver
+func (o *OverlayResolver) WithContext(ctx context.Context) Resolver {
+	return &OverlayResolver{resolver: bindContext(ctx, o.resolver), zone: o.zone}
+}
+
+// WithContext implements ContextResolver
+func (r *canceledResolver) WithContext(ctx context.Context) Resolver {
+	return &canceledResolver{bindContext(ctx, r.resolver), r.done}
+}
@@ -0,0 +1,139 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+// contextRecorder records the context value of ctxKey of every lookup
+type contextRecorder struct {
+	Resolver
+	mu     *sync.Mutex
+	values *[]string
+	ctx    context.Context
+}
+
+func (r *contextRecorder) WithContext(ctx context.Context) Resolver {
+	c := *r
+	c.ctx = ctx
+	return &c
+}
+
+func (r *contextRecorder) record(name string) {
+	v := "-"
+	if r.ctx != nil {
+		v, _ = r.ctx.Value(ctxKey{}).(string)
+	}
+	r.mu.Lock()
+	*r.values = append(*r.values, name+" "+v)
+	r.mu.Unlock()
+}
+
+func (r *contextRecorder) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	r.record(name)
+	return r.Resolver.LookupTXTStrict(name)
+}
+
+func (r *contextRecorder) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	r.record(name)
+	return r.Resolver.MatchIP(name, matcher)
+}
+
+// contextListener records the context value of ctxKey of every check
+type contextListener struct {
+	recordingListener
+}
+
+func (l *contextListener) CheckHostContext(ctx context.Context, ip net.IP, domain, sender string) {
+	v, _ := ctx.Value(ctxKey{}).(string)
+	l.add("CheckHostContext(%s, %s)", domain, v)
+}
+
+func newContextRecorder(t *testing.T) (*contextRecorder, *[]string) {
+	t.Helper()
+	o, err := NewOverlayResolver(testResolver, map[string][]string{
+		"ctx.example":     {"v=spf1 a:a.ctx.example include:inc.ctx.example ~all"},
+		"a.ctx.example":   {"A 192.0.2.1"},
+		"inc.ctx.example": {"v=spf1 a:a.ctx.example -all"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	return &contextRecorder{Resolver: o, mu: &sync.Mutex{}, values: &values}, &values
+}
+
+func TestWithContext(t *testing.T) {
+	r, values := newContextRecorder(t)
+	l := &contextListener{}
+	limited := NewLimitedResolver(r, 5, 10)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req-1")
+
+	res, _, _, err := CheckHost(net.ParseIP("192.0.2.2"), "ctx.example", "",
+		WithResolver(limited), WithListener(l), WithContext(ctx))
+	if res != Softfail || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want softfail", res, err)
+	}
+	want := []string{"ctx.example. req-1", "a.ctx.example. req-1", "inc.ctx.example. req-1", "a.ctx.example. req-1"}
+	if !reflect.DeepEqual(*values, want) {
+		t.Errorf("lookups = %q; want %q", *values, want)
+	}
+	want = []string{"CheckHostContext(ctx.example., req-1)", "CheckHostContext(inc.ctx.example., req-1)"}
+	if got := l.filter("CheckHostContext"); !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckHostContext = %q; want %q", got, want)
+	}
+	if _, _, err := limited.LookupTXTStrict("ctx.example."); !errors.Is(err, ErrDNSLimitExceeded) {
+		t.Errorf("lookups are not charged to the limited resolver: %v", err)
+	}
+}
+
+func TestWithContext_Deadline(t *testing.T) {
+	r, values := newContextRecorder(t)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	res, _, _, err := CheckHost(net.ParseIP("192.0.2.2"), "ctx.example", "", WithResolver(r), WithContext(ctx))
+	if res != Temperror || !errors.Is(err, ErrDeadlineExceeded) {
+		t.Errorf("CheckHost() = %s, %v; want temperror of %v", res, err, ErrDeadlineExceeded)
+	}
+	if len(*values) != 0 {
+		t.Errorf("lookups = %q; want none", *values)
+	}
+}
+
+func TestWithContextDecorator(t *testing.T) {
+	r, values := newContextRecorder(t)
+	var depths []int
+	decorate := func(ctx context.Context, depth int) (context.Context, context.CancelFunc) {
+		depths = append(depths, depth)
+		v, _ := ctx.Value(ctxKey{}).(string)
+		return context.WithCancel(context.WithValue(ctx, ctxKey{}, v+"/nested"))
+	}
+	res, _, _, err := CheckHost(net.ParseIP("192.0.2.2"), "ctx.example", "",
+		WithResolver(r), WithContext(context.WithValue(context.Background(), ctxKey{}, "req-1")),
+		WithContextDecorator(decorate))
+	if res != Softfail || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want softfail", res, err)
+	}
+	want := []string{"ctx.example. req-1", "a.ctx.example. req-1", "inc.ctx.example. req-1/nested", "a.ctx.example. req-1/nested"}
+	if !reflect.DeepEqual(*values, want) {
+		t.Errorf("lookups = %q; want %q", *values, want)
+	}
+	if want := []int{1}; !reflect.DeepEqual(depths, want) {
+		t.Errorf("depths = %v; want %v", depths, want)
+	}
+
+	expired := func(ctx context.Context, depth int) (context.Context, context.CancelFunc) {
+		return context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	}
+	res, _, _, err = CheckHost(net.ParseIP("192.0.2.2"), "ctx.example", "", WithResolver(r), WithContextDecorator(expired))
+	if res != Temperror || !errors.Is(err, ErrDeadlineExceeded) {
+		t.Errorf("CheckHost() with expired include = %s, %v; want temperror of %v", res, err, ErrDeadlineExceeded)
+	}
+}
@@ -0,0 +1,38 @@
+package spf
+
+import (
+	"time"
+)
+
+// Cost is the DNS cost of a term of SPF record, helping record owners to see
+// which terms use up the limit of DNS lookups. The cost of "include" and
+// "redirect" is the lookup of the SPF record they reach; terms of that record
+// have their own costs.
+type Cost struct {
+	Queries     int           `json:"queries"`               // number of DNS queries
+	VoidLookups int           `json:"voidLookups,omitempty"` // queries returned NXDOMAIN or no answers
+	Duration    time.Duration `json:"duration"`              // total time of the lookups
+}
+
+func (c *Cost) add(e *ResponseExtras) {
+	c.Queries += e.Queries
+	c.VoidLookups += e.VoidLookups
+	c.Duration += e.Duration
+}
+
+// spent returns a copy of e with the time the lookup took. A single query
+// is assumed if the Resolver doesn't count queries.
+func (e *ResponseExtras) spent(d time.Duration) *ResponseExtras {
+	if e == nil {
+		return nil
+	}
+	c := *e
+	c.Duration = d
+	if c.Queries == 0 {
+		c.Queries = 1
+		if c.Void {
+			c.VoidLookups = 1
+		}
+	}
+	return &c
+}
@@ -0,0 +1,87 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type costListener struct {
+	recordingListener
+}
+
+func (l *costListener) LookupExtras(qualifier, mechanism, value, fqdn string, extras *ResponseExtras) {
+	l.add("LookupExtras(%s, %d, %d)", fqdn, extras.Queries, extras.VoidLookups)
+}
+
+func TestCost(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("cost.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`cost.example. 0 IN TXT "v=spf1 ip4:192.0.2.0/24 a:void.cost.example mx include:inc.cost.example -all"`,
+		},
+		dns.TypeMX: {
+			`cost.example. 0 IN MX 10 mail.cost.example.`,
+		},
+	}))
+	defer dns.HandleRemove("cost.example.")
+
+	dns.HandleFunc("mail.cost.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`mail.cost.example. 0 IN A 10.0.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("mail.cost.example.")
+
+	dns.HandleFunc("inc.cost.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.cost.example. 0 IN TXT "v=spf1 ip4:172.16.0.0/16 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.cost.example.")
+
+	l := &costListener{}
+	p := Explain(net.ParseIP("203.0.113.1"), "cost.example", WithResolver(testResolver), WithListener(l))
+	if p == nil || p.Result != Fail {
+		t.Fatalf("Explain() = %v; want %s", p, Fail)
+	}
+
+	want := []struct {
+		term        string
+		queries     int
+		voidLookups int
+	}{
+		{"ip4:192.0.2.0/24", 0, 0},
+		{"a:void.cost.example", 2, 2}, // A and AAAA
+		{"mx", 3, 1},                  // MX, A and AAAA of the host
+		{"include:inc.cost.example", 1, 0},
+		{"-all", 0, 0},
+	}
+	if len(p.Steps) != len(want) {
+		t.Fatalf("len(Steps) = %d; want %d", len(p.Steps), len(want))
+	}
+	for i, w := range want {
+		s := p.Steps[i]
+		if s.Term != w.term {
+			t.Errorf("Steps[%d].Term = %q; want %q", i, s.Term, w.term)
+		}
+		if w.queries == 0 {
+			if s.Cost != nil {
+				t.Errorf("%s: Cost = %+v; want nil", s.Term, s.Cost)
+			}
+			continue
+		}
+		if s.Cost == nil || s.Cost.Queries != w.queries || s.Cost.VoidLookups != w.voidLookups || s.Cost.Duration <= 0 {
+			t.Errorf("%s: Cost = %+v; want %d queries, %d void", s.Term, s.Cost, w.queries, w.voidLookups)
+		}
+	}
+
+	wantEvents := "[LookupExtras(cost.example., 1, 0) LookupExtras(void.cost.example., 2, 2) " +
+		"LookupExtras(cost.example., 3, 1) LookupExtras(inc.cost.example., 1, 0)]"
+	if got := fmt.Sprint(l.filter("LookupExtras")); got != wantEvents {
+		t.Errorf("LookupExtras events:\n got=%s\nwant=%s", got, wantEvents)
+	}
+}
@@ -0,0 +1,92 @@
+package spf
+
+import (
+	"encoding/json"
+	"net"
+)
+
+// CheckResult is the outcome of CheckHostDetailed
+type CheckResult struct {
+	Result       Result     `json:"result"`
+	Explanation  string     `json:"explanation,omitempty"` // result of "exp="
+	Record       string     `json:"record,omitempty"`      // raw discovered SPF policy
+	MatchedToken string     `json:"matched,omitempty"`     // the term produced the result, empty if none
+	Err          error      `json:"error,omitempty"`       // the reason for the encountered problem
+	Trace        Trace      `json:"trace"`                 // data for "Received-SPF" header field
+	Aggregate    Aggregate  `json:"aggregate"`             // combined view of all the lookups made
+	Path         *Path      `json:"path,omitempty"`        // terms traversed during evaluation
+	Modifiers    []Modifier `json:"modifiers,omitempty"`   // unknown modifiers of the domain's record
+	NearMisses   []NearMiss `json:"nearMisses,omitempty"`  // TXT records of the domain probably meant to be SPF records
+
+	// Suggestions fix the policy producing "permerror", see SuggestRepairs
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, Err is rendered the way
+// SyntaxError.MarshalJSON does, so the result could be stored and restored
+// with UnmarshalJSON without losing kinds and codes of errors.
+func (r CheckResult) MarshalJSON() ([]byte, error) {
+	type checkResult CheckResult
+	return json.Marshal(struct {
+		checkResult
+		Err *errorJSON `json:"error,omitempty"`
+	}{checkResult(r), newErrorJSON(r.Err)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *CheckResult) UnmarshalJSON(b []byte) error {
+	type checkResult CheckResult
+	var v struct {
+		checkResult
+		Err *errorJSON `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*r = CheckResult(v.checkResult)
+	r.Err = v.Err.error()
+	return nil
+}
+
+// CheckHostDetailed evaluates e-mail with regard to SPF the same way as
+// CheckHost does, but returns all the details collected during evaluation.
+func CheckHostDetailed(ip net.IP, domain, sender string, opts ...Option) *CheckResult {
+	domain = NormalizeFQDN(domain)
+	e, p, spf := explain(ip, domain, sender, opts...)
+	r := &CheckResult{
+		Result:      e.root.Result,
+		Explanation: e.root.Explanation,
+		Record:      spf,
+		Err:         e.root.Err,
+		Aggregate:   *p.aggregate,
+		Path:        e.root,
+		Modifiers:   e.root.Modifiers,
+		NearMisses:  e.root.NearMisses,
+	}
+	if chain := e.root.Chain(); len(chain) > 0 {
+		r.MatchedToken = chain[len(chain)-1].Term
+	}
+	r.Trace = Trace{
+		Result:       r.Result,
+		Explanation:  r.Explanation,
+		ClientIP:     ip,
+		Helo:         p.heloDomain,
+		EnvelopeFrom: sender,
+		Problem:      r.Err,
+		Mechanism:    r.MatchedToken,
+		Pinned:       e.pinned,
+	}
+	if r.Result == Permerror {
+		r.Suggestions = SuggestRepairs(r.Path)
+	}
+	if p.receivingFQDN != "unknown" {
+		r.Trace.Receiver = p.receivingFQDN
+	}
+	p.hardening.Apply(&r.Trace)
+	return r
+}
+
+// Verdict returns compact outcome of the check.
+func (r *CheckResult) Verdict() Verdict {
+	return r.Path.Verdict()
+}
@@ -0,0 +1,172 @@
+package spf
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckHostDetailed(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("detailed.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`detailed.example. 300 IN TXT "v=spf1 a:void.detailed.example include:inc.detailed.example exp=exp.detailed.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("detailed.example.")
+
+	dns.HandleFunc("inc.detailed.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.detailed.example. 120 IN TXT "v=spf1 ip4:10.0.0.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.detailed.example.")
+
+	dns.HandleFunc("exp.detailed.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`exp.detailed.example. 60 IN TXT "%{i} is not allowed"`,
+		},
+	}))
+	defer dns.HandleRemove("exp.detailed.example.")
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ip          string
+		result      Result
+		explanation string
+		matched     string
+		lookups     int
+		voids       int
+		ttl         time.Duration
+		header      string
+	}{
+		{"10.0.0.1", Pass, "", "ip4:10.0.0.0/24", 3, 1, 120 * time.Second,
+			"pass (mx.example.net: domain of john@detailed.example designates 10.0.0.1 as permitted sender) client-ip=10.0.0.1; helo=mail.detailed.example; envelope-from=\"john@detailed.example\"; receiver=mx.example.net; mechanism=\"ip4:10.0.0.0/24\""},
+		{"10.0.1.1", Fail, "10.0.1.1 is not allowed", "-all", 4, 1, 120 * time.Second,
+			"fail (10.0.1.1 is not allowed) client-ip=10.0.1.1; helo=mail.detailed.example; envelope-from=\"john@detailed.example\"; receiver=mx.example.net; mechanism=-all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			r := CheckHostDetailed(ip, "detailed.example", "john@detailed.example",
+				WithResolver(testResolver),
+				HeloDomain("mail.detailed.example"),
+				ReceivingFQDN("mx.example.net"),
+				EvaluatedOn(now))
+			if r.Result != tt.result || r.Err != nil {
+				t.Errorf("Result = %s, %v; want %s", r.Result, r.Err, tt.result)
+			}
+			if r.Explanation != tt.explanation {
+				t.Errorf("Explanation = %q; want %q", r.Explanation, tt.explanation)
+			}
+			if r.Record != "v=spf1 a:void.detailed.example include:inc.detailed.example exp=exp.detailed.example -all" {
+				t.Errorf("Record = %q", r.Record)
+			}
+			if r.MatchedToken != tt.matched {
+				t.Errorf("MatchedToken = %q; want %q", r.MatchedToken, tt.matched)
+			}
+			if a := r.Aggregate; a.Queries != tt.lookups || a.VoidLookups != tt.voids || a.TTL != tt.ttl {
+				t.Errorf("Aggregate = %+v; want %d queries, %d void lookups, TTL %s", a, tt.lookups, tt.voids, tt.ttl)
+			}
+			if got := r.Trace.ReceivedSPF(); got != tt.header {
+				t.Errorf("Trace.ReceivedSPF() =\n%s\nwant\n%s", got, tt.header)
+			}
+			if v := r.Verdict(); v.Result != tt.result || v.Matched != tt.matched || !v.IP.Equal(ip) || !v.Timestamp.Equal(now) {
+				t.Errorf("Verdict() = %+v", v)
+			}
+
+			rr, expl, spf, err := CheckHost(ip, "detailed.example", "john@detailed.example", WithResolver(testResolver))
+			if rr != r.Result || expl != r.Explanation || spf != r.Record || err != r.Err {
+				t.Errorf("CheckHost() = %s, %q, %q, %v; differs from CheckHostDetailed()", rr, expl, spf, err)
+			}
+		})
+	}
+}
+
+func TestCheckHostDetailed_Modifiers(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("mods.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`mods.example. 0 IN TXT "v=spf1 include:inc.mods.example RA=postmaster rp=50 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("mods.example.")
+
+	dns.HandleFunc("inc.mods.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.mods.example. 0 IN TXT "v=spf1 ip4:10.0.0.0/24 rr=all -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.mods.example.")
+
+	r := CheckHostDetailed(net.ParseIP("10.0.0.1"), "mods.example", "john@mods.example", WithResolver(testResolver))
+	if r.Result != Pass || r.Err != nil {
+		t.Fatalf("Result = %s, %v; want pass", r.Result, r.Err)
+	}
+	want := []Modifier{{"ra", "postmaster"}, {"rp", "50"}}
+	if !reflect.DeepEqual(r.Modifiers, want) {
+		t.Errorf("Modifiers = %v; want %v", r.Modifiers, want)
+	}
+	inc := r.Path.Steps[0].Path
+	if want := []Modifier{{"rr", "all"}}; inc == nil || !reflect.DeepEqual(inc.Modifiers, want) {
+		t.Errorf("include Path = %+v; want Modifiers %v", inc, want)
+	}
+}
+
+func TestCheckResult_JSON(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("json.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`json.example. 0 IN TXT "v=spf1 include:inc.json.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("json.example.")
+
+	dns.HandleFunc("inc.json.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.json.example. 0 IN TXT "v=spf1 ip4:10.0.0.0/33 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.json.example.")
+
+	r := CheckHostDetailed(net.ParseIP("10.0.0.1"), "json.example", "john@json.example", WithResolver(testResolver))
+	if r.Result != Permerror || !errors.Is(r.Err, ErrNotIPv4) {
+		t.Fatalf("Result = %s, %v; want permerror", r.Result, r.Err)
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var got CheckResult
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.Result != r.Result || got.Record != r.Record || got.MatchedToken != r.MatchedToken {
+		t.Errorf("json.Unmarshal() = %+v; want %+v", got, r)
+	}
+	for name, err := range map[string]error{
+		"Err":                    got.Err,
+		"Trace.Problem":          got.Trace.Problem,
+		"Path.Err":               got.Path.Err,
+		"Path.Steps[0].Err":      got.Path.Steps[0].Err,
+		"Path.Steps[0].Path.Err": got.Path.Steps[0].Path.Err,
+	} {
+		if !errors.Is(err, ErrNotIPv4) {
+			t.Errorf("%s = %v; want %v", name, err, ErrNotIPv4)
+		}
+	}
+	if got.Err.Error() != r.Err.Error() {
+		t.Errorf("Err = %q; want %q", got.Err, r.Err)
+	}
+	if again, _ := json.Marshal(&got); string(again) != string(b) {
+		t.Errorf("json.Marshal() after round trip =\n%s\nwant\n%s", again, b)
+	}
+}
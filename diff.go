@@ -0,0 +1,169 @@
+package spf
+
+import "strconv"
+
+// ChangeKind classifies a difference between two SPF records
+type ChangeKind int
+
+const (
+	_ ChangeKind = iota
+
+	// TermAdded means the term is present in the new record only
+	TermAdded
+	// TermRemoved means the term is present in the old record only
+	TermRemoved
+	// TermChanged means the term has a different qualifier (for mechanisms)
+	// or a different value (for modifiers) in the new record
+	TermChanged
+	// TermMoved means the mechanism is evaluated in a different order
+	// relative to other mechanisms present in both records
+	TermMoved
+)
+
+// String returns string form of the change kind
+func (k ChangeKind) String() string {
+	switch k {
+	case TermAdded:
+		return "added"
+	case TermRemoved:
+		return "removed"
+	case TermChanged:
+		return "changed"
+	case TermMoved:
+		return "moved"
+	default:
+		return strconv.Itoa(int(k))
+	}
+}
+
+// TermChange describes a single difference found by Diff
+type TermChange struct {
+	Kind ChangeKind `json:"kind"`
+	Old  string     `json:"old,omitempty"` // the term in the old record, empty for added terms
+	New  string     `json:"new,omitempty"` // the term in the new record, empty for removed terms
+}
+
+// Diff compares the old SPF record a with the new record b term by term and
+// returns the list of semantic differences. Cosmetic changes, the ones
+// Canonicalize removes, are ignored. Removed terms are listed first in order
+// of the old record, followed by the rest of changes in order of the new record.
+func Diff(a, b string) []TermChange {
+	return diffRecords(diffTerms(a), diffTerms(b))
+}
+
+func diffRecords(a, b []*diffTerm) []TermChange {
+	inA := make(map[string]*diffTerm, len(a))
+	for _, t := range a {
+		inA[t.key] = t
+	}
+	inB := make(map[string]*diffTerm, len(b))
+	for _, t := range b {
+		inB[t.key] = t
+	}
+
+	var changes []TermChange
+	for _, t := range a {
+		if _, ok := inB[t.key]; !ok {
+			changes = append(changes, TermChange{Kind: TermRemoved, Old: t.text})
+		}
+	}
+
+	moved := movedMechanisms(a, b, inA, inB)
+	for _, t := range b {
+		o, ok := inA[t.key]
+		switch {
+		case !ok:
+			changes = append(changes, TermChange{Kind: TermAdded, New: t.text})
+		case o.text != t.text:
+			changes = append(changes, TermChange{Kind: TermChanged, Old: o.text, New: t.text})
+		case moved[t.key]:
+			changes = append(changes, TermChange{Kind: TermMoved, Old: o.text, New: t.text})
+		}
+	}
+	return changes
+}
+
+type diffTerm struct {
+	key       string // identity of the term regardless of qualifier
+	text      string
+	mechanism bool
+}
+
+func diffTerms(record string) []*diffTerm {
+	s, _ := Canonicalize(record)
+	tokens := lex(s)
+	terms := make([]*diffTerm, 0, len(tokens))
+	seen := make(map[string]int)
+	for _, t := range tokens {
+		d := &diffTerm{text: t.String()}
+		switch {
+		case t.isErr():
+			d.key = t.value
+		case t.mechanism == tUnknownModifier:
+			d.key, _ = t.modifier()
+		case t.mechanism.isModifier():
+			d.key = t.mechanism.String()
+		default:
+			d.key = t.mechanism.String() + ":" + t.value
+			d.mechanism = true
+		}
+		// records could have repeated keys, like "-mx ~mx" or two redirects
+		seen[d.key]++
+		if n := seen[d.key]; n > 1 {
+			d.key += "#" + strconv.Itoa(n)
+		}
+		terms = append(terms, d)
+	}
+	return terms
+}
+
+// movedMechanisms returns keys of mechanisms present in both records which
+// are not a part of the longest common subsequence of such mechanisms.
+func movedMechanisms(a, b []*diffTerm, inA, inB map[string]*diffTerm) map[string]bool {
+	var x, y []string
+	for _, t := range a {
+		if _, ok := inB[t.key]; ok && t.mechanism {
+			x = append(x, t.key)
+		}
+	}
+	for _, t := range b {
+		if _, ok := inA[t.key]; ok && t.mechanism {
+			y = append(y, t.key)
+		}
+	}
+
+	// lcs[i][j] is the length of LCS of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	moved := make(map[string]bool)
+	for _, k := range y {
+		moved[k] = true
+	}
+	for i, j := 0, 0; i < len(x) && j < len(y); {
+		switch {
+		case x[i] == y[j]:
+			delete(moved, y[j])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return moved
+}
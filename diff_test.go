@@ -0,0 +1,53 @@
+package spf
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		old  string
+		new  string
+		want []TermChange
+	}{
+		{"v=spf1 mx -all", "v=spf1 mx -all", nil},
+		{"v=spf1 +MX  -all", "v=spf1 mx -all mx", nil},
+		{"v=spf1 exp=x.example.com mx -all", "v=spf1 mx -all exp=x.example.com", nil},
+		{"v=spf1 mx -all", "v=spf1 mx ip4:10.0.0.1 -all", []TermChange{
+			{Kind: TermAdded, New: "ip4:10.0.0.1"},
+		}},
+		{"v=spf1 mx a -all", "v=spf1 mx -all", []TermChange{
+			{Kind: TermRemoved, Old: "a"},
+		}},
+		{"v=spf1 mx -all", "v=spf1 mx ~all", []TermChange{
+			{Kind: TermChanged, Old: "-all", New: "~all"},
+		}},
+		{"v=spf1 mx redirect=a.example.com", "v=spf1 mx redirect=b.example.com", []TermChange{
+			{Kind: TermChanged, Old: "redirect=a.example.com", New: "redirect=b.example.com"},
+		}},
+		{"v=spf1 a mx ip4:10.0.0.1 -all", "v=spf1 ip4:10.0.0.1 a mx -all", []TermChange{
+			{Kind: TermMoved, Old: "ip4:10.0.0.1", New: "ip4:10.0.0.1"},
+		}},
+		{"v=spf1 a:a.example.com include:x.example.com -all", "v=spf1 include:y.example.com ?a:a.example.com -all exp=e.example.com", []TermChange{
+			{Kind: TermRemoved, Old: "include:x.example.com"},
+			{Kind: TermAdded, New: "include:y.example.com"},
+			{Kind: TermChanged, Old: "a:a.example.com", New: "?a:a.example.com"},
+			{Kind: TermAdded, New: "exp=e.example.com"},
+		}},
+	}
+
+	const skipAllBut = -1
+	for no, test := range tests {
+		if skipAllBut != -1 && skipAllBut != no {
+			continue
+		}
+		t.Run(fmt.Sprintf("%d_%s", no, test.new), func(t *testing.T) {
+			got := Diff(test.old, test.new)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Diff(%q, %q) = %+v; want %+v", test.old, test.new, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package spf
+
+import "fmt"
+
+// TermKind classifies terms of SPF records.
+type TermKind int
+
+const (
+	// TermInvalid is a malformed term
+	TermInvalid TermKind = iota
+	// TermVersion is the "v=spf1" version term
+	TermVersion
+	// TermMechanism is "all", "include", "a", "mx", "ptr", "ip4", "ip6" or
+	// "exists"
+	TermMechanism
+	// TermModifier is "redirect" or "exp"
+	TermModifier
+	// TermUnknownModifier is a name=value modifier unknown to the evaluation,
+	// see ModifierListener
+	TermUnknownModifier
+)
+
+func (k TermKind) String() string {
+	switch k {
+	case TermInvalid:
+		return "invalid"
+	case TermVersion:
+		return "version"
+	case TermMechanism:
+		return "mechanism"
+	case TermModifier:
+		return "modifier"
+	case TermUnknownModifier:
+		return "unknown-modifier"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (k TermKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (k *TermKind) UnmarshalText(text []byte) error {
+	for c := TermInvalid; c <= TermUnknownModifier; c++ {
+		if c.String() == string(text) {
+			*k = c
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown term kind %q", text)
+}
+
+// DirectiveInfo describes a directive reported to DirectiveInfoListener.
+type DirectiveInfo struct {
+	Kind           TermKind `json:"kind"`
+	Qualifier      string   `json:"qualifier,omitempty"`      // "+", "-", "~" or "?" of mechanisms
+	Key            string   `json:"key"`                      // lowercased name of the mechanism or modifier, "v" of the version
+	Value          string   `json:"value,omitempty"`          // value as published, macros are not expanded
+	EffectiveValue string   `json:"effectiveValue,omitempty"` // value after macro expansion, empty for unused directives
+	Start          int      `json:"start"`                    // byte offset of the term in the record, -1 for injected terms
+	End            int      `json:"end"`                      // byte offset right after the term, -1 for injected terms
+	Unused         bool     `json:"unused,omitempty"`         // the directive wasn't evaluated
+	Synthetic      bool     `json:"synthetic,omitempty"`      // injected with WithInjectedTerms
+	QueriesDNS     bool     `json:"queriesDNS,omitempty"`     // the term counts against the limit of DNS lookups
+}
+
+// kind returns the kind of the term
+func (t *token) kind() TermKind {
+	switch {
+	case t.isErr():
+		return TermInvalid
+	case t.mechanism == tVersion:
+		return TermVersion
+	case t.mechanism == tUnknownModifier:
+		return TermUnknownModifier
+	case t.mechanism.isMechanism():
+		return TermMechanism
+	case t.mechanism.isModifier():
+		return TermModifier
+	}
+	return TermInvalid
+}
+
+// queriesDNS returns true for terms counting against the limit of DNS
+// lookups
+func (t *token) queriesDNS() bool {
+	switch t.mechanism {
+	case tInclude, tA, tMX, tPTR, tExists, tRedirect:
+		return !t.isErr()
+	}
+	return false
+}
+
+// directiveInfo returns DirectiveInfo of the term
+func (t *token) directiveInfo(unused bool, effectiveValue string) DirectiveInfo {
+	start, end := t.position()
+	info := DirectiveInfo{
+		Kind:           t.kind(),
+		Key:            t.mechanism.String(),
+		Value:          t.value,
+		EffectiveValue: effectiveValue,
+		Start:          start,
+		End:            end,
+		Unused:         unused,
+		Synthetic:      t.synthetic(),
+		QueriesDNS:     t.queriesDNS(),
+	}
+	switch info.Kind {
+	case TermMechanism:
+		info.Qualifier = t.qualifier.String()
+	case TermUnknownModifier:
+		info.Key, info.Value = t.modifier()
+	}
+	return info
+}
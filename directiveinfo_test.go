@@ -0,0 +1,73 @@
+package spf
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// directiveInfoListener records DirectiveInfo of every directive
+type directiveInfoListener struct {
+	recordingListener
+	infos []DirectiveInfo
+}
+
+func (l *directiveInfoListener) DirectiveInfo(info DirectiveInfo) {
+	l.infos = append(l.infos, info)
+}
+
+func TestDirectiveInfoListener(t *testing.T) {
+	r, err := NewOverlayResolver(nil, map[string][]string{
+		"info.example":     {"v=spf1 a:%{d} ra=postmaster include:inc.info.example -all redirect=other.example"},
+		"info.example.":    {"A 192.0.2.1"},
+		"inc.info.example": {"v=spf1 ip4:192.0.2.2 ~all"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &directiveInfoListener{}
+	res, _, _, _ := CheckHost(net.ParseIP("192.0.2.3"), "info.example", "",
+		WithResolver(r), WithListener(l), WithInjectedTerms("?ip4:198.51.100.1"))
+	if res != Fail {
+		t.Fatalf("CheckHost() = %s; want fail", res)
+	}
+	want := []DirectiveInfo{
+		{Kind: TermUnknownModifier, Key: "ra", Value: "postmaster", Start: 14, End: 27},
+		{Kind: TermVersion, Key: "v", Value: "spf1", Start: 0, End: 6},
+		{Kind: TermMechanism, Qualifier: "?", Key: "ip4", Value: "198.51.100.1", EffectiveValue: "198.51.100.1",
+			Start: -1, End: -1, Synthetic: true},
+		{Kind: TermMechanism, Qualifier: "+", Key: "a", Value: "%{d}", EffectiveValue: "info.example.",
+			Start: 7, End: 13, QueriesDNS: true},
+		{Kind: TermMechanism, Qualifier: "+", Key: "include", Value: "inc.info.example", EffectiveValue: "inc.info.example.",
+			Start: 28, End: 52, QueriesDNS: true},
+		{Kind: TermVersion, Key: "v", Value: "spf1", Start: 0, End: 6},
+		{Kind: TermMechanism, Qualifier: "+", Key: "ip4", Value: "192.0.2.2", EffectiveValue: "192.0.2.2",
+			Start: 7, End: 20},
+		{Kind: TermMechanism, Qualifier: "~", Key: "all", Start: 21, End: 25},
+		{Kind: TermMechanism, Qualifier: "-", Key: "all", Start: 53, End: 57},
+		{Kind: TermModifier, Key: "redirect", Value: "other.example", Start: 58, End: 80,
+			Unused: true, QueriesDNS: true},
+	}
+	if diff := cmp.Diff(want, l.infos); diff != "" {
+		t.Errorf("DirectiveInfo (-want +got):\n%s", diff)
+	}
+}
+
+func TestTermKind_MarshalText(t *testing.T) {
+	for k := TermInvalid; k <= TermUnknownModifier; k++ {
+		b, err := json.Marshal(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got TermKind
+		if err := json.Unmarshal(b, &got); err != nil || got != k {
+			t.Errorf("json.Unmarshal(%s) = %s, %v; want %s", b, got, err, k)
+		}
+	}
+	var k TermKind
+	if err := json.Unmarshal([]byte(`"bogus"`), &k); err == nil {
+		t.Errorf("json.Unmarshal(bogus) error = nil")
+	}
+}
@@ -0,0 +1,42 @@
+package spf
+
+import (
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/miekg/dns"
+)
+
+// DNSCache keeps DNS responses by their questions for Resolver returned by
+// NewMiekgDNSResolver (see MiekgDNSResponseCache). Implementations must be
+// safe for concurrent use. Cached responses are shared by lookups and must
+// not be modified.
+type DNSCache interface {
+	// Get returns the response to the question, false if there is none or
+	// it has expired.
+	Get(q dns.Question) (*dns.Msg, bool)
+	// Set keeps the response to the question for d.
+	Set(q dns.Question, res *dns.Msg, d time.Duration) error
+}
+
+// GCacheDNSCache adapts gcache.Cache to DNSCache.
+func GCacheDNSCache(c gcache.Cache) DNSCache {
+	return gcacheDNSCache{c}
+}
+
+type gcacheDNSCache struct {
+	c gcache.Cache
+}
+
+func (c gcacheDNSCache) Get(q dns.Question) (*dns.Msg, bool) {
+	v, err := c.c.Get(q) // dns.Question is comparable https://golang.org/ref/spec#Comparison_operators
+	if err != nil {
+		return nil, false
+	}
+	res, ok := v.(*dns.Msg)
+	return res, ok
+}
+
+func (c gcacheDNSCache) Set(q dns.Question, res *dns.Msg, d time.Duration) error {
+	return c.c.SetWithExpire(q, res, d)
+}
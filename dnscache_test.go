@@ -0,0 +1,65 @@
+package spf
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// mapDNSCache is DNSCache ignoring expiration
+type mapDNSCache struct {
+	sync.Mutex
+	m map[dns.Question]*dns.Msg
+	d map[dns.Question]time.Duration
+}
+
+func (c *mapDNSCache) Get(q dns.Question) (*dns.Msg, bool) {
+	c.Lock()
+	defer c.Unlock()
+	res, ok := c.m[q]
+	return res, ok
+}
+
+func (c *mapDNSCache) Set(q dns.Question, res *dns.Msg, d time.Duration) error {
+	c.Lock()
+	defer c.Unlock()
+	c.m[q], c.d[q] = res, d
+	return nil
+}
+
+func TestMiekgDNSResponseCache(t *testing.T) {
+	dns.HandleFunc("dnscache.test.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`dnscache.test. 300 IN TXT "v=spf1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("dnscache.test.")
+
+	c := &mapDNSCache{m: make(map[dns.Question]*dns.Msg), d: make(map[dns.Question]time.Duration)}
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr, MiekgDNSResponseCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.LookupTXT("dnscache.test."); err != nil {
+		t.Fatal(err)
+	}
+	q := dns.Question{Name: "dnscache.test.", Qtype: dns.TypeTXT, Qclass: dns.ClassINET}
+	if c.m[q] == nil || c.d[q] != 300*time.Second {
+		t.Fatalf("cache = %v, %v; want the response for 5m", c.m, c.d)
+	}
+
+	// the cached response is used
+	res := new(dns.Msg)
+	res.SetQuestion("dnscache.test.", dns.TypeTXT)
+	res.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: "dnscache.test.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+		Txt: []string{"v=spf1 +all"},
+	}}
+	c.m[q] = res
+	txts, _, err := r.LookupTXT("dnscache.test.")
+	if err != nil || len(txts) != 1 || txts[0] != "v=spf1 +all" {
+		t.Errorf("LookupTXT() = %q, %v; want the cached one", txts, err)
+	}
+}
@@ -0,0 +1,97 @@
+package spf
+
+import "strings"
+
+// DomainProfile defines domain names evaluation accepts: the checked domain
+// and targets of terms after macro expansion, e.g. of "include" or
+// "exists". Names not fitting the profile are DomainError.
+type DomainProfile int
+
+const (
+	// DomainRegistrable accepts names of LDH and underscore labels with at
+	// least one letter, e.g. "_spf.example.com" or "2.0.192.example.123"
+	// but not "192.0.2.1". It is the default.
+	DomainRegistrable DomainProfile = iota
+	// DomainStrict accepts names DomainRegistrable does which last label
+	// isn't all-numeric, as domain-end of RFC 7208 section 7.1 requires.
+	DomainStrict
+	// DomainLoose accepts names of any labels of printable ASCII characters
+	// within the limits of length, e.g. all-numeric targets built from %{i}
+	// as in "exists:%{i}._spf.example.com" of published records.
+	DomainLoose
+)
+
+func (dp DomainProfile) String() string {
+	switch dp {
+	case DomainRegistrable:
+		return "registrable"
+	case DomainStrict:
+		return "strict"
+	case DomainLoose:
+		return "loose"
+	default:
+		return "unknown"
+	}
+}
+
+// WithDomainProfile sets domain names evaluation accepts, DomainRegistrable
+// is used by default.
+func WithDomainProfile(dp DomainProfile) Option {
+	return func(p *parser) {
+		p.domainProfile = dp
+	}
+}
+
+// valid returns true if s is a domain name of the profile
+func (dp DomainProfile) valid(s string) bool {
+	switch dp {
+	case DomainStrict:
+		return isDomainName(s) && !numericTopLabel(s)
+	case DomainLoose:
+		return isLooseDomainName(s)
+	}
+	return isDomainName(s)
+}
+
+// numericTopLabel returns true if the last label of s is all-numeric
+func numericTopLabel(s string) bool {
+	s = removeRoot(s)
+	top := s[strings.LastIndexByte(s, '.')+1:]
+	if top == "" {
+		return false
+	}
+	for i := 0; i < len(top); i++ {
+		if !isDigit(rune(top[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLooseDomainName checks if s is a name of non-empty labels of printable
+// ASCII characters, fitting the limits of length isDomainName has
+func isLooseDomainName(s string) bool {
+	l := len(s)
+	if l == 0 || l > MaxDomainLen+1 || l == MaxDomainLen+1 && s[l-1] != '.' {
+		return false
+	}
+	partlen := 0
+	for i := 0; i < l; i++ {
+		c := s[i]
+		switch {
+		case c == '.':
+			if partlen == 0 {
+				return false
+			}
+			partlen = 0
+		case c > ' ' && c < 0x7f:
+			partlen++
+			if partlen > 63 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
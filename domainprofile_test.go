@@ -0,0 +1,86 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestDomainProfile_valid(t *testing.T) {
+	long := strings.Repeat("a", 63)
+	tests := []struct {
+		domain                     string
+		registrable, strict, loose bool
+	}{
+		{"example.com", true, true, true},
+		{"_spf.example.com.", true, true, true},
+		{"2.0.192.example.123", true, false, true},
+		{"example.123.", true, false, true},
+		{"192.0.2.1", false, false, true},
+		{"1.2.3.4.in-addr._spf.example.com", true, true, true},
+		{"a*b.example.com", false, false, true},
+		{"-a.example.com", false, false, true},
+		{"a..example.com", false, false, false},
+		{".example.com", false, false, false},
+		{"a b.example.com", false, false, false},
+		{"é.example.com", false, false, false},
+		{long + ".example.com", true, true, true},
+		{long + "a.example.com", false, false, false},
+		{strings.Repeat("a.", 127) + "a", false, false, false},
+		{strings.Repeat("a.", 127), true, true, true},
+		{"", false, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.domain, func(t *testing.T) {
+			for dp, want := range map[DomainProfile]bool{
+				DomainRegistrable: test.registrable,
+				DomainStrict:      test.strict,
+				DomainLoose:       test.loose,
+			} {
+				if got := dp.valid(test.domain); got != want {
+					t.Errorf("%s.valid(%q) = %t; want %t", dp, test.domain, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithDomainProfile(t *testing.T) {
+	r, err := NewOverlayResolver(nil, map[string][]string{
+		"ip.example":      {"v=spf1 exists:%{i} -all"},
+		"192.0.2.1":       {"A 127.0.0.2"},
+		"tld.example":     {"v=spf1 include:spf.example.123 -all"},
+		"spf.example.123": {"v=spf1 +all"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		domain string
+		dp     DomainProfile
+		want   Result
+	}{
+		{"ip.example", DomainRegistrable, Permerror},
+		{"ip.example", DomainStrict, Permerror},
+		{"ip.example", DomainLoose, Pass},
+		{"tld.example", DomainRegistrable, Pass},
+		{"tld.example", DomainStrict, Permerror},
+		{"tld.example", DomainLoose, Pass},
+		{"spf.example.123", DomainRegistrable, Pass},
+		{"spf.example.123", DomainStrict, None},
+	}
+	for _, test := range tests {
+		t.Run(test.domain+"/"+test.dp.String(), func(t *testing.T) {
+			res, _, _, err := CheckHost(net.ParseIP("192.0.2.1"), test.domain, "",
+				WithResolver(r), WithDomainProfile(test.dp))
+			if res != test.want {
+				t.Errorf("CheckHost() = %s, %v; want %s", res, err, test.want)
+			}
+			var de *DomainError
+			if res != Pass && !errors.As(err, &de) {
+				t.Errorf("CheckHost() error = %v; want DomainError", err)
+			}
+		})
+	}
+}
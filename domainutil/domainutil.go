@@ -0,0 +1,91 @@
+// Package domainutil provides manipulations of domain names SPF evaluation
+// and tools built around it need: normalization, label counting, subdomain
+// tests and organizational domains (RFC 7489).
+//
+// Names are compared case-insensitively and with or without the trailing
+// dot of the root.
+package domainutil
+
+import (
+	"strings"
+)
+
+// Normalize returns the name in lower case and with the trailing dot.
+func Normalize(name string) string {
+	if len(name) == 0 {
+		return ""
+	}
+	if name[len(name)-1] != '.' {
+		name = name + "."
+	}
+	return strings.ToLower(name)
+}
+
+// trim returns the name without the trailing dot
+func trim(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
+
+// LabelCount returns the number of labels of the name, the root is not
+// counted.
+func LabelCount(name string) int {
+	name = trim(name)
+	if name == "" {
+		return 0
+	}
+	return strings.Count(name, ".") + 1
+}
+
+// IsSubdomainOf returns true if the name is the parent itself or a
+// subdomain of it.
+func IsSubdomainOf(name, parent string) bool {
+	name, parent = trim(name), trim(parent)
+	if parent == "" {
+		return true
+	}
+	if len(name) < len(parent) || !strings.EqualFold(name[len(name)-len(parent):], parent) {
+		return false
+	}
+	return len(name) == len(parent) || name[len(name)-len(parent)-1] == '.'
+}
+
+// PublicSuffixList provides the public suffix of domains, e.g. "co.uk" for
+// "www.example.co.uk". It has the same method as PublicSuffixList of
+// net/http/cookiejar, so golang.org/x/net/publicsuffix.List could be used.
+type PublicSuffixList interface {
+	PublicSuffix(domain string) string
+}
+
+// TopLevelSuffixList is PublicSuffixList which takes the top-level domain
+// for the public suffix of any domain. It serves as a fallback when
+// the actual list isn't available, getting organizational domains of
+// second-level registrations like "example.co.uk" wrong.
+var TopLevelSuffixList PublicSuffixList = topLevel{}
+
+type topLevel struct{}
+
+func (topLevel) PublicSuffix(domain string) string {
+	domain = trim(domain)
+	return domain[strings.LastIndexByte(domain, '.')+1:]
+}
+
+// OrganizationalDomain returns the organizational domain of the name: its
+// public suffix along with one more label, e.g. "example.co.uk." for
+// "mail.example.co.uk". TopLevelSuffixList is used if list is nil.
+// The name itself is returned, normalized, if it's a public suffix.
+// https://tools.ietf.org/html/rfc7489#section-3.2
+func OrganizationalDomain(name string, list PublicSuffixList) string {
+	if list == nil {
+		list = TopLevelSuffixList
+	}
+	name = Normalize(name)
+	if name == "" {
+		return ""
+	}
+	labels := strings.Split(trim(name), ".")
+	n := LabelCount(list.PublicSuffix(trim(name))) + 1
+	if n >= len(labels) {
+		return name
+	}
+	return strings.Join(labels[len(labels)-n:], ".") + "."
+}
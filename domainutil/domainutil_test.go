@@ -0,0 +1,107 @@
+package domainutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"", ""},
+		{".", "."},
+		{"Example.COM", "example.com."},
+		{"example.com.", "example.com."},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.name); got != tt.want {
+			t.Errorf("Normalize(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"", 0},
+		{".", 0},
+		{"com", 1},
+		{"example.com.", 2},
+		{"mail.example.co.uk", 4},
+	}
+	for _, tt := range tests {
+		if got := LabelCount(tt.name); got != tt.want {
+			t.Errorf("LabelCount(%q) = %d; want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsSubdomainOf(t *testing.T) {
+	tests := []struct {
+		name, parent string
+		want         bool
+	}{
+		{"example.com", "example.com.", true},
+		{"mail.Example.com.", "example.COM", true},
+		{"a.b.example.com", "example.com", true},
+		{"badexample.com", "example.com", false},
+		{"example.com", "mail.example.com", false},
+		{"example.org", "example.com", false},
+		{"example.com", ".", true},
+	}
+	for _, tt := range tests {
+		if got := IsSubdomainOf(tt.name, tt.parent); got != tt.want {
+			t.Errorf("IsSubdomainOf(%q, %q) = %t; want %t", tt.name, tt.parent, got, tt.want)
+		}
+	}
+}
+
+// suffixes is PublicSuffixList of the given suffixes
+type suffixes []string
+
+func (l suffixes) PublicSuffix(domain string) string {
+	best := ""
+	for _, s := range l {
+		if IsSubdomainOf(domain, s) && len(s) > len(best) {
+			best = s
+		}
+	}
+	if best == "" {
+		return TopLevelSuffixList.PublicSuffix(domain)
+	}
+	return best
+}
+
+func TestOrganizationalDomain(t *testing.T) {
+	list := suffixes{"co.uk", "uk", "com"}
+	tests := []struct {
+		name string
+		list PublicSuffixList
+		want string
+	}{
+		{"", nil, ""},
+		{"mail.example.com", nil, "example.com."},
+		{"a.b.example.com.", nil, "example.com."},
+		{"example.com", nil, "example.com."},
+		{"com", nil, "com."},
+		{"mail.example.co.uk", nil, "co.uk."},
+		{"mail.example.co.uk", list, "example.co.uk."},
+		{"Example.CO.uk", list, "example.co.uk."},
+		{"co.uk", list, "co.uk."},
+		{"mail.example.org", list, "example.org."},
+	}
+	for _, tt := range tests {
+		name := tt.name
+		if tt.list != nil {
+			name += " (" + strings.Join(list, ",") + ")"
+		}
+		t.Run(name, func(t *testing.T) {
+			if got := OrganizationalDomain(tt.name, tt.list); got != tt.want {
+				t.Errorf("OrganizationalDomain(%q) = %q; want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package spf
+
+import "net"
+
+// DualStackResult is the evaluation of SPF policy of a domain for the IPv4
+// and IPv6 addresses of a sending host made by CheckDualStack.
+type DualStackResult struct {
+	Host   string       `json:"host"`
+	Domain string       `json:"domain"`
+	IPv4   []IPAnalysis `json:"ipv4,omitempty"` // evaluations for A records of the host
+	IPv6   []IPAnalysis `json:"ipv6,omitempty"` // evaluations for AAAA records of the host
+}
+
+// Passes reports for each family if the host has addresses of the family and
+// all of them pass the policy, e.g. ip6 is false if publishing AAAA records
+// of the host would make its mail fail SPF.
+func (d *DualStackResult) Passes() (ip4, ip6 bool) {
+	passes := func(a []IPAnalysis) bool {
+		for _, ip := range a {
+			if ip.Result != Pass {
+				return false
+			}
+		}
+		return len(a) > 0
+	}
+	return passes(d.IPv4), passes(d.IPv6)
+}
+
+// CheckDualStack looks up A and AAAA records of the sending host and
+// evaluates SPF policy of the domain for every address the way
+// AnalyzeRecord does, reporting the results per address family. The
+// addresses and the policy are looked up with r once.
+func CheckDualStack(host, domain string, r Resolver, opts ...Option) (*DualStackResult, error) {
+	d := &DualStackResult{Host: NormalizeFQDN(host), Domain: NormalizeFQDN(domain)}
+	m := newMemoResolver(r)
+	candidates, _, err := EnumerateIP(m, d.Host, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(candidates))
+	for i, c := range candidates {
+		ips[i] = c.IP
+	}
+	for _, a := range analyzeRecord(d.Domain, ips, m, opts).IPs {
+		if a.IP.To4() != nil {
+			d.IPv4 = append(d.IPv4, a)
+		} else {
+			d.IPv6 = append(d.IPv6, a)
+		}
+	}
+	return d, nil
+}
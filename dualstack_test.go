@@ -0,0 +1,44 @@
+package spf
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCheckDualStack(t *testing.T) {
+	r, err := NewOverlayResolver(testResolver, map[string][]string{
+		"dual.example":     {"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8:1::/48 -all"},
+		"mta.dual.example": {"A 192.0.2.10", "AAAA 2001:db8:1::10", "AAAA 2001:db8:2::10"},
+		"v4.dual.example":  {"A 192.0.2.11"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingResolver{Resolver: r}
+
+	d, err := CheckDualStack("mta.dual.example", "dual.example", counting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.IPv4) != 1 || d.IPv4[0].Result != Pass || !d.IPv4[0].IP.Equal(net.ParseIP("192.0.2.10")) {
+		t.Errorf("IPv4 = %+v", d.IPv4)
+	}
+	if len(d.IPv6) != 2 || d.IPv6[0].Result != Pass || d.IPv6[1].Result != Fail {
+		t.Errorf("IPv6 = %+v", d.IPv6)
+	}
+	if ip4, ip6 := d.Passes(); !ip4 || ip6 {
+		t.Errorf("Passes() = %t, %t; want true, false", ip4, ip6)
+	}
+	// addresses of the host and the policy once
+	if counting.lookups != 2 {
+		t.Errorf("lookups = %d; want 2", counting.lookups)
+	}
+
+	d, err = CheckDualStack("v4.dual.example", "dual.example", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip4, ip6 := d.Passes(); !ip4 || ip6 || len(d.IPv6) != 0 {
+		t.Errorf("Passes() = %t, %t; want true, false", ip4, ip6)
+	}
+}
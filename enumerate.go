@@ -0,0 +1,57 @@
+package spf
+
+import (
+	"net"
+	"sync"
+)
+
+// Candidate is an address considered by "a" or "mx" mechanism along with
+// the verdict for the checked IP.
+type Candidate struct {
+	Host    string     `json:"host"`    // name the address belongs to: the domain for "a", an MX name for "mx"
+	IP      net.IP     `json:"ip"`      // the address as found in DNS
+	Network *net.IPNet `json:"network"` // the address with the CIDR length of the mechanism applied
+	Matched bool       `json:"matched"` // the network contains the checked IP
+}
+
+// EnumerateIP looks up all A and AAAA records of the name the way "a"
+// mechanism does and returns every address found, unlike Resolver.MatchIP
+// which stops at the first match. Networks of the candidates have the masks
+// applied, nil masks stand for single addresses. Candidates found before
+// an error are returned along with it.
+func EnumerateIP(r Resolver, name string, ip net.IP, ip4Mask, ip6Mask net.IPMask) ([]Candidate, *ResponseExtras, error) {
+	return enumerate(r.MatchIP, NormalizeFQDN(name), ip, ip4Mask, ip6Mask)
+}
+
+// EnumerateMX looks up MX records of the name and addresses of all the MX
+// names the way "mx" mechanism does and returns every address found, see
+// EnumerateIP.
+func EnumerateMX(r Resolver, name string, ip net.IP, ip4Mask, ip6Mask net.IPMask) ([]Candidate, *ResponseExtras, error) {
+	return enumerate(r.MatchMX, NormalizeFQDN(name), ip, ip4Mask, ip6Mask)
+}
+
+func enumerate(match func(string, IPMatcherFunc) (bool, *ResponseExtras, error), name string, ip net.IP,
+	ip4Mask, ip6Mask net.IPMask) ([]Candidate, *ResponseExtras, error) {
+	if ip4Mask == nil {
+		ip4Mask = net.CIDRMask(32, 32)
+	}
+	if ip6Mask == nil {
+		ip6Mask = net.CIDRMask(128, 128)
+	}
+	var (
+		mu         sync.Mutex // matchers could be called concurrently
+		candidates []Candidate
+	)
+	_, extras, err := match(name, func(a net.IP, host string) (bool, error) {
+		n := &net.IPNet{IP: a, Mask: ip6Mask}
+		if len(a) == net.IPv4len {
+			n.Mask = ip4Mask
+		}
+		n.IP = n.IP.Mask(n.Mask)
+		mu.Lock()
+		candidates = append(candidates, Candidate{Host: NormalizeFQDN(host), IP: a, Network: n, Matched: n.Contains(ip)})
+		mu.Unlock()
+		return false, nil
+	})
+	return candidates, extras, err
+}
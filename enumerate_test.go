@@ -0,0 +1,54 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestEnumerate(t *testing.T) {
+	r, err := NewOverlayResolver(testResolver, map[string][]string{
+		"enum.example":     {"MX 10 mx1.enum.example.", "MX 20 mx2.enum.example.", "A 192.0.2.1"},
+		"mx1.enum.example": {"A 198.51.100.1", "AAAA 2001:db8::1"},
+		"mx2.enum.example": {"A 198.51.100.130", "A 198.51.100.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.ParseIP("198.51.100.2")
+
+	got, extras, err := EnumerateMX(r, "enum.example", ip, net.CIDRMask(25, 32), nil)
+	if err != nil || extras == nil || extras.Void {
+		t.Fatalf("EnumerateMX() = %v, %+v, %v", got, extras, err)
+	}
+	want := []struct {
+		host, network string
+		matched       bool
+	}{
+		{"mx1.enum.example.", "198.51.100.0/25", true},
+		{"mx1.enum.example.", "2001:db8::1/128", false},
+		{"mx2.enum.example.", "198.51.100.128/25", false},
+		{"mx2.enum.example.", "198.51.100.0/25", true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("EnumerateMX() = %v; want %d candidates", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Host != w.host || got[i].Network.String() != w.network || got[i].Matched != w.matched {
+			t.Errorf("candidate %d = %s %s %t; want %s %s %t", i, got[i].Host, got[i].Network, got[i].Matched,
+				w.host, w.network, w.matched)
+		}
+	}
+
+	got, _, err = EnumerateIP(r, "enum.example", ip, nil, nil)
+	if err != nil || len(got) != 1 || got[0].Host != "enum.example." || !got[0].IP.Equal(net.ParseIP("192.0.2.1")) ||
+		got[0].Matched {
+		t.Errorf("EnumerateIP() = %v, %v", got, err)
+	}
+
+	// the limit of MX addresses is reported with the candidates found
+	got, _, err = EnumerateMX(NewLimitedResolver(r, 10, 3), "enum.example", ip, nil, nil)
+	if len(got) != 2 || !errors.Is(err, ErrDNSLimitExceeded) {
+		t.Errorf("EnumerateMX() limited = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,194 @@
+package spf
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrorCode is a stable identifier of the error for machine consumption,
+// unlike error messages it never changes.
+type ErrorCode string
+
+// Codes of errors returned by evaluation
+const (
+	CodeUnknown            ErrorCode = "SPF_E_UNKNOWN"
+	CodeSyntax             ErrorCode = "SPF_E_SYNTAX"
+	CodeInvalidCIDR        ErrorCode = "SPF_E_INVALID_CIDR"
+	CodeMultipleRedirects  ErrorCode = "SPF_E_MULTIPLE_REDIRECTS"
+	CodeMultipleExps       ErrorCode = "SPF_E_MULTIPLE_EXPS"
+	CodeInvalidIP4         ErrorCode = "SPF_E_INVALID_IP4"
+	CodeInvalidIP6         ErrorCode = "SPF_E_INVALID_IP6"
+	CodeEmptyDomain        ErrorCode = "SPF_E_EMPTY_DOMAIN"
+	CodeInvalidDomain      ErrorCode = "SPF_E_INVALID_DOMAIN"
+	CodeStrayPunctuation   ErrorCode = "SPF_E_STRAY_PUNCTUATION"
+	CodeDuplicateAll       ErrorCode = "SPF_E_DUPLICATE_ALL"
+	CodeInvalidCharacter   ErrorCode = "SPF_E_INVALID_CHARACTER"
+	CodeTXTStringTooLong   ErrorCode = "SPF_E_TXT_STRING_TOO_LONG"
+	CodeInvalidMacro       ErrorCode = "SPF_E_INVALID_MACRO"
+	CodeDNSTemperror       ErrorCode = "SPF_E_DNS_TEMPERROR"
+	CodeDNSPermerror       ErrorCode = "SPF_E_DNS_PERMERROR"
+	CodeTooManyLookups     ErrorCode = "SPF_E_TOO_MANY_LOOKUPS"
+	CodeTooManyVoidLookups ErrorCode = "SPF_E_TOO_MANY_VOID_LOOKUPS"
+	CodeTimeout            ErrorCode = "SPF_E_TIMEOUT"
+	CodeDeadline           ErrorCode = "SPF_E_DEADLINE"
+	CodeNotFound           ErrorCode = "SPF_E_NOT_FOUND"
+	CodeMultipleRecords    ErrorCode = "SPF_E_MULTIPLE_RECORDS"
+	CodeLoop               ErrorCode = "SPF_E_LOOP"
+	CodeTooDeep            ErrorCode = "SPF_E_TOO_DEEP"
+	CodeTXTAnswerTooLarge  ErrorCode = "SPF_E_TXT_ANSWER_TOO_LARGE"
+	CodeTooManyMechanisms  ErrorCode = "SPF_E_TOO_MANY_MECHANISMS"
+	CodeTooManyMXNames     ErrorCode = "SPF_E_TOO_MANY_MX_NAMES"
+	CodeTooManyCNAMEs      ErrorCode = "SPF_E_TOO_MANY_CNAMES"
+	CodeTooManyErrors      ErrorCode = "SPF_E_TOO_MANY_ERRORS"
+	CodeUnreliableResult   ErrorCode = "SPF_E_UNRELIABLE_RESULT"
+)
+
+// ErrorCodeOf returns the code of the error, CodeUnknown if the error isn't
+// one of the errors of evaluation.
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.code
+		}
+	}
+	var de *DomainError
+	if errors.As(err, &de) {
+		return CodeInvalidDomain
+	}
+	return CodeUnknown
+}
+
+// Code returns the code of the error
+func (e SyntaxError) Code() ErrorCode {
+	return ErrorCodeOf(e)
+}
+
+// MarshalJSON renders the error with its kind, code, the faulty term, its
+// position in the record (see Position) and the message. The wrapped
+// SyntaxError or ErrorList, e.g. an error in the record of an included
+// domain, is rendered in "children".
+func (e SyntaxError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newErrorJSON(e))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Errors of evaluation are
+// restored so errors.Is, ErrorKindOf and ErrorCodeOf work as they did for
+// the marshaled error.
+func (e *SyntaxError) UnmarshalJSON(b []byte) error {
+	var j errorJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	err := j.error()
+	if se, ok := err.(SyntaxError); ok {
+		*e = se
+	} else {
+		*e = SyntaxError{err: err}
+	}
+	return nil
+}
+
+// errorJSON is JSON form of errors of evaluation
+type errorJSON struct {
+	Kind     ErrorKind    `json:"kind"`
+	Code     ErrorCode    `json:"code"`
+	Token    string       `json:"token,omitempty"`
+	Start    *int         `json:"start,omitempty"`
+	End      *int         `json:"end,omitempty"`
+	Message  string       `json:"message"`
+	Children []*errorJSON `json:"children,omitempty"`
+}
+
+func newErrorJSON(err error) *errorJSON {
+	if err == nil {
+		return nil
+	}
+	j := &errorJSON{Kind: ErrorKindOf(err), Code: ErrorCodeOf(err), Message: err.Error()}
+	switch e := err.(type) {
+	case SyntaxError:
+		start, end := e.Position()
+		j.Token, j.Start, j.End = e.token.String(), &start, &end
+		switch e.err.(type) {
+		case SyntaxError, ErrorList:
+			j.Children = []*errorJSON{newErrorJSON(e.err)}
+		}
+	case ErrorList:
+		for _, err := range e {
+			j.Children = append(j.Children, newErrorJSON(err))
+		}
+	}
+	return j
+}
+
+// error restores the error, errors of evaluation are matched by the code
+func (j *errorJSON) error() error {
+	if j == nil {
+		return nil
+	}
+	if j.Start == nil {
+		if len(j.Children) == 0 {
+			return codeError(j.Code, j.Message)
+		}
+		l := make(ErrorList, len(j.Children))
+		for i, c := range j.Children {
+			l[i] = c.error()
+		}
+		return l
+	}
+
+	var t *token
+	if tokens := lex(j.Token); len(tokens) > 0 {
+		t = tokens[0]
+		t.start = *j.Start
+		if j.End != nil {
+			t.end = *j.End
+		}
+	}
+	var err error
+	if len(j.Children) > 0 {
+		err = j.Children[0].error()
+	} else {
+		err = codeError(j.Code, strings.TrimSuffix(j.Message, " ["+j.Token+"]"))
+	}
+	return SyntaxError{t, err}
+}
+
+// codeError returns the error of evaluation with the code if it has the
+// message, the message wrapping the error of evaluation otherwise
+func codeError(code ErrorCode, message string) error {
+	if code == CodeInvalidDomain {
+		i := strings.Index(message, ": ")
+		if i < 0 {
+			return &DomainError{Err: message}
+		}
+		return &DomainError{Err: message[:i], Domain: message[i+2:]}
+	}
+	for _, k := range errorKinds {
+		if k.code != code {
+			continue
+		}
+		if k.err.Error() == message {
+			return k.err
+		}
+		return &codedError{message, k.err}
+	}
+	return errors.New(message)
+}
+
+// codedError is an unmarshaled error wrapping an error of evaluation
+type codedError struct {
+	message string
+	err     error
+}
+
+func (e *codedError) Error() string {
+	return e.message
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
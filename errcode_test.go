@@ -0,0 +1,90 @@
+package spf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorCode
+	}{
+		{nil, ""},
+		{errors.New("something"), CodeUnknown},
+		{ErrDNSLimitExceeded, CodeTooManyLookups},
+		{SyntaxError{&token{tInclude, qPlus, "a.example", 0, 0}, ErrLoopDetected}, CodeLoop},
+		{SyntaxError{&token{tIP4, qPlus, "10.0.0.0/33", 0, 0}, ErrInvalidCIDRLength}, CodeInvalidCIDR},
+		{fmt.Errorf("lookup: %w", ErrDNSTemperror), CodeDNSTemperror},
+		{newInvalidDomainError("a..example"), CodeInvalidDomain},
+	}
+	for _, test := range tests {
+		if got := ErrorCodeOf(test.err); got != test.want {
+			t.Errorf("ErrorCodeOf(%v) = %s; want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestSyntaxError_MarshalJSON(t *testing.T) {
+	err := SyntaxError{&token{tInclude, qPlus, "_spf.example.com", 7, 30},
+		SyntaxError{&token{tIP4, qMinus, "10.0.0.0/33", 7, 24}, ErrInvalidCIDRLength}}
+	b, e := json.Marshal(err)
+	if e != nil {
+		t.Fatalf("json.Marshal() error = %v", e)
+	}
+	want := `{"kind":"syntax","code":"SPF_E_INVALID_CIDR","token":"include:_spf.example.com","start":7,"end":30,` +
+		`"message":"invalid CIDR length [include:_spf.example.com -ip4:10.0.0.0/33]","children":[` +
+		`{"kind":"syntax","code":"SPF_E_INVALID_CIDR","token":"-ip4:10.0.0.0/33","start":7,"end":24,` +
+		`"message":"invalid CIDR length [-ip4:10.0.0.0/33]"}]}`
+	if string(b) != want {
+		t.Errorf("json.Marshal() =\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestSyntaxError_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		err  SyntaxError
+	}{
+		{"leaf", SyntaxError{&token{tIP4, qMinus, "10.0.0.0/33", 7, 24}, ErrInvalidCIDRLength}},
+		{"nested", SyntaxError{&token{tInclude, qPlus, "_spf.example.com", 7, 30},
+			SyntaxError{&token{tIP4, qMinus, "10.0.0.0/33", 7, 24}, ErrInvalidCIDRLength}}},
+		{"wrapped", SyntaxError{&token{tA, qTilde, "mail.example.com", 0, 21},
+			fmt.Errorf("lookup: %w", ErrDNSTemperror)}},
+		{"domain", SyntaxError{&token{tInclude, qPlus, "a..example", 0, 18}, newInvalidDomainError("a..example")}},
+		{"unknown", SyntaxError{&token{tMX, qPlus, "", 3, 5}, errors.New("something")}},
+		{"list", SyntaxError{&token{tInclude, qPlus, "_spf.example.com", 0, 24}, ErrorList{
+			SyntaxError{&token{tIP4, qPlus, "10.0.0.0/33", 7, 22}, ErrInvalidCIDRLength},
+			SyntaxError{&token{tAll, qPlus, "", 23, 26}, ErrDuplicateAll},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.err)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var got SyntaxError
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("json.Unmarshal(%s) error = %v", b, err)
+			}
+			if got.Error() != tt.err.Error() {
+				t.Errorf("Error() = %q; want %q", got.Error(), tt.err.Error())
+			}
+			if ErrorCodeOf(got) != ErrorCodeOf(tt.err) || ErrorKindOf(got) != ErrorKindOf(tt.err) {
+				t.Errorf("code, kind = %s, %s; want %s, %s", ErrorCodeOf(got), ErrorKindOf(got),
+					ErrorCodeOf(tt.err), ErrorKindOf(tt.err))
+			}
+			gs, ge := got.Position()
+			ws, we := tt.err.Position()
+			if gs != ws || ge != we {
+				t.Errorf("Position() = %d, %d; want %d, %d", gs, ge, ws, we)
+			}
+			if again, _ := json.Marshal(got); string(again) != string(b) {
+				t.Errorf("json.Marshal() after round trip =\n%s\nwant\n%s", again, b)
+			}
+		})
+	}
+}
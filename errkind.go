@@ -0,0 +1,183 @@
+package spf
+
+import (
+	"errors"
+)
+
+// ErrorKind is a broad category of errors encountered during evaluation.
+type ErrorKind int
+
+const (
+	// KindOther is any error not falling into other categories
+	KindOther ErrorKind = iota
+	// KindSyntax is a malformed SPF record or term
+	KindSyntax
+	// KindDNS is a failed DNS lookup or exceeded limit of lookups
+	KindDNS
+	// KindValidation is a well-formed policy which can't be evaluated:
+	// missing or multiple records, loops, invalid domain names
+	KindValidation
+
+	numErrorKinds = int(KindValidation) + 1
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindSyntax:
+		return "syntax"
+	case KindDNS:
+		return "dns"
+	case KindValidation:
+		return "validation"
+	default:
+		return "other"
+	}
+}
+
+func (k ErrorKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *ErrorKind) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "syntax":
+		*k = KindSyntax
+	case "dns":
+		*k = KindDNS
+	case "validation":
+		*k = KindValidation
+	default:
+		*k = KindOther
+	}
+	return nil
+}
+
+var errorKinds = []struct {
+	err  error
+	kind ErrorKind
+	code ErrorCode
+}{
+	{ErrSyntaxError, KindSyntax, CodeSyntax},
+	{ErrInvalidCIDRLength, KindSyntax, CodeInvalidCIDR},
+	{ErrTooManyRedirects, KindSyntax, CodeMultipleRedirects},
+	{ErrTooManyExps, KindSyntax, CodeMultipleExps},
+	{ErrNotIPv4, KindSyntax, CodeInvalidIP4},
+	{ErrNotIPv6, KindSyntax, CodeInvalidIP6},
+	{ErrEmptyDomain, KindSyntax, CodeEmptyDomain},
+	{ErrStrayPunctuation, KindSyntax, CodeStrayPunctuation},
+	{ErrDuplicateAll, KindSyntax, CodeDuplicateAll},
+	{ErrInvalidCharacter, KindSyntax, CodeInvalidCharacter},
+	{ErrTXTStringTooLong, KindSyntax, CodeTXTStringTooLong},
+	{ErrInvalidMacro, KindSyntax, CodeInvalidMacro},
+	{ErrDNSTemperror, KindDNS, CodeDNSTemperror},
+	{ErrDNSPermerror, KindDNS, CodeDNSPermerror},
+	{ErrDNSLimitExceeded, KindDNS, CodeTooManyLookups},
+	{ErrTooManyVoidLookups, KindDNS, CodeTooManyVoidLookups},
+	{ErrTooManyCNAMEs, KindDNS, CodeTooManyCNAMEs},
+	{ErrMechanismTimeout, KindDNS, CodeTimeout},
+	{ErrDeadlineExceeded, KindDNS, CodeDeadline},
+	{ErrSPFNotFound, KindValidation, CodeNotFound},
+	{ErrTooManySPFRecords, KindValidation, CodeMultipleRecords},
+	{ErrLoopDetected, KindValidation, CodeLoop},
+	{ErrTooDeep, KindValidation, CodeTooDeep},
+	{ErrTXTAnswerTooLarge, KindValidation, CodeTXTAnswerTooLarge},
+	{ErrTooManyMechanisms, KindValidation, CodeTooManyMechanisms},
+	{ErrTooManyMXNames, KindValidation, CodeTooManyMXNames},
+	{ErrTooManyErrors, KindOther, CodeTooManyErrors},
+	{ErrUnreliableResult, KindOther, CodeUnreliableResult},
+}
+
+// ErrorKindOf returns the category of the error.
+func ErrorKindOf(err error) ErrorKind {
+	if err == nil {
+		return KindOther
+	}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.kind
+		}
+	}
+	var de *DomainError
+	if errors.As(err, &de) {
+		return KindValidation
+	}
+	return KindOther
+}
+
+// temporaryErrors are errors of evaluation which could go away if the check
+// is retried later, the result is Temperror
+var temporaryErrors = []error{ErrDNSTemperror, ErrMechanismTimeout, ErrDeadlineExceeded, ErrAborted, errCanceled}
+
+// IsTemporary returns true if the error is transient, e.g. DNS lookup timed
+// out, so the check should be retried later and the transaction deferred
+// with 4xx reply. Errors implementing Temporary() bool, as net.Error does,
+// are reported by the method.
+func IsTemporary(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, e := range temporaryErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	var t interface{ Temporary() bool }
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// IsPolicyError returns true if the error is caused by the published policy
+// of the domain, e.g. malformed record, too many DNS lookups or records, or
+// its absence. Retrying won't change the result, Permerror (None if the
+// checked domain has no record), so the transaction could be rejected with
+// 5xx reply.
+func IsPolicyError(err error) bool {
+	if err == nil || IsTemporary(err) {
+		return false
+	}
+	switch {
+	case errors.Is(err, ErrTooManyErrors), errors.Is(err, ErrUnreliableResult):
+		// the options of the check, not the policy
+		return false
+	}
+	switch ErrorKindOf(err) {
+	case KindSyntax, KindValidation:
+		return true
+	case KindDNS:
+		return errors.Is(err, ErrDNSPermerror) || errors.Is(err, ErrDNSLimitExceeded) ||
+			errors.Is(err, ErrTooManyVoidLookups) || errors.Is(err, ErrTooManyCNAMEs)
+	default:
+		return false
+	}
+}
+
+// ErrorsThresholdByKind stops evaluation in walker mode (see IgnoreMatches)
+// after the number of errors of a kind reaches its limit, e.g. to stop after
+// two syntax errors while tolerating DNS failures:
+//
+//	spf.ErrorsThresholdByKind(map[spf.ErrorKind]int{spf.KindSyntax: 2})
+//
+// Errors of kinds missing in limits are not limited. It could be combined
+// with ErrorsThreshold.
+func ErrorsThresholdByKind(limits map[ErrorKind]int) Option {
+	return func(p *parser) {
+		p.errorLimits = limits
+	}
+}
+
+// errorsExceeded accounts the error of a term and checks it against limits
+// of ErrorsThresholdByKind
+func (p *parser) errorsExceeded(err error) bool {
+	if p.errorLimits == nil || err == nil {
+		return false
+	}
+	switch {
+	case errors.Is(err, ErrTooManyErrors):
+		return true
+	case errors.Is(err, ErrUnreliableResult):
+		return false
+	}
+	k := ErrorKindOf(err)
+	p.counters.errors[k]++
+	limit, ok := p.errorLimits[k]
+	return ok && p.counters.errors[k] >= limit
+}
@@ -0,0 +1,108 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestErrorKindOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorKind
+	}{
+		{nil, KindOther},
+		{errors.New("something"), KindOther},
+		{ErrSyntaxError, KindSyntax},
+		{SyntaxError{&token{tIP4, qPlus, "10.0.0.300", 0, 0}, ErrSyntaxError}, KindSyntax},
+		{SyntaxError{&token{tInclude, qPlus, "a.example", 0, 0},
+			SyntaxError{&token{tA, qPlus, "", 0, 0}, ErrDNSTemperror}}, KindDNS},
+		{ErrTooManyVoidLookups, KindDNS},
+		{fmt.Errorf("lookup: %w", ErrDNSPermerror), KindDNS},
+		{ErrLoopDetected, KindValidation},
+		{SyntaxError{&token{tMX, qPlus, "a.example", 0, 0}, ErrTooManyMXNames}, KindValidation},
+		{newInvalidDomainError("a..example"), KindValidation},
+	}
+	for _, test := range tests {
+		if got := ErrorKindOf(test.err); got != test.want {
+			t.Errorf("ErrorKindOf(%v) = %s; want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestIsTemporary_IsPolicyError(t *testing.T) {
+	tests := []struct {
+		err       error
+		temporary bool
+		policy    bool
+	}{
+		{nil, false, false},
+		{errors.New("something"), false, false},
+		{ErrDNSTemperror, true, false},
+		{SyntaxError{&token{tInclude, qPlus, "a.example", 0, 0},
+			SyntaxError{&token{tA, qPlus, "", 0, 0}, ErrDNSTemperror}}, true, false},
+		{SyntaxError{&token{tA, qPlus, "", 0, 0}, ErrMechanismTimeout}, true, false},
+		{ErrDeadlineExceeded, true, false},
+		{ErrAborted, true, false},
+		{&net.DNSError{Err: "timeout", IsTimeout: true, IsTemporary: true}, true, false},
+		{&net.DNSError{Err: "no such host", IsNotFound: true}, false, false},
+		{ErrDNSPermerror, false, true},
+		{ErrDNSLimitExceeded, false, true},
+		{ErrTooManyVoidLookups, false, true},
+		{SyntaxError{&token{tIP4, qPlus, "10.0.0.0/33", 0, 0}, ErrInvalidCIDRLength}, false, true},
+		{ErrTooManySPFRecords, false, true},
+		{ErrSPFNotFound, false, true},
+		{newInvalidDomainError("a..example"), false, true},
+		{ErrorList{ErrDNSTemperror, ErrSyntaxError}, true, false},
+		{ErrTooManyErrors, false, false},
+		{ErrUnreliableResult, false, false},
+	}
+	for _, test := range tests {
+		if got := IsTemporary(test.err); got != test.temporary {
+			t.Errorf("IsTemporary(%v) = %t; want %t", test.err, got, test.temporary)
+		}
+		if got := IsPolicyError(test.err); got != test.policy {
+			t.Errorf("IsPolicyError(%v) = %t; want %t", test.err, got, test.policy)
+		}
+	}
+}
+
+func TestErrorsThresholdByKind(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("kinds.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`kinds.example. 0 IN TXT "v=spf1 include:none.kinds.example include:none.kinds.example ip4:10.0.0.300 ip6:10.0.0.1 a -all"`,
+		},
+	}))
+	defer dns.HandleRemove("kinds.example.")
+
+	dns.HandleFunc("none.kinds.example.", zone(map[uint16][]string{}))
+	defer dns.HandleRemove("none.kinds.example.")
+
+	tests := []struct {
+		limits  map[ErrorKind]int
+		terms   int
+		stopped bool
+		byKind  map[ErrorKind]int
+	}{
+		{nil, 6, false, map[ErrorKind]int{KindValidation: 2, KindSyntax: 2}},
+		{map[ErrorKind]int{KindSyntax: 2}, 4, true, map[ErrorKind]int{KindValidation: 2, KindSyntax: 2}},
+		{map[ErrorKind]int{KindValidation: 1}, 1, true, map[ErrorKind]int{KindValidation: 1}},
+		{map[ErrorKind]int{KindDNS: 1}, 6, false, map[ErrorKind]int{KindValidation: 2, KindSyntax: 2}},
+	}
+
+	for no, test := range tests {
+		t.Run(fmt.Sprint(no), func(t *testing.T) {
+			in := InspectHost(net.ParseIP("10.0.0.1"), "kinds.example", "",
+				WithResolver(testResolver), ErrorsThresholdByKind(test.limits))
+			if len(in.Terms) != test.terms || in.Stopped != test.stopped || fmt.Sprint(in.ByKind) != fmt.Sprint(test.byKind) {
+				t.Errorf("InspectHost() = %d terms, stopped %t, %v; want %d, %t, %v",
+					len(in.Terms), in.Stopped, in.ByKind, test.terms, test.stopped, test.byKind)
+			}
+		})
+	}
+}
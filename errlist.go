@@ -0,0 +1,44 @@
+package spf
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrorList is a list of errors collected in one pass, e.g. errors of every
+// term visited by InspectHost. Errors of terms are SyntaxError holding
+// the faulty term.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	s := make([]string, len(l))
+	for i, err := range l {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Unwrap returns the errors of the list.
+func (l ErrorList) Unwrap() []error {
+	return l
+}
+
+// Is reports whether any error of the list matches target.
+func (l ErrorList) Is(target error) bool {
+	for _, err := range l {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of the list that matches target.
+func (l ErrorList) As(target interface{}) bool {
+	for _, err := range l {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
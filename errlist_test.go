@@ -0,0 +1,31 @@
+package spf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorList(t *testing.T) {
+	l := ErrorList{
+		SyntaxError{&token{tIP4, qPlus, "10.0.0.300", 7, 21}, ErrSyntaxError},
+		SyntaxError{&token{tInclude, qPlus, "a..example", 22, 40}, newInvalidDomainError("a..example")},
+	}
+
+	want := "wrong syntax [ip4:10.0.0.300]; invalid domain name: a..example [include:a..example]"
+	if got := l.Error(); got != want {
+		t.Errorf("Error() = %q; want %q", got, want)
+	}
+	if len(l.Unwrap()) != 2 {
+		t.Errorf("len(Unwrap()) = %d; want 2", len(l.Unwrap()))
+	}
+	if !errors.Is(l, ErrSyntaxError) || errors.Is(l, ErrLoopDetected) {
+		t.Errorf("errors.Is() doesn't check every error of the list")
+	}
+	if !errors.Is(l, SyntaxError{&token{tInclude, qPlus, "a..example", 0, 0}, nil}) {
+		t.Errorf("errors.Is() doesn't match the term of the second error")
+	}
+	var de *DomainError
+	if !errors.As(l, &de) || de.Domain != "a..example" {
+		t.Errorf("errors.As() = %v; want DomainError", de)
+	}
+}
@@ -0,0 +1,165 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrAborted is returned (wrapped into SyntaxError of the directive not
+// evaluated) when Evaluation is aborted, the result is Temperror.
+var ErrAborted = errors.New("evaluation aborted")
+
+// Directive is a directive Evaluation is about to evaluate.
+type Directive struct {
+	Domain string // domain which record has the directive
+	Depth  int    // number of "include" and "redirect" the domain is reached through
+	Term   string // the directive as published
+}
+
+// Evaluation is a check made one directive at a time, so embedders can
+// interleave evaluation of large records with their own scheduling and
+// stop it once it's no longer needed. "redirect" modifiers are stepped
+// through as directives as well.
+//
+// The check runs in a goroutine of its own which waits between directives,
+// time waiting counts against WithOverallDeadline and WithMechanismTimeout.
+// ConcurrentIncludes is ignored. Methods of Evaluation must not be called
+// concurrently.
+//
+// Once started, the evaluation must be finished with Result or Abort, the
+// goroutine and the resources of the check are held until then. Canceling
+// the context given with WithContext aborts the evaluation as Abort does, so
+// evaluations tied to a request are released with it.
+type Evaluation struct {
+	ip     net.IP
+	domain string
+	sender string
+	opts   []Option
+
+	next    chan Directive
+	proceed chan struct{}
+	aborted chan struct{}
+	done    chan struct{}
+	ctx     context.Context // of WithContext, set by the check
+	abort   sync.Once
+	started bool
+	pending bool // the directive returned waits to be evaluated
+
+	result      Result
+	explanation string
+	spf         string
+	err         error
+}
+
+// Evaluate returns Evaluation of the check CheckHost would make, nothing is
+// evaluated until NextDirective or Result is called.
+func Evaluate(ip net.IP, domain, sender string, opts ...Option) *Evaluation {
+	e := &Evaluation{
+		ip:      ip,
+		domain:  domain,
+		sender:  sender,
+		next:    make(chan Directive),
+		proceed: make(chan struct{}),
+		aborted: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	e.opts = append(opts[:len(opts):len(opts)], func(p *parser) {
+		p.step = e.step
+		p.concurrency = 0
+		e.ctx = p.ctx
+	})
+	return e
+}
+
+func (e *Evaluation) start() {
+	if e.started {
+		return
+	}
+	e.started = true
+	go func() {
+		defer close(e.done)
+		e.result, e.explanation, e.spf, e.err = CheckHost(e.ip, e.domain, e.sender, e.opts...)
+	}()
+}
+
+// step is called by the parsers of the evaluation before each directive,
+// it returns false if the evaluation is aborted or its context is done
+func (e *Evaluation) step(d Directive) bool {
+	var cancel <-chan struct{}
+	if e.ctx != nil {
+		cancel = e.ctx.Done()
+	}
+	select {
+	case e.next <- d:
+	case <-e.aborted:
+		return false
+	case <-cancel:
+		return false
+	}
+	select {
+	case <-e.proceed:
+		return true
+	case <-e.aborted:
+		return false
+	case <-cancel:
+		return false
+	}
+}
+
+// NextDirective lets the directive returned by the previous call be
+// evaluated and returns the directive to be evaluated next. It returns
+// false once the evaluation is done, Result returns its outcome then.
+func (e *Evaluation) NextDirective() (Directive, bool) {
+	e.start()
+	if e.pending {
+		e.pending = false
+		select {
+		case e.proceed <- struct{}{}:
+		case <-e.done:
+			return Directive{}, false
+		}
+	}
+	select {
+	case d := <-e.next:
+		e.pending = true
+		return d, true
+	case <-e.done:
+		return Directive{}, false
+	}
+}
+
+// Abort stops the evaluation before the pending directive, the result is
+// Temperror with ErrAborted. Abort returns once the evaluation is done.
+func (e *Evaluation) Abort() {
+	e.abort.Do(func() {
+		close(e.aborted)
+	})
+	e.start()
+	<-e.done
+}
+
+// Result evaluates the remaining directives and returns the outcome as
+// CheckHost does.
+func (e *Evaluation) Result() (Result, string, string, error) {
+	for {
+		if _, ok := e.NextDirective(); !ok {
+			break
+		}
+	}
+	return e.result, e.explanation, e.spf, e.err
+}
+
+// proceed waits for the evaluation the parser belongs to stepping to the
+// term, it returns false if the evaluation is aborted
+func (p *parser) proceed(t *token) bool {
+	if p.step == nil || t.mechanism == tVersion {
+		return true
+	}
+	return p.step(Directive{
+		Domain: NormalizeFQDN(p.domain),
+		Depth:  len(p.visited.s) - 1,
+		Term:   t.String(),
+	})
+}
@@ -0,0 +1,114 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestEvaluation(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("evaluation.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`evaluation.example. 300 IN TXT "v=spf1 ip4:10.0.0.0/24 include:inc.evaluation.example redirect=other.evaluation.example"`,
+		},
+	}))
+	defer dns.HandleRemove("evaluation.example.")
+
+	dns.HandleFunc("inc.evaluation.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.evaluation.example. 300 IN TXT "v=spf1 ip4:10.0.1.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.evaluation.example.")
+
+	dns.HandleFunc("other.evaluation.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`other.evaluation.example. 300 IN TXT "v=spf1 ip4:10.0.2.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("other.evaluation.example.")
+
+	all := []Directive{
+		{"evaluation.example.", 0, "ip4:10.0.0.0/24"},
+		{"evaluation.example.", 0, "include:inc.evaluation.example"},
+		{"inc.evaluation.example.", 1, "ip4:10.0.1.0/24"},
+		{"inc.evaluation.example.", 1, "-all"},
+		{"evaluation.example.", 0, "redirect=other.evaluation.example"},
+		{"other.evaluation.example.", 1, "ip4:10.0.2.0/24"},
+	}
+	tests := []struct {
+		ip         string
+		directives []Directive
+		result     Result
+	}{
+		{"10.0.0.1", all[:1], Pass},
+		{"10.0.1.1", all[:3], Pass},
+		{"10.0.2.1", all, Pass},
+		{"10.0.3.1", append(all[:len(all):len(all)], Directive{"other.evaluation.example.", 1, "-all"}), Fail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			e := Evaluate(ip, "evaluation.example", "", WithResolver(testResolver), ConcurrentIncludes(2))
+			var got []Directive
+			for {
+				d, ok := e.NextDirective()
+				if !ok {
+					break
+				}
+				got = append(got, d)
+			}
+			if !reflect.DeepEqual(got, tt.directives) {
+				t.Errorf("directives = %v; want %v", got, tt.directives)
+			}
+			r, _, spf, err := e.Result()
+			want, _, wantSPF, wantErr := CheckHost(ip, "evaluation.example", "", WithResolver(testResolver))
+			if r != tt.result || r != want || spf != wantSPF || err != wantErr {
+				t.Errorf("Result() = %s, %q, %v; want %s, %q, %v", r, spf, err, want, wantSPF, wantErr)
+			}
+		})
+	}
+
+	t.Run("abort", func(t *testing.T) {
+		e := Evaluate(net.ParseIP("10.0.3.1"), "evaluation.example", "", WithResolver(testResolver))
+		for i := 0; i < 3; i++ {
+			if _, ok := e.NextDirective(); !ok {
+				t.Fatalf("NextDirective() #%d is done", i)
+			}
+		}
+		e.Abort()
+		if _, ok := e.NextDirective(); ok {
+			t.Error("NextDirective() after Abort() is not done")
+		}
+		r, _, _, err := e.Result()
+		var se SyntaxError
+		if r != Temperror || !errors.Is(err, ErrAborted) || !errors.As(err, &se) || se.TokenString() != "include:inc.evaluation.example" {
+			t.Errorf("Result() = %s, %v; want %s, %v of the include", r, err, Temperror, ErrAborted)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		e := Evaluate(net.ParseIP("10.0.3.1"), "evaluation.example", "", WithResolver(testResolver), WithContext(ctx))
+		if _, ok := e.NextDirective(); !ok {
+			t.Fatal("NextDirective() is done")
+		}
+		cancel()
+		select {
+		case <-e.done:
+		case <-time.After(time.Second):
+			t.Fatal("evaluation is not released on cancel")
+		}
+		r, _, _, err := e.Result()
+		if r != Temperror || !errors.Is(err, ErrAborted) {
+			t.Errorf("Result() = %s, %v; want %s, %v", r, err, Temperror, ErrAborted)
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/redsift/spf"
+)
+
+// Filter checks SMTP sessions against SPF and maps results to the
+// actions of the Postfix policy delegation protocol
+// http://www.postfix.org/SMTPD_POLICY_README.html
+type Filter struct {
+	Resolver spf.Resolver // shared caching resolver, lookup limits are applied per check
+	Receiver string       // the host name of the SPF verifier
+	Pins     *spf.Pins    // policies pinned by operators, optional
+	Metrics  *expvar.Map  // counters of results and DNS lookups, optional
+}
+
+// Request is the part of a policy delegation request relevant to SPF
+type Request struct {
+	ClientAddress string // client_address
+	HeloName      string // helo_name
+	Sender        string // sender
+}
+
+// Decision is the outcome of a check
+type Decision struct {
+	Trace  spf.Trace
+	Action string // policy delegation action, e.g. "PREPEND Received-SPF: pass ..." or "550 5.7.23 ..."
+}
+
+// Check evaluates SPF for the request. MAIL FROM identity is checked unless
+// the sender is empty (bounces), HELO identity is checked otherwise.
+func (f *Filter) Check(req Request) Decision {
+	t := spf.Trace{
+		ClientIP:     net.ParseIP(req.ClientAddress),
+		Helo:         req.HeloName,
+		EnvelopeFrom: req.Sender,
+		Receiver:     f.Receiver,
+		Identity:     "mailfrom",
+	}
+	sender := req.Sender
+	if sender == "" {
+		t.Identity = "helo"
+		sender = "postmaster@" + req.HeloName
+	}
+	domain := sender[strings.LastIndexByte(sender, '@')+1:]
+
+	l := &filterListener{metrics: f.Metrics}
+	opts := []spf.Option{
+		spf.WithResolver(spf.NewLimitedResolver(f.Resolver, 10, 10)),
+		spf.WithListener(l),
+		spf.WithPins(f.Pins),
+		spf.HeloDomain(req.HeloName),
+		spf.ReceivingFQDN(f.Receiver),
+	}
+	if t.ClientIP == nil {
+		t.Result, t.Problem = spf.None, fmt.Errorf("invalid client address %q", req.ClientAddress)
+	} else {
+		t.Result, t.Explanation, _, t.Problem = spf.CheckHost(t.ClientIP, domain, sender, opts...)
+	}
+	t.Pinned = l.pinned
+	t.Mechanism = l.matched
+	f.count("result."+t.Result.String(), 1)
+
+	return Decision{Trace: t, Action: action(&t)}
+}
+
+// action maps SPF result to SMTP reply as recommended by RFC 7208 section 8
+// using enhanced status codes of RFC 7372
+func action(t *spf.Trace) string {
+	switch t.Result {
+	case spf.Fail:
+		text := t.Explanation
+		if text == "" {
+			text = "SPF check failed"
+		}
+		return "550 5.7.23 " + text
+	case spf.Temperror:
+		return "451 4.7.24 SPF temporary error"
+	case spf.Permerror:
+		return "550 5.7.24 SPF permanent error"
+	default:
+		return "PREPEND Received-SPF: " + t.ReceivedSPF()
+	}
+}
+
+func (f *Filter) count(key string, delta int64) {
+	if f.Metrics != nil {
+		f.Metrics.Add(key, delta)
+	}
+}
+
+// Serve handles policy delegation requests read from r until EOF
+func (f *Filter) Serve(r io.Reader, w io.Writer) error {
+	s := bufio.NewScanner(r)
+	var req Request
+	for s.Scan() {
+		line := s.Text()
+		if line != "" {
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "client_address":
+				req.ClientAddress = kv[1]
+			case "helo_name":
+				req.HeloName = kv[1]
+			case "sender":
+				req.Sender = kv[1]
+			}
+			continue
+		}
+		d := f.Check(req)
+		if _, err := fmt.Fprintf(w, "action=%s\n\n", d.Action); err != nil {
+			return err
+		}
+		req = Request{}
+	}
+	return s.Err()
+}
+
+// filterListener collects details of the evaluation not returned by
+// CheckHost, it implements optional spf.PinListener and spf.ExtrasListener
+type filterListener struct {
+	mu      sync.Mutex
+	metrics *expvar.Map
+	depth   int
+	matched string
+	pinned  string
+}
+
+func (l *filterListener) CheckHost(net.IP, string, string) {
+	l.mu.Lock()
+	l.depth++
+	l.mu.Unlock()
+}
+
+func (l *filterListener) CheckHostResult(spf.Result, string, error) {
+	l.mu.Lock()
+	l.depth--
+	l.mu.Unlock()
+}
+
+func (l *filterListener) SPFRecord(string)                                                     {}
+func (l *filterListener) Directive(bool, string, string, string, string)                       {}
+func (l *filterListener) NonMatch(string, string, string, spf.Result, error)                   {}
+func (l *filterListener) MatchingIP(string, string, string, string, net.IPNet, string, net.IP) {}
+
+func (l *filterListener) Match(qualifier, mechanism, value string, _ spf.Result, _ string, _ error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.depth == 1 {
+		l.matched = mechanism
+	}
+}
+
+func (l *filterListener) Pinned(_ string, pin spf.Pin) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pinned = pin.String()
+}
+
+func (l *filterListener) LookupExtras(_, _, _, _ string, extras *spf.ResponseExtras) {
+	if l.metrics == nil {
+		return
+	}
+	l.metrics.Add("dns.lookups", 1)
+	if extras.Void {
+		l.metrics.Add("dns.void", 1)
+	}
+}
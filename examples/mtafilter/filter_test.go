@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"expvar"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/redsift/spf"
+)
+
+func newTestFilter(t *testing.T, records map[string][]string) (*Filter, func()) {
+	t.Helper()
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		rrs, ok := records[q.Name]
+		if !ok {
+			m.SetRcode(req, dns.RcodeNameError)
+		}
+		for _, s := range rrs {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				t.Errorf("bad record %q: %v", s, err)
+				continue
+			}
+			if rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		_ = w.WriteMsg(m)
+	})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	s := &dns.Server{PacketConn: pc, Handler: mux, ReadTimeout: time.Second, WriteTimeout: time.Second,
+		NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = s.ActivateAndServe() }()
+	<-started
+
+	r, err := spf.NewMiekgDNSResolver(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := new(expvar.Map).Init()
+	return &Filter{Resolver: r, Receiver: "mx.example.net", Pins: spf.NewPins(), Metrics: m},
+		func() { _ = s.Shutdown() }
+}
+
+func TestFilter_Serve(t *testing.T) {
+	f, stop := newTestFilter(t, map[string][]string{
+		"example.com.": {
+			`example.com. 300 IN TXT "v=spf1 ip4:192.0.2.0/24 include:_spf.example.com exp=exp.example.com -all"`,
+		},
+		"_spf.example.com.": {
+			`_spf.example.com. 300 IN TXT "v=spf1 a:mail.example.com ~all"`,
+		},
+		"mail.example.com.": {
+			`mail.example.com. 300 IN A 198.51.100.1`,
+			`mail.example.com. 300 IN TXT "v=spf1 a -all"`,
+		},
+		"exp.example.com.": {
+			`exp.example.com. 300 IN TXT "%{i} is not one of %{d}'s designated mail servers"`,
+		},
+		"broken.example.com.": {
+			`broken.example.com. 300 IN TXT "v=spf1 include:nowhere.example.com -all"`,
+		},
+		"vendor.example.org.": {
+			`vendor.example.org. 300 IN TXT "v=spf1 -all"`,
+		},
+	})
+	defer stop()
+	f.Pins.Pin(spf.Pin{Domain: "vendor.example.org", Record: "v=spf1 ip4:203.0.113.0/24 -all", Reason: "INC-42"})
+
+	tests := []struct {
+		name    string
+		request string
+		action  string
+	}{
+		{"pass",
+			"client_address=192.0.2.10\nhelo_name=mail.example.com\nsender=john@example.com\n\n",
+			"action=PREPEND Received-SPF: pass (mx.example.net: domain of john@example.com designates 192.0.2.10 as permitted sender) client-ip=192.0.2.10; identity=mailfrom; helo=mail.example.com; envelope-from=\"john@example.com\"; receiver=mx.example.net; mechanism=ip4\n\n"},
+		{"pass via include",
+			"client_address=198.51.100.1\nhelo_name=mail.example.com\nsender=john@example.com\n\n",
+			"action=PREPEND Received-SPF: pass (mx.example.net: domain of john@example.com designates 198.51.100.1 as permitted sender) client-ip=198.51.100.1; identity=mailfrom; helo=mail.example.com; envelope-from=\"john@example.com\"; receiver=mx.example.net; mechanism=include\n\n"},
+		{"fail with explanation",
+			"client_address=203.0.113.1\nhelo_name=mail.example.com\nsender=john@example.com\n\n",
+			"action=550 5.7.23 203.0.113.1 is not one of example.com's designated mail servers\n\n"},
+		{"helo identity",
+			"client_address=198.51.100.1\nhelo_name=mail.example.com\nsender=\n\n",
+			"action=PREPEND Received-SPF: pass (mx.example.net: domain of sender designates 198.51.100.1 as permitted sender) client-ip=198.51.100.1; identity=helo; helo=mail.example.com; receiver=mx.example.net; mechanism=a\n\n"},
+		{"permerror",
+			"client_address=192.0.2.10\nsender=john@broken.example.com\n\n",
+			"action=550 5.7.24 SPF permanent error\n\n"},
+		{"none",
+			"client_address=192.0.2.10\nsender=john@unknown.example.com\n\n",
+			"action=PREPEND Received-SPF: none (mx.example.net: domain of john@unknown.example.com does not have an SPF record or the SPF record does not evaluate to a result) client-ip=192.0.2.10; problem=\"permanent DNS error\"; identity=mailfrom; envelope-from=\"john@unknown.example.com\"; receiver=mx.example.net\n\n"},
+		{"pinned",
+			"client_address=203.0.113.1\nsender=john@vendor.example.org\n\n",
+			"action=PREPEND Received-SPF: pass (mx.example.net: domain of john@vendor.example.org designates 203.0.113.1 as permitted sender) (pinned: vendor.example.org pinned to \"v=spf1 ip4:203.0.113.0/24 -all\": INC-42) client-ip=203.0.113.1; identity=mailfrom; envelope-from=\"john@vendor.example.org\"; receiver=mx.example.net; mechanism=ip4\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w bytes.Buffer
+			if err := f.Serve(strings.NewReader(tt.request), &w); err != nil {
+				t.Fatalf("Serve() error = %v", err)
+			}
+			if w.String() != tt.action {
+				t.Errorf("Serve() =\n%q\nwant\n%q", w.String(), tt.action)
+			}
+		})
+	}
+
+	if got := f.Metrics.Get("result.pass").String(); got != "4" {
+		t.Errorf("result.pass = %s; want 4", got)
+	}
+	if f.Metrics.Get("dns.lookups") == nil || f.Metrics.Get("dns.void") == nil {
+		t.Errorf("no DNS metrics: %s", f.Metrics)
+	}
+}
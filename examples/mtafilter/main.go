@@ -0,0 +1,59 @@
+// Command mtafilter is an SPF policy service for Postfix.
+// It wires CheckHost with a caching resolver, lookup limits, metrics,
+// "Received-SPF" header insertion and SMTP reply mapping.
+//
+//	smtpd_recipient_restrictions = ... check_policy_service inet:127.0.0.1:10030
+package main
+
+import (
+	"expvar"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/bluele/gcache"
+	"github.com/redsift/spf"
+)
+
+func main() {
+	var (
+		listen   = flag.String("listen", "127.0.0.1:10030", "policy service address")
+		metrics  = flag.String("metrics", "127.0.0.1:10031", "address to serve /debug/vars on")
+		dns      = flag.String("dns", "127.0.0.1:53", "recursive DNS server address")
+		receiver = flag.String("receiver", "", "the host name of the SPF verifier")
+	)
+	flag.Parse()
+
+	r, err := spf.NewMiekgDNSResolver(*dns, spf.MiekgDNSCache(gcache.New(10000).LRU().Build()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	f := &Filter{
+		Resolver: r,
+		Receiver: *receiver,
+		Pins:     spf.NewPins(),
+		Metrics:  expvar.NewMap("spf"),
+	}
+
+	go func() {
+		log.Println(http.ListenAndServe(*metrics, nil))
+	}()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			defer c.Close()
+			if err := f.Serve(c, c); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+}
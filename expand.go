@@ -0,0 +1,50 @@
+package spf
+
+import (
+	"net"
+	"time"
+)
+
+// MacroContext holds values macros of SPF record are expanded with.
+// https://tools.ietf.org/html/rfc7208#section-7.2
+type MacroContext struct {
+	Sender    string    // <sender>, %{s}, %{l} and %{o}
+	Domain    string    // <domain>, %{d}
+	HELO      string    // HELO/EHLO domain, %{h}
+	IP        net.IP    // <ip>, %{i}, %{v} and %{c}
+	Receiver  string    // domain name of the host performing the check, %{r}
+	Timestamp time.Time // current timestamp, %{t}
+	Exp       bool      // expand "exp" text, where %{c}, %{r} and %{t} are allowed
+	Partial   bool      // keep unresolved macros as placeholders, see PartialMacros
+	Escapes   bool      // expand escapes in partial mode, see ExpandEscapes
+}
+
+// MissingMacro is a macro which value is absent in MacroContext, the macro is
+// expanded to an empty string, or kept as is in partial mode.
+type MissingMacro struct {
+	Letter       string `json:"letter"`                 // lowercased macro letter
+	Transformers string `json:"transformers,omitempty"` // digits and "r", as in "%{d2r}"
+	Delimiters   string `json:"delimiters,omitempty"`   // as in "%{l-}"
+	Start        int    `json:"start"`                  // byte offset of the macro in the input
+	End          int    `json:"end"`                    // byte offset right after the macro
+}
+
+// ExpandMacros expands macros of the input as evaluation of SPF record does,
+// without doing any DNS lookups. Macros with values missing in the context
+// are expanded to empty strings and reported. With ctx.Partial the expansion
+// works as a dry run: unresolved macros are kept in the output as placeholders
+// and reported.
+func ExpandMacros(input string, ctx MacroContext) (string, []MissingMacro, error) {
+	p := &parser{
+		sender:        ctx.Sender,
+		domain:        ctx.Domain,
+		heloDomain:    ctx.HELO,
+		ip:            ctx.IP,
+		receivingFQDN: ctx.Receiver,
+		evaluatedOn:   ctx.Timestamp,
+		partialMacros: ctx.Partial,
+		expandEscapes: ctx.Escapes,
+		clock:         SystemClock,
+	}
+	return expandMacro(p, input, ctx.Exp)
+}
@@ -0,0 +1,149 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpandMacros(t *testing.T) {
+	full := MacroContext{
+		Sender:    "john@example.com",
+		Domain:    "example.com",
+		HELO:      "mx.example.com",
+		IP:        net.IPv4(10, 0, 0, 1),
+		Receiver:  "mx.example.net",
+		Timestamp: time.Unix(1600000000, 0),
+		Exp:       true,
+	}
+
+	tests := []struct {
+		input   string
+		ctx     MacroContext
+		want    string
+		missing []MissingMacro
+		err     bool
+	}{
+		{"%{l}@%{o} %{d2} %{h}", full, "john@example.com example.com mx.example.com", nil, false},
+		{"%{ir}.%{v}.arpa %{c} %{r} %{t}", full, "1.0.0.10.in-addr.arpa 10.0.0.1 mx.example.net 1600000000", nil, false},
+		{"%{ir}.%{v}._spf.%{d}", MacroContext{Domain: "example.com"}, ".._spf.example.com",
+			[]MissingMacro{{Letter: "i", Transformers: "r", Start: 0, End: 5}, {Letter: "v", Start: 6, End: 10}}, false},
+		{"%{S} %{h}", MacroContext{}, " ",
+			[]MissingMacro{{Letter: "s", Start: 0, End: 4}, {Letter: "h", Start: 5, End: 9}}, false},
+		{"%{c}", MacroContext{IP: full.IP}, "", nil, true},
+		{"%{c} %{t}", MacroContext{Exp: true}, " ",
+			[]MissingMacro{{Letter: "c", Start: 0, End: 4}, {Letter: "t", Start: 5, End: 9}}, false},
+		{"%{x", full, "", nil, true},
+		{"%{p}", full, "unknown", nil, false},
+		{"%{d2r-}.%{s}", MacroContext{}, ".",
+			[]MissingMacro{{Letter: "d", Transformers: "2r", Delimiters: "-", Start: 0, End: 7}, {Letter: "s", Start: 8, End: 12}}, false},
+		{"%{l-+}", MacroContext{Sender: "first-last+tag@example.com"}, "first.last.tag", nil, false},
+		{"%{vr-}", full, "addr.in", nil, false},
+		{"%{L}@%{l}", MacroContext{Sender: "a b@example.com"}, "a%20b@a b", nil, false},
+		{"%{x}", full, "", nil, true},
+		{"%{d0}", full, "", nil, true},
+	}
+
+	for no, test := range tests {
+		t.Run(fmt.Sprintf("%d_%s", no, test.input), func(t *testing.T) {
+			got, missing, err := ExpandMacros(test.input, test.ctx)
+			if (err != nil) != test.err {
+				t.Fatalf("ExpandMacros() error = %v, want error %t", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("ExpandMacros() = %q, want %q", got, test.want)
+			}
+			if diff := cmp.Diff(test.missing, missing); diff != "" {
+				t.Errorf("ExpandMacros() missing (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExpandMacros_Partial(t *testing.T) {
+	tests := []struct {
+		input   string
+		ctx     MacroContext
+		want    string
+		missing []MissingMacro
+	}{
+		{"%{ir}.%{v}._spf.%{d}", MacroContext{Domain: "example.com", Partial: true}, "%{ir}.%{v}._spf.example.com",
+			[]MissingMacro{{Letter: "i", Transformers: "r", Start: 0, End: 5}, {Letter: "v", Start: 6, End: 10}}},
+		{"%{l1r-}.%%.%{D}", MacroContext{Partial: true}, "%{l1r-}.%%.%{D}",
+			[]MissingMacro{{Letter: "l", Transformers: "1r", Delimiters: "-", Start: 0, End: 7}, {Letter: "d", Start: 11, End: 15}}},
+		{"%{d2}", MacroContext{Domain: "mail.example.com", Partial: true}, "example.com", nil},
+		{"%{h}.%{l}.%{v}.%{i}", MacroContext{Sender: "example.com", HELO: "mx.example.com", IP: net.IPv6loopback, Partial: true},
+			"mx.example.com.postmaster.ip6.%{i}", []MissingMacro{{Letter: "i", Start: 15, End: 19}}},
+		{"%{l}.%%%_%-.%{h}", MacroContext{Sender: "a%b@example.com", Partial: true}, "a%%b.%%%_%-.%{h}",
+			[]MissingMacro{{Letter: "h", Start: 12, End: 16}}},
+		{"%{l}.%%%_%-.%{h}", MacroContext{Sender: "a%b@example.com", Partial: true, Escapes: true}, "a%b.% %20.%{h}",
+			[]MissingMacro{{Letter: "h", Start: 12, End: 16}}},
+	}
+
+	for no, test := range tests {
+		t.Run(fmt.Sprintf("%d_%s", no, test.input), func(t *testing.T) {
+			got, missing, err := ExpandMacros(test.input, test.ctx)
+			if err != nil {
+				t.Fatalf("ExpandMacros() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("ExpandMacros() = %q, want %q", got, test.want)
+			}
+			if diff := cmp.Diff(test.missing, missing); diff != "" {
+				t.Errorf("ExpandMacros() missing (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExpandMacros_PartialRoundTrip(t *testing.T) {
+	full := MacroContext{
+		Sender:    "a%b@example.com",
+		Domain:    "mail.example.com",
+		HELO:      "mx.example.com",
+		IP:        net.IPv4(192, 0, 2, 1),
+		Receiver:  "mx.example.net",
+		Timestamp: time.Unix(1600000000, 0),
+		Exp:       true,
+	}
+	partials := []MacroContext{
+		{Partial: true},
+		{Sender: full.Sender, Domain: full.Domain, Partial: true},
+		{Sender: full.Sender, Domain: full.Domain, HELO: full.HELO, IP: full.IP, Partial: true},
+	}
+	inputs := []string{
+		"%{ir}.%{v}._spf.%{d2}",
+		"%{l}.%%.%_.%-.%{o}",
+		"%{L1r-}%%{d}",
+		"%{c} %{r} %{t} %{p} %{h}",
+	}
+	for _, s := range genMacroStrings(2000) {
+		if _, err := ParseMacroString(s); err == nil {
+			inputs = append(inputs, s)
+		}
+	}
+
+	for _, input := range inputs {
+		want, _, err := ExpandMacros(input, full)
+		if err != nil {
+			t.Fatalf("ExpandMacros(%q) error = %v", input, err)
+		}
+		for _, ctx := range partials {
+			partial, _, err := ExpandMacros(input, ctx)
+			if err != nil {
+				t.Fatalf("ExpandMacros(%q, partial) error = %v", input, err)
+			}
+			got, _, err := ExpandMacros(partial, full)
+			if err != nil {
+				t.Errorf("ExpandMacros(%q) of partial expansion of %q error = %v", partial, input, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("ExpandMacros(%q) of partial expansion of %q = %q, want %q", partial, input, got, want)
+			}
+		}
+	}
+}
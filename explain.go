@@ -0,0 +1,264 @@
+package spf
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+)
+
+// Path is a structured record of the evaluation of a domain's policy
+// produced by Explain.
+type Path struct {
+	Domain      string     `json:"domain"`
+	Record      string     `json:"record,omitempty"`      // evaluated SPF record
+	Result      Result     `json:"result"`                // result of check_host() for the domain
+	Explanation string     `json:"explanation,omitempty"` // result of "exp=", if any
+	Err         error      `json:"error,omitempty"`       // the reason for the encountered problem, if any
+	Pinned      string     `json:"pinned,omitempty"`      // description of the pin used instead of the published policy
+	Steps       []*Step    `json:"steps,omitempty"`       // terms in order of evaluation
+	Modifiers   []Modifier `json:"modifiers,omitempty"`   // unknown modifiers of the record
+	NearMisses  []NearMiss `json:"nearMisses,omitempty"`  // TXT records probably meant to be SPF records
+
+	// the following are set for the top-level Path only
+	ip          net.IP
+	evaluatedOn time.Time
+	ttl         time.Duration
+}
+
+// Step is a single term evaluated as a part of Path.
+type Step struct {
+	Term      string `json:"term"`                // the term as published, e.g. "-include:_spf.example.com"
+	Effective string `json:"effective,omitempty"` // value of the term after macro expansion
+	Matched   bool   `json:"matched,omitempty"`   // the term produced the result of the Path
+	Result    Result `json:"result,omitempty"`    // result produced by the term if it matched
+	Err       error  `json:"error,omitempty"`     // problem encountered while evaluating the term
+	Path      *Path  `json:"path,omitempty"`      // nested evaluation for "include" and "redirect"
+	Synthetic bool   `json:"synthetic,omitempty"` // the term was injected, see WithInjectedTerms
+	Cost      *Cost  `json:"cost,omitempty"`      // DNS lookups made for the term, if any
+
+	token    *token
+	networks []*net.IPNet // networks the term matches, if known
+}
+
+// MarshalJSON implements json.Marshaler, Err is rendered the way
+// SyntaxError.MarshalJSON does.
+func (p Path) MarshalJSON() ([]byte, error) {
+	type path Path
+	return json.Marshal(struct {
+		path
+		Err *errorJSON `json:"error,omitempty"`
+	}{path(p), newErrorJSON(p.Err)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *Path) UnmarshalJSON(b []byte) error {
+	type path Path
+	var v struct {
+		path
+		Err *errorJSON `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*p = Path(v.path)
+	p.Err = v.Err.error()
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, Err is rendered the way
+// SyntaxError.MarshalJSON does.
+func (s Step) MarshalJSON() ([]byte, error) {
+	type step Step
+	return json.Marshal(struct {
+		step
+		Err *errorJSON `json:"error,omitempty"`
+	}{step(s), newErrorJSON(s.Err)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *Step) UnmarshalJSON(b []byte) error {
+	type step Step
+	var v struct {
+		step
+		Err *errorJSON `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = Step(v.step)
+	s.Err = v.Err.error()
+	return nil
+}
+
+// Chain returns the steps that lead to the result of the Path: every
+// matched "include" or "redirect" followed by the term that
+// produced the final result. It returns nil when no term matched, e.g. when
+// there was no SPF record or the result was the default "neutral".
+func (p *Path) Chain() []*Step {
+	var chain []*Step
+	for p != nil {
+		var next *Step
+		for _, s := range p.Steps {
+			if s.Matched {
+				next = s
+			}
+		}
+		if next == nil {
+			break
+		}
+		chain = append(chain, next)
+		p = next.Path
+	}
+	return chain
+}
+
+// Explain evaluates SPF policy of the domain for the ip the same way
+// CheckHost does and returns the full path of terms traversed, including
+// nested "include" and "redirect" evaluations.
+// The sender is assumed to be "postmaster@<domain>".
+func Explain(ip net.IP, domain string, opts ...Option) *Path {
+	domain = NormalizeFQDN(domain)
+	e, _, _ := explain(ip, domain, "postmaster@"+domain, opts...)
+	return e.root
+}
+
+// explain runs check_host() collecting its path
+func explain(ip net.IP, domain, sender string, opts ...Option) (*explainer, *parser, string) {
+	e := &explainer{}
+	opts = append(opts[:len(opts):len(opts)], func(p *parser) {
+		p.explainer = e
+		if p.aggregate == nil {
+			p.aggregate = &e.aggregate
+		}
+	})
+	p := newParser(opts...)
+	_, _, spf, _ := p.checkHost(ip, domain, sender)
+	e.root.ip = ip
+	e.root.evaluatedOn = p.evaluatedOn
+	e.root.ttl = p.aggregate.TTL
+	return e, p, spf
+}
+
+// explainer builds Path from the evaluation events
+type explainer struct {
+	root      *Path
+	stack     []*Path
+	pinned    string    // description of the last pin used
+	aggregate Aggregate // used unless WithAggregate is given
+}
+
+func (e *explainer) top() *Path {
+	if len(e.stack) == 0 {
+		return nil
+	}
+	return e.stack[len(e.stack)-1]
+}
+
+func (e *explainer) last() *Step {
+	p := e.top()
+	if p == nil || len(p.Steps) == 0 {
+		return nil
+	}
+	return p.Steps[len(p.Steps)-1]
+}
+
+func (e *explainer) checkHost(domain string) {
+	p := &Path{Domain: domain}
+	if s := e.last(); s != nil {
+		s.Path = p
+	} else if e.root == nil {
+		e.root = p
+	}
+	e.stack = append(e.stack, p)
+}
+
+func (e *explainer) checkHostResult(r Result, explanation string, err error) {
+	if p := e.top(); p != nil {
+		p.Result, p.Explanation, p.Err = r, explanation, err
+		e.stack = e.stack[:len(e.stack)-1]
+	}
+}
+
+func (e *explainer) record(s string) {
+	if p := e.top(); p != nil {
+		p.Record = s
+	}
+}
+
+func (e *explainer) nearMiss(m NearMiss) {
+	if p := e.top(); p != nil {
+		p.NearMisses = append(p.NearMisses, m)
+	}
+}
+
+func (e *explainer) pin(pin Pin) {
+	e.pinned = pin.String()
+	if p := e.top(); p != nil {
+		p.Pinned = e.pinned
+	}
+}
+
+func (e *explainer) modifier(name, value string) {
+	if p := e.top(); p != nil {
+		p.Modifiers = append(p.Modifiers, Modifier{name, value})
+	}
+}
+
+func (e *explainer) directive(t *token, effectiveValue string) {
+	p := e.top()
+	if p == nil || t.mechanism == tVersion {
+		return
+	}
+	s := &Step{Term: t.String(), Effective: effectiveValue, Synthetic: t.synthetic(), token: t}
+	if t.mechanism == tIP4 || t.mechanism == tIP6 {
+		if n, err := parseNetwork(t.value); err == nil {
+			s.networks = []*net.IPNet{n}
+		}
+	}
+	p.Steps = append(p.Steps, s)
+}
+
+// lookup accounts the cost of the lookup to the term which made it, the lookup
+// of SPF record reached through "include" or "redirect" is accounted to the term
+func (e *explainer) lookup(t *token, extras *ResponseExtras) {
+	if extras == nil {
+		return
+	}
+	var s *Step
+	switch {
+	case t != nil:
+		s = e.last()
+		if s != nil && s.token != t {
+			s = nil
+		}
+	case len(e.stack) > 1:
+		if p := e.stack[len(e.stack)-2]; len(p.Steps) > 0 {
+			s = p.Steps[len(p.Steps)-1]
+		}
+	}
+	if s == nil {
+		return
+	}
+	if s.Cost == nil {
+		s.Cost = &Cost{}
+	}
+	s.Cost.add(extras)
+}
+
+func (e *explainer) matchingIP(ipn net.IPNet) {
+	if s := e.last(); s != nil {
+		s.networks = append(s.networks, &net.IPNet{IP: ipn.IP.Mask(ipn.Mask), Mask: ipn.Mask})
+	}
+}
+
+func (e *explainer) match(r Result, err error) {
+	if s := e.last(); s != nil {
+		s.Matched, s.Result, s.Err = true, r, err
+	}
+}
+
+func (e *explainer) nonMatch(err error) {
+	if s := e.last(); s != nil {
+		s.Err = err
+	}
+}
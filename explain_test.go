@@ -0,0 +1,84 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestExplain(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("explain.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`explain.example. 0 IN TXT "v=spf1 ip4:192.0.2.0/24 include:inc.explain.example redirect=red.explain.example"`,
+		},
+	}))
+	defer dns.HandleRemove("explain.example.")
+
+	dns.HandleFunc("inc.explain.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.explain.example. 0 IN TXT "v=spf1 a:%{d} ip4:10.0.0.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.explain.example.")
+
+	dns.HandleFunc("red.explain.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`red.explain.example. 0 IN TXT "v=spf1 ?ip4:172.16.0.0/16 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("red.explain.example.")
+
+	tests := []struct {
+		ip     string
+		result Result
+		chain  []string
+	}{
+		{"192.0.2.1", Pass, []string{"ip4:192.0.2.0/24"}},
+		{"10.0.0.1", Pass, []string{"include:inc.explain.example", "ip4:10.0.0.0/24"}},
+		{"172.16.0.1", Neutral, []string{"redirect=red.explain.example", "?ip4:172.16.0.0/16"}},
+		{"203.0.113.1", Fail, []string{"redirect=red.explain.example", "-all"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			p := Explain(net.ParseIP(tt.ip), "explain.example", WithResolver(testResolver))
+			if p == nil {
+				t.Fatal("Explain() = nil")
+			}
+			if p.Result != tt.result || p.Err != nil {
+				t.Errorf("Explain().Result = %s, %v; want %s", p.Result, p.Err, tt.result)
+			}
+			var chain []string
+			for _, s := range p.Chain() {
+				if s.Result != tt.result {
+					t.Errorf("step %q result = %s; want %s", s.Term, s.Result, tt.result)
+				}
+				chain = append(chain, s.Term)
+			}
+			if fmt.Sprint(chain) != fmt.Sprint(tt.chain) {
+				t.Errorf("Chain() = %q; want %q", chain, tt.chain)
+			}
+		})
+	}
+
+	t.Run("path", func(t *testing.T) {
+		p := Explain(net.ParseIP("10.0.0.1"), "explain.example", WithResolver(testResolver))
+		if p.Domain != "explain.example." || p.Record != "v=spf1 ip4:192.0.2.0/24 include:inc.explain.example redirect=red.explain.example" {
+			t.Errorf("Explain() = %q, %q", p.Domain, p.Record)
+		}
+		if len(p.Steps) != 2 {
+			t.Fatalf("Explain() steps = %d; want 2", len(p.Steps))
+		}
+		inc := p.Steps[1].Path
+		if inc == nil || inc.Domain != "inc.explain.example." || inc.Result != Pass {
+			t.Fatalf("include path = %+v", inc)
+		}
+		if got := inc.Steps[0]; got.Term != "a:%{d}" || got.Effective != "inc.explain.example." || got.Matched {
+			t.Errorf("include step = %+v", got)
+		}
+	})
+}
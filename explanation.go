@@ -0,0 +1,36 @@
+package spf
+
+// IgnoreExplanations makes evaluation skip "exp=" modifiers, so "fail"
+// results come without explanation and no DNS lookup is made for it.
+func IgnoreExplanations() Option {
+	return func(p *parser) {
+		p.ignoreExplanations = true
+	}
+}
+
+// CountExplanationLookup makes the lookup of "exp=" count against the DNS
+// lookups limit enforced by LimitedResolver. RFC 7208 exempts it from
+// the limit, yet some operators account every query made on behalf of
+// a check. Once the limit is reached, the explanation is not looked up and
+// ErrDNSLimitExceeded is returned along with "fail". Otherwise the lookup is
+// made as without the option, e.g. NXDOMAIN just means no explanation.
+// https://tools.ietf.org/html/rfc7208#section-4.6.4
+func CountExplanationLookup() Option {
+	return func(p *parser) {
+		p.countExplanation = true
+	}
+}
+
+// lookupExplanation looks up TXT records of the domain of "exp="
+func (p *parser) lookupExplanation(domain string) ([]string, *ResponseExtras, error) {
+	if p.countExplanation {
+		if l, ok := p.resolver.(*LimitedResolver); ok && !l.canLookup() {
+			return nil, nil, ErrDNSLimitExceeded
+		}
+	}
+	txts, extras, err := p.dns().LookupTXT(domain)
+	if err == nil {
+		err = p.checkTXTAnswer(domain, txts)
+	}
+	return txts, extras, err
+}
@@ -0,0 +1,77 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestExplanationOptions(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("expopt.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`expopt.example. 300 IN TXT "v=spf1 -all exp=exp.expopt.example"`,
+		},
+	}))
+	defer dns.HandleRemove("expopt.example.")
+
+	dns.HandleFunc("exp.expopt.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`exp.expopt.example. 300 IN TXT "%{i} is not one of %{d}'s designated mail servers"`,
+		},
+	}))
+	defer dns.HandleRemove("exp.expopt.example.")
+
+	dns.HandleFunc("nx.expopt.example.", func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNameError)
+		_ = w.WriteMsg(m)
+	})
+	defer dns.HandleRemove("nx.expopt.example.")
+
+	dns.HandleFunc("nxexp.expopt.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`nxexp.expopt.example. 300 IN TXT "v=spf1 -all exp=nx.expopt.example"`,
+		},
+	}))
+	defer dns.HandleRemove("nxexp.expopt.example.")
+
+	const expl = "10.0.0.1 is not one of expopt.example's designated mail servers"
+	tests := []struct {
+		name        string
+		domain      string
+		lookupLimit uint16
+		opts        []Option
+		explanation string
+		err         error
+		queries     int
+		expQueries  int
+	}{
+		{"default", "expopt.example", 10, nil, expl, nil, 2, 1},
+		{"not counted", "expopt.example", 2, nil, expl, nil, 2, 1},
+		{"ignored", "expopt.example", 10, []Option{IgnoreExplanations()}, "", nil, 1, 0},
+		{"counted", "expopt.example", 10, []Option{CountExplanationLookup()}, expl, nil, 2, 1},
+		{"counted over limit", "expopt.example", 2, []Option{CountExplanationLookup()}, "", ErrDNSLimitExceeded, 1, 0},
+		{"nxdomain", "nxexp.expopt.example", 10, nil, "", nil, 2, 1},
+		{"counted nxdomain", "nxexp.expopt.example", 10, []Option{CountExplanationLookup()}, "", nil, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a Aggregate
+			opts := append([]Option{WithResolver(NewLimitedResolver(testResolver, tt.lookupLimit, 10)), WithAggregate(&a)}, tt.opts...)
+			r, s, _, err := CheckHost(net.ParseIP("10.0.0.1"), tt.domain, "", opts...)
+			if r != Fail || s != tt.explanation {
+				t.Errorf("CheckHost() = %s, %q; want %s, %q", r, s, Fail, tt.explanation)
+			}
+			if tt.err == nil && err != nil || !errors.Is(err, tt.err) {
+				t.Errorf("CheckHost() error = %v; want %v", err, tt.err)
+			}
+			if a.Queries != tt.queries || a.ExplanationQueries != tt.expQueries {
+				t.Errorf("Aggregate = %+v; want %d queries, %d for explanation", a, tt.queries, tt.expQueries)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package spf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// formatIndent is the indentation of continuation lines of Format
+const formatIndent = "  "
+
+// Format re-wraps the record into lines of at most width characters for
+// documentation or tickets: terms are kept as published and never split,
+// continuation lines are indented with two spaces. A term longer than width
+// goes on a line of its own. Zero or negative width puts every term on a line
+// of its own. The result is not a valid record, use Minify or Canonicalize
+// to get one.
+func Format(record string, width int) string {
+	terms, _ := Tokenize(record)
+	var (
+		b    strings.Builder
+		line int
+	)
+	for _, t := range terms {
+		if t.Text == "" {
+			continue
+		}
+		switch {
+		case b.Len() == 0:
+		case width > 0 && line+1+len(t.Text) <= width:
+			b.WriteByte(' ')
+			line++
+		default:
+			b.WriteString("\n" + formatIndent)
+			line = len(formatIndent)
+		}
+		b.WriteString(t.Text)
+		line += len(t.Text)
+	}
+	return b.String()
+}
+
+// Minify returns the shortest record evaluated the same way as the given
+// one: terms are separated with a single space, names are lowercased, "+"
+// qualifiers are removed, "explanation" is spelled "exp" and default CIDR
+// lengths, /32 of IPv4 and /128 of IPv6, are dropped. The order of terms is
+// preserved and terms with syntax errors are kept verbatim.
+func Minify(record string) string {
+	terms, _ := Tokenize(record)
+	s := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if t.Text == "" {
+			continue
+		}
+		if t.Kind == TermInvalid {
+			s = append(s, t.Text)
+			continue
+		}
+		tok := t.token()
+		switch tok.mechanism {
+		case tIP4:
+			tok.value = trimCIDRLength(tok.value, 8*4)
+		case tIP6:
+			tok.value = trimCIDRLength(tok.value, 8*16)
+		case tA, tMX:
+			tok.value = trimDualCIDRLength(tok.value)
+		}
+		s = append(s, tok.String())
+	}
+	return strings.Join(s, " ")
+}
+
+// trimCIDRLength removes the CIDR length of the network if it is the default
+// one, bits
+func trimCIDRLength(network string, bits int) string {
+	i := strings.LastIndexByte(network, '/')
+	if i < 0 {
+		return network
+	}
+	if l, err := strconv.Atoi(network[i+1:]); err != nil || l != bits {
+		return network
+	}
+	return network[:i]
+}
+
+// trimDualCIDRLength removes the default lengths of dual-cidr-length of the
+// domain-spec of "a" or "mx" mechanism, see RFC 7208 section 5.6
+func trimDualCIDRLength(value string) string {
+	var ip4Len, ip6Len string
+	if i := strings.LastIndex(value, "//"); i >= 0 && isNumber(value[i+2:]) {
+		value, ip6Len = value[:i], value[i+2:]
+	}
+	if i := strings.LastIndexByte(value, '/'); i >= 0 && isNumber(value[i+1:]) {
+		value, ip4Len = value[:i], value[i+1:]
+	}
+	if l, _ := strconv.Atoi(ip4Len); ip4Len != "" && l != 8*4 {
+		value += "/" + ip4Len
+	}
+	if l, _ := strconv.Atoi(ip6Len); ip6Len != "" && l != 8*16 {
+		value += "//" + ip6Len
+	}
+	return value
+}
+
+// isNumber returns true if s is a non-empty string of digits
+func isNumber(s string) bool {
+	return s != "" && strings.TrimLeft(s, "0123456789") == ""
+}
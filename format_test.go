@@ -0,0 +1,55 @@
+package spf
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	record := "v=spf1  ip4:192.0.2.0/24 ip6:2001:db8::/32 include:_spf.example.com include:_spf.long-vendor-name.example.net ~all"
+	tests := []struct {
+		width int
+		want  string
+	}{
+		{41, "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32\n" +
+			"  include:_spf.example.com\n" +
+			"  include:_spf.long-vendor-name.example.net\n" +
+			"  ~all"},
+		{40, "v=spf1 ip4:192.0.2.0/24\n" +
+			"  ip6:2001:db8::/32\n" +
+			"  include:_spf.example.com\n" +
+			"  include:_spf.long-vendor-name.example.net\n" +
+			"  ~all"},
+		{60, "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32\n" +
+			"  include:_spf.example.com\n" +
+			"  include:_spf.long-vendor-name.example.net ~all"},
+		{0, "v=spf1\n  ip4:192.0.2.0/24\n  ip6:2001:db8::/32\n  include:_spf.example.com\n" +
+			"  include:_spf.long-vendor-name.example.net\n  ~all"},
+		{200, "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 include:_spf.example.com include:_spf.long-vendor-name.example.net ~all"},
+	}
+	for _, test := range tests {
+		if got := Format(record, test.width); got != test.want {
+			t.Errorf("Format(%d) = %q; want %q", test.width, got, test.want)
+		}
+	}
+	if got := Format("  v=spf1 include: -all ", 10); got != "v=spf1\n  include:\n  -all" {
+		t.Errorf("Format(invalid) = %q", got)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	tests := []struct {
+		record string
+		want   string
+	}{
+		{"v=spf1 -all", "v=spf1 -all"},
+		{"  V=SPF1\t+MX  +ip4:192.0.2.1/32 -ALL ", "v=SPF1 mx ip4:192.0.2.1 -all"},
+		{"v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::1/128 ip6:2001:db8::/32", "v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::1 ip6:2001:db8::/32"},
+		{"v=spf1 a/32 mx//128 a/32//128 a:example.com/24//128 mx:example.com/32//64", "v=spf1 a mx a a:example.com/24 mx:example.com//64"},
+		{"v=spf1 a/32//abc a:x.example/32// ip4:192.0.2.1/ab", "v=spf1 a/32//abc a:x.example/32// ip4:192.0.2.1/ab"},
+		{"v=spf1 explanation=exp.%{d} ra=Postmaster", "v=spf1 exp=exp.%{d} ra=Postmaster"},
+		{"v=spf1 include: +-all ?all", "v=spf1 include: +-all ?all"},
+	}
+	for _, test := range tests {
+		if got := Minify(test.record); got != test.want {
+			t.Errorf("Minify(%q) = %q; want %q", test.record, got, test.want)
+		}
+	}
+}
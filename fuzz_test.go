@@ -0,0 +1,138 @@
+//go:build go1.18
+// +build go1.18
+
+package spf
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// weirdRecords are SPF records seen in the wild, seeds of the fuzz targets
+var weirdRecords = []string{
+	"v=spf1 -all",
+	"v=spf1 include:_spf.google.com include:spf.protection.outlook.com ~all",
+	"v=spf1 ip4:192.0.2.0/24 ip4:198.51.100.1 ~all,",
+	"v=spf1 a mx ptr ?all v=spf1",
+	"v=spf1 redirect=_spf.example.com redirect=",
+	"v=spf1 exists:%{i}._spf.%{d} -all",
+	"v=spf1 +a:%{d1r}.%{l-}. -all",
+	"v=spf1 ip6:::ffff:192.0.2.1/96 ip4:10.0.0.1/33 -all",
+	"v=spf1 a/24//64 mx:example.com/0 -all",
+	"V=SPF1 INCLUDE:EXAMPLE.COM\t-ALL;",
+	"v=spf1 -all exp=explain.%{d} ra=postmaster rp=100",
+	"v=spf1 include:example.com. include: -all",
+	"v=spf1 ~all all all",
+	"v=spf1 \xff\xfe include:\xc3\x28.example -all",
+	"v=spf1 exists:%{ir}.%{v}._spf.%{d2} exists:%{%{d}}.example -all",
+	"v=spf1 a:%{s}%{l}%{o}%{h}%{c}%{r}%{t}%{p} -all",
+}
+
+func FuzzLex(f *testing.F) {
+	for _, s := range weirdRecords {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, tok := range lex(s) {
+			if start, end := tok.position(); start < 0 || start > end || end > len(s) {
+				t.Errorf("lex(%q) token %q at [%d, %d)", s, tok, start, end)
+			}
+		}
+	})
+}
+
+func FuzzParseMacro(f *testing.F) {
+	for _, s := range []string{
+		"%{i}._spf.%{d}",
+		"%{ir}.%{v}.arpa",
+		"%{d2r}.%{l-}.%{o+=._-}",
+		"%%%_%-%{",
+		"%{%{%{d}}}",
+		"%{d999999999999999999999r}",
+		"%{l\xff}",
+		"\xff%{s}\xfe",
+		"%{c} %{r} %{t} %{p}",
+	} {
+		f.Add(s, false)
+		f.Add(s, true)
+	}
+	ctx := MacroContext{
+		Sender:    "strong-bad@email.example.com",
+		Domain:    "email.example.com",
+		HELO:      "mx.example.org",
+		IP:        net.ParseIP("2001:db8::cb01"),
+		Receiver:  "mx.example.net",
+		Timestamp: time.Unix(1600000000, 0),
+	}
+	f.Fuzz(func(t *testing.T, s string, exp bool) {
+		c := ctx
+		c.Exp = exp
+		_, _, _ = ExpandMacros(s, c)
+		c.Partial = true
+		_, missing, _ := ExpandMacros(s, c)
+		for _, m := range missing {
+			if m.Start < 0 || m.Start > m.End || m.End > len(s) {
+				t.Errorf("ExpandMacros(%q) missing %q at [%d, %d)", s, m.Letter, m.Start, m.End)
+			}
+		}
+	})
+}
+
+// fuzzResolver answers every lookup without DNS: names starting with "v"
+// have SPF records, "exists" matches names starting with "a", and every
+// address lookup returns 192.0.2.1 and 2001:db8::1
+type fuzzResolver struct{}
+
+func (fuzzResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	if !strings.HasPrefix(name, "v") {
+		return nil, &ResponseExtras{Void: true}, ErrDNSPermerror
+	}
+	return []string{"v=spf1 a -all"}, &ResponseExtras{Answers: 1}, nil
+}
+
+func (r fuzzResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	return []string{"explanation for %{i}"}, &ResponseExtras{Answers: 1}, nil
+}
+
+func (fuzzResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	found := strings.HasPrefix(name, "a")
+	return found, &ResponseExtras{Void: !found}, nil
+}
+
+func (fuzzResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	for _, ip := range []net.IP{net.ParseIP("192.0.2.1").To4(), net.ParseIP("2001:db8::1")} {
+		if m, err := matcher(ip, name); m || err != nil {
+			return m, &ResponseExtras{Answers: 1}, err
+		}
+	}
+	return false, &ResponseExtras{Answers: 2}, nil
+}
+
+func (r fuzzResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	return r.MatchIP(name, matcher)
+}
+
+func FuzzCheckHostRecord(f *testing.F) {
+	for _, s := range weirdRecords {
+		f.Add(s, "192.0.2.1")
+		f.Add(s, "2001:db8::1")
+	}
+	f.Fuzz(func(t *testing.T, record, addr string) {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			ip = net.IPv4(192, 0, 2, 1)
+		}
+		opts := []Option{
+			WithResolver(NewLimitedResolver(fuzzResolver{}, 10, 10)),
+			WithLocalPolicy(LocalPolicy{Before: func(string) string { return record }}),
+			HeloDomain("mx.example.org"),
+		}
+		r, _, _, _ := CheckHost(ip, "example.com", "user@example.com", opts...)
+		if r < None || r > Permerror {
+			t.Errorf("CheckHost(%q) = %d; want a valid result", record, r)
+		}
+		_, _, _, _ = CheckHost(ip, "example.com", "user@example.com", append(opts, WithParsingMode(Lenient), IgnoreMatches())...)
+	})
+}
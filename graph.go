@@ -0,0 +1,168 @@
+package spf
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// IncludeGraph is the graph of SPF policies reachable from a domain through
+// "include" and "redirect" built by BuildIncludeGraph.
+type IncludeGraph struct {
+	Root   string       `json:"root"`
+	Nodes  []*GraphNode `json:"nodes"`            // in order of discovery, the root first
+	Edges  []GraphEdge  `json:"edges,omitempty"`  // in order of discovery
+	Cycles [][]Hop      `json:"cycles,omitempty"` // loops, from the domain reached again to the domain reaching it
+	Shared []string     `json:"shared,omitempty"` // domains reached from more than one record
+}
+
+// GraphNode is a domain of IncludeGraph with its SPF record.
+type GraphNode struct {
+	Domain string `json:"domain"`
+	Record string `json:"record,omitempty"`
+	Err    error  `json:"error,omitempty"` // problem fetching or parsing the record, if any
+}
+
+// GraphEdge is an "include" or "redirect" term of the record of From
+// reaching To.
+type GraphEdge struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Mechanism string `json:"mechanism"` // "include" or "redirect"
+	Term      string `json:"term"`      // the term as published
+	Depth     int    `json:"depth"`     // nesting level of To, 1 for domains reached by the root
+}
+
+// MarshalJSON implements json.Marshaler, Err is rendered the way
+// SyntaxError.MarshalJSON does.
+func (n GraphNode) MarshalJSON() ([]byte, error) {
+	type graphNode GraphNode
+	return json.Marshal(struct {
+		graphNode
+		Err *errorJSON `json:"error,omitempty"`
+	}{graphNode(n), newErrorJSON(n.Err)})
+}
+
+// Node returns the node of the domain, nil if the graph has none.
+func (g *IncludeGraph) Node(domain string) *GraphNode {
+	domain = NormalizeFQDN(domain)
+	for _, n := range g.Nodes {
+		if n.Domain == domain {
+			return n
+		}
+	}
+	return nil
+}
+
+// BuildIncludeGraph fetches SPF records of the domain and of all the domains
+// its policy reaches through "include" and "redirect", and returns them
+// as a graph. Unlike evaluation it doesn't stop at problems: they are kept by
+// the nodes and loops are reported as Cycles. Every domain is fetched once;
+// targets with macros and "redirect" ignored because of "all" are not
+// followed. The number of lookups is limited to 100.
+func BuildIncludeGraph(domain string, r Resolver) *IncludeGraph {
+	domain = NormalizeFQDN(domain)
+	b := &graphBuilder{
+		resolver: NewLimitedResolver(r, maxSplitLookups, MaxMXNames),
+		visited:  newStringsStack(),
+		nodes:    make(map[string]*GraphNode),
+		parents:  make(map[string]map[string]bool),
+		g:        &IncludeGraph{Root: domain},
+	}
+	b.walk(domain, 0)
+	for _, n := range b.g.Nodes {
+		if len(b.parents[n.Domain]) > 1 {
+			b.g.Shared = append(b.g.Shared, n.Domain)
+		}
+	}
+	return b.g
+}
+
+type graphBuilder struct {
+	resolver Resolver
+	visited  *stringsStack
+	nodes    map[string]*GraphNode
+	parents  map[string]map[string]bool // domains reaching the domain, loops aside
+	g        *IncludeGraph
+}
+
+func (b *graphBuilder) walk(domain string, depth int) {
+	n := &GraphNode{Domain: domain}
+	b.nodes[domain] = n
+	b.g.Nodes = append(b.g.Nodes, n)
+	if !isDomainName(domain) {
+		n.Err = newInvalidDomainError(domain)
+		return
+	}
+	b.visited.push(domain)
+	defer b.visited.pop()
+
+	txts, _, err := b.resolver.LookupTXTStrict(domain)
+	if err == nil {
+		n.Record, err = filterSPF(txts)
+	}
+	if err == nil && n.Record == "" {
+		err = ErrSPFNotFound
+	}
+	if err != nil {
+		n.Err = err
+		return
+	}
+	tokens := lex(n.Record)
+	if _, _, _, _, err := sortTokens(tokens); err != nil {
+		n.Err = err
+	}
+
+	var (
+		all      bool
+		redirect *token
+	)
+	for _, t := range tokens {
+		switch t.mechanism {
+		case tAll:
+			all = true
+		case tInclude:
+			b.edge(n, t, depth)
+		case tRedirect:
+			if redirect == nil {
+				redirect = t
+			}
+		}
+	}
+	if redirect != nil && !all {
+		b.edge(n, redirect, depth)
+	}
+}
+
+// edge adds the edge of the term and walks its target if it's new
+func (b *graphBuilder) edge(from *GraphNode, t *token, depth int) {
+	if t.value == "" || strings.ContainsRune(t.value, '%') {
+		return
+	}
+	to := NormalizeFQDN(t.value)
+	b.g.Edges = append(b.g.Edges, GraphEdge{
+		From:      from.Domain,
+		To:        to,
+		Mechanism: t.mechanism.String(),
+		Term:      t.String(),
+		Depth:     depth + 1,
+	})
+	b.visited.via(t.mechanism)
+	if b.visited.has(to) {
+		chain := b.visited.loop(to).(LoopError).Chain
+		for i, h := range chain {
+			if h.Domain == to {
+				b.g.Cycles = append(b.g.Cycles, chain[i:])
+				break
+			}
+		}
+		return
+	}
+	if b.parents[to] == nil {
+		b.parents[to] = make(map[string]bool)
+	}
+	b.parents[to][from.Domain] = true
+	if _, ok := b.nodes[to]; ok {
+		return
+	}
+	b.walk(to, depth+1)
+}
@@ -0,0 +1,74 @@
+package spf
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildIncludeGraph(t *testing.T) {
+	r, err := NewOverlayResolver(testResolver, map[string][]string{
+		"graph.example":        {"v=spf1 include:a.graph.example include:b.graph.example redirect=c.graph.example"},
+		"a.graph.example":      {"v=spf1 include:shared.graph.example include:%{d}.graph.example -all"},
+		"b.graph.example":      {"v=spf1 include:shared.graph.example include:none.graph.example -all"},
+		"c.graph.example":      {"v=spf1 include:loop.graph.example ~all redirect=a.graph.example"},
+		"loop.graph.example":   {"v=spf1 include:c.graph.example -all"},
+		"shared.graph.example": {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"none.graph.example":   {"not spf"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := BuildIncludeGraph("graph.example", r)
+
+	var nodes []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.Domain)
+	}
+	wantNodes := []string{"graph.example.", "a.graph.example.", "shared.graph.example.", "b.graph.example.",
+		"none.graph.example.", "c.graph.example.", "loop.graph.example."}
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Errorf("Nodes = %q; want %q", nodes, wantNodes)
+	}
+
+	wantEdges := []GraphEdge{
+		{"graph.example.", "a.graph.example.", "include", "include:a.graph.example", 1},
+		{"a.graph.example.", "shared.graph.example.", "include", "include:shared.graph.example", 2},
+		{"graph.example.", "b.graph.example.", "include", "include:b.graph.example", 1},
+		{"b.graph.example.", "shared.graph.example.", "include", "include:shared.graph.example", 2},
+		{"b.graph.example.", "none.graph.example.", "include", "include:none.graph.example", 2},
+		{"graph.example.", "c.graph.example.", "redirect", "redirect=c.graph.example", 1},
+		{"c.graph.example.", "loop.graph.example.", "include", "include:loop.graph.example", 2},
+		{"loop.graph.example.", "c.graph.example.", "include", "include:c.graph.example", 3},
+	}
+	if !reflect.DeepEqual(g.Edges, wantEdges) {
+		t.Errorf("Edges = %+v; want %+v", g.Edges, wantEdges)
+	}
+
+	wantCycles := [][]Hop{{
+		{"c.graph.example.", "redirect", "graph.example."},
+		{"loop.graph.example.", "include", "c.graph.example."},
+		{"c.graph.example.", "include", "loop.graph.example."},
+	}}
+	if !reflect.DeepEqual(g.Cycles, wantCycles) {
+		t.Errorf("Cycles = %+v; want %+v", g.Cycles, wantCycles)
+	}
+	if want := []string{"shared.graph.example."}; !reflect.DeepEqual(g.Shared, want) {
+		t.Errorf("Shared = %q; want %q", g.Shared, want)
+	}
+
+	if n := g.Node("none.graph.example"); n == nil || !errors.Is(n.Err, ErrSPFNotFound) {
+		t.Errorf("Node(none) = %+v; want ErrSPFNotFound", n)
+	}
+	if n := g.Node("shared.graph.example"); n == nil || n.Record != "v=spf1 ip4:192.0.2.0/24 -all" || n.Err != nil {
+		t.Errorf("Node(shared) = %+v", n)
+	}
+
+	b, err := json.Marshal(g)
+	if err != nil || !strings.Contains(string(b), `"shared":["shared.graph.example."]`) ||
+		!strings.Contains(string(b), `"error":{"kind":`) {
+		t.Errorf("json.Marshal() = %s, %v", b, err)
+	}
+}
@@ -0,0 +1,81 @@
+package spf
+
+import "strings"
+
+// Hardening maps results of checks to stricter ones for receivers enforcing
+// SPF strictly, e.g. Softfail to Fail and Neutral to Softfail:
+//
+//	spf.WithHardening(spf.Hardening{spf.Softfail: spf.Fail, spf.Neutral: spf.Softfail})
+//
+// Results are mapped once, Softfail hardened from Neutral is not hardened
+// again to Fail.
+type Hardening map[Result]Result
+
+// HardenedError is Trace.Problem of the result changed by Hardening, it wraps
+// the problem encountered by evaluation, if any.
+type HardenedError struct {
+	From Result // the result of evaluation
+	To   Result // the result of local policy
+	Err  error  // the problem encountered by evaluation, if any
+}
+
+func (e *HardenedError) Error() string {
+	s := "local policy: " + e.From.String() + " hardened to " + e.To.String()
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *HardenedError) Unwrap() error {
+	return e.Err
+}
+
+// Apply maps the result of the trace, recording the change in Problem as
+// HardenedError. It returns false if the result is not changed.
+func (h Hardening) Apply(t *Trace) bool {
+	to, ok := h[t.Result]
+	if !ok || to == t.Result {
+		return false
+	}
+	t.Problem = &HardenedError{From: t.Result, To: to, Err: t.Problem}
+	t.Result = to
+	return true
+}
+
+// WithHardening makes CheckHostDetailed and EvaluateSession harden results
+// of their traces. Other fields of the results, and results of CheckHost,
+// stay as evaluated.
+func WithHardening(h Hardening) Option {
+	return func(p *parser) {
+		p.hardening = h
+	}
+}
+
+// HardeningPolicy is Hardening of recipient domains, e.g. of the domains
+// requiring strict SPF enforcement; subdomains follow the hardening of their
+// parent domain unless they have their own.
+type HardeningPolicy map[string]Hardening
+
+// For returns the hardening of the recipient, an address or a domain, nil if
+// there is none.
+func (p HardeningPolicy) For(recipient string) Hardening {
+	domain := recipient
+	if i := strings.LastIndexByte(recipient, '@'); i >= 0 {
+		domain = recipient[i+1:]
+	}
+	domain = NormalizeFQDN(domain)
+	for domain != "" && domain != "." {
+		for k, h := range p {
+			if NormalizeFQDN(k) == domain {
+				return h
+			}
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestWithHardening(t *testing.T) {
+	r, err := NewOverlayResolver(testResolver, map[string][]string{
+		"hardening.example":      {"v=spf1 ip4:192.0.2.1 ?ip4:192.0.2.2 ~all"},
+		"perm.hardening.example": {"v=spf1 include:none.hardening.example ~all"},
+		"none.hardening.example": {"not spf"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Hardening{Softfail: Fail, Neutral: Softfail}
+
+	tests := []struct {
+		ip     string
+		domain string
+		want   Result
+		from   Result // evaluated result, -1 if not hardened
+	}{
+		{"192.0.2.1", "hardening.example", Pass, -1},
+		{"192.0.2.2", "hardening.example", Softfail, Neutral},
+		{"192.0.2.3", "hardening.example", Fail, Softfail},
+		{"192.0.2.3", "perm.hardening.example", Permerror, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip+" "+tt.domain, func(t *testing.T) {
+			c := CheckHostDetailed(net.ParseIP(tt.ip), tt.domain, "john@"+tt.domain, WithResolver(r), WithHardening(h))
+			if c.Trace.Result != tt.want {
+				t.Errorf("Trace.Result = %s; want %s", c.Trace.Result, tt.want)
+			}
+			var he *HardenedError
+			switch {
+			case tt.from < 0:
+				if errors.As(c.Trace.Problem, &he) || c.Result != tt.want {
+					t.Errorf("Result = %s, Problem = %v; want %s not hardened", c.Result, c.Trace.Problem, tt.want)
+				}
+			case !errors.As(c.Trace.Problem, &he) || he.From != tt.from || he.To != tt.want:
+				t.Errorf("Problem = %v; want hardened %s to %s", c.Trace.Problem, tt.from, tt.want)
+			case c.Result != tt.from:
+				t.Errorf("Result = %s; want %s as evaluated", c.Result, tt.from)
+			}
+		})
+	}
+
+	s := EvaluateSession(net.ParseIP("192.0.2.3"), "[192.0.2.3]", "john@hardening.example", WithResolver(r), WithHardening(h))
+	if s.Result() != Fail || s.Trace.Identity != "mailfrom" {
+		t.Errorf("EvaluateSession() = %s, %q; want fail of mailfrom", s.Result(), s.Trace.Identity)
+	}
+}
+
+func TestHardening_Apply(t *testing.T) {
+	tr := Trace{Result: Neutral, Problem: ErrDNSTemperror}
+	if !(Hardening{Neutral: Softfail}).Apply(&tr) {
+		t.Fatal("Apply() = false; want true")
+	}
+	if tr.Result != Softfail || !errors.Is(tr.Problem, ErrDNSTemperror) {
+		t.Errorf("Apply() = %s, %v; want softfail wrapping the problem", tr.Result, tr.Problem)
+	}
+	if want := "local policy: neutral hardened to softfail: " + ErrDNSTemperror.Error(); tr.Problem.Error() != want {
+		t.Errorf("Problem = %q; want %q", tr.Problem, want)
+	}
+	if (Hardening{Neutral: Softfail}).Apply(&tr) {
+		t.Error("Apply() of softfail = true; want false")
+	}
+	if Hardening(nil).Apply(&tr) {
+		t.Error("nil Apply() = true; want false")
+	}
+}
+
+func TestHardeningPolicy_For(t *testing.T) {
+	strict := Hardening{Softfail: Fail}
+	stricter := Hardening{Softfail: Fail, Neutral: Softfail}
+	p := HardeningPolicy{"example.com": strict, "Bank.Example.com.": stricter}
+
+	tests := []struct {
+		recipient string
+		want      Hardening
+	}{
+		{"john@example.com", strict},
+		{"john@mail.example.com", strict},
+		{"john@bank.example.com", stricter},
+		{"online.bank.example.com", stricter},
+		{"john@example.org", nil},
+		{"com", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := p.For(tt.recipient); len(got) != len(tt.want) {
+			t.Errorf("For(%q) = %v; want %v", tt.recipient, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package spf
+
+import (
+	"errors"
+	"sync"
+)
+
+// MemoizeIncludes makes evaluation reuse the result of "include" of a domain
+// already evaluated during the same check, e.g. when records of two vendors
+// both include the same third-party record. Only the first evaluation makes
+// DNS lookups and counts against the lookup limits, and only it is reported to
+// Listener.
+//
+// This is not RFC 7208 compliant: the result may differ from the one of
+// CheckHost without the option when the limits are reached. Meant for
+// analysis runs, e.g. along with IgnoreMatches.
+func MemoizeIncludes() Option {
+	return func(p *parser) {
+		p.memoizeIncludes = true
+	}
+}
+
+// includeMemo keeps results of "include" evaluations for the duration of
+// the check, it is shared by all parsers of the check.
+// Concurrently evaluated includes (see ConcurrentIncludes) use a memo of their
+// own on top of the shared one, it is committed when their result is used.
+type includeMemo struct {
+	sync.Mutex
+	parent  *includeMemo
+	results map[string]includeResult
+}
+
+type includeResult struct {
+	result Result
+	err    error
+}
+
+func (m *includeMemo) get(key string) (includeResult, bool) {
+	for ; m != nil; m = m.parent {
+		m.Lock()
+		r, ok := m.results[key]
+		m.Unlock()
+		if ok {
+			return r, true
+		}
+	}
+	return includeResult{}, false
+}
+
+func (m *includeMemo) set(key string, r includeResult) {
+	m.Lock()
+	defer m.Unlock()
+	if m.results == nil {
+		m.results = make(map[string]includeResult)
+	}
+	m.results[key] = r
+}
+
+// speculative returns a memo for an evaluation which result may be discarded
+func (m *includeMemo) speculative() *includeMemo {
+	if m == nil {
+		return nil
+	}
+	return &includeMemo{parent: m}
+}
+
+// commit adds results of speculative memo to its parent
+func (m *includeMemo) commit() {
+	if m == nil || m.parent == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	for k, r := range m.results {
+		m.parent.set(k, r)
+	}
+}
+
+// include evaluates policy of the domain for "include" mechanism, reusing
+// the result memoized during the check if there is one.
+func (p *parser) include(domain string) (Result, error) {
+	m := p.includeMemo
+	if m == nil {
+		return p.checkNested(tInclude, domain)
+	}
+	key := domain + "|" + p.ip.String()
+	if ir, ok := m.get(key); ok {
+		return ir.result, ir.err
+	}
+
+	// the lock is not held during the evaluation as it could include
+	// the same domains again; concurrent evaluations of the same domain are
+	// not worth preventing
+	r, err := p.checkNested(tInclude, domain)
+	// results depending on the path the domain was reached through
+	// are not reused
+	if errors.Is(err, ErrLoopDetected) || errors.Is(err, ErrTooDeep) || errors.Is(err, errCanceled) {
+		return r, err
+	}
+	m.set(key, includeResult{r, err})
+	return r, err
+}
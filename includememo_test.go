@@ -0,0 +1,54 @@
+package spf
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestMemoizeIncludes(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("memo.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`memo.example. 0 IN TXT "v=spf1 include:v1.memo.example include:v2.memo.example -all"`,
+			`v1.memo.example. 0 IN TXT "v=spf1 include:shared.memo.example"`,
+			`v2.memo.example. 0 IN TXT "v=spf1 include:shared.memo.example"`,
+			`shared.memo.example. 0 IN TXT "v=spf1 a:h1.memo.example a:h2.memo.example a:h3.memo.example"`,
+		},
+		dns.TypeA: {
+			`h1.memo.example. 0 IN A 192.0.2.1`,
+			`h2.memo.example. 0 IN A 192.0.2.2`,
+			`h3.memo.example. 0 IN A 192.0.2.3`,
+		},
+	}))
+	defer dns.HandleRemove("memo.example.")
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		result Result
+		checks int
+	}{
+		{"rfc", nil, Permerror, 5},
+		{"memoized", []Option{MemoizeIncludes()}, Fail, 4},
+		{"memoized concurrently", []Option{MemoizeIncludes(), ConcurrentIncludes(2)}, Fail, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &recordingListener{}
+			opts := append([]Option{
+				WithResolver(NewLimitedResolver(testResolver, 8, 10)),
+				WithListener(l),
+			}, test.opts...)
+			r, _, _, err := CheckHost(net.ParseIP("10.0.0.1"), "memo.example", "", opts...)
+			if r != test.result {
+				t.Errorf("CheckHost() = %v, %v; want %v", r, err, test.result)
+			}
+			if got := len(l.filter("CheckHost(")); got != test.checks {
+				t.Errorf("CheckHost events = %d; want %d %q", got, test.checks, l.events)
+			}
+		})
+	}
+}
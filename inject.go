@@ -0,0 +1,61 @@
+package spf
+
+import (
+	"net"
+)
+
+// WithInjectedTerms prepends mechanisms to the record of the checked domain
+// without altering DNS data, e.g. "include:spf.trusted-forwarder.org" to
+// accept mail relayed by trusted forwarders, or "ip4:192.0.2.0/24" to allow
+// own relays. The terms go right after "v=spf1" in the given order and count
+// against the DNS lookups limit as any other term.
+// Records of domains reached through "include" or "redirect" are not
+// altered. Terms which aren't valid mechanisms are ignored.
+//
+// Listener gets events for injected terms as for published ones, the
+// events could be told apart with SyntheticListener.
+func WithInjectedTerms(terms ...string) Option {
+	var tokens []*token
+	for _, s := range terms {
+		for _, t := range lex(s) {
+			if t.isErr() || !t.mechanism.isMechanism() || t.mechanism == tVersion {
+				continue
+			}
+			t.start, t.end = -1, -1 // synthetic, not a part of any record
+			tokens = append(tokens, t)
+		}
+	}
+	return func(p *parser) {
+		p.injected = append(p.injected, tokens...)
+	}
+}
+
+// WithAllowlist is a shorthand for WithInjectedTerms adding "ip4" or "ip6"
+// term for every network.
+func WithAllowlist(networks ...net.IPNet) Option {
+	terms := make([]string, 0, len(networks))
+	for _, n := range networks {
+		m := "ip6:"
+		if n.IP.To4() != nil {
+			m = "ip4:"
+		}
+		terms = append(terms, m+n.String())
+	}
+	return WithInjectedTerms(terms...)
+}
+
+// synthetic returns true for terms injected with WithInjectedTerms
+func (t *token) synthetic() bool {
+	return t.start < 0
+}
+
+// inject inserts injected terms into the tokens of the checked domain's record
+func (p *parser) inject(tokens []*token) []*token {
+	if len(p.injected) == 0 || len(tokens) == 0 || tokens[0].mechanism != tVersion {
+		return tokens
+	}
+	r := make([]*token, 0, len(tokens)+len(p.injected))
+	r = append(r, tokens[0])
+	r = append(r, p.injected...)
+	return append(r, tokens[1:]...)
+}
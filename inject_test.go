@@ -0,0 +1,96 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type syntheticListener struct {
+	recordingListener
+}
+
+func (l *syntheticListener) SyntheticDirective(unused bool, qualifier, mechanism, value string) {
+	l.add("SyntheticDirective(%t, %s, %s, %s)", unused, qualifier, mechanism, value)
+}
+
+func TestWithInjectedTerms(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("injected.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`injected.example. 0 IN TXT "v=spf1 include:inc.injected.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("injected.example.")
+
+	dns.HandleFunc("inc.injected.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.injected.example. 0 IN TXT "v=spf1 ip4:10.0.0.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.injected.example.")
+
+	dns.HandleFunc("forwarder.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`forwarder.example. 0 IN TXT "v=spf1 ip4:172.16.0.1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("forwarder.example.")
+
+	_, allowed, _ := net.ParseCIDR("192.168.0.0/16")
+	opts := []Option{
+		WithResolver(testResolver),
+		WithInjectedTerms("include:forwarder.example", "bogus", "redirect=x.example"),
+		WithAllowlist(*allowed),
+	}
+
+	tests := []struct {
+		ip     string
+		r      Result
+		events []string
+	}{
+		{"10.0.0.1", Pass, []string{
+			"SyntheticDirective(false, +, include, forwarder.example)",
+			"SyntheticDirective(false, +, ip4, 192.168.0.0/16)",
+		}},
+		{"172.16.0.1", Pass, []string{
+			"SyntheticDirective(false, +, include, forwarder.example)",
+			"SyntheticDirective(true, +, ip4, 192.168.0.0/16)",
+		}},
+		{"192.168.1.1", Pass, []string{
+			"SyntheticDirective(false, +, include, forwarder.example)",
+			"SyntheticDirective(false, +, ip4, 192.168.0.0/16)",
+		}},
+		{"10.0.1.1", Fail, []string{
+			"SyntheticDirective(false, +, include, forwarder.example)",
+			"SyntheticDirective(false, +, ip4, 192.168.0.0/16)",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			l := &syntheticListener{}
+			r, _, _, err := CheckHost(net.ParseIP(test.ip), "injected.example", "john@injected.example",
+				append(opts, WithListener(l))...)
+			if r != test.r {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, test.r)
+			}
+			if got := l.filter("SyntheticDirective"); fmt.Sprint(got) != fmt.Sprint(test.events) {
+				t.Errorf("SyntheticDirective events:\n got=%q\nwant=%q", got, test.events)
+			}
+		})
+	}
+
+	p := Explain(net.ParseIP("192.168.1.1"), "injected.example", opts...)
+	var synthetic []string
+	for _, s := range p.Steps {
+		if s.Synthetic {
+			synthetic = append(synthetic, s.Term)
+		}
+	}
+	if want := []string{"include:forwarder.example", "ip4:192.168.0.0/16"}; fmt.Sprint(synthetic) != fmt.Sprint(want) {
+		t.Errorf("synthetic steps = %q; want %q", synthetic, want)
+	}
+}
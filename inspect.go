@@ -0,0 +1,102 @@
+package spf
+
+import (
+	"errors"
+	"net"
+)
+
+// Inspection is the outcome of InspectHost.
+type Inspection struct {
+	Terms   []*InspectedTerm  `json:"terms,omitempty"`   // visited terms in order of evaluation
+	Errors  int               `json:"errors"`            // number of terms which produced errors
+	ByKind  map[ErrorKind]int `json:"byKind,omitempty"`  // number of errors of each kind
+	Stopped bool              `json:"stopped,omitempty"` // inspection stopped by ErrorsThreshold or ErrorsThresholdByKind
+	Err     error             `json:"error,omitempty"`   // the reason the checked domain's policy wasn't inspected, if any
+
+	errs ErrorList
+}
+
+// InspectedTerm is the outcome of a single term visited by InspectHost.
+type InspectedTerm struct {
+	Domain    string `json:"domain"`              // domain which record has the term
+	Depth     int    `json:"depth"`               // number of "include" and "redirect" the domain is reached through
+	Term      string `json:"term"`                // the term as published
+	Effective string `json:"effective,omitempty"` // value of the term after macro expansion
+	Matches   bool   `json:"matches,omitempty"`   // the term matches the checked IP
+	Result    Result `json:"result,omitempty"`    // result the term would produce if it matches
+	Err       error  `json:"error,omitempty"`     // problem encountered while evaluating the term
+}
+
+// InspectHost walks SPF policy of the domain visiting every term, including
+// those CheckHost wouldn't get to, and reports outcomes of each of them.
+// Unlike CheckHost with IgnoreMatches option, it doesn't produce a result.
+// Use ErrorsThreshold to stop the inspection after too many errors.
+func InspectHost(ip net.IP, domain, sender string, opts ...Option) *Inspection {
+	opts = append(opts[:len(opts):len(opts)], IgnoreMatches())
+	e, _, _ := explain(ip, NormalizeFQDN(domain), sender, opts...)
+
+	in := &Inspection{}
+	if e.root == nil {
+		return in
+	}
+	switch err := e.root.Err; {
+	case errors.Is(err, ErrUnreliableResult):
+	case errors.Is(err, ErrTooManyErrors):
+		in.Stopped = true
+	default:
+		in.Err = e.root.Err
+	}
+	in.walk(e.root, 0)
+	return in
+}
+
+// FollowRedirects makes InspectHost (or CheckHost with IgnoreMatches option)
+// descend into "redirect" target of records having "all" as well, although
+// evaluation ignores "redirect" then, so the audit covers the redirected policy
+// too. Loops are detected as usual and reported as ErrLoopDetected of the
+// "redirect" term.
+// Without the option, such "redirect" is reported as unused.
+func FollowRedirects() Option {
+	return func(p *parser) {
+		p.followRedirects = true
+	}
+}
+
+// ErrorList returns errors of all the terms visited, nil if there were none.
+func (in *Inspection) ErrorList() ErrorList {
+	return in.errs
+}
+
+func (in *Inspection) walk(p *Path, depth int) {
+	for _, s := range p.Steps {
+		t := &InspectedTerm{
+			Domain:    p.Domain,
+			Depth:     depth,
+			Term:      s.Term,
+			Effective: s.Effective,
+			Matches:   s.Matched,
+			Result:    s.Result,
+			Err:       s.Err,
+		}
+		// nested policies are walked, they have no result of their own
+		if errors.Is(s.Err, ErrUnreliableResult) || errors.Is(s.Err, ErrTooManyErrors) {
+			t.Matches, t.Result, t.Err = false, 0, nil
+		}
+		if t.Err != nil {
+			in.Errors++
+			err := t.Err
+			if _, ok := err.(SyntaxError); !ok && s.token != nil {
+				err = SyntaxError{s.token, err}
+			}
+			in.errs = append(in.errs, err)
+			if in.ByKind == nil {
+				in.ByKind = make(map[ErrorKind]int)
+			}
+			in.ByKind[ErrorKindOf(t.Err)]++
+		}
+		in.Terms = append(in.Terms, t)
+		if s.Path != nil {
+			in.walk(s.Path, depth+1)
+		}
+	}
+}
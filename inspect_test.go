@@ -0,0 +1,155 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestInspectHost(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("inspect.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inspect.example. 0 IN TXT "v=spf1 ip4:10.0.0.0/8 include:inc.inspect.example a:void.inspect.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inspect.example.")
+
+	dns.HandleFunc("inc.inspect.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.inspect.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 ip4:10.0.0.300 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.inspect.example.")
+
+	format := func(in *Inspection) []string {
+		var s []string
+		for _, t := range in.Terms {
+			s = append(s, fmt.Sprintf("%d %s %s %t %s %t", t.Depth, t.Domain, t.Term, t.Matches, t.Result, t.Err != nil))
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		domain  string
+		opts    []Option
+		terms   []string
+		errors  int
+		stopped bool
+		err     error
+	}{
+		{"whole policy", "inspect.example", nil,
+			[]string{
+				"0 inspect.example. ip4:10.0.0.0/8 true pass false",
+				"0 inspect.example. include:inc.inspect.example false 0 false",
+				"1 inc.inspect.example. ip4:10.0.0.1 true pass false",
+				"1 inc.inspect.example. ip4:10.0.0.300 true permerror true",
+				"1 inc.inspect.example. -all true fail false",
+				"0 inspect.example. a:void.inspect.example false 0 false",
+				"0 inspect.example. -all true fail false",
+			}, 1, false, nil},
+		{"errors threshold", "inspect.example", []Option{ErrorsThreshold(1)},
+			[]string{
+				"0 inspect.example. ip4:10.0.0.0/8 true pass false",
+				"0 inspect.example. include:inc.inspect.example false 0 false",
+				"1 inc.inspect.example. ip4:10.0.0.1 true pass false",
+				"1 inc.inspect.example. ip4:10.0.0.300 true permerror true",
+			}, 1, true, nil},
+		{"no record", "void.inspect.example", nil, nil, 0, false, ErrSPFNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := append([]Option{WithResolver(testResolver)}, test.opts...)
+			in := InspectHost(net.ParseIP("10.0.0.1"), test.domain, "", opts...)
+			if got := format(in); fmt.Sprint(got) != fmt.Sprint(test.terms) {
+				t.Errorf("InspectHost() terms:\n got=%q\nwant=%q", got, test.terms)
+			}
+			if len(in.ErrorList()) != test.errors {
+				t.Errorf("ErrorList() = %v; want %d errors", in.ErrorList(), test.errors)
+			}
+			if test.errors > 0 && !errors.Is(in.ErrorList(), SyntaxError{&token{tIP4, qPlus, "10.0.0.300", 0, 0}, nil}) {
+				t.Errorf("ErrorList() = %v; want error of ip4:10.0.0.300", in.ErrorList())
+			}
+			if in.Errors != test.errors || in.Stopped != test.stopped || in.Err != test.err {
+				t.Errorf("InspectHost() = %d errors, stopped %t, %v; want %d, %t, %v",
+					in.Errors, in.Stopped, in.Err, test.errors, test.stopped, test.err)
+			}
+		})
+	}
+}
+
+func TestInspectHost_FollowRedirects(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("redir.inspect.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`redir.inspect.example. 0 IN TXT "v=spf1 ip4:10.0.0.2 -all redirect=target.inspect.example"`,
+		},
+	}))
+	defer dns.HandleRemove("redir.inspect.example.")
+
+	dns.HandleFunc("target.inspect.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`target.inspect.example. 0 IN TXT "v=spf1 ip4:10.0.0.3 -all redirect=redir.inspect.example"`,
+		},
+	}))
+	defer dns.HandleRemove("target.inspect.example.")
+
+	format := func(in *Inspection) []string {
+		var s []string
+		for _, t := range in.Terms {
+			s = append(s, fmt.Sprintf("%d %s %s %t %s %t", t.Depth, t.Domain, t.Term, t.Matches, t.Result, t.Err != nil))
+		}
+		return s
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		terms  []string
+		errors int
+		unused []string
+	}{
+		{"ignored", nil,
+			[]string{
+				"0 redir.inspect.example. ip4:10.0.0.2 false 0 false",
+				"0 redir.inspect.example. -all true fail false",
+			}, 0,
+			[]string{"Directive(true, +, redirect, target.inspect.example, )"}},
+		{"followed", []Option{FollowRedirects()},
+			[]string{
+				"0 redir.inspect.example. ip4:10.0.0.2 false 0 false",
+				"0 redir.inspect.example. -all true fail false",
+				"0 redir.inspect.example. redirect=target.inspect.example false 0 false",
+				"1 target.inspect.example. ip4:10.0.0.3 false 0 false",
+				"1 target.inspect.example. -all true fail false",
+				"1 target.inspect.example. redirect=redir.inspect.example true permerror true",
+			}, 1, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &recordingListener{}
+			opts := append([]Option{WithResolver(testResolver), WithListener(l)}, test.opts...)
+			in := InspectHost(net.ParseIP("10.0.0.1"), "redir.inspect.example", "", opts...)
+			if got := format(in); fmt.Sprint(got) != fmt.Sprint(test.terms) {
+				t.Errorf("InspectHost() terms:\n got=%q\nwant=%q", got, test.terms)
+			}
+			if in.Errors != test.errors {
+				t.Errorf("InspectHost() = %d errors; want %d", in.Errors, test.errors)
+			}
+			if test.errors > 0 && !errors.Is(in.ErrorList(), ErrLoopDetected) {
+				t.Errorf("ErrorList() = %v; want %v", in.ErrorList(), ErrLoopDetected)
+			}
+			if got := l.filter("Directive(true"); fmt.Sprint(got) != fmt.Sprint(test.unused) {
+				t.Errorf("unused directives = %q; want %q", got, test.unused)
+			}
+		})
+	}
+}
@@ -35,7 +35,7 @@ func (l *lexer) scan() *token {
 	for {
 		r, eof := l.next()
 		if eof {
-			return &token{tEOF, tEOF, ""}
+			return &token{tEOF, tEOF, "", l.pos, l.pos}
 		} else if isWhitespace(r) || l.eof() { // we just scanned some meaningful data
 			token := l.scanIdent()
 			l.scanWhitespaces()
@@ -87,9 +87,15 @@ func (l *lexer) scanWhitespaces() {
 // A cursor tries to find delimiters and set proper `mechanism`, `qualifier`
 // and value itself.
 // The default token has `mechanism` set to tErr, that is, error state.
+// Token spans the scanned term including qualifier but without trailing
+// whitespaces.
 func (l *lexer) scanIdent() *token {
-	t := &token{tErr, qPlus, ""}
 	start := l.start
+	end := len(strings.TrimRight(l.input[:l.pos], " \t\n"))
+	if end < start {
+		end = start
+	}
+	t := &token{tErr, qPlus, "", start, end}
 	cursor := l.start
 	hasQualifier := false
 loop:
@@ -99,6 +105,9 @@ loop:
 
 		switch ch {
 		case '+', '-', '~', '?':
+			if l.start != cursor-size {
+				continue // not a qualifier, but a part of the name
+			}
 			if hasQualifier {
 				t.qualifier = qErr // multiple qualifiers
 			} else {
@@ -110,6 +119,12 @@ loop:
 		case '=', ':', '/':
 			if t.qualifier != qErr {
 				t.mechanism = tokenTypeFromString(l.input[l.start : cursor-size])
+				if t.mechanism == tErr && ch == '=' && !hasQualifier && isModifierName(l.input[l.start:cursor-size]) {
+					// unknown-modifier keeps the name along with its value
+					t.mechanism = tUnknownModifier
+					t.value = strings.TrimSpace(l.input[l.start:l.pos])
+					break loop
+				}
 				p := cursor
 				if ch == '/' { // special case for (mx|a) dual-cidr-length
 					p = cursor - size
@@ -38,35 +38,43 @@ func TestLexerScanIdent(t *testing.T) {
 		query string
 		want  *token
 	}{
-		{"v=spf1", &token{tVersion, qPlus, "spf1"}},
-		{"v=spf1 ", &token{tVersion, qPlus, "spf1"}},
-		{"A:127.0.0.1", &token{tA, qPlus, "127.0.0.1"}},
-		{"a:127.0.0.1", &token{tA, qPlus, "127.0.0.1"}},
-		{"a", &token{tA, qPlus, ""}},
-		{"A", &token{tA, qPlus, ""}},
-		{"a:127.0.0.1 ", &token{tA, qPlus, "127.0.0.1"}},
-		{"?a:127.0.0.1   ", &token{tA, qQuestionMark, "127.0.0.1"}},
-		{"?ip6:2001::43   ", &token{tIP6, qQuestionMark, "2001::43"}},
-		{"+ip6:::1", &token{tIP6, qPlus, "::1"}},
-		{"^ip6:2001::4", &token{tErr, qErr, "^ip6:2001::4"}},
-		{"-all", &token{tAll, qMinus, ""}},
-		{"-all ", &token{tAll, qMinus, ""}},
-		{"-mx:localhost", &token{tMX, qMinus, "localhost"}},
-		{"mx", &token{tMX, qPlus, ""}},
-		{"a:", &token{tErr, qErr, "a:"}},
-		{"?mx:localhost", &token{tMX, qQuestionMark, "localhost"}},
-		{"?random:localhost", &token{tErr, qErr, "?random:localhost"}},
-		{"-:localhost", &token{tErr, qErr, "-:localhost"}},
-		{"", &token{tErr, qErr, ""}},
-		{"qowie", &token{tErr, qErr, "qowie"}},
-		{"~+all", &token{tErr, qErr, "~+all"}},
-		{"-~all", &token{tErr, qErr, "-~all"}},
-		{"mx", &token{tMX, qPlus, ""}},
-		{"mx/24", &token{tMX, qPlus, "/24"}},
-		{"~mx/24", &token{tMX, qTilde, "/24"}},
-		{"a", &token{tA, qPlus, ""}},
-		{"a/24", &token{tA, qPlus, "/24"}},
-		{"~a/24", &token{tA, qTilde, "/24"}},
+		{"v=spf1", &token{tVersion, qPlus, "spf1", 0, 6}},
+		{"v=spf1 ", &token{tVersion, qPlus, "spf1", 0, 6}},
+		{"A:127.0.0.1", &token{tA, qPlus, "127.0.0.1", 0, 11}},
+		{"a:127.0.0.1", &token{tA, qPlus, "127.0.0.1", 0, 11}},
+		{"a", &token{tA, qPlus, "", 0, 1}},
+		{"A", &token{tA, qPlus, "", 0, 1}},
+		{"a:127.0.0.1 ", &token{tA, qPlus, "127.0.0.1", 0, 11}},
+		{"?a:127.0.0.1   ", &token{tA, qQuestionMark, "127.0.0.1", 0, 12}},
+		{"?ip6:2001::43   ", &token{tIP6, qQuestionMark, "2001::43", 0, 13}},
+		{"+ip6:::1", &token{tIP6, qPlus, "::1", 0, 8}},
+		{"^ip6:2001::4", &token{tErr, qErr, "^ip6:2001::4", 0, 12}},
+		{"-all", &token{tAll, qMinus, "", 0, 4}},
+		{"-all ", &token{tAll, qMinus, "", 0, 4}},
+		{"-mx:localhost", &token{tMX, qMinus, "localhost", 0, 13}},
+		{"mx", &token{tMX, qPlus, "", 0, 2}},
+		{"a:", &token{tErr, qErr, "a:", 0, 2}},
+		{"?mx:localhost", &token{tMX, qQuestionMark, "localhost", 0, 13}},
+		{"?random:localhost", &token{tErr, qErr, "?random:localhost", 0, 17}},
+		{"-:localhost", &token{tErr, qErr, "-:localhost", 0, 11}},
+		{"", &token{tErr, qErr, "", 0, 0}},
+		{"qowie", &token{tErr, qErr, "qowie", 0, 5}},
+		{"~+all", &token{tErr, qErr, "~+all", 0, 5}},
+		{"-~all", &token{tErr, qErr, "-~all", 0, 5}},
+		{"mx", &token{tMX, qPlus, "", 0, 2}},
+		{"mx/24", &token{tMX, qPlus, "/24", 0, 5}},
+		{"~mx/24", &token{tMX, qTilde, "/24", 0, 6}},
+		{"a", &token{tA, qPlus, "", 0, 1}},
+		{"a/24", &token{tA, qPlus, "/24", 0, 4}},
+		{"~a/24", &token{tA, qTilde, "/24", 0, 5}},
+		{"ra=postmaster", &token{tUnknownModifier, qPlus, "ra=postmaster", 0, 13}},
+		{"Rp=100 ", &token{tUnknownModifier, qPlus, "Rp=100", 0, 6}},
+		{"rr=", &token{tUnknownModifier, qPlus, "rr=", 0, 3}},
+		{"x.y-z_=%{d}", &token{tUnknownModifier, qPlus, "x.y-z_=%{d}", 0, 11}},
+		{"+ra=postmaster", &token{tErr, qErr, "+ra=postmaster", 0, 14}},
+		{"1ra=postmaster", &token{tErr, qErr, "1ra=postmaster", 0, 14}},
+		{"=postmaster", &token{tErr, qErr, "=postmaster", 0, 11}},
+		{"a-all", &token{tErr, qErr, "a-all", 0, 5}},
 	}
 
 	for _, test := range tests {
@@ -85,53 +93,53 @@ func TestLexFunc(t *testing.T) {
 		Record string
 		Tokens []*token
 	}
-	versionToken := &token{tVersion, qPlus, "spf1"}
+	versionToken := &token{tVersion, qPlus, "spf1", 0, 6}
 
 	testpairs := []TestPair{
 		{"v=spf1 a:127.0.0.1",
 			[]*token{
 				versionToken,
-				{tA, qPlus, "127.0.0.1"}}},
+				{tA, qPlus, "127.0.0.1", 7, 18}}},
 		{"v=spf1 ip4:127.0.0.1 -all",
 			[]*token{
 				versionToken,
-				{tIP4, qPlus, "127.0.0.1"},
-				{tAll, qMinus, ""}}},
+				{tIP4, qPlus, "127.0.0.1", 7, 20},
+				{tAll, qMinus, "", 21, 25}}},
 		{"v=spf1  -ptr:arpa.1.0.0.127   -all  ",
 			[]*token{
 				versionToken,
-				{tPTR, qMinus, "arpa.1.0.0.127"},
-				{tAll, qMinus, ""}}},
+				{tPTR, qMinus, "arpa.1.0.0.127", 8, 27},
+				{tAll, qMinus, "", 30, 34}}},
 		{"v=spf1  ~ip6:2001:db8::cd30 ?all  ",
 			[]*token{
 				versionToken,
-				{tIP6, qTilde, "2001:db8::cd30"},
-				{tAll, qQuestionMark, ""}}},
+				{tIP6, qTilde, "2001:db8::cd30", 8, 27},
+				{tAll, qQuestionMark, "", 28, 32}}},
 		{"v=spf1  include:example.org -all  ",
 			[]*token{
 				versionToken,
-				{tInclude, qPlus, "example.org"},
-				{tAll, qMinus, ""}}},
+				{tInclude, qPlus, "example.org", 8, 27},
+				{tAll, qMinus, "", 28, 32}}},
 		{"v=spf1  include=example.org -all  ",
 			[]*token{
 				versionToken,
-				{tErr, qErr, "include=example.org"},
-				{tAll, qMinus, ""}}},
+				{tErr, qErr, "include=example.org", 8, 27},
+				{tAll, qMinus, "", 28, 32}}},
 		{"v=spf1  exists:%{ir}.%{l1r+-}._spf.%{d} +all",
 			[]*token{
 				versionToken,
-				{tExists, qPlus, "%{ir}.%{l1r+-}._spf.%{d}"},
-				{tAll, qPlus, ""}}},
+				{tExists, qPlus, "%{ir}.%{l1r+-}._spf.%{d}", 8, 39},
+				{tAll, qPlus, "", 40, 44}}},
 		{"v=spf1  redirect=_spf.example.org",
 			[]*token{
 				versionToken,
-				{tRedirect, qPlus, "_spf.example.org"}}},
+				{tRedirect, qPlus, "_spf.example.org", 8, 33}}},
 		{"v=spf1 mx -all exp=explain._spf.%{d}",
 			[]*token{
 				versionToken,
-				{tMX, qPlus, ""},
-				{tAll, qMinus, ""},
-				{tExp, qPlus, "explain._spf.%{d}"}}},
+				{tMX, qPlus, "", 7, 9},
+				{tAll, qMinus, "", 10, 14},
+				{tExp, qPlus, "explain._spf.%{d}", 15, 36}}},
 	}
 
 	for _, testpair := range testpairs {
@@ -0,0 +1,64 @@
+package spf
+
+// Limits of RFC 7208 section 4.6.4 and of domain names
+// https://tools.ietf.org/html/rfc7208#section-4.6.4
+const (
+	MaxDNSLookups  = 10  // terms causing DNS lookups per check: "include", "a", "mx", "ptr", "exists" and "redirect"
+	MaxVoidLookups = 2   // lookups returning no answers per check
+	MaxPTRNames    = 10  // names of PTR records "ptr" mechanism validates, the rest are ignored
+	MaxMXNames     = 10  // MX records "mx" mechanism processes, more of them produce "permerror"
+	MaxDomainLen   = 253 // characters of a domain name, not counting the trailing dot
+)
+
+// Limits are the limits of evaluation, the defaults are those of RFC 7208.
+// Zero fields stand for the defaults.
+type Limits struct {
+	DNSLookups  int `json:"dnsLookups,omitempty"`  // see MaxDNSLookups
+	VoidLookups int `json:"voidLookups,omitempty"` // see MaxVoidLookups
+	PTRNames    int `json:"ptrNames,omitempty"`    // see MaxPTRNames
+	MXNames     int `json:"mxNames,omitempty"`     // see MaxMXNames
+}
+
+// DefaultLimits returns the limits of RFC 7208.
+func DefaultLimits() Limits {
+	return Limits{
+		DNSLookups:  MaxDNSLookups,
+		VoidLookups: MaxVoidLookups,
+		PTRNames:    MaxPTRNames,
+		MXNames:     MaxMXNames,
+	}
+}
+
+// normalized returns l with zero fields set to the defaults
+func (l Limits) normalized() Limits {
+	d := DefaultLimits()
+	if l.DNSLookups <= 0 {
+		l.DNSLookups = d.DNSLookups
+	}
+	if l.VoidLookups <= 0 {
+		l.VoidLookups = d.VoidLookups
+	}
+	if l.PTRNames <= 0 {
+		l.PTRNames = d.PTRNames
+	}
+	if l.MXNames <= 0 {
+		l.MXNames = d.MXNames
+	}
+	return l
+}
+
+// Resolver returns LimitedResolver of r enforcing the DNS lookups and MX names
+// limits, the way NewLimitedResolver(r, 10, 10) does with the defaults.
+func (l Limits) Resolver(r Resolver) Resolver {
+	l = l.normalized()
+	return NewLimitedResolver(r, uint16(l.DNSLookups), uint16(l.MXNames))
+}
+
+// WithLimits makes evaluation apply the limits of void lookups and PTR names
+// and the limits of the default resolver. Resolvers given with WithResolver
+// enforce limits of their own, see Limits.Resolver.
+func WithLimits(l Limits) Option {
+	return func(p *parser) {
+		p.limits = l.normalized()
+	}
+}
@@ -0,0 +1,59 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestLimits_normalized(t *testing.T) {
+	if got := (Limits{}).normalized(); got != DefaultLimits() {
+		t.Errorf("normalized() = %+v; want %+v", got, DefaultLimits())
+	}
+	l := Limits{DNSLookups: 20, VoidLookups: 1}
+	want := Limits{DNSLookups: 20, VoidLookups: 1, PTRNames: MaxPTRNames, MXNames: MaxMXNames}
+	if got := l.normalized(); got != want {
+		t.Errorf("normalized() = %+v; want %+v", got, want)
+	}
+}
+
+func TestLimits_Resolver(t *testing.T) {
+	r, err := NewOverlayResolver(nil, map[string][]string{"limits.example": {"v=spf1 -all"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := Limits{DNSLookups: 3}.Resolver(r)
+	for i := 0; i < 2; i++ {
+		if _, _, err := limited.LookupTXTStrict("limits.example."); err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+	}
+	if _, _, err := limited.LookupTXTStrict("limits.example."); !errors.Is(err, ErrDNSLimitExceeded) {
+		t.Errorf("LookupTXTStrict() = %v; want %v", err, ErrDNSLimitExceeded)
+	}
+}
+
+func TestWithLimits(t *testing.T) {
+	r, err := NewOverlayResolver(testResolver, map[string][]string{
+		"limits.example":       {"v=spf1 a:none1.limits.example a:none2.limits.example -all"},
+		"none1.limits.example": nil,
+		"none2.limits.example": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		limits Limits
+		want   Result
+		err    error
+	}{
+		{Limits{}, Fail, nil},
+		{Limits{VoidLookups: 1}, Permerror, ErrTooManyVoidLookups},
+	}
+	for _, tt := range tests {
+		res, _, _, err := CheckHost(net.ParseIP("192.0.2.1"), "limits.example", "", WithResolver(r), WithLimits(tt.limits))
+		if res != tt.want || !errors.Is(err, tt.err) || tt.err == nil && err != nil {
+			t.Errorf("CheckHost(%+v) = %s, %v; want %s, %v", tt.limits, res, err, tt.want, tt.err)
+		}
+	}
+}
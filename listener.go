@@ -1,7 +1,10 @@
 package spf
 
 import (
+	"context"
 	"net"
+
+	"github.com/miekg/dns"
 )
 
 type Listener interface {
@@ -13,3 +16,118 @@ type Listener interface {
 	Match(qualifier, mechanism, value string, result Result, explanation string, err error)
 	MatchingIP(qualifier, mechanism, value string, fqdn string, ipn net.IPNet, host string, ip net.IP)
 }
+
+// ExtrasListener is an optional interface a Listener could implement to get
+// ResponseExtras of DNS lookups made during evaluation.
+// Token related arguments are empty for the lookup of the SPF record itself.
+// Queries, VoidLookups and Duration of the extras are the DNS cost of the term.
+type ExtrasListener interface {
+	LookupExtras(qualifier, mechanism, value, fqdn string, extras *ResponseExtras)
+}
+
+// RawResponseListener is an optional interface a Listener could implement to
+// get DNS responses the evaluation used as they were received, e.g. to archive
+// the evidence of the verdict. RawResponse is called for every response of
+// the lookup right before the corresponding LookupExtras. Only Resolver
+// returned by NewMiekgDNSResolver provides responses; responses served from
+// its cache are the cached ones and must not be modified.
+type RawResponseListener interface {
+	RawResponse(question dns.Question, msg *dns.Msg)
+}
+
+// PinListener is an optional interface a Listener could implement to be
+// notified when a pinned policy is used instead of the published one.
+type PinListener interface {
+	Pinned(domain string, pin Pin)
+}
+
+// PositionListener is an optional interface a Listener could implement to get
+// byte offsets [start, end) of directives in the SPF record being evaluated.
+// DirectivePosition is called right before the corresponding Directive.
+// Offsets are -1 for terms not present in the record (see WithInjectedTerms).
+type PositionListener interface {
+	DirectivePosition(unused bool, qualifier, mechanism, value string, start, end int)
+}
+
+// DirectiveInfoListener is an optional interface a Listener could implement
+// to get directives along with their kind, position and other metadata
+// instead of inferring them from names. DirectiveInfo is called right before
+// the corresponding Directive. Unknown modifiers, which Directive doesn't
+// get, are reported too, right before the corresponding UnknownModifier.
+type DirectiveInfoListener interface {
+	DirectiveInfo(info DirectiveInfo)
+}
+
+// ModifierListener is an optional interface a Listener could implement to get
+// modifiers of SPF record not known to the evaluation, e.g. "ra=" of RFC 6652.
+// The name is lowercased and the value is not macro-expanded.
+type ModifierListener interface {
+	UnknownModifier(name, value string)
+}
+
+// LocalPolicyListener is an optional interface a Listener could implement to
+// be notified when local policy is applied to the checked domain (see
+// WithLocalPolicy): either the synthetic record is evaluated or the result
+// is overridden.
+type LocalPolicyListener interface {
+	LocalPolicy(domain, record string, r Result)
+}
+
+// SyntheticListener is an optional interface a Listener could implement to
+// tell apart directives injected with WithInjectedTerms. SyntheticDirective is
+// called right before the corresponding Directive.
+type SyntheticListener interface {
+	SyntheticDirective(unused bool, qualifier, mechanism, value string)
+}
+
+// IssueListener is an optional interface a Listener could implement to get
+// problems of SPF records tolerated in Lenient mode (see WithParsingMode).
+// The term is given in its normalized form.
+type IssueListener interface {
+	Issue(term string, err error)
+}
+
+// SPFRRListener is an optional interface a Listener could implement to be
+// notified when SPF record published as SPF RR type differs from the one
+// published as TXT (see LookupSPFRR). The rrs are all SPF RR records of the
+// domain and txt is SPF record selected from TXT records, if any.
+type SPFRRListener interface {
+	SPFRRConflict(domain string, rrs []string, txt string)
+}
+
+// NearMissListener is an optional interface a Listener could implement to
+// get TXT records of domains which look like SPF records but are ignored,
+// see NearMisses.
+type NearMissListener interface {
+	NearMiss(domain, record string, kind NearMissKind)
+}
+
+// PTRListener is an optional interface a Listener could implement to be
+// notified of PTR names "ptr" mechanism didn't use: names over the limit
+// of 10 (ErrTooManyPTRNames), names not resolving to the checked IP
+// (ErrPTRNotConfirmed) and names failed to resolve.
+type PTRListener interface {
+	SkippedPTRName(qualifier, mechanism, value, name string, err error)
+}
+
+// NestingListener is an optional interface a Listener could implement to
+// follow nesting of the evaluation without inferring it from CheckHost calls.
+// EnterInclude and EnterRedirect are called right before the evaluation of
+// the domain reached by "include" or "redirect" and Exit right after it with
+// the result of the domain. depth is 1 for the domains reached from the
+// checked one and grows by one with every nested "include" or "redirect".
+// Includes with results reused (see MemoizeIncludes) are not entered.
+type NestingListener interface {
+	EnterInclude(domain string, depth int)
+	EnterRedirect(domain string, depth int)
+	Exit(domain string, depth int, r Result)
+}
+
+// ContextListener is an optional interface a Listener could implement to get
+// the context of the check (see WithContext), e.g. to log request IDs along
+// with the events. CheckHostContext is called right before the corresponding
+// CheckHost with the context of the domain's evaluation, the one returned by
+// the decorator for nested domains (see WithContextDecorator).
+type ContextListener interface {
+	CheckHostContext(ctx context.Context, ip net.IP, domain, sender string)
+}
@@ -0,0 +1,303 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// recordingListener keeps string representation of every received event
+type recordingListener struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *recordingListener) add(format string, a ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, fmt.Sprintf(format, a...))
+}
+
+func (l *recordingListener) CheckHost(ip net.IP, domain, sender string) {
+	l.add("CheckHost(%s, %s, %s)", ip, domain, sender)
+}
+
+func (l *recordingListener) CheckHostResult(r Result, explanation string, err error) {
+	l.add("CheckHostResult(%s, %q, %v)", r, explanation, err)
+}
+
+func (l *recordingListener) SPFRecord(s string) {
+	l.add("SPFRecord(%s)", s)
+}
+
+func (l *recordingListener) Directive(unused bool, qualifier, mechanism, value, effectiveValue string) {
+	l.add("Directive(%t, %s, %s, %s, %s)", unused, qualifier, mechanism, value, effectiveValue)
+}
+
+func (l *recordingListener) NonMatch(qualifier, mechanism, value string, result Result, err error) {
+	l.add("NonMatch(%s, %s, %s, %s, %v)", qualifier, mechanism, value, result, err)
+}
+
+func (l *recordingListener) Match(qualifier, mechanism, value string, result Result, explanation string, err error) {
+	l.add("Match(%s, %s, %s, %s, %q, %v)", qualifier, mechanism, value, result, explanation, err)
+}
+
+func (l *recordingListener) MatchingIP(qualifier, mechanism, value string, fqdn string, ipn net.IPNet, host string, ip net.IP) {
+	l.add("MatchingIP(%s, %s, %s, %s, %s, %s, %s)", qualifier, mechanism, value, fqdn, ipn.String(), host, ip)
+}
+
+type extrasListener struct {
+	recordingListener
+}
+
+func (l *extrasListener) LookupExtras(qualifier, mechanism, value, fqdn string, extras *ResponseExtras) {
+	l.add("LookupExtras(%s, %s, %s, %s, void=%t, answers=%d)", qualifier, mechanism, value, fqdn, extras.Void, extras.Answers)
+}
+
+func (l *recordingListener) filter(prefix string) []string {
+	var r []string
+	for _, e := range l.events {
+		if len(e) >= len(prefix) && e[:len(prefix)] == prefix {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+func TestExtrasListener(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("extras.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`extras.example. 0 IN TXT "v=spf1 a:a.extras.example exists:void.extras.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("extras.example.")
+
+	dns.HandleFunc("a.extras.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`a.extras.example. 0 IN A 10.0.0.1`,
+			`a.extras.example. 0 IN A 10.0.0.2`,
+		},
+	}))
+	defer dns.HandleRemove("a.extras.example.")
+
+	l := &extrasListener{}
+	r, _, _, err := CheckHost(net.ParseIP("10.0.0.3"), "extras.example", "extras.example", WithResolver(testResolver), WithListener(l))
+	if r != Fail || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want fail", r, err)
+	}
+
+	want := []string{
+		"LookupExtras(, , , extras.example., void=false, answers=1)",
+		"LookupExtras(+, a, a.extras.example, a.extras.example., void=false, answers=2)",
+		"LookupExtras(+, exists, void.extras.example, void.extras.example., void=true, answers=0)",
+	}
+	got := l.filter("LookupExtras")
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("LookupExtras events:\n got=%q\nwant=%q", got, want)
+	}
+}
+
+type rawResponseListener struct {
+	extrasListener
+}
+
+func (l *rawResponseListener) RawResponse(question dns.Question, msg *dns.Msg) {
+	l.add("RawResponse(%s, %s, rcode=%s, answers=%d)", question.Name, dns.TypeToString[question.Qtype], dns.RcodeToString[msg.Rcode], len(msg.Answer))
+}
+
+func TestRawResponseListener(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("raw.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`raw.example. 0 IN TXT "v=spf1 mx exists:void.raw.example -all"`,
+		},
+		dns.TypeMX: {
+			`raw.example. 0 IN MX 10 mx.raw.example.`,
+		},
+	}))
+	defer dns.HandleRemove("raw.example.")
+
+	// sequential lookups keep the order of A and AAAA responses
+	resolver, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr, MiekgDNSParallelism(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &rawResponseListener{}
+	r, _, _, err := CheckHost(net.ParseIP("10.0.0.3"), "raw.example", "raw.example", WithResolver(resolver), WithListener(l))
+	if r != Fail || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want fail", r, err)
+	}
+
+	want := []string{
+		"RawResponse(raw.example., TXT, rcode=NOERROR, answers=1)",
+		"LookupExtras(, , , raw.example., void=false, answers=1)",
+		"RawResponse(raw.example., MX, rcode=NOERROR, answers=1)",
+		"RawResponse(mx.raw.example., A, rcode=NOERROR, answers=0)",
+		"RawResponse(mx.raw.example., AAAA, rcode=NOERROR, answers=0)",
+		"LookupExtras(+, mx, , raw.example., void=false, answers=1)",
+		"RawResponse(void.raw.example., A, rcode=NOERROR, answers=0)",
+		"LookupExtras(+, exists, void.raw.example, void.raw.example., void=true, answers=0)",
+	}
+	var got []string
+	for _, e := range l.events {
+		if strings.HasPrefix(e, "RawResponse") || strings.HasPrefix(e, "LookupExtras") {
+			got = append(got, e)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events:\n got=%q\nwant=%q", got, want)
+	}
+}
+
+type positionListener struct {
+	recordingListener
+}
+
+func (l *positionListener) DirectivePosition(unused bool, qualifier, mechanism, value string, start, end int) {
+	l.add("DirectivePosition(%t, %s, %s, %s, %d, %d)", unused, qualifier, mechanism, value, start, end)
+}
+
+func TestPositionListener(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("position.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`position.example. 0 IN TXT "v=spf1  ip4:10.0.0.0/8 -all redirect=other.example"`,
+		},
+	}))
+	defer dns.HandleRemove("position.example.")
+
+	l := &positionListener{}
+	r, _, _, err := CheckHost(net.ParseIP("10.0.0.3"), "position.example", "position.example", WithResolver(testResolver), WithListener(l))
+	if r != Pass || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want pass", r, err)
+	}
+
+	want := []string{
+		"DirectivePosition(false, +, v, spf1, 0, 6)",
+		"DirectivePosition(false, +, ip4, 10.0.0.0/8, 8, 22)",
+		"DirectivePosition(true, -, all, , 23, 27)",
+		"DirectivePosition(true, +, redirect, other.example, 28, 50)",
+	}
+	got := l.filter("DirectivePosition")
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("DirectivePosition events:\n got=%q\nwant=%q", got, want)
+	}
+}
+
+type modifierListener struct {
+	recordingListener
+}
+
+func (l *modifierListener) UnknownModifier(name, value string) {
+	l.add("UnknownModifier(%s, %s)", name, value)
+}
+
+func TestModifierListener(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("modifier.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`modifier.example. 0 IN TXT "v=spf1 ra=postmaster -all rp=100 rr=all:e"`,
+		},
+	}))
+	defer dns.HandleRemove("modifier.example.")
+
+	l := &modifierListener{}
+	r, _, _, err := CheckHost(net.ParseIP("10.0.0.3"), "modifier.example", "modifier.example", WithResolver(testResolver), WithListener(l))
+	if r != Fail || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want fail", r, err)
+	}
+
+	want := []string{
+		"UnknownModifier(ra, postmaster)",
+		"UnknownModifier(rp, 100)",
+		"UnknownModifier(rr, all:e)",
+	}
+	got := l.filter("UnknownModifier")
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("UnknownModifier events:\n got=%q\nwant=%q", got, want)
+	}
+}
+
+type nestingListener struct {
+	recordingListener
+}
+
+func (l *nestingListener) EnterInclude(domain string, depth int) {
+	l.add("Enter(include, %s, %d)", domain, depth)
+}
+
+func (l *nestingListener) EnterRedirect(domain string, depth int) {
+	l.add("Enter(redirect, %s, %d)", domain, depth)
+}
+
+func (l *nestingListener) Exit(domain string, depth int, r Result) {
+	l.add("Exit(%s, %d, %s)", domain, depth, r)
+}
+
+func TestNestingListener(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("nesting.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`nesting.example. 0 IN TXT "v=spf1 include:a.nesting.example include:b.nesting.example redirect=c.nesting.example"`,
+		},
+	}))
+	defer dns.HandleRemove("nesting.example.")
+
+	dns.HandleFunc("a.nesting.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`a.nesting.example. 0 IN TXT "v=spf1 include:b.nesting.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("a.nesting.example.")
+
+	dns.HandleFunc("b.nesting.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`b.nesting.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("b.nesting.example.")
+
+	dns.HandleFunc("c.nesting.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`c.nesting.example. 0 IN TXT "v=spf1 redirect=b.nesting.example"`,
+		},
+	}))
+	defer dns.HandleRemove("c.nesting.example.")
+
+	want := []string{
+		"Enter(include, a.nesting.example., 1)",
+		"Enter(include, b.nesting.example., 2)",
+		"Exit(b.nesting.example., 2, fail)",
+		"Exit(a.nesting.example., 1, fail)",
+		"Enter(include, b.nesting.example., 1)",
+		"Exit(b.nesting.example., 1, fail)",
+		"Enter(redirect, c.nesting.example., 1)",
+		"Enter(redirect, b.nesting.example., 2)",
+		"Exit(b.nesting.example., 2, fail)",
+		"Exit(c.nesting.example., 1, fail)",
+	}
+	for _, concurrency := range []int{0, 4} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			l := &nestingListener{}
+			r, _, _, err := CheckHost(net.ParseIP("10.0.0.3"), "nesting.example", "nesting.example",
+				WithResolver(testResolver), WithListener(l), ConcurrentIncludes(concurrency))
+			if r != Fail || err != nil {
+				t.Fatalf("CheckHost() = %s, %v; want fail", r, err)
+			}
+			got := l.filter("E")
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("nesting events:\n got=%q\nwant=%q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package spf
+
+// LocalPolicy is a set of hooks letting the caller apply local policy to the
+// checked domain, e.g. "best guess" SPF for domains publishing no record:
+//
+//	spf.WithLocalPolicy(spf.LocalPolicy{
+//		After: func(domain string, r spf.Result, err error) (string, spf.Result) {
+//			if r == spf.None {
+//				return "v=spf1 a/24 mx/24 ?all", 0
+//			}
+//			return "", 0
+//		},
+//	})
+//
+// Hooks are called for the checked domain only, never for domains reached
+// through "include" or "redirect". Both hooks are optional. Pins (see
+// WithPins) take precedence over Before.
+type LocalPolicy struct {
+	// Before is called before the lookup of SPF record of the domain.
+	// Non-empty record returned is evaluated instead of the published one.
+	Before func(domain string) (record string)
+	// After is called when evaluation of the domain's policy results in
+	// None or Permerror. Non-empty record returned is evaluated and its
+	// result is used, otherwise non-zero result returned replaces the one
+	// produced by evaluation.
+	After func(domain string, r Result, err error) (record string, result Result)
+}
+
+// WithLocalPolicy sets hooks applying local policy to the checked domain.
+func WithLocalPolicy(l LocalPolicy) Option {
+	return func(p *parser) {
+		p.localPolicy = l
+	}
+}
+
+// topLevel returns true if p is about to evaluate the checked domain
+func (p *parser) topLevel() bool {
+	return len(p.visited.s) == 0
+}
+
+// localRecord returns synthetic record for the domain if local policy has one
+func (p *parser) localRecord(domain string) (string, bool) {
+	if p.localPolicy.Before == nil || !p.topLevel() {
+		return "", false
+	}
+	record := p.localPolicy.Before(domain)
+	if record == "" {
+		return "", false
+	}
+	p.fireLocalPolicy(domain, record, 0)
+	return record, true
+}
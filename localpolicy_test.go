@@ -0,0 +1,88 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type localPolicyListener struct {
+	recordingListener
+}
+
+func (l *localPolicyListener) LocalPolicy(domain, record string, r Result) {
+	l.add("LocalPolicy(%s, %s, %s)", domain, record, r)
+}
+
+func TestWithLocalPolicy(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("local.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`local.example. 0 IN TXT "v=spf1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("local.example.")
+
+	dns.HandleFunc("norecord.local.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`norecord.local.example. 0 IN A 10.0.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("norecord.local.example.")
+
+	dns.HandleFunc("broken.local.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`broken.local.example. 0 IN TXT "v=spf1 include:norecord.local.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("broken.local.example.")
+
+	bestGuess := LocalPolicy{
+		After: func(domain string, r Result, err error) (string, Result) {
+			if r == None {
+				return "v=spf1 a mx ?all", 0
+			}
+			return "", 0
+		},
+	}
+
+	tests := []struct {
+		domain string
+		ip     string
+		policy LocalPolicy
+		r      Result
+		events []string
+	}{
+		{"local.example", "10.0.0.1", LocalPolicy{}, Fail, nil},
+		{"local.example", "10.0.0.1",
+			LocalPolicy{Before: func(domain string) string { return "v=spf1 ip4:10.0.0.0/8 -all" }},
+			Pass, []string{"LocalPolicy(local.example., v=spf1 ip4:10.0.0.0/8 -all, 0)"}},
+		{"norecord.local.example", "10.0.0.1", LocalPolicy{}, None, nil},
+		{"norecord.local.example", "10.0.0.1", bestGuess,
+			Pass, []string{"LocalPolicy(norecord.local.example., v=spf1 a mx ?all, 0)"}},
+		{"norecord.local.example", "10.0.0.2", bestGuess,
+			Neutral, []string{"LocalPolicy(norecord.local.example., v=spf1 a mx ?all, 0)"}},
+		// the hook isn't called for the included domain without a record
+		{"broken.local.example", "10.0.0.1", bestGuess, Permerror, nil},
+		{"broken.local.example", "10.0.0.1",
+			LocalPolicy{After: func(domain string, r Result, err error) (string, Result) { return "", Neutral }},
+			Neutral, []string{"LocalPolicy(broken.local.example., , neutral)"}},
+	}
+
+	for no, test := range tests {
+		t.Run(fmt.Sprintf("%d_%s", no, test.domain), func(t *testing.T) {
+			l := &localPolicyListener{}
+			r, _, _, err := CheckHost(net.ParseIP(test.ip), test.domain, "john@"+test.domain,
+				WithResolver(testResolver), WithListener(l), WithLocalPolicy(test.policy))
+			if r != test.r {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, test.r)
+			}
+			if got := l.filter("LocalPolicy"); fmt.Sprint(got) != fmt.Sprint(test.events) {
+				t.Errorf("LocalPolicy events:\n got=%q\nwant=%q", got, test.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package spf
+
+// LookupSPFRecord looks up SPF record of the domain the way evaluation
+// does, without evaluating it: TXT records are looked up (NXDOMAIN is an
+// error) and those beginning with "v=spf1" become candidates, the record is
+// the only candidate. Errors are:
+//   - DomainError if the domain is malformed;
+//   - ErrDNSPermerror if the domain doesn't exist,
+//     ErrDNSTemperror or other errors of r if the lookup failed;
+//   - ErrSPFNotFound if there are no candidates;
+//   - ErrTooManySPFRecords if there are several candidates.
+func LookupSPFRecord(domain string, r Resolver) (record string, candidates []string, extras *ResponseExtras, err error) {
+	if !isDomainName(domain) {
+		return "", nil, nil, newInvalidDomainError(domain)
+	}
+	txts, extras, err := r.LookupTXTStrict(NormalizeFQDN(domain))
+	if err != nil {
+		return "", nil, extras, err
+	}
+	candidates = spfRecords(txts)
+	switch len(candidates) {
+	case 0:
+		return "", nil, extras, ErrSPFNotFound
+	case 1:
+		return candidates[0], candidates, extras, nil
+	default:
+		return "", candidates, extras, ErrTooManySPFRecords
+	}
+}
@@ -0,0 +1,73 @@
+package spf
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestLookupSPFRecord(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("lookup.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`lookup.example. 300 IN TXT "google-site-verification=abc"`,
+			`lookup.example. 300 IN TXT "v=spf1 mx -all"`,
+			`lookup.example. 300 IN TXT "v=spf10 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("lookup.example.")
+
+	dns.HandleFunc("two.lookup.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`two.lookup.example. 300 IN TXT "v=spf1 a -all"`,
+			`two.lookup.example. 300 IN TXT "v=spf1 mx -all"`,
+		},
+	}))
+	defer dns.HandleRemove("two.lookup.example.")
+
+	dns.HandleFunc("none.lookup.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`none.lookup.example. 300 IN TXT "v=DMARC1; p=none"`,
+		},
+	}))
+	defer dns.HandleRemove("none.lookup.example.")
+
+	tests := []struct {
+		domain     string
+		record     string
+		candidates []string
+		err        error
+	}{
+		{"lookup.example", "v=spf1 mx -all", []string{"v=spf1 mx -all"}, nil},
+		{"two.lookup.example.", "", []string{"v=spf1 a -all", "v=spf1 mx -all"}, ErrTooManySPFRecords},
+		{"none.lookup.example", "", nil, ErrSPFNotFound},
+		{"nxdomain.example", "", nil, ErrDNSPermerror},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			record, candidates, extras, err := LookupSPFRecord(tt.domain, testResolver)
+			if record != tt.record || !errors.Is(err, tt.err) || tt.err == nil && err != nil {
+				t.Errorf("LookupSPFRecord() = %q, %v; want %q, %v", record, err, tt.record, tt.err)
+			}
+			if len(candidates) > 1 || len(tt.candidates) > 1 {
+				// order of records in the response isn't defined
+				if len(candidates) != len(tt.candidates) {
+					t.Errorf("LookupSPFRecord() candidates = %q; want %q", candidates, tt.candidates)
+				}
+			} else if !reflect.DeepEqual(candidates, tt.candidates) {
+				t.Errorf("LookupSPFRecord() candidates = %q; want %q", candidates, tt.candidates)
+			}
+			if extras == nil {
+				t.Error("LookupSPFRecord() extras = nil")
+			}
+		})
+	}
+
+	var de *DomainError
+	if _, _, _, err := LookupSPFRecord("invalid..example", testResolver); !errors.As(err, &de) {
+		t.Errorf("LookupSPFRecord() error = %v; want DomainError", err)
+	}
+}
@@ -1,55 +1,78 @@
 package spf
 
 import (
-	"errors"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
-	"unicode/utf8"
 )
 
-const (
-	// delimiter is a constant rune other than any allowed delimiter.
-	// It indicates lack of allowed delimiters, hence no split in delimiter
-	delimiter = '*'
-
-	// negative is a special value indicating there will be no split on macro.
-	negative = -1
-)
-
-type macro struct {
-	start  int
-	pos    int
-	prev   int
-	length int
-	input  string
-	output []string
-	state  stateFn
-	exp    bool
-	pctPos int
-}
-
-func newMacro(input string, exp bool) *macro {
-	return &macro{0, 0, 0, len(input), input, make([]string, 0, 0), nil, exp, 0}
-}
-
-type stateFn func(*macro, *parser) (stateFn, error)
-
 // parseMacro evaluates whole input string and replaces keywords with appropriate
 // values from
 func parseMacro(p *parser, input string, exp bool) (string, error) {
-	m := newMacro(input, exp)
-	var err error
-	for m.state = scanText; m.state != nil; {
-		m.state, err = m.state(m, p)
-		if err != nil {
-			// log error
-			return "", err
-		}
+	s, _, err := expandMacro(p, input, exp)
+	return s, err
+}
 
+// expandMacro evaluates whole input string like parseMacro does and also
+// returns macros which values are missing in p. The syntax is the one of
+// ParseMacroString, so records are rejected the same way by evaluation and
+// by the tools inspecting them.
+func expandMacro(p *parser, input string, exp bool) (string, []MissingMacro, error) {
+	ast, err := ParseMacroString(input)
+	if err != nil {
+		return "", nil, err
 	}
-	return strings.Join(m.output, ""), nil
+	var (
+		b       strings.Builder
+		missing []MissingMacro
+	)
+	for _, n := range ast.Nodes {
+		switch n.Kind {
+		case MacroLiteral:
+			b.WriteString(n.Text)
+		case MacroEscape:
+			if p.partialMacros && !p.expandEscapes {
+				b.WriteString(n.Text)
+			} else {
+				b.WriteString(unescapeMacro(n))
+			}
+		case MacroExpand:
+			if p.partialMacros {
+				// letters not depending on the connection are expanded
+				// if values are known, the rest are kept as placeholders
+				value, known := partialMacroValue(p, n.Letter)
+				if !known {
+					b.WriteString(n.Text)
+					missing = append(missing, missingMacro(n))
+					continue
+				}
+				value = transformMacro(value, n)
+				if n.Upper {
+					value = urlEscapeMacro(value)
+				}
+				if !p.expandEscapes {
+					// keep the output a macro-string
+					value = strings.Replace(value, "%", "%%", -1)
+				}
+				b.WriteString(value)
+				continue
+			}
+			if n.ExpOnly() && !exp {
+				return "", nil, MacroError{fmt.Sprintf("'%s' macro letter allowed only in \"exp\" text", n.Letter), n.Start + len("%{")}
+			}
+			value, absent := macroValue(p, n.Letter)
+			if absent {
+				missing = append(missing, missingMacro(n))
+			}
+			value = transformMacro(value, n)
+			if n.Upper {
+				value = urlEscapeMacro(value)
+			}
+			b.WriteString(value)
+		}
+	}
+	return b.String(), missing, nil
 }
 
 // parseMacroToken evaluates whole input string and replaces keywords with appropriate
@@ -58,306 +81,142 @@ func parseMacroToken(p *parser, t *token) (string, error) {
 	return parseMacro(p, t.value, false)
 }
 
-// macro.eof() return true when scanned record has ended, false otherwise
-func (m *macro) eof() bool { return m.pos >= m.length }
-
-// next() returns next read rune and boolean indicator whether scanned
-// record has ended. Method also moves `pos` value to size (length of read rune),
-// and `prev` to previous `pos` location.
-// Upon eof found, an non nil error is returned.
-func (m *macro) next() (rune, error) {
-	if m.eof() {
-		return 0, fmt.Errorf("unexpected eof for macro (%v)", m.input)
+// unescapeMacro returns the text the escape stands for
+func unescapeMacro(n MacroNode) string {
+	switch n.Text {
+	case "%_":
+		return " "
+	case "%-":
+		return "%20"
 	}
-	r, size := utf8.DecodeRuneInString(m.input[m.pos:])
-	m.prev = m.pos
-	m.pos += size
-	return r, nil
+	return "%"
 }
 
-// macro.moveon() sets macro.start to macro.pos. This is usually done once the
-// ident has been scanned.
-func (m *macro) moveon() { m.start = m.pos }
-
-// macro.back() moves back current macro.pos to a previous position.
-func (m *macro) back() { m.pos = m.prev }
-
-// State functions
-
-func scanText(m *macro, p *parser) (stateFn, error) {
-	for {
-
-		r, err := m.next()
-
-		if err != nil {
-			m.output = append(m.output, m.input[m.start:m.pos])
-			m.moveon()
-			break
+// macroValue returns the value of the macro letter before transformation and
+// true if the value is missing in p
+func macroValue(p *parser, letter string) (string, bool) {
+	switch letter {
+	case "s":
+		return p.sender, p.sender == ""
+	case "l":
+		return ParseAddrSpec(p.sender, p.sender).Local, p.sender == ""
+	case "o":
+		return ParseAddrSpec(p.sender, p.sender).Domain, p.sender == ""
+	case "h":
+		return removeRoot(p.heloDomain), p.heloDomain == ""
+	case "d":
+		return removeRoot(p.domain), p.domain == ""
+	case "i":
+		if p.ip == nil {
+			return "", true
 		}
-
-		if r == '%' {
-			// TODO(zaccone): exercise more with peek(),next(), back()
-			m.output = append(m.output, m.input[m.start:m.prev])
-			m.pctPos = m.prev
-			m.moveon()
-			if p.partialMacros {
-				return scanPercentPartial, nil
-			}
-			return scanPercent, nil
+		return toDottedHex(p.ip, false), false
+	case "p":
+		// RFC doesn't recommend it, validated names are looked up once per check
+		return p.validatedDomain(), false
+	case "v":
+		switch {
+		case p.ip == nil:
+			return "", true
+		case p.ip.To4() == nil:
+			return "ip6", false
 		}
-
+		return "in-addr", false
+	case "c":
+		if p.ip == nil {
+			return "", true
+		}
+		return p.ip.String(), false
+	case "r":
+		return p.receivingFQDN, p.receivingFQDN == ""
+	case "t":
+		if p.evaluatedOn.IsZero() {
+			return "", true
+		}
+		return strconv.FormatInt(p.evaluatedOn.UTC().Unix(), 10), false
 	}
-	return nil, nil
+	return "", true
 }
 
-func scanPercentPartial(m *macro, _ *parser) (stateFn, error) {
-	r, err := m.next()
-	if err != nil {
-		return nil, err
-	}
-	switch r {
-	case '{':
-		m.moveon()
-		return scanMacroPartial, nil
-	case '%':
-		m.collect("%%")
-	case '_':
-		m.collect("%_")
-	case '-':
-		m.collect("%-")
-	default:
-		return nil, fmt.Errorf("forbidden character (%v) after %%", r)
+// partialMacroValue returns the value of the macro letter and true if it is
+// known in partial mode, where only letters not depending on the connection
+// are expanded
+func partialMacroValue(p *parser, letter string) (string, bool) {
+	switch letter {
+	case "s", "l", "o", "h", "d":
+		value, absent := macroValue(p, letter)
+		return value, !absent && value != ""
+	case "v":
+		if p.ip == nil || p.ip.IsUnspecified() {
+			return "", false
+		}
+		value, _ := macroValue(p, letter)
+		return value, true
 	}
-
-	m.moveon()
-	return scanText, nil
+	return "", false
 }
 
-func scanPercent(m *macro, _ *parser) (stateFn, error) {
-	r, err := m.next()
-	if err != nil {
-		return nil, err
+// transformMacro splits the value by the delimiters of the macro, reverses
+// the parts and keeps the right-hand ones as its transformers say, the parts
+// are joined with dots
+// https://tools.ietf.org/html/rfc7208#section-7.3
+func transformMacro(value string, n MacroNode) string {
+	if n.Digits == 0 && !n.Reverse && n.Delimiters == "" {
+		return value
 	}
-	switch r {
-	case '{':
-		m.moveon()
-		return scanMacro, nil
-	case '%':
-		m.collect("%")
-	case '_':
-		m.collect(" ")
-	case '-':
-		m.collect("%20")
-	default:
-		return nil, fmt.Errorf("forbidden character (%v) after %%", r)
+	delimiters := n.Delimiters
+	if delimiters == "" {
+		delimiters = "."
 	}
-
-	m.moveon()
-	return scanText, nil
-}
-
-type item struct {
-	value       string
-	cardinality int
-	delimiter   rune
-	reversed    bool
-}
-
-func errInvalidMacroSyntax(e error) (stateFn, error) {
-	return nil, fmt.Errorf("wrong macro syntax: %s", e.Error())
-}
-
-func scanMacroPartial(m *macro, p *parser) (stateFn, error) {
-	r, err := m.next()
-	if err != nil {
-		return nil, err
-	}
-	var curItem item
-
-	//var err error
-	var result string
-
-	switch r {
-	case 's', 'S':
-		fallthrough
-	case 'l', 'L':
-		fallthrough
-	case 'o', 'O':
-		fallthrough
-	case 'h', 'H':
-		fallthrough
-	case 'i', 'I':
-		fallthrough
-	case 'c', 'C':
-		fallthrough
-	case 'r', 'R':
-		fallthrough
-	case 't', 'T':
-		m.moveon()
-		if err := skipMacroBody(m); err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-
-	case 'd', 'D':
-		curItem = item{removeRoot(p.domain), negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
+	var parts []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		if strings.IndexByte(delimiters, value[i]) >= 0 {
+			parts = append(parts, value[start:i])
+			start = i + 1
 		}
-
-	case 'p', 'P':
-	case 'v', 'V':
 	}
-
-	if r, err = m.next(); err != nil {
-		// macro not ended properly, handle error here
-		return nil, err
-	} else if r != '}' {
-		// macro not ended properly, handle error here
-		return nil, fmt.Errorf("unexpected char '%v', expected '}'", r)
+	parts = append(parts, value[start:])
+	if n.Reverse {
+		for first, last := 0, len(parts)-1; first < last; first, last = first+1, last-1 {
+			parts[first], parts[last] = parts[last], parts[first]
+		}
 	}
-
-	if result != "" {
-		m.collect(result)
-		m.moveon()
-	} else {
-		m.collectMacroBody()
+	if n.Digits > 0 && n.Digits < len(parts) {
+		parts = parts[len(parts)-n.Digits:]
 	}
-
-	m.moveon()
-	return scanText, nil
+	return strings.Join(parts, ".")
 }
 
-func scanMacro(m *macro, p *parser) (stateFn, error) {
-	r, err := m.next()
-	if err != nil {
-		return nil, err
-	}
-	var curItem item
-
-	//var err error
-	var result string
-	var email *addrSpec
-
-	switch r {
-	case 's', 'S':
-		curItem = item{p.sender, negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-
-	case 'l', 'L':
-		email = parseAddrSpec(p.sender, p.sender)
-		curItem = item{email.local, negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-
-	case 'o', 'O':
-		email = parseAddrSpec(p.sender, p.sender)
-		curItem = item{removeRoot(email.domain), negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-
-	case 'h', 'H':
-		curItem = item{removeRoot(p.heloDomain), negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-
-	case 'd', 'D':
-		curItem = item{removeRoot(p.domain), negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-
-	case 'i', 'I':
-		curItem = item{toDottedHex(p.ip, false), negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
+// urlEscapeMacro URL escapes the expanded value of an uppercase macro letter
+// as RFC 7208 section 7.3 requires: characters other than the unreserved ones
+// of RFC 3986 are percent-encoded.
+func urlEscapeMacro(value string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+			continue
 		}
-
-	case 'p', 'P':
-		// let's not use it for the moment, RFC doesn't recommend it.
-
-	case 'v', 'V':
-		// TODO(zaccone): move such functions to some generic utils module
-		if p.ip.To4() == nil {
-			result = "ip6"
-		} else {
-			result = "in-addr"
-		}
-
-	case 'c', 'C':
-		if !m.exp {
-			return errInvalidMacroSyntax(errors.New(`'c' macro letter allowed only in "exp" text`))
-		}
-		curItem = item{p.ip.String(), negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-
-	case 'r', 'R':
-		if !m.exp {
-			return errInvalidMacroSyntax(errors.New(`'r' macro letter allowed only in "exp" text`))
-		}
-		curItem = item{p.receivingFQDN, negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-
-	case 't', 'T':
-		if !m.exp {
-			return errInvalidMacroSyntax(errors.New(`'t' macro letter allowed only in "exp" text`))
-		}
-		curItem = item{strconv.FormatInt(p.evaluatedOn.UTC().Unix(), 10), negative, delimiter, false}
-		m.moveon()
-		result, err = parseDelimiter(m, &curItem)
-		if err != nil {
-			return errInvalidMacroSyntax(err)
-		}
-	}
-
-	r, err = m.next()
-	if err != nil {
-		// macro not ended properly, handle error here
-		return nil, err
-	} else if r != '}' {
-		// macro not ended properly, handle error here
-		return nil, fmt.Errorf("unexpected char '%v', expected '}'", r)
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
 	}
-
-	m.collect(result)
-	m.moveon()
-
-	m.moveon()
-	return scanText, nil
-}
-
-func (m *macro) collect(result string) {
-	m.output = append(m.output, result)
+	return b.String()
 }
 
-func (m *macro) collectMacroBody() {
-	m.output = append(m.output, m.input[m.pctPos:m.pos])
+// missingMacro returns the macro as one with the value missing
+func missingMacro(n MacroNode) MissingMacro {
+	body := n.Text[len("%{")+len(n.Letter) : len(n.Text)-len("}")]
+	return MissingMacro{
+		Letter:       n.Letter,
+		Transformers: body[:len(body)-len(n.Delimiters)],
+		Delimiters:   n.Delimiters,
+		Start:        n.Start,
+		End:          n.End,
+	}
 }
 
 func toDottedHex(ip net.IP, partial bool) string {
@@ -409,141 +268,6 @@ func isMacroDelimiter(ch rune) bool {
 	return strings.ContainsRune(".-+,/_=", ch)
 }
 
-func skipMacroBody(m *macro) error {
-	var (
-		r   rune
-		err error
-	)
-	if r, err = m.next(); err != nil {
-		return err
-	}
-
-	if isDigit(r) {
-		m.back()
-		for {
-			if r, err = m.next(); err != nil {
-				return err
-			}
-
-			if !isDigit(r) {
-				m.back()
-				break
-			}
-		}
-
-		if r, err = m.next(); err != nil {
-			return err
-		}
-	}
-
-	if r == 'r' || r == 'R' {
-		if r, err = m.next(); err != nil {
-			return err
-		}
-	}
-	if isMacroDelimiter(r) {
-		if r, err = m.next(); err != nil {
-			return err
-		}
-	}
-	if r != '}' {
-		// syntax error
-		return fmt.Errorf("unexpected char (%v), expected '}'", r)
-	}
-
-	m.back()
-
-	return nil
-}
-
-func parseDelimiter(m *macro, curItem *item) (string, error) {
-	var (
-		r   rune
-		err error
-	)
-	r, err = m.next()
-	if err != nil {
-		return "", err
-	}
-
-	if isDigit(r) {
-		m.back()
-		for {
-			r, err = m.next()
-			if err != nil {
-				return "", err
-			}
-
-			if !isDigit(r) {
-				m.back()
-				curItem.cardinality, err = strconv.Atoi(
-					m.input[m.start:m.pos])
-				if err != nil {
-					return "", err
-				}
-				break
-			}
-		}
-
-		r, err = m.next()
-		if err != nil {
-			return "", err
-		}
-	}
-
-	if r == 'r' || r == 'R' {
-		curItem.reversed = true
-		r, err = m.next()
-		if err != nil {
-			return "", err
-		}
-	}
-	if isMacroDelimiter(r) {
-		curItem.delimiter = r
-		r, err = m.next()
-		if err != nil {
-			return "", err
-		}
-	}
-	if r != '}' {
-		// syntax error
-		return "", fmt.Errorf("unexpected char (%v), expected '}'", r)
-	}
-
-	m.back()
-
-	// handle curItem
-	var parts []string
-	if curItem.cardinality > 0 ||
-		curItem.reversed ||
-		curItem.delimiter != delimiter {
-
-		if curItem.delimiter == delimiter {
-			curItem.delimiter = '.'
-		}
-		parts = strings.Split(curItem.value, string(curItem.delimiter))
-		if curItem.reversed {
-			first, last := 0, len(parts)-1
-			for first < last {
-				parts[first], parts[last] = parts[last], parts[first]
-				first++
-				last--
-			}
-		}
-	} else {
-		parts = []string{curItem.value}
-	}
-
-	if curItem.cardinality == negative {
-		curItem.cardinality = len(parts)
-	}
-
-	if curItem.cardinality > negative && curItem.cardinality > len(parts) {
-		curItem.cardinality = len(parts)
-	}
-	return strings.Join(parts[len(parts)-curItem.cardinality:], "."), nil
-}
-
 func removeRoot(d string) string {
 	l := len(d)
 	if l > 0 && d[l-1] == '.' {
@@ -106,7 +106,7 @@ func TestMacroExpansionRFCExamples(t *testing.T) {
 			"3.2.0.192.in-addr.strong.lp._spf.example.com"},
 		{"%{d2}.trusted-domains.example.net",
 			"example.com.trusted-domains.example.net"},
-		{"%{S}", "strong-bad@email.example.com"},
+		{"%{S}", "strong-bad%40email.example.com"},
 		{"%{O}", "email.example.com"},
 		{"%{D}", "email.example.com"},
 		{"%{D4}", "email.example.com"},
@@ -147,6 +147,10 @@ func TestMacroExpansion_partial(t *testing.T) {
 		{"%{h}.%%.%{d}", "%{h}.%%.email.example.com"},
 		{"%{h}.%_.%{d}", "%{h}.%_.email.example.com"},
 		{"%{h}.%-.%{d}", "%{h}.%-.email.example.com"},
+		{"%{s}", "strong-bad@email.example.com"},
+		{"%{l}.%{o2r}", "strong-bad.example.email"},
+		{"%{ir}.%{v}.arpa", "%{ir}.in-addr.arpa"},
+		{"%{c}.%{r}.%{t}.%{p}", "%{c}.%{r}.%{t}.%{p}"},
 	}
 
 	parser := newParser(WithResolver(testResolver), PartialMacros(true)).
@@ -0,0 +1,190 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidMacro is a macro-string not fitting the grammar of RFC 7208
+// section 7.1
+var ErrInvalidMacro = errors.New("wrong macro syntax")
+
+// MacroError is ErrInvalidMacro along with the reason and the position of
+// the fault. Use errors.As to get it, errors.Is(err, ErrInvalidMacro) keeps
+// working as well.
+type MacroError struct {
+	Reason string
+	Offset int // byte offset of the fault in the macro-string
+}
+
+func (e MacroError) Error() string {
+	return fmt.Sprintf("%s: %s at %d", ErrInvalidMacro, e.Reason, e.Offset)
+}
+
+func (e MacroError) Unwrap() error {
+	return ErrInvalidMacro
+}
+
+// MacroNodeKind tells literal segments of a macro-string from macros.
+type MacroNodeKind int
+
+// Kinds of nodes of MacroAST
+const (
+	MacroLiteral MacroNodeKind = iota // text without macros, copied as is
+	MacroEscape                       // "%%", "%_" or "%-"
+	MacroExpand                       // "%{" letter transformers delimiters "}"
+)
+
+// maxMacroDigits caps DIGIT transformers, RFC 7208 requires supporting at
+// least 127 and values beyond the number of parts keep all of them anyway
+const maxMacroDigits = 1 << 16
+
+// MacroNode is a literal segment or a macro of a macro-string.
+type MacroNode struct {
+	Kind       MacroNodeKind
+	Text       string // the node as published
+	Letter     string // lowercased macro letter of MacroExpand
+	Upper      bool   // the letter is in upper case, the value is URL escaped
+	Digits     int    // right-hand parts of the value kept, zero if not given
+	Reverse    bool   // parts of the value are reversed, as in "%{ir}"
+	Delimiters string // delimiters splitting the value, "." if none are given
+	Start      int    // byte offset of the node in the macro-string
+	End        int    // byte offset right after the node
+}
+
+// ExpOnly returns true for macros allowed only in "exp" text: %{c}, %{r}
+// and %{t}.
+func (n MacroNode) ExpOnly() bool {
+	if n.Kind != MacroExpand {
+		return false
+	}
+	switch n.Letter {
+	case "c", "r", "t":
+		return true
+	}
+	return false
+}
+
+// MacroAST is a macro-string broken down into literal segments and macros,
+// see ParseMacroString.
+type MacroAST struct {
+	Input string
+	Nodes []MacroNode
+}
+
+// Macros returns the nodes of MacroExpand kind.
+func (a MacroAST) Macros() []MacroNode {
+	var macros []MacroNode
+	for _, n := range a.Nodes {
+		if n.Kind == MacroExpand {
+			macros = append(macros, n)
+		}
+	}
+	return macros
+}
+
+// ParseMacroString breaks s down into literal segments, escapes and macros
+// by the grammar of RFC 7208 section 7.1, the errors are MacroError. All the
+// macro letters are accepted, as they are in "exp" text; domain-specs must
+// not have macros which ExpOnly is true. Literal segments are not checked
+// for characters, see ValidateRecord.
+// https://tools.ietf.org/html/rfc7208#section-7.1
+func ParseMacroString(s string) (MacroAST, error) {
+	ast := MacroAST{Input: s}
+	literal := 0 // start of the literal segment being scanned
+	for i := 0; i < len(s); {
+		if s[i] != '%' {
+			i++
+			continue
+		}
+		if literal < i {
+			ast.Nodes = append(ast.Nodes, MacroNode{Kind: MacroLiteral, Text: s[literal:i], Start: literal, End: i})
+		}
+		n, err := parseMacroNode(s, i)
+		if err != nil {
+			return MacroAST{}, err
+		}
+		ast.Nodes = append(ast.Nodes, n)
+		i, literal = n.End, n.End
+	}
+	if literal < len(s) {
+		ast.Nodes = append(ast.Nodes, MacroNode{Kind: MacroLiteral, Text: s[literal:], Start: literal, End: len(s)})
+	}
+	return ast, nil
+}
+
+// parseMacroNode parses the escape or the macro starting with '%' at start
+func parseMacroNode(s string, start int) (MacroNode, error) {
+	i := start + 1
+	if i == len(s) {
+		return MacroNode{}, MacroError{"unexpected end after '%'", i}
+	}
+	switch s[i] {
+	case '%', '_', '-':
+		return MacroNode{Kind: MacroEscape, Text: s[start : i+1], Start: start, End: i + 1}, nil
+	case '{':
+	default:
+		return MacroNode{}, MacroError{fmt.Sprintf("forbidden character %s after '%%'", quoteAt(s, i)), i}
+	}
+
+	i++
+	if i == len(s) {
+		return MacroNode{}, MacroError{"unexpected end of macro", i}
+	}
+	if !isMacroLetter(s[i]) {
+		return MacroNode{}, MacroError{fmt.Sprintf("invalid macro letter %s", quoteAt(s, i)), i}
+	}
+	n := MacroNode{
+		Kind:   MacroExpand,
+		Letter: strings.ToLower(s[i : i+1]),
+		Upper:  s[i] >= 'A' && s[i] <= 'Z',
+		Start:  start,
+	}
+	i++
+
+	digits := i
+	for ; i < len(s) && isDigit(rune(s[i])); i++ {
+		if n.Digits < maxMacroDigits {
+			n.Digits = n.Digits*10 + int(s[i]-'0')
+		}
+	}
+	if n.Digits > maxMacroDigits {
+		n.Digits = maxMacroDigits
+	}
+	if i > digits && n.Digits == 0 {
+		return MacroNode{}, MacroError{"zero digits transformer", digits}
+	}
+	if i < len(s) && (s[i] == 'r' || s[i] == 'R') {
+		n.Reverse = true
+		i++
+	}
+	delimiters := i
+	for i < len(s) && isMacroDelimiter(rune(s[i])) {
+		i++
+	}
+	n.Delimiters = s[delimiters:i]
+
+	if i == len(s) {
+		return MacroNode{}, MacroError{"unexpected end of macro", i}
+	}
+	if s[i] != '}' {
+		return MacroNode{}, MacroError{fmt.Sprintf("unexpected character %s, expected '}'", quoteAt(s, i)), i}
+	}
+	n.End = i + 1
+	n.Text = s[start:n.End]
+	return n, nil
+}
+
+// isMacroLetter returns true for macro letters of RFC 7208 section 7.1 in
+// either case
+func isMacroLetter(c byte) bool {
+	return strings.IndexByte("slodiphcrtvSLODIPHCRTV", c) >= 0
+}
+
+// quoteAt returns the character at i of s quoted
+func quoteAt(s string, i int) string {
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return fmt.Sprintf("%q", r)
+}
@@ -0,0 +1,198 @@
+package spf
+
+import (
+	"errors"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseMacroString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []MacroNode
+	}{
+		{"", nil},
+		{"_spf.example.com", []MacroNode{
+			{Kind: MacroLiteral, Text: "_spf.example.com", Start: 0, End: 16},
+		}},
+		{"%{ir}.%{v}._spf.%{d2}", []MacroNode{
+			{Kind: MacroExpand, Text: "%{ir}", Letter: "i", Reverse: true, Start: 0, End: 5},
+			{Kind: MacroLiteral, Text: ".", Start: 5, End: 6},
+			{Kind: MacroExpand, Text: "%{v}", Letter: "v", Start: 6, End: 10},
+			{Kind: MacroLiteral, Text: "._spf.", Start: 10, End: 16},
+			{Kind: MacroExpand, Text: "%{d2}", Letter: "d", Digits: 2, Start: 16, End: 21},
+		}},
+		{"%%%_%-", []MacroNode{
+			{Kind: MacroEscape, Text: "%%", Start: 0, End: 2},
+			{Kind: MacroEscape, Text: "%_", Start: 2, End: 4},
+			{Kind: MacroEscape, Text: "%-", Start: 4, End: 6},
+		}},
+		{"%{L12R-+}@%{O}", []MacroNode{
+			{Kind: MacroExpand, Text: "%{L12R-+}", Letter: "l", Upper: true, Digits: 12, Reverse: true, Delimiters: "-+", Start: 0, End: 9},
+			{Kind: MacroLiteral, Text: "@", Start: 9, End: 10},
+			{Kind: MacroExpand, Text: "%{O}", Letter: "o", Upper: true, Start: 10, End: 14},
+		}},
+		{"%{s99999999999999999999}", []MacroNode{
+			{Kind: MacroExpand, Text: "%{s99999999999999999999}", Letter: "s", Digits: maxMacroDigits, Start: 0, End: 24},
+		}},
+		{"%{c} at %{t}", []MacroNode{
+			{Kind: MacroExpand, Text: "%{c}", Letter: "c", Start: 0, End: 4},
+			{Kind: MacroLiteral, Text: " at ", Start: 4, End: 8},
+			{Kind: MacroExpand, Text: "%{t}", Letter: "t", Start: 8, End: 12},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := ParseMacroString(test.input)
+			if err != nil {
+				t.Fatalf("ParseMacroString() error = %v", err)
+			}
+			if got.Input != test.input {
+				t.Errorf("Input = %q; want %q", got.Input, test.input)
+			}
+			if diff := cmp.Diff(test.want, got.Nodes); diff != "" {
+				t.Errorf("ParseMacroString() (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseMacroString_Errors(t *testing.T) {
+	tests := []struct {
+		input  string
+		offset int
+	}{
+		{"%", 1},
+		{"a%b", 2},
+		{"%{", 2},
+		{"%{x}", 2},
+		{"%{é}", 2},
+		{"%{d", 3},
+		{"%{d0}", 3},
+		{"%{d00r}", 3},
+		{"%{d2r.", 6},
+		{"%{d2r.x}", 6},
+		{"%{dr2}", 4},
+		{"%{d}%{", 6},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := ParseMacroString(test.input)
+			var me MacroError
+			if !errors.As(err, &me) {
+				t.Fatalf("ParseMacroString() error = %v; want MacroError", err)
+			}
+			if me.Offset != test.offset {
+				t.Errorf("Offset = %d; want %d (%v)", me.Offset, test.offset, err)
+			}
+			if !errors.Is(err, ErrInvalidMacro) || ErrorCodeOf(err) != CodeInvalidMacro || ErrorKindOf(err) != KindSyntax {
+				t.Errorf("error %v is not %v", err, ErrInvalidMacro)
+			}
+		})
+	}
+}
+
+func TestMacroAST_Macros(t *testing.T) {
+	ast, err := ParseMacroString("%{r} %% %{d}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var letters []string
+	var expOnly []bool
+	for _, n := range ast.Macros() {
+		letters = append(letters, n.Letter)
+		expOnly = append(expOnly, n.ExpOnly())
+	}
+	if diff := cmp.Diff([]string{"r", "d"}, letters); diff != "" {
+		t.Errorf("Macros() (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]bool{true, false}, expOnly); diff != "" {
+		t.Errorf("ExpOnly() (-want +got):\n%s", diff)
+	}
+}
+
+// reMacroStringRFC7208 is the macro-string of RFC 7208 section 7.1, with
+// any characters in literals as ParseMacroString allows
+var reMacroStringRFC7208 = regexp.MustCompile(
+	`^(?:[^%]|%[%_-]|%\{[slodiphcrtvSLODIPHCRTV](?:0*[1-9][0-9]*)?[rR]?[.\-+,/_=]*\})*$`)
+
+// genMacroStrings returns n strings made of fragments of macro-strings, both
+// valid and not
+func genMacroStrings(n int) []string {
+	fragments := []string{
+		"%", "{", "}", "%{", "%%", "%_", "%-", "a", ".", "_spf", " ", "é",
+		"s", "l", "o", "d", "i", "p", "h", "c", "r", "t", "v", "x", "S", "I", "R",
+		"0", "1", "2", "12", "-", "+", ",", "/", "_", "=",
+		"%{d}", "%{ir}", "%{l1r-}", "%{v}",
+	}
+	rnd := rand.New(rand.NewSource(1))
+	strs := make([]string, n)
+	for i := range strs {
+		var b strings.Builder
+		for j := rnd.Intn(8); j >= 0; j-- {
+			b.WriteString(fragments[rnd.Intn(len(fragments))])
+		}
+		strs[i] = b.String()
+	}
+	return strs
+}
+
+func TestParseMacroString_Differential(t *testing.T) {
+	var valid int
+	for _, s := range genMacroStrings(20000) {
+		ast, err := ParseMacroString(s)
+		want := reMacroStringRFC7208.MatchString(s)
+		if (err == nil) != want {
+			t.Errorf("ParseMacroString(%q) error = %v; want valid %t", s, err, want)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		valid++
+		var text strings.Builder
+		for _, n := range ast.Nodes {
+			text.WriteString(n.Text)
+		}
+		if text.String() != s {
+			t.Errorf("ParseMacroString(%q) nodes make %q", s, text.String())
+		}
+	}
+	if valid < 1000 {
+		t.Errorf("only %d strings of the corpus are valid", valid)
+	}
+}
+
+func TestExpandMacros_Differential(t *testing.T) {
+	ctx := MacroContext{
+		Sender:    "john@example.com",
+		Domain:    "example.com",
+		HELO:      "mx.example.com",
+		IP:        []byte{192, 0, 2, 1},
+		Receiver:  "mx.example.net",
+		Timestamp: time.Unix(1600000000, 0),
+	}
+	for _, s := range genMacroStrings(20000) {
+		ast, perr := ParseMacroString(s)
+		expOnly := false
+		for _, n := range ast.Macros() {
+			expOnly = expOnly || n.ExpOnly()
+		}
+		for _, mode := range []struct {
+			exp, partial bool
+		}{{false, false}, {true, false}, {false, true}} {
+			ctx.Exp, ctx.Partial = mode.exp, mode.partial
+			_, _, err := ExpandMacros(s, ctx)
+			want := perr == nil && (mode.exp || mode.partial || !expOnly)
+			if (err == nil) != want {
+				t.Errorf("ExpandMacros(%q, exp %t, partial %t) error = %v; want valid %t (%v)",
+					s, mode.exp, mode.partial, err, want, perr)
+			}
+		}
+	}
+}
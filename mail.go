@@ -2,35 +2,73 @@ package spf
 
 import "strings"
 
-// addrSpec abstracts Addr-Spec as it defined by RFC5322
+// postmaster is the local-part of senders without one
+// https://tools.ietf.org/html/rfc7208#section-4.3
+const postmaster = "postmaster"
+
+// AddrSpec is an e-mail address split into the local-part and the domain,
+// as Addr-Spec of RFC 5322 is, see ParseAddrSpec.
 // https://tools.ietf.org/html/rfc5322#section-3.4.1
-type addrSpec struct {
-	local  string
-	domain string
+type AddrSpec struct {
+	Local  string // %{l}, quotes of a quoted local-part are kept
+	Domain string // %{o}, without the trailing dot
 }
 
-// parseAddrSpec parses e-mail string address and returns *addrSpec structure.
-// The "postmaster" will be used if no local part specified in addr.
-// The domain will be used if no domain specified in addr.
-func parseAddrSpec(addr, domain string) *addrSpec {
-	const postmaster string = "postmaster"
+// String returns the address as local-part@domain.
+func (a AddrSpec) String() string {
+	return a.Local + "@" + a.Domain
+}
 
+// ParseAddrSpec splits the e-mail address into the local-part and the
+// domain the way %{l} and %{o} macros do:
+//   - "postmaster" is used if the address has no local-part, e.g. "@domain"
+//     or the domain alone, see RFC 7208 section 4.3;
+//   - the domain given is used if the address has no domain, e.g. "local@";
+//   - the local-part may be quoted, "@" within quotes doesn't split the
+//     address, e.g. `"john@home"@example.com`;
+//   - a trailing dot of the domain is dropped.
+//
+// Addresses are not validated otherwise.
+func ParseAddrSpec(addr, domain string) AddrSpec {
 	if addr == "" || addr == "@" {
-		return &addrSpec{postmaster, domain}
+		return AddrSpec{postmaster, removeRoot(domain)}
 	}
-
-	var l, d string
 	i := strings.LastIndexByte(addr, '@')
-	if i < 0 || i == len(addr)-1 { // local[@]
-		d = domain
-	} else {
-		d = addr[i+1:]
+	if end := quotedLocalEnd(addr); end > 0 && i < end {
+		// "@" within quotes
+		i = -1
+	}
+	if i < 0 {
+		if strings.HasPrefix(addr, `"`) {
+			// quoted local-part alone
+			return AddrSpec{addr, removeRoot(domain)}
+		}
+		return AddrSpec{postmaster, removeRoot(addr)}
 	}
-	if i < 1 { // [@]domain
-		l = postmaster
-	} else {
-		l = addr[:i]
+	a := AddrSpec{addr[:i], removeRoot(addr[i+1:])}
+	if a.Local == "" {
+		a.Local = postmaster
 	}
+	if a.Domain == "" {
+		a.Domain = removeRoot(domain)
+	}
+	return a
+}
 
-	return &addrSpec{l, d}
+// quotedLocalEnd returns the offset right after the closing quote of the
+// quoted local-part of addr, zero if the local-part isn't quoted or the
+// quote isn't closed
+func quotedLocalEnd(addr string) int {
+	if !strings.HasPrefix(addr, `"`) {
+		return 0
+	}
+	for i := 1; i < len(addr); i++ {
+		switch addr[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return 0
 }
@@ -0,0 +1,39 @@
+package spf
+
+import "testing"
+
+func TestParseAddrSpec(t *testing.T) {
+	tests := []struct {
+		addr   string
+		domain string
+		want   AddrSpec
+	}{
+		{"john@example.com", "example.org", AddrSpec{"john", "example.com"}},
+		{"john.doe+tag@mail.example.com", "", AddrSpec{"john.doe+tag", "mail.example.com"}},
+		{"", "example.org", AddrSpec{"postmaster", "example.org"}},
+		{"@", "example.org.", AddrSpec{"postmaster", "example.org"}},
+		{"@example.com", "example.org", AddrSpec{"postmaster", "example.com"}},
+		{"example.com", "example.org", AddrSpec{"postmaster", "example.com"}},
+		{"john@", "example.org", AddrSpec{"john", "example.org"}},
+		{"john@example.com.", "", AddrSpec{"john", "example.com"}},
+		{"example.com.", "", AddrSpec{"postmaster", "example.com"}},
+		{"a@b@example.com", "", AddrSpec{"a@b", "example.com"}},
+		{`"john@home"@example.com`, "", AddrSpec{`"john@home"`, "example.com"}},
+		{`"john\"@\"home"@example.com`, "", AddrSpec{`"john\"@\"home"`, "example.com"}},
+		{`"john@home"`, "example.org", AddrSpec{`"john@home"`, "example.org"}},
+		{`"john@example.com`, "", AddrSpec{`"john`, "example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.addr, func(t *testing.T) {
+			if got := ParseAddrSpec(test.addr, test.domain); got != test.want {
+				t.Errorf("ParseAddrSpec(%q, %q) = %+v; want %+v", test.addr, test.domain, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddrSpec_String(t *testing.T) {
+	if got, want := ParseAddrSpec("example.com", "").String(), "postmaster@example.com"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+// Package milter provides the glue commonly written to check SPF in mail
+// filters (milters): it follows an SMTP session, evaluates its identities,
+// produces "Received-SPF" and "Authentication-Results" header fields and maps
+// the result to the action to take on the message.
+//
+// The package doesn't depend on any milter protocol implementation, callbacks
+// of the one in use are expected to call Session methods.
+package milter
+
+import (
+	"net"
+	"strings"
+
+	"github.com/redsift/spf"
+)
+
+// DefaultPolicy is spf.DefaultActionPolicy quarantining "softfail" of MAIL
+// FROM identity instead of marking it only.
+func DefaultPolicy() spf.ActionPolicy {
+	p := spf.DefaultActionPolicy()
+	p.MailFrom[spf.Softfail] = spf.Quarantine
+	return p
+}
+
+// Header is a header field to add to the message.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Handler checks SMTP sessions against SPF. It is safe for concurrent use
+// as long as its fields are not changed.
+type Handler struct {
+	Resolver   spf.Resolver      // shared resolver, lookup limits are applied per check
+	AuthServID string            // the host name of the verifier, used as authserv-id and receiver
+	Pins       *spf.Pins         // policies pinned by operators, optional
+	Policy     *spf.ActionPolicy // DefaultPolicy() if nil
+	Catalog    spf.Catalog       // wording of "Received-SPF" comments and replies, unless Policy has its own
+	Options    []spf.Option      // additional options of every check
+}
+
+// Decision is the outcome of a check.
+type Decision struct {
+	Trace   spf.Trace
+	Action  spf.Action
+	Reply   spf.Reply // SMTP reply for spf.Reject and spf.Defer
+	Headers []Header  // "Received-SPF" and "Authentication-Results" fields
+}
+
+// Session follows a single SMTP connection.
+type Session struct {
+	h    *Handler
+	ip   net.IP
+	helo string
+}
+
+// Connect starts the session of a client connected from the address.
+func (h *Handler) Connect(ip net.IP) *Session {
+	return &Session{h: h, ip: ip}
+}
+
+// Helo records the name given by the client in HELO or EHLO command.
+func (s *Session) Helo(name string) {
+	s.helo = strings.TrimSuffix(name, ".")
+}
+
+// MailFrom checks the reverse-path of MAIL FROM command along with the HELO
+// identity as spf.EvaluateSession does. The address may be enclosed in angle
+// brackets.
+func (s *Session) MailFrom(addr string) *Decision {
+	addr = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(addr), "<"), ">")
+	if s.ip == nil {
+		return s.h.decide(spf.Trace{Result: spf.None, Helo: s.helo, EnvelopeFrom: addr, Identity: "mailfrom"})
+	}
+	t := spf.EvaluateSession(s.ip, s.helo, addr, s.h.options()...).Trace
+	t.Receiver = s.h.AuthServID
+	return s.h.decide(t)
+}
+
+func (h *Handler) options() []spf.Option {
+	opts := make([]spf.Option, 0, 3+len(h.Options))
+	if h.Resolver != nil {
+		// each identity is checked within limits of its own
+		opts = append(opts, spf.WithResolverFactory(spf.LimitedResolverFactory(h.Resolver, spf.MaxDNSLookups, spf.MaxMXNames)))
+	}
+	opts = append(opts, spf.WithPins(h.Pins))
+	if h.AuthServID != "" {
+		opts = append(opts, spf.ReceivingFQDN(h.AuthServID))
+	}
+	return append(opts, h.Options...)
+}
+
+// decide maps the result to the action and builds the header fields
+func (h *Handler) decide(t spf.Trace) *Decision {
+	policy := DefaultPolicy()
+	if h.Policy != nil {
+		policy = *h.Policy
+	}
+	if policy.Catalog == nil {
+		policy.Catalog = h.Catalog
+	}
+	d := &Decision{
+		Trace: t,
+		Headers: []Header{
+			{Name: "Received-SPF", Value: t.ReceivedSPF(spf.ReceivedSPFCatalog(h.Catalog))},
+			{Name: "Authentication-Results", Value: AuthenticationResults(h.AuthServID, &t)},
+		},
+	}
+	d.Action, d.Reply = policy.Decide(&t)
+	return d
+}
+
+// AuthenticationResults returns the value of "Authentication-Results" header
+// field of RFC 8601 with the "spf" method result of the trace.
+func AuthenticationResults(authServID string, t *spf.Trace) string {
+	var b strings.Builder
+	if authServID == "" {
+		authServID = "unknown"
+	}
+	b.WriteString(authServID)
+	b.WriteString("; spf=")
+	b.WriteString(t.Result.String())
+	if t.Identity == "helo" {
+		if t.Helo != "" {
+			b.WriteString(" smtp.helo=")
+			b.WriteString(t.Helo)
+		}
+	} else if t.EnvelopeFrom != "" {
+		b.WriteString(" smtp.mailfrom=")
+		b.WriteString(t.EnvelopeFrom)
+	}
+	return b.String()
+}
@@ -0,0 +1,228 @@
+package milter
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/redsift/spf"
+)
+
+// zoneResolver answers lookups from TXT and A records kept in maps
+type zoneResolver struct {
+	txt map[string][]string
+	a   map[string][]net.IP
+}
+
+func (r *zoneResolver) LookupTXT(name string) ([]string, *spf.ResponseExtras, error) {
+	txt := r.txt[name]
+	return txt, &spf.ResponseExtras{Void: len(txt) == 0, Answers: len(txt)}, nil
+}
+
+func (r *zoneResolver) LookupTXTStrict(name string) ([]string, *spf.ResponseExtras, error) {
+	txt, extras, err := r.LookupTXT(name)
+	if len(txt) == 0 {
+		return nil, extras, spf.ErrDNSPermerror
+	}
+	return txt, extras, err
+}
+
+func (r *zoneResolver) Exists(name string) (bool, *spf.ResponseExtras, error) {
+	ok := len(r.a[name]) > 0
+	return ok, &spf.ResponseExtras{Void: !ok}, nil
+}
+
+func (r *zoneResolver) MatchIP(name string, matcher spf.IPMatcherFunc) (bool, *spf.ResponseExtras, error) {
+	ips := r.a[name]
+	extras := &spf.ResponseExtras{Void: len(ips) == 0, Answers: len(ips)}
+	for _, ip := range ips {
+		if ok, err := matcher(ip, name); ok || err != nil {
+			return ok, extras, err
+		}
+	}
+	return false, extras, nil
+}
+
+func (r *zoneResolver) MatchMX(name string, matcher spf.IPMatcherFunc) (bool, *spf.ResponseExtras, error) {
+	return false, &spf.ResponseExtras{Void: true}, nil
+}
+
+func newTestHandler() *Handler {
+	// "many.example." makes more DNS lookups than RFC 7208 allows
+	txt := map[string][]string{
+		"example.com.":      {"v=spf1 ip4:192.0.2.0/24 exp=exp.example.com -all"},
+		"exp.example.com.":  {"%{i} is not one of %{d}'s designated mail servers"},
+		"soft.example.com.": {"v=spf1 ip4:192.0.2.0/24 ~all"},
+		"mail.example.com.": {"v=spf1 a -all"},
+		"broken.example.":   {"v=spf1 foo -all"},
+	}
+	many := "v=spf1"
+	for i := 1; i <= 15; i++ {
+		host := fmt.Sprintf("i%d.many.example", i)
+		many += " include:" + host
+		txt[host+"."] = []string{"v=spf1 ip4:192.0.2.1 -all"}
+	}
+	txt["many.example."] = []string{many + " -all"}
+	return &Handler{
+		Resolver: &zoneResolver{
+			txt: txt,
+			a: map[string][]net.IP{
+				"mail.example.com.": {net.ParseIP("198.51.100.1")},
+			},
+		},
+		AuthServID: "mx.example.net",
+	}
+}
+
+func TestSession_MailFrom(t *testing.T) {
+	h := newTestHandler()
+	tests := []struct {
+		name     string
+		ip       string
+		helo     string
+		from     string
+		result   spf.Result
+		action   spf.Action
+		reply    string
+		received string
+		authRes  string
+	}{
+		{
+			name:     "pass",
+			ip:       "192.0.2.10",
+			helo:     "relay.example.org",
+			from:     "<alice@example.com>",
+			result:   spf.Pass,
+			action:   spf.Accept,
+			received: "pass (mx.example.net: domain of alice@example.com designates 192.0.2.10 as permitted sender) client-ip=192.0.2.10; identity=mailfrom; helo=relay.example.org; envelope-from=\"alice@example.com\"; receiver=mx.example.net; mechanism=\"ip4:192.0.2.0/24\"",
+			authRes:  "mx.example.net; spf=pass smtp.mailfrom=alice@example.com",
+		},
+		{
+			name:    "fail with explanation",
+			ip:      "203.0.113.1",
+			helo:    "relay.example.org",
+			from:    "alice@example.com",
+			result:  spf.Fail,
+			action:  spf.Reject,
+			reply:   "550 5.7.23 203.0.113.1 is not one of example.com's designated mail servers",
+			authRes: "mx.example.net; spf=fail smtp.mailfrom=alice@example.com",
+		},
+		{
+			name:    "softfail",
+			ip:      "203.0.113.1",
+			from:    "bob@soft.example.com",
+			result:  spf.Softfail,
+			action:  spf.Quarantine,
+			authRes: "mx.example.net; spf=softfail smtp.mailfrom=bob@soft.example.com",
+		},
+		{
+			name:    "helo fallback",
+			ip:      "198.51.100.1",
+			helo:    "mail.example.com.",
+			from:    "<>",
+			result:  spf.Pass,
+			action:  spf.Accept,
+			authRes: "mx.example.net; spf=pass smtp.helo=mail.example.com",
+		},
+		{
+			name:    "no identity",
+			ip:      "198.51.100.1",
+			from:    "",
+			result:  spf.None,
+			action:  spf.Accept,
+			authRes: "mx.example.net; spf=none",
+		},
+		{
+			name:    "permerror",
+			ip:      "198.51.100.1",
+			from:    "carol@broken.example",
+			result:  spf.Permerror,
+			action:  spf.MarkOnly,
+			authRes: "mx.example.net; spf=permerror smtp.mailfrom=carol@broken.example",
+		},
+		{
+			name:    "too many lookups",
+			ip:      "203.0.113.1",
+			helo:    "[203.0.113.1]",
+			from:    "dave@many.example",
+			result:  spf.Permerror,
+			action:  spf.MarkOnly,
+			authRes: "mx.example.net; spf=permerror smtp.mailfrom=dave@many.example",
+		},
+		{
+			name:    "helo fail",
+			ip:      "203.0.113.1",
+			helo:    "mail.example.com",
+			from:    "alice@example.com",
+			result:  spf.Fail,
+			action:  spf.Reject,
+			reply:   "550 5.7.23 SPF HELO check failed",
+			authRes: "mx.example.net; spf=fail smtp.helo=mail.example.com",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := h.Connect(net.ParseIP(test.ip))
+			s.Helo(test.helo)
+			d := s.MailFrom(test.from)
+			if d.Trace.Result != test.result {
+				t.Fatalf("result = %v, want %v (%v)", d.Trace.Result, test.result, d.Trace.Problem)
+			}
+			if d.Action != test.action {
+				t.Errorf("action = %v, want %v", d.Action, test.action)
+			}
+			if test.reply != "" {
+				if reply := d.Reply.String(); reply != test.reply {
+					t.Errorf("reply = %q, want %q", reply, test.reply)
+				}
+			}
+			if len(d.Headers) != 2 || d.Headers[0].Name != "Received-SPF" || d.Headers[1].Name != "Authentication-Results" {
+				t.Fatalf("headers = %v", d.Headers)
+			}
+			if test.received != "" && d.Headers[0].Value != test.received {
+				t.Errorf("Received-SPF = %q, want %q", d.Headers[0].Value, test.received)
+			}
+			if d.Headers[1].Value != test.authRes {
+				t.Errorf("Authentication-Results = %q, want %q", d.Headers[1].Value, test.authRes)
+			}
+		})
+	}
+}
+
+func TestHandler_Policy(t *testing.T) {
+	h := newTestHandler()
+	h.Policy = &spf.ActionPolicy{MailFrom: map[spf.Result]spf.Action{spf.Fail: spf.Defer, spf.Permerror: spf.Reject}}
+
+	d := h.Connect(net.ParseIP("203.0.113.1")).MailFrom("alice@example.com")
+	if d.Action != spf.Defer || d.Reply.Code != 451 || d.Reply.Status != "4.7.23" {
+		t.Errorf("fail: got %v %q", d.Action, d.Reply)
+	}
+	d = h.Connect(net.ParseIP("203.0.113.1")).MailFrom("carol@broken.example")
+	if d.Action != spf.Reject || d.Reply.String() != "550 5.7.24 SPF MAIL FROM check permanent error" {
+		t.Errorf("permerror: got %v %q", d.Action, d.Reply)
+	}
+	d = h.Connect(net.ParseIP("203.0.113.1")).MailFrom("bob@soft.example.com")
+	if d.Action != spf.Accept || d.Reply.Code != 0 {
+		t.Errorf("softfail: got %v %q", d.Action, d.Reply)
+	}
+}
+
+// shortCatalog words every phrase the same
+type shortCatalog struct{}
+
+func (shortCatalog) Reason(t *spf.Trace) string      { return "result is " + t.Result.String() }
+func (shortCatalog) Reply(string, spf.Result) string { return "rejected by SPF" }
+
+func TestHandler_Catalog(t *testing.T) {
+	h := newTestHandler()
+	h.Catalog = shortCatalog{}
+
+	d := h.Connect(net.ParseIP("203.0.113.1")).MailFrom("carol@mail.example.com")
+	if d.Action != spf.Reject || d.Reply.String() != "550 5.7.23 rejected by SPF" {
+		t.Errorf("got %v %q", d.Action, d.Reply)
+	}
+	if want := "fail (mx.example.net: result is fail)"; !strings.HasPrefix(d.Headers[0].Value, want) {
+		t.Errorf("Received-SPF = %q; want prefix %q", d.Headers[0].Value, want)
+	}
+}
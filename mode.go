@@ -0,0 +1,99 @@
+package spf
+
+import (
+	"errors"
+	"strings"
+)
+
+// Issues tolerated in Lenient mode
+var (
+	ErrStrayPunctuation = errors.New("stray punctuation")
+	ErrDuplicateAll     = errors.New(`duplicate "all"`)
+)
+
+// ParsingMode defines how evaluation treats malformed SPF records.
+//
+// Both modes accept mechanism and modifier names in any case (as RFC 7208
+// requires), tabs as terms separators and "explanation=" as an alias of
+// "exp=" (historical).
+type ParsingMode int
+
+const (
+	// Strict mode follows RFC 7208: any syntax error produces "permerror".
+	Strict ParsingMode = iota
+	// Lenient mode tolerates common mistakes seen in published records:
+	//   - trailing commas and semicolons are removed from terms;
+	//   - unknown or malformed terms are skipped;
+	//   - terms with characters other than printable ASCII are skipped;
+	//   - "ip4" and "ip6" with malformed addresses are skipped;
+	//   - only the first "redirect" and "exp" are used;
+	//   - every "all" after the first one is skipped.
+	// Every tolerated issue is reported to IssueListener.
+	Lenient
+)
+
+func (m ParsingMode) String() string {
+	switch m {
+	case Strict:
+		return "strict"
+	case Lenient:
+		return "lenient"
+	default:
+		return "unknown"
+	}
+}
+
+// WithParsingMode sets parsing mode, Strict is used by default.
+func WithParsingMode(m ParsingMode) Option {
+	return func(p *parser) {
+		p.mode = m
+	}
+}
+
+// tolerate fixes or drops faulty tokens reporting the issues found
+func (p *parser) tolerate(tokens []*token) []*token {
+	var (
+		r                  = make([]*token, 0, len(tokens))
+		all, redirect, exp bool
+	)
+	for _, t := range tokens {
+		if t.mechanism == tVersion {
+			r = append(r, t)
+			continue
+		}
+		raw := t.String()
+		if s := strings.TrimRight(raw, ",;"); s != raw {
+			p.fireIssue(t, ErrStrayPunctuation)
+			if s == "" {
+				continue
+			}
+			f := lex(s)[0]
+			f.start, f.end = t.start, t.end-(len(raw)-len(s))
+			if t.synthetic() {
+				f.start, f.end = -1, -1
+			}
+			t = f
+		}
+		issue := invalidCharacter(t)
+		switch {
+		case issue != nil:
+		case t.isErr():
+			issue = ErrSyntaxError
+		case t.mechanism == tAll && all:
+			issue = ErrDuplicateAll
+		case t.mechanism == tRedirect && redirect:
+			issue = ErrTooManyRedirects
+		case t.mechanism == tExp && exp:
+			issue = ErrTooManyExps
+		}
+		if issue != nil {
+			p.fireIssue(t, issue)
+			continue
+		}
+		all = all || t.mechanism == tAll
+		redirect = redirect || t.mechanism == tRedirect
+		exp = exp || t.mechanism == tExp
+		r = append(r, t)
+	}
+	return r
+}
@@ -0,0 +1,85 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type issueListener struct {
+	recordingListener
+}
+
+func (l *issueListener) Issue(term string, err error) {
+	l.add("Issue(%s, %v)", term, err)
+}
+
+func TestWithParsingMode(t *testing.T) {
+	tests := []struct {
+		record  string
+		ip      string
+		strict  Result
+		lenient Result
+		issues  []string
+	}{
+		{"v=spf1 ip4:10.0.0.0/8 -all", "10.0.0.1", Pass, Pass, nil},
+		{"v=spf1 ip4:10.0.0.0/8, -all;", "10.0.0.1", Permerror, Pass, []string{
+			"Issue(ip4:10.0.0.0/8,, stray punctuation)",
+			"Issue(-all;, stray punctuation)",
+		}},
+		{"v=spf1 ip4:10.0.0.0/8 ; -all", "192.168.0.1", Permerror, Fail, []string{
+			"Issue(;, stray punctuation)",
+		}},
+		{"v=spf1 IP4:10.0.0.0/8 -ALL", "192.168.0.1", Fail, Fail, nil},
+		{"v=spf1 ip4:10.0.0.0/8 foo:bar ~all -all", "192.168.0.1", Permerror, Softfail, []string{
+			"Issue(foo:bar, wrong syntax)",
+			`Issue(-all, duplicate "all")`,
+		}},
+		{"v=spf1 ip4:10.0.0.300 ip6:10.0.0.1 ip4:10.0.0.0/8 -all", "10.0.0.1", Permerror, Pass, []string{
+			"Issue(ip4:10.0.0.300, address isn't ipv4 [ip4:10.0.0.300])",
+			"Issue(ip6:10.0.0.1, address isn't ipv6 [ip6:10.0.0.1])",
+		}},
+		{"v=spf1 ip4:10.0.0.0/8 redirect=a.mode.example redirect=b.mode.example", "192.168.0.1", Permerror, Neutral, []string{
+			`Issue(redirect=b.mode.example, too many "redirect")`,
+		}},
+	}
+
+	testResolverCache.Purge()
+	dns.HandleFunc("a.mode.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`a.mode.example. 0 IN TXT "v=spf1 ?all"`,
+		},
+	}))
+	defer dns.HandleRemove("a.mode.example.")
+
+	for no, test := range tests {
+		t.Run(fmt.Sprintf("%d_%s", no, test.record), func(t *testing.T) {
+			dns.HandleFunc("mode.example.", zone(map[uint16][]string{
+				dns.TypeTXT: {
+					fmt.Sprintf(`mode.example. 0 IN TXT "%s"`, test.record),
+				},
+			}))
+			defer dns.HandleRemove("mode.example.")
+			testResolverCache.Purge()
+
+			ip := net.ParseIP(test.ip)
+			if r, _, _, err := CheckHost(ip, "mode.example", "mode.example", WithResolver(testResolver)); r != test.strict {
+				t.Errorf("CheckHost() = %s, %v; want %s in default mode", r, err, test.strict)
+			}
+			if r, _, _, err := CheckHost(ip, "mode.example", "mode.example", WithResolver(testResolver), WithParsingMode(Strict)); r != test.strict {
+				t.Errorf("CheckHost() = %s, %v; want %s in strict mode", r, err, test.strict)
+			}
+
+			l := &issueListener{}
+			r, _, _, err := CheckHost(ip, "mode.example", "mode.example", WithResolver(testResolver), WithParsingMode(Lenient), WithListener(l))
+			if r != test.lenient || err != nil {
+				t.Errorf("CheckHost() = %s, %v; want %s in lenient mode", r, err, test.lenient)
+			}
+			if got := l.filter("Issue"); fmt.Sprint(got) != fmt.Sprint(test.issues) {
+				t.Errorf("Issue events:\n got=%q\nwant=%q", got, test.issues)
+			}
+		})
+	}
+}
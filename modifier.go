@@ -0,0 +1,44 @@
+package spf
+
+import (
+	"strings"
+)
+
+// Modifier is a name=value term of SPF record unknown to the evaluation,
+// like "ra=postmaster" of RFC 6652. Unknown modifiers don't change
+// the result and are otherwise ignored, but consumers may act on them.
+type Modifier struct {
+	Name  string `json:"name"`  // lowercased name of the modifier
+	Value string `json:"value"` // value as published, macros are not expanded
+}
+
+func (m Modifier) String() string {
+	return m.Name + "=" + m.Value
+}
+
+// modifier returns lowercased name and the value of unknown-modifier token
+func (t *token) modifier() (name, value string) {
+	i := strings.IndexByte(t.value, '=')
+	if i < 0 {
+		return strings.ToLower(t.value), ""
+	}
+	return strings.ToLower(t.value[:i]), t.value[i+1:]
+}
+
+// isModifierName checks s against RFC 7208 grammar:
+//
+//	name = ALPHA *( ALPHA / DIGIT / "-" / "_" / "." )
+func isModifierName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, ch := range s {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z':
+		case i > 0 && (isDigit(ch) || ch == '-' || ch == '_' || ch == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package spf
+
+import (
+	"strings"
+)
+
+// NearMissKind tells what's wrong with a TXT record which was probably meant
+// to be SPF record.
+type NearMissKind int
+
+const (
+	// NearMissTypo is a misspelled version section, e.g. "v:spf1",
+	// "V=SPF1", "v=spf 1" or "spf1"
+	NearMissTypo NearMissKind = iota + 1
+	// NearMissVersion is a version of SPF which doesn't exist,
+	// e.g. "v=spf2" or "v=spf10"
+	NearMissVersion
+	// NearMissSenderID is Sender ID record, e.g. "spf2.0/pra", which
+	// SPF ignores
+	// https://tools.ietf.org/html/rfc4406
+	NearMissSenderID
+)
+
+func (k NearMissKind) String() string {
+	switch k {
+	case NearMissTypo:
+		return "typo"
+	case NearMissVersion:
+		return "version"
+	case NearMissSenderID:
+		return "sender-id"
+	default:
+		return "unknown"
+	}
+}
+
+func (k NearMissKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *NearMissKind) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "typo":
+		*k = NearMissTypo
+	case "version":
+		*k = NearMissVersion
+	case "sender-id":
+		*k = NearMissSenderID
+	default:
+		*k = 0
+	}
+	return nil
+}
+
+// NearMiss is a TXT record which looks like SPF record but is ignored as
+// it doesn't begin with exactly "v=spf1".
+type NearMiss struct {
+	Record string       `json:"record"`
+	Kind   NearMissKind `json:"kind"`
+}
+
+// NearMisses returns TXT records which were probably meant to be SPF
+// records but are ignored by evaluation.
+func NearMisses(txt []string) []NearMiss {
+	var misses []NearMiss
+	for _, s := range txt {
+		if len(spfRecords([]string{s})) > 0 {
+			continue
+		}
+		if k := nearMissKind(s); k != 0 {
+			misses = append(misses, NearMiss{s, k})
+		}
+	}
+	return misses
+}
+
+// nearMissKind classifies the record, it returns 0 if the record doesn't
+// look like SPF record at all
+func nearMissKind(s string) NearMissKind {
+	l := strings.ToLower(strings.TrimLeft(s, " \t\"'"))
+	if strings.HasPrefix(l, "spf2.0/") {
+		return NearMissSenderID
+	}
+	if l == "spf1" || strings.HasPrefix(l, "spf1 ") {
+		return NearMissTypo
+	}
+
+	// v, separator, "spf" and version, each could be surrounded by spaces
+	if !strings.HasPrefix(l, "v") {
+		return 0
+	}
+	l = strings.TrimLeft(l[1:], " \t")
+	if l == "" || !strings.ContainsRune("=:-", rune(l[0])) {
+		return 0
+	}
+	l = strings.TrimLeft(l[1:], " \t")
+	if len(l) < 3 || !isAnagramOfSPF(l[:3]) {
+		return 0
+	}
+	l = strings.TrimLeft(l[3:], " \t")
+	end := strings.IndexAny(l, " \t")
+	if end < 0 {
+		end = len(l)
+	}
+	if version := l[:end]; version != "1" && version != "" && strings.Trim(version, "0123456789.") == "" {
+		return NearMissVersion
+	}
+	return NearMissTypo
+}
+
+// isAnagramOfSPF returns true for "spf" and its transpositions like "sfp"
+func isAnagramOfSPF(s string) bool {
+	return len(s) == 3 && strings.ContainsRune(s, 's') && strings.ContainsRune(s, 'p') && strings.ContainsRune(s, 'f')
+}
@@ -0,0 +1,96 @@
+package spf
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestNearMisses(t *testing.T) {
+	tests := []struct {
+		record string
+		kind   NearMissKind
+	}{
+		{"v=spf1 -all", 0},
+		{"v=spf1", 0},
+		{"google-site-verification=abc", 0},
+		{"v=DMARC1; p=none", 0},
+		{"verification=spf", 0},
+		{"v:spf1 -all", NearMissTypo},
+		{"V=SPF1 -all", NearMissTypo},
+		{" v=spf1 -all", NearMissTypo},
+		{`"v=spf1 -all"`, NearMissTypo},
+		{"v = spf1 -all", NearMissTypo},
+		{"v=spf 1 -all", NearMissTypo},
+		{"v=sfp1 -all", NearMissTypo},
+		{"v=spf -all", NearMissTypo},
+		{"v-spf1 mx", NearMissTypo},
+		{"spf1 mx -all", NearMissTypo},
+		{"v=spf2 -all", NearMissVersion},
+		{"v=spf10 -all", NearMissVersion},
+		{"v=spf1.0 -all", NearMissVersion},
+		{"spf2.0/pra ip4:10.0.0.0/8 -all", NearMissSenderID},
+		{"SPF2.0/mfrom,pra -all", NearMissSenderID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.record, func(t *testing.T) {
+			var want []NearMiss
+			if tt.kind != 0 {
+				want = []NearMiss{{tt.record, tt.kind}}
+			}
+			if got := NearMisses([]string{tt.record}); !reflect.DeepEqual(got, want) {
+				t.Errorf("NearMisses() = %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+type nearMissListener struct {
+	recordingListener
+}
+
+func (l *nearMissListener) NearMiss(domain, record string, kind NearMissKind) {
+	l.add("NearMiss(%s, %s, %s)", domain, record, kind)
+}
+
+func TestCheckHostDetailed_NearMisses(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("nearmiss.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`nearmiss.example. 300 IN TXT "v=spf1 include:inc.nearmiss.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("nearmiss.example.")
+
+	dns.HandleFunc("inc.nearmiss.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.nearmiss.example. 300 IN TXT "v:spf1 ip4:10.0.0.0/8 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.nearmiss.example.")
+
+	l := &nearMissListener{}
+	r := CheckHostDetailed(net.ParseIP("10.0.0.1"), "nearmiss.example", "", WithResolver(testResolver), WithListener(l))
+	if r.Result != Permerror {
+		t.Errorf("Result = %s, %v; want %s", r.Result, r.Err, Permerror)
+	}
+	if r.NearMisses != nil {
+		t.Errorf("NearMisses = %v; want none", r.NearMisses)
+	}
+	want := []NearMiss{{"v:spf1 ip4:10.0.0.0/8 -all", NearMissTypo}}
+	if got := r.Path.Steps[0].Path.NearMisses; !reflect.DeepEqual(got, want) {
+		t.Errorf("NearMisses of the include = %v; want %v", got, want)
+	}
+	wantEvents := []string{"NearMiss(inc.nearmiss.example., v:spf1 ip4:10.0.0.0/8 -all, typo)"}
+	if got := l.filter("NearMiss"); !reflect.DeepEqual(got, wantEvents) {
+		t.Errorf("events = %q; want %q", got, wantEvents)
+	}
+
+	r = CheckHostDetailed(net.ParseIP("10.0.0.1"), "inc.nearmiss.example", "", WithResolver(testResolver))
+	if r.Result != None || !reflect.DeepEqual(r.NearMisses, want) {
+		t.Errorf("CheckHostDetailed() = %s, %v; want %s, %v", r.Result, r.NearMisses, None, want)
+	}
+}
@@ -0,0 +1,112 @@
+//go:build go1.18
+// +build go1.18
+
+package spf
+
+import (
+	"net"
+	"net/netip"
+)
+
+// CheckHostAddr is CheckHost taking the IP address as netip.Addr.
+func CheckHostAddr(addr netip.Addr, domain, sender string, opts ...Option) (Result, string, string, error) {
+	return CheckHost(addrIP(addr), domain, sender, opts...)
+}
+
+// CheckHostDetailedAddr is CheckHostDetailed taking the IP address as
+// netip.Addr.
+func CheckHostDetailedAddr(addr netip.Addr, domain, sender string, opts ...Option) *CheckResult {
+	return CheckHostDetailed(addrIP(addr), domain, sender, opts...)
+}
+
+// MatchAddr is Match taking the IP address as netip.Addr.
+func (m *Matcher) MatchAddr(addr netip.Addr) Result {
+	return m.Match(addrIP(addr))
+}
+
+// WithAllowlistPrefixes is WithAllowlist taking the networks as
+// netip.Prefix, invalid prefixes are ignored.
+func WithAllowlistPrefixes(prefixes ...netip.Prefix) Option {
+	networks := make([]net.IPNet, 0, len(prefixes))
+	for _, p := range prefixes {
+		if n, ok := PrefixIPNet(p); ok {
+			networks = append(networks, n)
+		}
+	}
+	return WithAllowlist(networks...)
+}
+
+// Prefix returns the network as netip.Prefix.
+func (n AuthorizedNetwork) Prefix() (netip.Prefix, bool) {
+	if n.Network == nil {
+		return netip.Prefix{}, false
+	}
+	return IPNetPrefix(*n.Network)
+}
+
+// AddrMatcherFunc is IPMatcherFunc taking the IP address as netip.Addr.
+type AddrMatcherFunc func(addr netip.Addr, name string) (bool, error)
+
+// IPMatcher adapts AddrMatcherFunc to IPMatcherFunc, addresses which aren't
+// valid don't match.
+func IPMatcher(f AddrMatcherFunc) IPMatcherFunc {
+	return func(ip net.IP, name string) (bool, error) {
+		addr, ok := IPAddr(ip)
+		if !ok {
+			return false, nil
+		}
+		return f(addr, name)
+	}
+}
+
+// AddrMatcher adapts IPMatcherFunc to AddrMatcherFunc.
+func AddrMatcher(f IPMatcherFunc) AddrMatcherFunc {
+	return func(addr netip.Addr, name string) (bool, error) {
+		return f(addrIP(addr), name)
+	}
+}
+
+// IPAddr converts net.IP to netip.Addr, IPv4 addresses are always returned
+// as such, even if ip is of 16 bytes.
+func IPAddr(ip net.IP) (netip.Addr, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
+
+// IPNetPrefix converts net.IPNet to netip.Prefix, it returns false for
+// networks which masks aren't of CIDR form.
+func IPNetPrefix(n net.IPNet) (netip.Prefix, bool) {
+	addr, ok := IPAddr(n.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, bits := n.Mask.Size()
+	if bits == 0 {
+		return netip.Prefix{}, false
+	}
+	if addr.Is4() && bits == 8*net.IPv6len {
+		ones -= 8 * (net.IPv6len - net.IPv4len)
+	}
+	return netip.PrefixFrom(addr, ones).Masked(), true
+}
+
+// PrefixIPNet converts netip.Prefix to net.IPNet, it returns false for
+// invalid prefixes.
+func PrefixIPNet(p netip.Prefix) (net.IPNet, bool) {
+	if !p.IsValid() {
+		return net.IPNet{}, false
+	}
+	p = p.Masked()
+	return net.IPNet{
+		IP:   addrIP(p.Addr()),
+		Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+	}, true
+}
+
+// addrIP converts netip.Addr to net.IP, the zero Addr becomes nil
+func addrIP(addr netip.Addr) net.IP {
+	if !addr.IsValid() {
+		return nil
+	}
+	return net.IP(addr.Unmap().AsSlice())
+}
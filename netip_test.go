@@ -0,0 +1,120 @@
+//go:build go1.18
+// +build go1.18
+
+package spf
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckHostAddr(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("netip.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`netip.example. 300 IN TXT "v=spf1 ip4:10.0.0.0/24 ip6:2001:db8::/32 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("netip.example.")
+
+	tests := []struct {
+		addr   netip.Addr
+		result Result
+	}{
+		{netip.MustParseAddr("10.0.0.1"), Pass},
+		{netip.MustParseAddr("::ffff:10.0.0.1"), Pass},
+		{netip.MustParseAddr("2001:db8::1"), Pass},
+		{netip.MustParseAddr("10.0.1.1"), Fail},
+		{netip.MustParseAddr("2001:db9::1"), Fail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr.String(), func(t *testing.T) {
+			r, _, _, err := CheckHostAddr(tt.addr, "netip.example", "", WithResolver(testResolver))
+			if r != tt.result {
+				t.Errorf("CheckHostAddr() = %s, %v; want %s", r, err, tt.result)
+			}
+			if d := CheckHostDetailedAddr(tt.addr, "netip.example", "", WithResolver(testResolver)); d.Result != tt.result {
+				t.Errorf("CheckHostDetailedAddr() = %s, %v; want %s", d.Result, d.Err, tt.result)
+			}
+		})
+	}
+}
+
+func TestIPNetPrefix(t *testing.T) {
+	tests := []struct {
+		network string
+		prefix  string
+	}{
+		{"10.0.0.0/24", "10.0.0.0/24"},
+		{"192.0.2.1/32", "192.0.2.1/32"},
+		{"2001:db8::/32", "2001:db8::/32"},
+		{"::/0", "::/0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			_, n, _ := net.ParseCIDR(tt.network)
+			p, ok := IPNetPrefix(*n)
+			if !ok || p.String() != tt.prefix {
+				t.Errorf("IPNetPrefix(%s) = %s, %t; want %s", n, p, ok, tt.prefix)
+			}
+			back, ok := PrefixIPNet(p)
+			if !ok || back.String() != n.String() {
+				t.Errorf("PrefixIPNet(%s) = %s, %t; want %s", p, &back, ok, n)
+			}
+		})
+	}
+
+	// IPv4 network with 16 bytes address and mask
+	n := net.IPNet{IP: net.ParseIP("10.1.0.0"), Mask: net.CIDRMask(112, 128)}
+	if p, ok := IPNetPrefix(n); !ok || p.String() != "10.1.0.0/16" {
+		t.Errorf("IPNetPrefix(%v) = %s, %t; want 10.1.0.0/16", n, p, ok)
+	}
+	if _, ok := IPNetPrefix(net.IPNet{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.IPv4Mask(255, 0, 255, 0)}); ok {
+		t.Error("IPNetPrefix() of non-CIDR mask is ok")
+	}
+	if _, ok := PrefixIPNet(netip.Prefix{}); ok {
+		t.Error("PrefixIPNet() of invalid prefix is ok")
+	}
+}
+
+func TestAddrMatcher(t *testing.T) {
+	var got netip.Addr
+	f := IPMatcher(func(addr netip.Addr, name string) (bool, error) {
+		got = addr
+		return addr.Is4(), nil
+	})
+	if ok, _ := f(net.ParseIP("192.0.2.1"), "example.com"); !ok || got != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("IPMatcher() got %s, matches %t; want 192.0.2.1", got, ok)
+	}
+	if ok, _ := f(net.IP{1, 2, 3}, "example.com"); ok {
+		t.Error("IPMatcher() matches invalid address")
+	}
+
+	g := AddrMatcher(func(ip net.IP, name string) (bool, error) {
+		return ip.Equal(net.ParseIP("2001:db8::1")), nil
+	})
+	if ok, _ := g(netip.MustParseAddr("2001:db8::1"), "example.com"); !ok {
+		t.Error("AddrMatcher() doesn't match")
+	}
+}
+
+func TestWithAllowlistPrefixes(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("allowprefix.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`allowprefix.example. 300 IN TXT "v=spf1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("allowprefix.example.")
+
+	opt := WithAllowlistPrefixes(netip.MustParsePrefix("192.0.2.0/24"), netip.Prefix{})
+	r, _, _, err := CheckHostAddr(netip.MustParseAddr("192.0.2.7"), "allowprefix.example", "", WithResolver(testResolver), opt)
+	if r != Pass {
+		t.Errorf("CheckHostAddr() = %s, %v; want %s", r, err, Pass)
+	}
+}
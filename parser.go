@@ -1,10 +1,13 @@
 package spf
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -82,28 +85,92 @@ func (e SyntaxError) Cause() error {
 	return e.err
 }
 
+// Unwrap returns the underlying error, so sentinel errors could be found in
+// the chain with errors.Is and errors.As.
+func (e SyntaxError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is SyntaxError of the same term, which error,
+// unless nil, is in the chain of e's error.
+func (e SyntaxError) Is(target error) bool {
+	t, ok := target.(SyntaxError)
+	if !ok || e.token.String() != t.token.String() {
+		return false
+	}
+	return t.err == nil || errors.Is(e.err, t.err)
+}
+
 func (e SyntaxError) TokenString() string {
 	return e.token.String()
 }
 
+// Position returns byte offsets [start, end) of the faulty term in the SPF
+// record it belongs to. For errors from included or redirected records
+// the offsets refer to the record of the domain the term came from.
+// Both offsets are -1 when the error isn't bound to any term.
+func (e SyntaxError) Position() (start, end int) {
+	return e.token.position()
+}
+
 // parser represents parsing structure. It keeps all arguments provided by top
 // level CheckHost method as well as tokenized terms from TXT RR. One should
 // call parser.Parse() for a proper SPF evaluation.
 type parser struct {
-	sender        string
-	domain        string
-	heloDomain    string
-	ip            net.IP
-	query         string
-	resolver      Resolver
-	listener      Listener
-	ignoreMatches bool
-	options       []Option
-	visited       *stringsStack
-	evaluatedOn   time.Time
-	receivingFQDN string
-	stopAtError   func(error) bool
-	partialMacros bool
+	sender           string
+	domain           string
+	heloDomain       string
+	ip               net.IP
+	query            string
+	resolver         Resolver
+	resolverFactory  func() Resolver // see WithResolverFactory
+	hardening        Hardening       // see WithHardening
+	maxDepth         int             // see WithMaxDepth
+	limits           Limits          // see WithLimits
+	maxTXTRecords    int             // see WithTXTLimits
+	maxTXTBytes      int             // see WithTXTLimits
+	ctx              context.Context // see WithContext, switched for nested domains by contextDecorator
+	contextDecorator func(context.Context, int) (context.Context, context.CancelFunc)
+	listener         Listener
+	ignoreMatches    bool
+	followRedirects  bool // see FollowRedirects
+	options          []Option
+	visited          *stringsStack
+	evaluatedOn      time.Time
+	evaluatedOnSet   bool  // EvaluatedOn is given, see WithClock
+	clock            Clock // see WithClock
+	receivingFQDN    string
+	stopAtError      func(error) bool
+	errorLimits      map[ErrorKind]int // see ErrorsThresholdByKind
+	partialMacros    bool
+	expandEscapes    bool
+	domainProfile    DomainProfile
+	pins             *Pins
+	localPolicy      LocalPolicy
+	injected         []*token // terms prepended to the checked domain's record
+	mode             ParsingMode
+	spec             Spec
+	spfRR            bool         // look up SPF RR type along with TXT
+	senderID         bool         // see EvaluateSenderID
+	counters         *counters    // shared by all parsers of the check
+	ptrMemo          *ptrMemo     // shared by all parsers of the check
+	includeMemo      *includeMemo // shared by all parsers of the check, see MemoizeIncludes
+	memoizeIncludes  bool
+	explainer        *explainer
+	concurrency      int                  // number of includes evaluated concurrently
+	events           *eventsBuffer        // buffer for events of concurrently evaluated include
+	step             func(Directive) bool // see Evaluation
+	records          *RecordCache
+	networks         map[*token]ipNetwork // of the record evaluated, see RecordCache
+
+	ignoreExplanations bool
+	countExplanation   bool
+
+	aggregate        *Aggregate
+	mechanismTimeout time.Duration
+	overallTimeout   time.Duration
+	outerDeadline    deadline // deadline of the mechanism which caused evaluation of the record
+	deadline         deadline // deadline of the lookups in progress
 }
 
 // newParser creates new Parser objects and returns its reference.
@@ -117,13 +184,38 @@ func newParser(opts ...Option) *parser {
 // It accepts CheckHost() parameters as well as SPF query (fetched from TXT RR
 // during initial DNS lookup.
 func newParserWithVisited(visited *stringsStack, opts ...Option) *parser {
-	p := &parser{
-		//mechanisms: make([]*token, 0, 10),
-		resolver:      NewLimitedResolver(&DNSResolver{}, 10, 10),
+	p := acquireParser(visited, opts)
+	if p.resolverFactory != nil {
+		p.resolver = p.resolverFactory()
+	}
+	if p.resolver == nil {
+		p.resolver = p.limits.Resolver(&DNSResolver{})
+	}
+	if p.counters == nil {
+		p.counters = &counters{}
+	}
+	if !p.evaluatedOnSet {
+		p.evaluatedOn = p.now().UTC()
+	}
+	return p
+}
+
+// parsers keeps parsers of finished evaluations, as one is needed for every
+// record evaluated, including those reached by "include" and "redirect".
+var parsers = sync.Pool{
+	New: func() interface{} { return new(parser) },
+}
+
+// acquireParser returns a parser from the pool with the options applied
+func acquireParser(visited *stringsStack, opts []Option) *parser {
+	p := parsers.Get().(*parser)
+	*p = parser{
 		options:       opts,
 		visited:       visited,
 		receivingFQDN: "unknown",
-		evaluatedOn:   time.Now().UTC(),
+		clock:         SystemClock,
+		maxDepth:      defaultMaxDepth,
+		limits:        DefaultLimits(),
 	}
 	for _, opt := range opts {
 		opt(p)
@@ -131,6 +223,12 @@ func newParserWithVisited(visited *stringsStack, opts ...Option) *parser {
 	return p
 }
 
+// release puts p back to the pool, it must not be used by anything after.
+func (p *parser) release() {
+	*p = parser{}
+	parsers.Put(p)
+}
+
 // checkHostWithResolver does checking with custom Resolver.
 // Note, that DNS lookup limits need to be enforced by provided Resolver.
 //
@@ -138,6 +236,13 @@ func newParserWithVisited(visited *stringsStack, opts ...Option) *parser {
 // and error as the reason for the encountered problem.
 func (p *parser) checkHost(ip net.IP, domain, sender string) (r Result, expl string, spf string, err error) {
 	var u unused
+	if p.topLevel() {
+		p.counters = &counters{}
+		p.ptrMemo = &ptrMemo{}
+		if p.memoizeIncludes {
+			p.includeMemo = &includeMemo{}
+		}
+	}
 	p.fireCheckHost(ip, domain, sender)
 	defer func() {
 		p.fireCheckHostResult(r, expl, err)
@@ -146,6 +251,27 @@ func (p *parser) checkHost(ip net.IP, domain, sender string) (r Result, expl str
 		}
 		p.fireUnusedDirective(u.redirect)
 	}()
+	r, expl, spf, err, u = p.evaluate(ip, domain, sender)
+	if p.localPolicy.After == nil || !p.topLevel() || r != None && r != Permerror || !p.domainProfile.valid(domain) {
+		return
+	}
+	record, result := p.localPolicy.After(NormalizeFQDN(domain), r, err)
+	switch {
+	case record != "":
+		p.fireLocalPolicy(NormalizeFQDN(domain), record, 0)
+		spf = record
+		np := p.nested(p.visited).with(spf, sender, domain, ip)
+		r, expl, err, u = np.check()
+		np.release()
+	case result != 0:
+		p.fireLocalPolicy(NormalizeFQDN(domain), "", result)
+		r, expl, err, u = result, "", nil, unused{}
+	}
+	return
+}
+
+// evaluate looks up SPF record of the domain and evaluates it
+func (p *parser) evaluate(ip net.IP, domain, sender string) (r Result, expl string, spf string, err error, u unused) {
 	/*
 	* As per RFC 7208 Section 4.3:
 	* If the <domain> is malformed (e.g., label longer than 63
@@ -153,41 +279,85 @@ func (p *parser) checkHost(ip net.IP, domain, sender string) (r Result, expl str
 	* a multi-label
 	* domain name, [...], check_host() immediately returns None
 	 */
-	if !isDomainName(domain) {
-		return None, "", "", newInvalidDomainError(domain)
+	if !p.domainProfile.valid(domain) {
+		return None, "", "", newInvalidDomainError(domain), u
 	}
 
 	if p.visited.has(NormalizeFQDN(domain)) {
-		return Permerror, "", "", ErrLoopDetected
+		return Permerror, "", "", p.visited.loop(NormalizeFQDN(domain)), u
 	}
 
-	txts, err := p.resolver.LookupTXTStrict(NormalizeFQDN(domain))
-	switch err {
-	case nil:
-		// continue
-	case ErrDNSLimitExceeded:
-		return Permerror, "", "", err
-	case ErrDNSPermerror:
-		return None, "", "", err
-	default:
-		return Temperror, "", "", err
+	if p.maxDepth > 0 && len(p.visited.s) > p.maxDepth {
+		return Permerror, "", "", ErrTooDeep, u
 	}
 
-	// If the resultant record set includes no records, check_host()
-	// produces the "none" result.  If the resultant record set includes
-	// more than one record, check_host() produces the "permerror" result.
-	spf, err = filterSPF(txts)
-	if err != nil {
-		return Permerror, "", "", err
+	if p.overallTimeout > 0 && p.deadline.t.IsZero() {
+		p.deadline = deadline{time.Now().Add(p.overallTimeout), ErrDeadlineExceeded}
+	}
+	p.deadline = earliest(p.deadline, contextDeadline(p.ctx))
+
+	pin, pinned := p.pins.Lookup(domain, p.evaluatedOn)
+	if pinned {
+		p.firePinned(NormalizeFQDN(domain), pin)
+		if pin.Result != 0 {
+			return pin.Result, "", "", nil, u
+		}
+		spf = pin.Record
+	} else if record, ok := p.localRecord(NormalizeFQDN(domain)); ok {
+		spf = record
+	} else {
+		start := p.now()
+		txts, extras, err := p.dns().LookupTXTStrict(NormalizeFQDN(domain))
+		p.fireLookupExtras(nil, NormalizeFQDN(domain), extras.spent(p.since(start)))
+		switch {
+		case err == nil:
+			// continue
+		case errors.Is(err, ErrDNSLimitExceeded):
+			return Permerror, "", "", err, u
+		case errors.Is(err, ErrDNSPermerror):
+			return None, "", "", err, u
+		default:
+			return Temperror, "", "", err, u
+		}
+
+		// If the resultant record set includes no records, check_host()
+		// produces the "none" result.  If the resultant record set includes
+		// more than one record, check_host() produces the "permerror" result.
+		if err := p.checkTXTAnswer(NormalizeFQDN(domain), txts); err != nil {
+			return Permerror, "", "", err, u
+		}
+		p.fireNearMisses(NormalizeFQDN(domain), txts)
+		spf, err = filterSPF(txts)
+		if spf == "" && err == nil && p.senderID {
+			spf, err = filterSenderID(txts)
+		}
+		if p.spfRR {
+			spf, err = p.reconcileSPFRR(NormalizeFQDN(domain), spf, err)
+		}
+		if err != nil {
+			return Permerror, "", "", err, u
+		}
 	}
 	if spf == "" {
-		return None, "", "", ErrSPFNotFound
+		return None, "", "", ErrSPFNotFound, u
 	}
 
-	r, expl, err, u = newParserWithVisited(p.visited, p.options...).with(spf, sender, domain, ip).check()
+	np := p.nested(p.visited).with(spf, sender, domain, ip)
+	r, expl, err, u = np.check()
+	np.release()
 	return
 }
 
+// nested returns a parser for evaluation of a record reached from the one
+// evaluated by p, the state of the whole evaluation is shared with p.
+func (p *parser) nested(visited *stringsStack) *parser {
+	np := acquireParser(visited, p.options)
+	np.resolver, np.events, np.counters, np.ptrMemo = p.resolver, p.events, p.counters, p.ptrMemo
+	np.includeMemo, np.evaluatedOn = p.includeMemo, p.evaluatedOn
+	np.outerDeadline, np.ctx = p.deadline, p.ctx
+	return np
+}
+
 func (p *parser) with(query, sender, domain string, ip net.IP) *parser {
 	p.query = query
 	p.sender = sender
@@ -207,11 +377,25 @@ type unused struct {
 // each token (from left to right). Once a token matches parse stops and
 // returns matched result.
 func (p *parser) check() (Result, string, error, unused) {
+	top := p.topLevel()
 	p.visited.push(p.domain)
 	defer p.visited.pop()
 
 	p.fireSPFRecord(p.query)
-	tokens := lex(p.query)
+	query := p.query
+	if p.senderID {
+		query = senderIDAsSPF(query)
+	}
+	tokens, networks := p.records.parse(query)
+	p.networks = networks
+	if top {
+		tokens = p.inject(tokens)
+	}
+	if p.mode == Lenient {
+		tokens = p.tolerate(tokens)
+	} else if err := invalidCharacters(tokens); err != nil {
+		return Permerror, "", err, unused{}
+	}
 
 	var (
 		result  = Neutral
@@ -220,13 +404,26 @@ func (p *parser) check() (Result, string, error, unused) {
 		i       int
 	)
 
-	mechanisms, redirect, explanation, err := sortTokens(tokens)
+	mechanisms, redirect, explanation, modifiers, err := sortTokens(tokens)
 	if err != nil {
 		return Permerror, "", err, unused{mechanisms, redirect}
 	}
+	for _, t := range modifiers {
+		p.fireUnknownModifier(t)
+	}
+
+	var includes *concurrentIncludes
+	if p.concurrency > 0 && !p.ignoreMatches {
+		includes = p.evaluateIncludes(mechanisms)
+		defer includes.cancel()
+	}
 
 	var all bool
 	for i, token = range mechanisms {
+		if !p.proceed(token) {
+			return Temperror, "", SyntaxError{token, ErrAborted}, unused{mechanisms[i:], redirect}
+		}
+		p.startMechanism()
 		switch token.mechanism {
 		case tVersion:
 			matches, result, err = p.parseVersion(token)
@@ -242,27 +439,50 @@ func (p *parser) check() (Result, string, error, unused) {
 		case tMX:
 			matches, result, err = p.parseMX(token)
 		case tInclude:
-			matches, result, err = p.parseInclude(token)
+			if includes != nil {
+				matches, result, err = includes.result(p, token)
+			} else {
+				matches, result, err = p.parseInclude(token)
+			}
 		case tExists:
 			matches, result, err = p.parseExists(token)
 		case tPTR:
-			_, _, _ = p.parsePtr(token)
+			matches, result, err = p.parsePtr(token)
 		default:
 			p.fireDirective(token, "")
 		}
 
+		if p.mode == Lenient && matches && result == Permerror && (token.mechanism == tIP4 || token.mechanism == tIP6) {
+			p.fireIssue(token, err)
+			matches, err = false, nil
+		}
+
+		if e := p.limitsError(); e != nil && err == nil {
+			matches, result, err = true, Permerror, SyntaxError{token, e}
+		}
+
+		if isTimeout(err) {
+			matches, result = true, Temperror
+			if _, ok := err.(SyntaxError); !ok {
+				err = SyntaxError{token, err}
+			}
+		}
+
 		if !p.ignoreMatches && matches {
 			var s string
-			if result == Fail && explanation != nil {
+			if result == Fail && explanation != nil && !p.ignoreExplanations {
 				s, err = p.handleExplanation(explanation)
 			}
 			p.fireMatch(token, result, s, err)
 			return result, s, err, unused{mechanisms[i+1:], redirect}
 		}
+		if p.ignoreMatches && matches && p.explainer != nil {
+			p.explainer.match(result, err)
+		}
 		p.fireNonMatch(token, result, err)
 
 		// in walker-mode we want to count number of errors and check the counter against some threshold
-		if p.ignoreMatches && p.stopAtError != nil && p.stopAtError(err) {
+		if p.ignoreMatches && (p.stopAtError != nil && p.stopAtError(err) || p.errorsExceeded(err)) {
 			return unreliableResult, "", ErrTooManyErrors, unused{mechanisms[i+1:], redirect}
 		}
 
@@ -270,24 +490,51 @@ func (p *parser) check() (Result, string, error, unused) {
 		// others are being registered by listener
 	}
 
-	if !all {
+	// "redirect" is ignored when there is "all", unless inspection follows it
+	follow := !all || p.ignoreMatches && p.followRedirects
+	if follow {
+		if redirect != nil && !p.proceed(redirect) {
+			return Temperror, "", SyntaxError{redirect, ErrAborted}, unused{redirect: redirect}
+		}
+		p.startMechanism()
 		result, err = p.handleRedirect(redirect)
+		if e := p.limitsError(); e != nil && err == nil {
+			result, err = Permerror, SyntaxError{redirect, e}
+		}
 	}
 
 	if p.ignoreMatches {
+		if !follow {
+			return unreliableResult, "", ErrUnreliableResult, unused{redirect: redirect}
+		}
 		return unreliableResult, "", ErrUnreliableResult, unused{}
 	}
 	return result, "", err, unused{}
 }
 
 func (p *parser) fireCheckHost(ip net.IP, domain, sender string) {
+	if p.buffered(func(p *parser) { p.fireCheckHost(ip, domain, sender) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.checkHost(domain)
+	}
 	if p.listener == nil {
 		return
 	}
+	if l, ok := p.listener.(ContextListener); ok && p.ctx != nil {
+		l.CheckHostContext(p.ctx, ip, domain, sender)
+	}
 	p.listener.CheckHost(ip, domain, sender)
 }
 
 func (p *parser) fireCheckHostResult(r Result, explanation string, e error) {
+	if p.buffered(func(p *parser) { p.fireCheckHostResult(r, explanation, e) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.checkHostResult(r, explanation, e)
+	}
 	if p.listener == nil {
 		return
 	}
@@ -295,34 +542,253 @@ func (p *parser) fireCheckHostResult(r Result, explanation string, e error) {
 }
 
 func (p *parser) fireSPFRecord(s string) {
+	if p.buffered(func(p *parser) { p.fireSPFRecord(s) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.record(s)
+	}
 	if p.listener == nil {
 		return
 	}
 	p.listener.SPFRecord(s)
 }
 
+func (p *parser) fireNearMisses(domain string, txts []string) {
+	if p.buffered(func(p *parser) { p.fireNearMisses(domain, txts) }) {
+		return
+	}
+	l, ok := p.listener.(NearMissListener)
+	if !ok && p.explainer == nil {
+		return
+	}
+	for _, m := range NearMisses(txts) {
+		if p.explainer != nil {
+			p.explainer.nearMiss(m)
+		}
+		if ok {
+			l.NearMiss(domain, m.Record, m.Kind)
+		}
+	}
+}
+
 func (p *parser) fireDirective(t *token, effectiveValue string) {
+	p.countTerm(t)
+	if p.buffered(func(p *parser) { p.fireDirective(t, effectiveValue) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.directive(t, effectiveValue)
+	}
 	if p.listener == nil {
 		return
 	}
+	if l, ok := p.listener.(PositionListener); ok {
+		start, end := t.position()
+		l.DirectivePosition(false, t.qualifier.String(), t.mechanism.String(), t.value, start, end)
+	}
+	if l, ok := p.listener.(SyntheticListener); ok && t.synthetic() {
+		l.SyntheticDirective(false, t.qualifier.String(), t.mechanism.String(), t.value)
+	}
+	if l, ok := p.listener.(DirectiveInfoListener); ok {
+		l.DirectiveInfo(t.directiveInfo(false, effectiveValue))
+	}
 	p.listener.Directive(false, t.qualifier.String(), t.mechanism.String(), t.value, effectiveValue)
 }
 
 func (p *parser) fireMatchingIP(t *token, fqdn string, ipn net.IPNet, host string, ip net.IP) {
+	if p.buffered(func(p *parser) { p.fireMatchingIP(t, fqdn, ipn, host, ip) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.matchingIP(ipn)
+	}
 	if p.listener == nil {
 		return
 	}
 	p.listener.MatchingIP(t.qualifier.String(), t.mechanism.String(), t.value, fqdn, ipn, host, ip)
 }
 
+func (p *parser) fireLookupExtras(t *token, fqdn string, extras *ResponseExtras) {
+	p.countLookup(t, extras)
+	if p.buffered(func(p *parser) { p.fireLookupExtras(t, fqdn, extras) }) {
+		return
+	}
+	p.aggregate.add(t, extras)
+	if p.explainer != nil {
+		p.explainer.lookup(t, extras)
+	}
+	if p.listener == nil || extras == nil {
+		return
+	}
+	if l, ok := p.listener.(RawResponseListener); ok {
+		for _, m := range extras.responses {
+			if len(m.Question) > 0 {
+				l.RawResponse(m.Question[0], m)
+			}
+		}
+	}
+	l, ok := p.listener.(ExtrasListener)
+	if !ok {
+		return
+	}
+	if t == nil {
+		l.LookupExtras("", "", "", fqdn, extras)
+		return
+	}
+	l.LookupExtras(t.qualifier.String(), t.mechanism.String(), t.value, fqdn, extras)
+}
+
+func (p *parser) firePinned(domain string, pin Pin) {
+	if p.buffered(func(p *parser) { p.firePinned(domain, pin) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.pin(pin)
+	}
+	if p.listener == nil {
+		return
+	}
+	if l, ok := p.listener.(PinListener); ok {
+		l.Pinned(domain, pin)
+	}
+}
+
+// fireRedirectResult has no listener events of its own, but redirect
+// produces the result for explainer
+func (p *parser) fireRedirectResult(r Result, e error) {
+	if p.buffered(func(p *parser) { p.fireRedirectResult(r, e) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.match(r, e)
+	}
+}
+
+func (p *parser) fireEnter(via tokenType, domain string, depth int) {
+	if p.buffered(func(p *parser) { p.fireEnter(via, domain, depth) }) {
+		return
+	}
+	l, ok := p.listener.(NestingListener)
+	if !ok {
+		return
+	}
+	if via == tRedirect {
+		l.EnterRedirect(domain, depth)
+	} else {
+		l.EnterInclude(domain, depth)
+	}
+}
+
+func (p *parser) fireExit(domain string, depth int, r Result) {
+	if p.buffered(func(p *parser) { p.fireExit(domain, depth, r) }) {
+		return
+	}
+	if l, ok := p.listener.(NestingListener); ok {
+		l.Exit(domain, depth, r)
+	}
+}
+
+func (p *parser) fireUnknownModifier(t *token) {
+	if p.buffered(func(p *parser) { p.fireUnknownModifier(t) }) {
+		return
+	}
+	name, value := t.modifier()
+	if p.explainer != nil {
+		p.explainer.modifier(name, value)
+	}
+	if p.listener == nil {
+		return
+	}
+	if l, ok := p.listener.(DirectiveInfoListener); ok {
+		l.DirectiveInfo(t.directiveInfo(false, ""))
+	}
+	if l, ok := p.listener.(ModifierListener); ok {
+		l.UnknownModifier(name, value)
+	}
+}
+
+func (p *parser) fireLocalPolicy(domain, record string, r Result) {
+	if p.buffered(func(p *parser) { p.fireLocalPolicy(domain, record, r) }) {
+		return
+	}
+	if p.listener == nil {
+		return
+	}
+	if l, ok := p.listener.(LocalPolicyListener); ok {
+		l.LocalPolicy(domain, record, r)
+	}
+}
+
+func (p *parser) fireIssue(t *token, err error) {
+	if p.buffered(func(p *parser) { p.fireIssue(t, err) }) {
+		return
+	}
+	if p.listener == nil {
+		return
+	}
+	if l, ok := p.listener.(IssueListener); ok {
+		l.Issue(t.String(), err)
+	}
+}
+
+func (p *parser) fireSPFRRConflict(domain string, rrs []string, txt string) {
+	if p.buffered(func(p *parser) { p.fireSPFRRConflict(domain, rrs, txt) }) {
+		return
+	}
+	if p.listener == nil {
+		return
+	}
+	if l, ok := p.listener.(SPFRRListener); ok {
+		l.SPFRRConflict(domain, rrs, txt)
+	}
+}
+
+func (p *parser) fireSkippedPTRName(t *token, name string, err error) {
+	if p.buffered(func(p *parser) { p.fireSkippedPTRName(t, name, err) }) {
+		return
+	}
+	if p.listener == nil {
+		return
+	}
+	l, ok := p.listener.(PTRListener)
+	if !ok {
+		return
+	}
+	if t == nil {
+		l.SkippedPTRName("", "", "", name, err)
+		return
+	}
+	l.SkippedPTRName(t.qualifier.String(), t.mechanism.String(), t.value, name, err)
+}
+
 func (p *parser) fireUnusedDirective(t *token) {
+	if p.buffered(func(p *parser) { p.fireUnusedDirective(t) }) {
+		return
+	}
 	if p.listener == nil || t == nil {
 		return
 	}
+	if l, ok := p.listener.(PositionListener); ok {
+		start, end := t.position()
+		l.DirectivePosition(true, t.qualifier.String(), t.mechanism.String(), t.value, start, end)
+	}
+	if l, ok := p.listener.(SyntheticListener); ok && t.synthetic() {
+		l.SyntheticDirective(true, t.qualifier.String(), t.mechanism.String(), t.value)
+	}
+	if l, ok := p.listener.(DirectiveInfoListener); ok {
+		l.DirectiveInfo(t.directiveInfo(true, ""))
+	}
 	p.listener.Directive(true, t.qualifier.String(), t.mechanism.String(), t.value, "")
 }
 
 func (p *parser) fireNonMatch(t *token, r Result, e error) {
+	if p.buffered(func(p *parser) { p.fireNonMatch(t, r, e) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.nonMatch(e)
+	}
 	if p.listener == nil {
 		return
 	}
@@ -330,13 +796,19 @@ func (p *parser) fireNonMatch(t *token, r Result, e error) {
 }
 
 func (p *parser) fireMatch(t *token, r Result, explanation string, e error) {
+	if p.buffered(func(p *parser) { p.fireMatch(t, r, explanation, e) }) {
+		return
+	}
+	if p.explainer != nil {
+		p.explainer.match(r, e)
+	}
 	if p.listener == nil {
 		return
 	}
 	p.listener.Match(t.qualifier.String(), t.mechanism.String(), t.value, r, explanation, e)
 }
 
-func sortTokens(tokens []*token) (mechanisms []*token, redirect, explanation *token, err error) {
+func sortTokens(tokens []*token) (mechanisms []*token, redirect, explanation *token, modifiers []*token, err error) {
 	mechanisms = make([]*token, 0, len(tokens))
 	for _, token := range tokens {
 		if token.isErr() {
@@ -362,6 +834,9 @@ func sortTokens(tokens []*token) (mechanisms []*token, redirect, explanation *to
 			explanation = token
 			continue
 		}
+		if token.mechanism == tUnknownModifier {
+			modifiers = append(modifiers, token)
+		}
 	}
 
 	return
@@ -404,18 +879,11 @@ func (p *parser) parseIP4(t *token) (bool, Result, error) {
 
 	result, _ := matchingResult(t.qualifier)
 
-	if ip, ipnet, err := net.ParseCIDR(t.value); err == nil {
-		if ip.To4() == nil {
-			return true, Permerror, SyntaxError{t, ErrNotIPv4}
-		}
-		return ipnet.Contains(p.ip), result, nil
-	}
-
-	ip := net.ParseIP(t.value).To4()
-	if ip == nil {
-		return true, Permerror, SyntaxError{t, ErrNotIPv4}
+	matches, err := p.matchNetwork(t)
+	if err != nil {
+		return true, Permerror, SyntaxError{t, err}
 	}
-	return ip.Equal(p.ip), result, nil
+	return matches, result, nil
 }
 
 func (p *parser) parseIP6(t *token) (bool, Result, error) {
@@ -423,18 +891,11 @@ func (p *parser) parseIP6(t *token) (bool, Result, error) {
 
 	result, _ := matchingResult(t.qualifier)
 
-	if ip, ipnet, err := net.ParseCIDR(t.value); err == nil {
-		if ip.To16() == nil {
-			return true, Permerror, SyntaxError{t, ErrNotIPv6}
-		}
-		return ipnet.Contains(p.ip), result, nil
-	}
-
-	ip := net.ParseIP(t.value)
-	if ip.To4() != nil || ip.To16() == nil {
-		return true, Permerror, SyntaxError{t, ErrNotIPv6}
+	matches, err := p.matchNetwork(t)
+	if err != nil {
+		return true, Permerror, SyntaxError{t, err}
 	}
-	return ip.Equal(p.ip), result, nil
+	return matches, result, nil
 }
 
 func (p *parser) parseA(t *token) (bool, Result, error) {
@@ -445,7 +906,7 @@ func (p *parser) parseA(t *token) (bool, Result, error) {
 	if err == nil {
 		fqdn, err = truncateFQDN(fqdn)
 	}
-	if err == nil && !isDomainName(fqdn) {
+	if err == nil && !p.domainProfile.valid(fqdn) {
 		err = newInvalidDomainError(fqdn)
 	}
 	fqdn = NormalizeFQDN(fqdn)
@@ -456,7 +917,8 @@ func (p *parser) parseA(t *token) (bool, Result, error) {
 
 	result, _ := matchingResult(t.qualifier)
 
-	found, err := p.resolver.MatchIP(fqdn, func(ip net.IP, host string) (bool, error) {
+	start := p.now()
+	found, extras, err := p.dns().MatchIP(fqdn, func(ip net.IP, host string) (bool, error) {
 		n := net.IPNet{
 			IP: ip,
 		}
@@ -469,6 +931,7 @@ func (p *parser) parseA(t *token) (bool, Result, error) {
 		p.fireMatchingIP(t, fqdn, n, host, p.ip)
 		return n.Contains(p.ip), nil
 	})
+	p.fireLookupExtras(t, fqdn, extras.spent(p.since(start)))
 	return found, result, err
 }
 
@@ -480,7 +943,7 @@ func (p *parser) parseMX(t *token) (bool, Result, error) {
 	if err == nil {
 		fqdn, err = truncateFQDN(fqdn)
 	}
-	if err == nil && !isDomainName(fqdn) {
+	if err == nil && !p.domainProfile.valid(fqdn) {
 		err = newInvalidDomainError(fqdn)
 	}
 	fqdn = NormalizeFQDN(fqdn)
@@ -490,7 +953,8 @@ func (p *parser) parseMX(t *token) (bool, Result, error) {
 	}
 
 	result, _ := matchingResult(t.qualifier)
-	found, err := p.resolver.MatchMX(fqdn, func(ip net.IP, host string) (bool, error) {
+	start := p.now()
+	found, extras, err := p.dns().MatchMX(fqdn, func(ip net.IP, host string) (bool, error) {
 		n := net.IPNet{
 			IP: ip,
 		}
@@ -503,6 +967,7 @@ func (p *parser) parseMX(t *token) (bool, Result, error) {
 		p.fireMatchingIP(t, fqdn, n, host, p.ip)
 		return n.Contains(p.ip), nil
 	})
+	p.fireLookupExtras(t, fqdn, extras.spent(p.since(start)))
 	if err != nil {
 		return true, Permerror, SyntaxError{t, err}
 	}
@@ -514,7 +979,7 @@ func (p *parser) parseInclude(t *token) (bool, Result, error) {
 	if err == nil {
 		domain, err = truncateFQDN(domain)
 	}
-	if err == nil && !isDomainName(domain) {
+	if err == nil && !p.domainProfile.valid(domain) {
 		err = newInvalidDomainError(domain)
 	}
 	domain = NormalizeFQDN(domain)
@@ -525,7 +990,7 @@ func (p *parser) parseInclude(t *token) (bool, Result, error) {
 	if domain == "" {
 		return true, Permerror, SyntaxError{t, ErrEmptyDomain}
 	}
-	theirResult, _, _, err := p.checkHost(p.ip, domain, p.sender)
+	theirResult, err := p.include(domain)
 
 	/* Adhere to following result table:
 	* +---------------------------------+---------------------------------+
@@ -575,7 +1040,7 @@ func (p *parser) parseExists(t *token) (bool, Result, error) {
 	if err == nil {
 		resolvedDomain, err = truncateFQDN(resolvedDomain)
 	}
-	if err == nil && !isDomainName(resolvedDomain) {
+	if err == nil && !p.domainProfile.valid(resolvedDomain) {
 		err = newInvalidDomainError(resolvedDomain)
 	}
 	resolvedDomain = NormalizeFQDN(resolvedDomain)
@@ -589,22 +1054,19 @@ func (p *parser) parseExists(t *token) (bool, Result, error) {
 
 	result, _ := matchingResult(t.qualifier)
 
-	found, err := p.resolver.Exists(resolvedDomain)
-	switch err {
-	case nil:
+	start := p.now()
+	found, extras, err := p.dns().Exists(resolvedDomain)
+	p.fireLookupExtras(t, resolvedDomain, extras.spent(p.since(start)))
+	switch {
+	case err == nil:
 		return found, result, nil
-	case ErrDNSPermerror:
+	case errors.Is(err, ErrDNSPermerror):
 		return false, result, nil
 	default:
 		return false, Temperror, err // was true 8-|
 	}
 }
 
-func (p *parser) parsePtr(t *token) (bool, Result, error) {
-	p.fireDirective(t, domainSpec(t.value, p.domain))
-	return false, internalError, nil
-}
-
 func (p *parser) handleRedirect(t *token) (Result, error) {
 	if t == nil {
 		return Neutral, nil
@@ -619,7 +1081,7 @@ func (p *parser) handleRedirect(t *token) (Result, error) {
 	if err == nil {
 		domain, err = truncateFQDN(domain)
 	}
-	if err == nil && !isDomainName(domain) {
+	if err == nil && !p.domainProfile.valid(domain) {
 		err = newInvalidDomainError(domain)
 	}
 	redirectDomain := NormalizeFQDN(domain)
@@ -629,7 +1091,9 @@ func (p *parser) handleRedirect(t *token) (Result, error) {
 		return Permerror, SyntaxError{t, err}
 	}
 
-	if result, _, _, err = p.checkHost(p.ip, redirectDomain, p.sender); err != nil {
+	if result, err = p.checkNested(tRedirect, redirectDomain); isTimeout(err) {
+		result, err = Temperror, SyntaxError{t, err}
+	} else if err != nil {
 		//TODO(zaccone): confirm result value
 		result = Permerror
 	} else if result == None || result == Permerror {
@@ -639,10 +1103,23 @@ func (p *parser) handleRedirect(t *token) (Result, error) {
 		// result is a "permerror" rather than "none".
 		result = Permerror
 	}
+	p.fireRedirectResult(result, err)
 
 	return result, err
 }
 
+// checkNested evaluates the domain reached by "include" or "redirect"
+func (p *parser) checkNested(via tokenType, domain string) (Result, error) {
+	depth := len(p.visited.s)
+	p.visited.via(via)
+	p.fireEnter(via, domain, depth)
+	leave := p.enterContext(depth)
+	r, _, _, err := p.checkHost(p.ip, domain, p.sender)
+	leave()
+	p.fireExit(domain, depth, r)
+	return r, err
+}
+
 func (p *parser) handleExplanation(t *token) (string, error) {
 	domain, err := parseMacroToken(p, t)
 	if err != nil {
@@ -655,11 +1132,13 @@ func (p *parser) handleExplanation(t *token) (string, error) {
 	if err != nil {
 		return "", SyntaxError{t, err}
 	}
-	if !isDomainName(domain) {
+	if !p.domainProfile.valid(domain) {
 		return "", SyntaxError{t, newInvalidDomainError(domain)}
 	}
 
-	txts, err := p.resolver.LookupTXT(NormalizeFQDN(domain))
+	start := p.now()
+	txts, extras, err := p.lookupExplanation(NormalizeFQDN(domain))
+	p.fireLookupExtras(t, NormalizeFQDN(domain), extras.spent(p.since(start)))
 	if err != nil {
 		return "", err
 	}
@@ -83,7 +83,7 @@ func TestMatchingResult(t *testing.T) {
 
 func TestTokensSoriting(t *testing.T) {
 	//stub := "stub"
-	versionToken := &token{tVersion, qPlus, "spf1"}
+	versionToken := &token{tVersion, qPlus, "spf1", 0, 0}
 	type TestCase struct {
 		Tokens      []*token
 		ExpTokens   []*token
@@ -95,11 +95,11 @@ func TestTokensSoriting(t *testing.T) {
 		{
 			[]*token{
 				versionToken,
-				{tAll, qMinus, ""},
+				{tAll, qMinus, "", 0, 0},
 			},
 			[]*token{
 				versionToken,
-				{tAll, qMinus, ""},
+				{tAll, qMinus, "", 0, 0},
 			},
 			nil,
 			nil,
@@ -107,65 +107,65 @@ func TestTokensSoriting(t *testing.T) {
 		{
 			[]*token{
 				versionToken,
-				{tRedirect, qPlus, "_spf.example.com"},
-				{tMX, qTilde, "example.org"},
+				{tRedirect, qPlus, "_spf.example.com", 0, 0},
+				{tMX, qTilde, "example.org", 0, 0},
 			},
 			[]*token{
 				versionToken,
-				{tMX, qTilde, "example.org"},
+				{tMX, qTilde, "example.org", 0, 0},
 			},
-			&token{tRedirect, qPlus, "_spf.example.com"},
+			&token{tRedirect, qPlus, "_spf.example.com", 0, 0},
 			nil,
 		},
 		{
 			[]*token{
 				versionToken,
-				{tRedirect, qPlus, "_spf.example.com"},
-				{tIP4, qTilde, "192.168.1.2"},
-				{tExp, qPlus, "Something went wrong"},
+				{tRedirect, qPlus, "_spf.example.com", 0, 0},
+				{tIP4, qTilde, "192.168.1.2", 0, 0},
+				{tExp, qPlus, "Something went wrong", 0, 0},
 			},
 			[]*token{
 				versionToken,
-				{tIP4, qTilde, "192.168.1.2"},
+				{tIP4, qTilde, "192.168.1.2", 0, 0},
 			},
-			&token{tRedirect, qPlus, "_spf.example.com"},
-			&token{tExp, qPlus, "Something went wrong"},
+			&token{tRedirect, qPlus, "_spf.example.com", 0, 0},
+			&token{tExp, qPlus, "Something went wrong", 0, 0},
 		},
 		{
 			[]*token{
 				versionToken,
-				{tRedirect, qPlus, "_spf.example.com"},
-				{tMX, qTilde, "example.org"},
-				{tAll, qQuestionMark, ""},
+				{tRedirect, qPlus, "_spf.example.com", 0, 0},
+				{tMX, qTilde, "example.org", 0, 0},
+				{tAll, qQuestionMark, "", 0, 0},
 			},
 			[]*token{
 				versionToken,
-				{tMX, qTilde, "example.org"},
-				{tAll, qQuestionMark, ""},
+				{tMX, qTilde, "example.org", 0, 0},
+				{tAll, qQuestionMark, "", 0, 0},
 			},
-			&token{tRedirect, qPlus, "_spf.example.com"},
+			&token{tRedirect, qPlus, "_spf.example.com", 0, 0},
 			nil,
 		},
 		{
 			[]*token{
 				versionToken,
-				{tRedirect, qPlus, "_spf.example.com"},
-				{tMX, qTilde, "example.org"},
-				{tAll, qQuestionMark, ""},
-				{tExp, qPlus, "You are wrong"},
+				{tRedirect, qPlus, "_spf.example.com", 0, 0},
+				{tMX, qTilde, "example.org", 0, 0},
+				{tAll, qQuestionMark, "", 0, 0},
+				{tExp, qPlus, "You are wrong", 0, 0},
 			},
 			[]*token{
 				versionToken,
-				{tMX, qTilde, "example.org"},
-				{tAll, qQuestionMark, ""},
+				{tMX, qTilde, "example.org", 0, 0},
+				{tAll, qQuestionMark, "", 0, 0},
 			},
-			&token{tRedirect, qPlus, "_spf.example.com"},
-			&token{tExp, qPlus, "You are wrong"},
+			&token{tRedirect, qPlus, "_spf.example.com", 0, 0},
+			&token{tExp, qPlus, "You are wrong", 0, 0},
 		},
 	}
 
 	for _, testcase := range testcases {
-		mechanisms, redirect, explanation, _ := sortTokens(testcase.Tokens)
+		mechanisms, redirect, explanation, _, _ := sortTokens(testcase.Tokens)
 
 		if !reflect.DeepEqual(mechanisms, testcase.ExpTokens) {
 			t.Error("mechanisms mistmatch, got: ", mechanisms,
@@ -183,7 +183,7 @@ func TestTokensSoriting(t *testing.T) {
 }
 
 func TestTokensSoritingHandleErrors(t *testing.T) {
-	versionToken := &token{tVersion, qPlus, "spf1"}
+	versionToken := &token{tVersion, qPlus, "spf1", 0, 0}
 	type TestCase struct {
 		Tokens []*token
 	}
@@ -192,33 +192,33 @@ func TestTokensSoritingHandleErrors(t *testing.T) {
 		{
 			[]*token{
 				versionToken,
-				{tRedirect, qPlus, "_spf.example.com"},
-				{tMX, qMinus, "example.org"},
-				{tRedirect, qPlus, "_spf.example.com"},
+				{tRedirect, qPlus, "_spf.example.com", 0, 0},
+				{tMX, qMinus, "example.org", 0, 0},
+				{tRedirect, qPlus, "_spf.example.com", 0, 0},
 			},
 		},
 		{
 			[]*token{
 				versionToken,
-				{tRedirect, qPlus, "_spf.example.com"},
-				{tMX, qMinus, "example.org"},
-				{tExp, qPlus, "Explanation"},
-				{tExp, qPlus, "Explanation"},
+				{tRedirect, qPlus, "_spf.example.com", 0, 0},
+				{tMX, qMinus, "example.org", 0, 0},
+				{tExp, qPlus, "Explanation", 0, 0},
+				{tExp, qPlus, "Explanation", 0, 0},
 			},
 		},
 		{
 			[]*token{
 				versionToken,
-				{tRedirect, qPlus, "_spf.example.com"},
-				{tAll, qMinus, ""},
-				{tExp, qPlus, "_spf.example.com"},
-				{tRedirect, qPlus, "mydomain.com"},
+				{tRedirect, qPlus, "_spf.example.com", 0, 0},
+				{tAll, qMinus, "", 0, 0},
+				{tExp, qPlus, "_spf.example.com", 0, 0},
+				{tRedirect, qPlus, "mydomain.com", 0, 0},
 			},
 		},
 	}
 
 	for _, testcase := range testcases {
-		if _, _, _, err := sortTokens(testcase.Tokens); err == nil {
+		if _, _, _, _, err := sortTokens(testcase.Tokens); err == nil {
 			t.Error("We should have gotten an error, ")
 		}
 	}
@@ -237,11 +237,11 @@ type TokenTestCase struct {
 func TestParseAll(t *testing.T) {
 	p := newParser(WithResolver(testResolver)).with(stub, stub, stub, ip)
 	testcases := []TokenTestCase{
-		{&token{tAll, qPlus, ""}, Pass, true},
-		{&token{tAll, qMinus, ""}, Fail, true},
-		{&token{tAll, qQuestionMark, ""}, Neutral, true},
-		{&token{tAll, qTilde, ""}, Softfail, true},
-		{&token{tAll, tErr, ""}, Permerror, true},
+		{&token{tAll, qPlus, "", 0, 0}, Pass, true},
+		{&token{tAll, qMinus, "", 0, 0}, Fail, true},
+		{&token{tAll, qQuestionMark, "", 0, 0}, Neutral, true},
+		{&token{tAll, qTilde, "", 0, 0}, Softfail, true},
+		{&token{tAll, tErr, "", 0, 0}, Permerror, true},
 	}
 
 	var match bool
@@ -306,37 +306,37 @@ func TestParseA(t *testing.T) {
 
 	p := newParser(WithResolver(testResolver)).with(stub, domain, "matching.com", net.IP{172, 18, 0, 2})
 	testcases := []TokenTestCase{
-		{&token{tA, qPlus, "positive.matching.com"}, Pass, true},
-		{&token{tA, qPlus, "positive.matching.com/32"}, Pass, true},
-		{&token{tA, qPlus, "negative.matching.com"}, Pass, false},
-		{&token{tA, qPlus, "range.matching.com/16"}, Pass, true},
-		{&token{tA, qPlus, "range.matching.com/128"}, Permerror, true},
-		{&token{tA, qPlus, "idontexist"}, Pass, false},
-		{&token{tA, qPlus, "#%$%^"}, Permerror, true},
-		{&token{tA, qPlus, "lb.matching.com"}, Pass, true},
-		{&token{tA, qMinus, ""}, Fail, true},
-		{&token{tA, qTilde, ""}, Softfail, true},
+		{&token{tA, qPlus, "positive.matching.com", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com/32", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "negative.matching.com", 0, 0}, Pass, false},
+		{&token{tA, qPlus, "range.matching.com/16", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "range.matching.com/128", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "idontexist", 0, 0}, Pass, false},
+		{&token{tA, qPlus, "#%$%^", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "lb.matching.com", 0, 0}, Pass, true},
+		{&token{tA, qMinus, "", 0, 0}, Fail, true},
+		{&token{tA, qTilde, "", 0, 0}, Softfail, true},
 
 		// expect (Permerror, true) results as a result of syntax errors
-		{&token{tA, qPlus, "range.matching.com/wrongmask"}, Permerror, true},
-		{&token{tA, qPlus, "range.matching.com/129"}, Permerror, true},
-		{&token{tA, qPlus, "range.matching.com/-1"}, Permerror, true},
+		{&token{tA, qPlus, "range.matching.com/wrongmask", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "range.matching.com/129", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "range.matching.com/-1", 0, 0}, Permerror, true},
 
 		// expect (Permerror, true) due to wrong netmasks.
 		// It's a syntax error to specify a netmask over 32 bits for IPv4 addresses
-		{&token{tA, qPlus, "negative.matching.com/128"}, Permerror, true},
-		{&token{tA, qPlus, "positive.matching.com/128"}, Permerror, true},
-		{&token{tA, qPlus, "positive.matching.com/128"}, Permerror, true},
+		{&token{tA, qPlus, "negative.matching.com/128", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "positive.matching.com/128", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "positive.matching.com/128", 0, 0}, Permerror, true},
 
 		// test dual-cidr syntax
-		{&token{tA, qPlus, "positive.matching.com//128"}, Pass, true},
-		{&token{tA, qPlus, "positive.matching.com/32/"}, Pass, true},
-		{&token{tA, qPlus, "positive.matching.com/0/0"}, Pass, true},
-		{&token{tA, qPlus, "positive.matching.com/24/24"}, Pass, true},
-		{&token{tA, qPlus, "positive.matching.com/33/100"}, Permerror, true},
-		{&token{tA, qPlus, "positive.matching.com/24/129"}, Permerror, true},
-		{&token{tA, qPlus, "positive.matching.com/128/32"}, Permerror, true},
-		{&token{tA, qPlus, "//32"}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com//128", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com/32/", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com/0/0", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com/24/24", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com/33/100", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "positive.matching.com/24/129", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "positive.matching.com/128/32", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "//32", 0, 0}, Pass, true},
 	}
 
 	var match bool
@@ -383,15 +383,15 @@ func TestParseAIpv6(t *testing.T) {
 
 	p := newParser(WithResolver(testResolver)).with(stub, domain, "matching.com", ipv6)
 	testcases := []TokenTestCase{
-		{&token{tA, qPlus, "positive.matching.com"}, Pass, true},
-		{&token{tA, qPlus, "positive.matching.com//128"}, Pass, true},
-		{&token{tA, qPlus, "positive.matching.com//64"}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com//128", 0, 0}, Pass, true},
+		{&token{tA, qPlus, "positive.matching.com//64", 0, 0}, Pass, true},
 
-		{&token{tA, qPlus, "negative.matching.com"}, Pass, false},
-		{&token{tA, qPlus, "negative.matching.com//64"}, Pass, false},
-		{&token{tA, qPlus, "positive.matching.com// "}, Permerror, true},
-		{&token{tA, qPlus, "positive.matching.com/ "}, Permerror, true},
-		{&token{tA, qPlus, "positive.matching.com/ / "}, Permerror, true},
+		{&token{tA, qPlus, "negative.matching.com", 0, 0}, Pass, false},
+		{&token{tA, qPlus, "negative.matching.com//64", 0, 0}, Pass, false},
+		{&token{tA, qPlus, "positive.matching.com// ", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "positive.matching.com/ ", 0, 0}, Permerror, true},
+		{&token{tA, qPlus, "positive.matching.com/ / ", 0, 0}, Permerror, true},
 	}
 
 	var match bool
@@ -413,19 +413,19 @@ func TestParseAIpv6(t *testing.T) {
 func TestParseIp4(t *testing.T) {
 	p := newParser(WithResolver(testResolver)).with(stub, stub, stub, ip)
 	testcases := []TokenTestCase{
-		{&token{tIP4, qPlus, "127.0.0.1"}, Pass, true},
-		{&token{tIP4, qMinus, "127.0.0.1"}, Fail, true},
-		{&token{tIP4, qQuestionMark, "127.0.0.1"}, Neutral, true},
-		{&token{tIP4, qTilde, "127.0.0.1"}, Softfail, true},
+		{&token{tIP4, qPlus, "127.0.0.1", 0, 0}, Pass, true},
+		{&token{tIP4, qMinus, "127.0.0.1", 0, 0}, Fail, true},
+		{&token{tIP4, qQuestionMark, "127.0.0.1", 0, 0}, Neutral, true},
+		{&token{tIP4, qTilde, "127.0.0.1", 0, 0}, Softfail, true},
 
-		{&token{tIP4, qTilde, "127.0.0.0/16"}, Softfail, true},
+		{&token{tIP4, qTilde, "127.0.0.0/16", 0, 0}, Softfail, true},
 
-		{&token{tIP4, qTilde, "192.168.1.2"}, Softfail, false},
-		{&token{tIP4, qMinus, "192.168.1.5/16"}, Fail, false},
+		{&token{tIP4, qTilde, "192.168.1.2", 0, 0}, Softfail, false},
+		{&token{tIP4, qMinus, "192.168.1.5/16", 0, 0}, Fail, false},
 
-		{&token{tIP4, qMinus, "random string"}, Permerror, true},
-		{&token{tIP4, qMinus, "2001:4860:0:2001::68"}, Permerror, true},
-		{&token{tIP4, qMinus, "2001:4860:0:2001::68/48"}, Permerror, true},
+		{&token{tIP4, qMinus, "random string", 0, 0}, Permerror, true},
+		{&token{tIP4, qMinus, "2001:4860:0:2001::68", 0, 0}, Permerror, true},
+		{&token{tIP4, qMinus, "2001:4860:0:2001::68/48", 0, 0}, Permerror, true},
 	}
 
 	var match bool
@@ -446,17 +446,17 @@ func TestParseIp6(t *testing.T) {
 	p := newParser(WithResolver(testResolver)).with(stub, stub, stub, ipv6)
 
 	testcases := []TokenTestCase{
-		{&token{tIP6, qPlus, "2001:4860:0:2001::68"}, Pass, true},
-		{&token{tIP6, qMinus, "2001:4860:0:2001::68"}, Fail, true},
-		{&token{tIP6, qQuestionMark, "2001:4860:0:2001::68"}, Neutral, true},
-		{&token{tIP6, qTilde, "2001:4860:0:2001::68"}, Softfail, true},
+		{&token{tIP6, qPlus, "2001:4860:0:2001::68", 0, 0}, Pass, true},
+		{&token{tIP6, qMinus, "2001:4860:0:2001::68", 0, 0}, Fail, true},
+		{&token{tIP6, qQuestionMark, "2001:4860:0:2001::68", 0, 0}, Neutral, true},
+		{&token{tIP6, qTilde, "2001:4860:0:2001::68", 0, 0}, Softfail, true},
 
-		{&token{tIP6, qTilde, "2001:4860:0:2001::68/64"}, Softfail, true},
+		{&token{tIP6, qTilde, "2001:4860:0:2001::68/64", 0, 0}, Softfail, true},
 
-		{&token{tIP6, qTilde, "::1"}, Softfail, false},
-		{&token{tIP6, qMinus, "2002::/16"}, Fail, false},
+		{&token{tIP6, qTilde, "::1", 0, 0}, Softfail, false},
+		{&token{tIP6, qMinus, "2002::/16", 0, 0}, Fail, false},
 
-		{&token{tIP6, qMinus, "random string"}, Permerror, true},
+		{&token{tIP6, qMinus, "random string", 0, 0}, Permerror, true},
 	}
 
 	var match bool
@@ -477,8 +477,8 @@ func TestParseIp6WithIp4(t *testing.T) {
 	p := newParser(WithResolver(testResolver)).with(stub, stub, stub, ip)
 
 	testcases := []TokenTestCase{
-		{&token{tIP6, qPlus, "127.0.0.1"}, Permerror, true},
-		{&token{tIP6, qTilde, "127.0.0.1"}, Permerror, true},
+		{&token{tIP6, qPlus, "127.0.0.1", 0, 0}, Permerror, true},
+		{&token{tIP6, qTilde, "127.0.0.1", 0, 0}, Permerror, true},
 	}
 
 	var match bool
@@ -528,18 +528,18 @@ func TestParseMX(t *testing.T) {
 	p := newParser(WithResolver(testResolver)).with(stub, domain, "matching.com", net.IP{0, 0, 0, 0})
 
 	testcases := []TokenTestCase{
-		{&token{tMX, qPlus, "matching.com"}, Pass, true},
-		{&token{tMX, qPlus, "matching.com/24"}, Pass, true},
-		{&token{tMX, qPlus, "matching.com/24/64"}, Pass, true},
-		{&token{tMX, qPlus, "/24"}, Pass, true}, // domain is matching.com.
-		{&token{tMX, qPlus, ""}, Pass, true},
-		{&token{tMX, qMinus, ""}, Fail, true},
-		{&token{tMX, qPlus, "idontexist"}, Pass, false},
+		{&token{tMX, qPlus, "matching.com", 0, 0}, Pass, true},
+		{&token{tMX, qPlus, "matching.com/24", 0, 0}, Pass, true},
+		{&token{tMX, qPlus, "matching.com/24/64", 0, 0}, Pass, true},
+		{&token{tMX, qPlus, "/24", 0, 0}, Pass, true}, // domain is matching.com.
+		{&token{tMX, qPlus, "", 0, 0}, Pass, true},
+		{&token{tMX, qMinus, "", 0, 0}, Fail, true},
+		{&token{tMX, qPlus, "idontexist", 0, 0}, Pass, false},
 		// Mind that the domain is matching.NET and we expect Parser
 		// to not match results.
-		{&token{tMX, qPlus, "matching.net"}, Pass, false},
-		{&token{tMX, qPlus, "matching.net/24"}, Pass, false},
-		{&token{tMX, qPlus, "matching.net/24/64"}, Pass, false},
+		{&token{tMX, qPlus, "matching.net", 0, 0}, Pass, false},
+		{&token{tMX, qPlus, "matching.net/24", 0, 0}, Pass, false},
+		{&token{tMX, qPlus, "matching.net/24/64", 0, 0}, Pass, false},
 	}
 
 	var match bool
@@ -588,11 +588,11 @@ func TestParseMXNegativeTests(t *testing.T) {
 	p := newParser(WithResolver(testResolver)).with(stub, "matching.com", "matching.com", net.IP{127, 0, 0, 1})
 
 	testcases := []TokenTestCase{
-		{&token{tMX, qPlus, "matching.com"}, Pass, false},
-		{&token{tMX, qPlus, ""}, Pass, false},
-		//TokenTestCase{&Token{tMX, qPlus, "google.com"}, Pass, false},
-		{&token{tMX, qPlus, "idontexist"}, Pass, false},
-		{&token{tMX, qMinus, "matching.com"}, Fail, false},
+		{&token{tMX, qPlus, "matching.com", 0, 0}, Pass, false},
+		{&token{tMX, qPlus, "", 0, 0}, Pass, false},
+		//TokenTestCase{&Token{tMX, qPlus, "google.com", 0, 0}, Pass, false},
+		{&token{tMX, qPlus, "idontexist", 0, 0}, Pass, false},
+		{&token{tMX, qMinus, "matching.com", 0, 0}, Fail, false},
 	}
 
 	var match bool
@@ -609,6 +609,43 @@ func TestParseMXNegativeTests(t *testing.T) {
 	}
 }
 
+func TestParseMX_TooManyNames(t *testing.T) {
+	mx := func(n int) []string {
+		var rrs []string
+		for i := 0; i < n; i++ {
+			rrs = append(rrs, fmt.Sprintf("%d.mx.example. 0 IN MX %d h%d.mx.example.", n, i, i))
+		}
+		return rrs
+	}
+	dns.HandleFunc("mx.example.", zone(map[uint16][]string{
+		dns.TypeMX: append(mx(10), mx(11)...),
+		dns.TypeA: {
+			"h9.mx.example. 0 IN A 10.0.0.9",
+		},
+	}))
+	defer dns.HandleRemove("mx.example.")
+
+	tests := []struct {
+		value  string
+		match  bool
+		result Result
+		err    error
+	}{
+		{"10.mx.example", true, Pass, nil},
+		{"11.mx.example", true, Permerror, ErrTooManyMXNames},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			testResolverCache.Purge()
+			p := newParser(WithResolver(testResolver)).with(stub, "mx.example", "mx.example", net.IP{10, 0, 0, 9})
+			match, result, err := p.parseMX(&token{tMX, qPlus, test.value, 0, 0})
+			if match != test.match || result != test.result || !errors.Is(err, test.err) {
+				t.Errorf("parseMX() = %t, %v, %v; want %t, %v, %v", match, result, err, test.match, test.result, test.err)
+			}
+		})
+	}
+}
+
 /* parseInclude tests */
 
 func TestParseInclude(t *testing.T) {
@@ -647,10 +684,10 @@ func TestParseInclude(t *testing.T) {
 
 	p := newParser(WithResolver(testResolver)).with(stub, "matching.net", "matching.net", net.IP{0, 0, 0, 0})
 	testcases := []TokenTestCase{
-		{&token{tInclude, qPlus, "_spf.matching.net"}, Pass, true},
-		{&token{tInclude, qMinus, "_spf.matching.net"}, Fail, true},
-		{&token{tInclude, qTilde, "_spf.matching.net"}, Softfail, true},
-		{&token{tInclude, qQuestionMark, "_spf.matching.net"}, Neutral, true},
+		{&token{tInclude, qPlus, "_spf.matching.net", 0, 0}, Pass, true},
+		{&token{tInclude, qMinus, "_spf.matching.net", 0, 0}, Fail, true},
+		{&token{tInclude, qTilde, "_spf.matching.net", 0, 0}, Softfail, true},
+		{&token{tInclude, qQuestionMark, "_spf.matching.net", 0, 0}, Neutral, true},
 	}
 
 	for i, testcase := range testcases {
@@ -716,15 +753,15 @@ func TestParseIncludeNegative(t *testing.T) {
 	p := newParser(WithResolver(testResolver)).with(stub, "matching.net", "matching.net", ip)
 
 	testcases := []TokenTestCase{
-		{&token{tInclude, qMinus, "_spf.matching.net"}, None, false},
-		{&token{tInclude, qPlus, "_spf.matching.net"}, None, false},
+		{&token{tInclude, qMinus, "_spf.matching.net", 0, 0}, None, false},
+		{&token{tInclude, qPlus, "_spf.matching.net", 0, 0}, None, false},
 		// TODO(zaccone): Following 3 tests are practically identitcal
-		{&token{tInclude, qPlus, "_errspf.matching.net"}, Permerror, true},
-		{&token{tInclude, qPlus, "nospf.matching.net"}, Permerror, true},
-		{&token{tInclude, qPlus, "idontexist.matching.net"}, Permerror, true},
+		{&token{tInclude, qPlus, "_errspf.matching.net", 0, 0}, Permerror, true},
+		{&token{tInclude, qPlus, "nospf.matching.net", 0, 0}, Permerror, true},
+		{&token{tInclude, qPlus, "idontexist.matching.net", 0, 0}, Permerror, true},
 
 		// empty input qualifier results in Permerror withour recursive calls
-		{&token{tInclude, qMinus, ""}, Permerror, true},
+		{&token{tInclude, qMinus, "", 0, 0}, Permerror, true},
 	}
 
 	var match bool
@@ -768,14 +805,14 @@ func TestParseExists(t *testing.T) {
 
 	p := newParser(WithResolver(testResolver)).with(stub, "matching.com", "matching.com", ip)
 	testcases := []TokenTestCase{
-		{&token{tExists, qPlus, "positive.matching.net"}, Pass, true},
-		{&token{tExists, qMinus, "positive.matching.net"}, Fail, true},
-		{&token{tExists, qMinus, "idontexist.matching.net"}, Fail, false},
-		{&token{tExists, qMinus, "idontexist.%{d}"}, Fail, false},
-		{&token{tExists, qTilde, "positive.%{d}"}, Softfail, true},
-		{&token{tExists, qTilde, "positive.%{d}"}, Softfail, true},
-		{&token{tExists, qTilde, ""}, Permerror, true},
-		{&token{tExists, qTilde, "invalidsyntax%{}"}, Permerror, true},
+		{&token{tExists, qPlus, "positive.matching.net", 0, 0}, Pass, true},
+		{&token{tExists, qMinus, "positive.matching.net", 0, 0}, Fail, true},
+		{&token{tExists, qMinus, "idontexist.matching.net", 0, 0}, Fail, false},
+		{&token{tExists, qMinus, "idontexist.%{d}", 0, 0}, Fail, false},
+		{&token{tExists, qTilde, "positive.%{d}", 0, 0}, Softfail, true},
+		{&token{tExists, qTilde, "positive.%{d}", 0, 0}, Softfail, true},
+		{&token{tExists, qTilde, "", 0, 0}, Permerror, true},
+		{&token{tExists, qTilde, "invalidsyntax%{}", 0, 0}, Permerror, true},
 	}
 
 	for _, testcase := range testcases {
@@ -1011,9 +1048,11 @@ func TestCheckHost_RecursionLoop(t *testing.T) {
 		err    string
 	}{
 		{"v=spf1 include:loop.matching.net -all", net.IP{10, 0, 0, 1}, Permerror,
-			"infinite recursion detected [include:loop.matching.net include:loop1.matching.net include:loop2.matching.net include:loop.matching.net]"},
+			"infinite recursion detected: matching.com include→ loop.matching.net include→ loop1.matching.net include→ loop2.matching.net include→ loop.matching.net" +
+				" [include:loop.matching.net include:loop1.matching.net include:loop2.matching.net include:loop.matching.net]"},
 		{"v=spf1 redirect=loop.matching.net", net.IP{10, 0, 0, 1}, Permerror,
-			"infinite recursion detected [include:loop1.matching.net include:loop2.matching.net include:loop.matching.net]"},
+			"infinite recursion detected: matching.com redirect→ loop.matching.net include→ loop1.matching.net include→ loop2.matching.net include→ loop.matching.net" +
+				" [include:loop1.matching.net include:loop2.matching.net include:loop.matching.net]"},
 	}
 
 	for _, test := range tests {
@@ -1315,8 +1354,12 @@ func TestCheckHost_Loops(t *testing.T) {
 		opts []Option
 	}{
 		{"normal mode", "ab.example.com", Permerror,
-			SyntaxError{&token{tInclude, qPlus, "ba.example.com"},
-				SyntaxError{&token{tInclude, qPlus, "ab.example.com"}, ErrLoopDetected}},
+			SyntaxError{&token{tInclude, qPlus, "ba.example.com", 7, 29},
+				SyntaxError{&token{tInclude, qPlus, "ab.example.com", 7, 29}, LoopError{[]Hop{
+					{Domain: "ab.example.com."},
+					{Domain: "ba.example.com.", Mechanism: "include", Parent: "ab.example.com."},
+					{Domain: "ab.example.com.", Mechanism: "include", Parent: "ba.example.com."},
+				}}}},
 			[]Option{WithResolver(testResolver)}},
 		{"walker mode, errors below threshold", "example.com", unreliableResult, ErrUnreliableResult, []Option{WithResolver(testResolver), IgnoreMatches(), ErrorsThreshold(4)}},
 		{"walker mode, errors above threshold", "example.com", unreliableResult, ErrTooManyErrors, []Option{WithResolver(testResolver), IgnoreMatches(), ErrorsThreshold(2)}},
@@ -1336,6 +1379,36 @@ func TestCheckHost_Loops(t *testing.T) {
 	}
 }
 
+func TestSyntaxErrorPosition(t *testing.T) {
+	tests := []struct {
+		record     string
+		start, end int
+	}{
+		{"v=spf1 ip4:10.0.0.0/8 include=example.org -all", 22, 41},
+		{"v=spf1  -ip4:10.0.0.300  -all", 8, 23},
+		{"v=spf1 ~all\tredirect:_spf.example.org", 12, 37},
+	}
+
+	ip := net.ParseIP("10.0.0.1")
+	for _, test := range tests {
+		t.Run(test.record, func(t *testing.T) {
+			p := newParser(WithResolver(testResolver)).with(test.record, "example.org", "example.org", ip)
+			_, _, err, _ := p.check()
+			se, ok := err.(SyntaxError)
+			if !ok {
+				t.Fatalf("check() error = %#v; want SyntaxError", err)
+			}
+			if start, end := se.Position(); start != test.start || end != test.end {
+				t.Errorf("Position() = %d, %d; want %d, %d", start, end, test.start, test.end)
+			}
+		})
+	}
+
+	if start, end := (SyntaxError{nil, ErrSyntaxError}).Position(); start != -1 || end != -1 {
+		t.Errorf("Position() = %d, %d; want -1, -1", start, end)
+	}
+}
+
 func deepAllowUnexported(vs ...interface{}) cmp.Option {
 	m := make(map[reflect.Type]struct{})
 	for _, v := range vs {
@@ -1376,3 +1449,82 @@ func structTypes(v reflect.Value, m map[reflect.Type]struct{}) {
 		}
 	}
 }
+
+// wrappingResolver fails lookups of "nxdomain." names with wrapped ErrDNSPermerror
+type wrappingResolver struct {
+	Resolver
+}
+
+func (r wrappingResolver) nxdomain(name string) error {
+	if strings.HasPrefix(name, "nxdomain.") {
+		return fmt.Errorf("lookup %s: %w", name, ErrDNSPermerror)
+	}
+	return nil
+}
+
+func (r wrappingResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	if err := r.nxdomain(name); err != nil {
+		return nil, nil, err
+	}
+	return r.Resolver.LookupTXTStrict(name)
+}
+
+func (r wrappingResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	if err := r.nxdomain(name); err != nil {
+		return false, nil, err
+	}
+	return r.Resolver.Exists(name)
+}
+
+func TestSyntaxErrorIs(t *testing.T) {
+	inc := &token{tInclude, qPlus, "_spf.example.com", 7, 30}
+	a := &token{tA, qPlus, "", 7, 8}
+	err := SyntaxError{inc, SyntaxError{a, fmt.Errorf("lookup: %w", ErrDNSTemperror)}}
+
+	if !errors.Is(err, ErrDNSTemperror) {
+		t.Errorf("errors.Is(%v, ErrDNSTemperror) = false", err)
+	}
+	if errors.Is(err, ErrDNSPermerror) {
+		t.Errorf("errors.Is(%v, ErrDNSPermerror) = true", err)
+	}
+	if !errors.Is(err, SyntaxError{&token{tA, qPlus, "", 0, 0}, ErrDNSTemperror}) {
+		t.Errorf("errors.Is(%v, SyntaxError{a, ErrDNSTemperror}) = false", err)
+	}
+	if !errors.Is(err, SyntaxError{inc, nil}) {
+		t.Errorf("errors.Is(%v, SyntaxError{include, nil}) = false", err)
+	}
+	if errors.Is(err, SyntaxError{&token{tMX, qPlus, "", 0, 0}, nil}) {
+		t.Errorf("errors.Is(%v, SyntaxError{mx, nil}) = true", err)
+	}
+
+	var de *DomainError
+	if !errors.As(SyntaxError{inc, SyntaxError{a, newInvalidDomainError("a..b")}}, &de) || de.Domain != "a..b" {
+		t.Errorf("errors.As() = %v; want DomainError", de)
+	}
+}
+
+func TestCheckHost_WrappedDNSErrors(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("wrapped.example.com.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`wrapped.example.com. 0 IN TXT "v=spf1 exists:nxdomain.wrapped.example.com include:nxdomain.wrapped.example.com -all"`,
+		},
+	}))
+	defer dns.HandleRemove("wrapped.example.com.")
+
+	r, _, _, err := CheckHost(net.ParseIP("10.0.0.1"), "nxdomain.wrapped.example.com", "",
+		WithResolver(wrappingResolver{testResolver}))
+	if r != None || !errors.Is(err, ErrDNSPermerror) {
+		t.Errorf("CheckHost() = %s, %v; want %s, %v", r, err, None, ErrDNSPermerror)
+	}
+
+	r, _, _, err = CheckHost(net.ParseIP("10.0.0.1"), "wrapped.example.com", "",
+		WithResolver(wrappingResolver{testResolver}))
+	if r != Permerror || !errors.Is(err, ErrDNSPermerror) {
+		t.Errorf("CheckHost() = %s, %v; want %s, %v", r, err, Permerror, ErrDNSPermerror)
+	}
+	if ErrorKindOf(err) != KindDNS {
+		t.Errorf("ErrorKindOf(%v) = %s; want %s", err, ErrorKindOf(err), KindDNS)
+	}
+}
@@ -0,0 +1,101 @@
+package spf
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Pin overrides SPF evaluation for a domain, it is intended to be used by
+// operators during incidents, e.g. when a vendor accidentally published "-all".
+// Pinned Result is returned without any evaluation, otherwise pinned Record
+// is evaluated instead of the one published in DNS.
+type Pin struct {
+	Domain  string    `json:"domain"`
+	Record  string    `json:"record,omitempty"`  // record to evaluate instead of the published one
+	Result  Result    `json:"result,omitempty"`  // result to return, takes precedence over Record
+	Expires time.Time `json:"expires,omitempty"` // zero value means the pin never expires
+	Reason  string    `json:"reason,omitempty"`  // free text description of the pin
+}
+
+// String returns human readable description of the pin suitable for
+// Trace.Pinned
+func (p Pin) String() string {
+	s := p.Domain
+	if p.Result != 0 {
+		s += " pinned to " + p.Result.String()
+	} else {
+		s += fmt.Sprintf(" pinned to %q", p.Record)
+	}
+	if !p.Expires.IsZero() {
+		s += " until " + p.Expires.UTC().Format(time.RFC3339)
+	}
+	if p.Reason != "" {
+		s += ": " + p.Reason
+	}
+	return s
+}
+
+func (p Pin) expired(t time.Time) bool {
+	return !p.Expires.IsZero() && !t.Before(p.Expires)
+}
+
+// Pins is a set of pinned policies. It is safe for concurrent use, so pins
+// could be added or removed while evaluations are in progress.
+type Pins struct {
+	mu sync.RWMutex
+	m  map[string]Pin
+}
+
+// NewPins returns an empty set of pins
+func NewPins() *Pins {
+	return &Pins{m: make(map[string]Pin)}
+}
+
+// Pin adds the pin replacing any previous one for the same domain.
+func (s *Pins) Pin(p Pin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[NormalizeFQDN(p.Domain)] = p
+}
+
+// Unpin removes the pin for the domain.
+func (s *Pins) Unpin(domain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, NormalizeFQDN(domain))
+}
+
+// Lookup returns the pin for the domain which is still in effect at time t.
+func (s *Pins) Lookup(domain string, t time.Time) (Pin, bool) {
+	if s == nil {
+		return Pin{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.m[NormalizeFQDN(domain)]
+	if !ok || p.expired(t) {
+		return Pin{}, false
+	}
+	return p, true
+}
+
+// Purge removes pins expired at time t.
+func (s *Pins) Purge(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, p := range s.m {
+		if p.expired(t) {
+			delete(s.m, k)
+		}
+	}
+}
+
+// WithPins makes evaluation honor pins for the checked domain as well as for
+// domains reached through "include" and "redirect". Pins expiration is
+// checked against the time of evaluation (see EvaluatedOn).
+func WithPins(s *Pins) Option {
+	return func(p *parser) {
+		p.pins = s
+	}
+}
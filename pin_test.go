@@ -0,0 +1,119 @@
+package spf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type pinListener struct {
+	recordingListener
+}
+
+func (l *pinListener) Pinned(domain string, pin Pin) {
+	l.add("Pinned(%s, %s)", domain, pin)
+}
+
+func TestPins(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("pins.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`pins.example. 0 IN TXT "v=spf1 include:vendor.pins.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("pins.example.")
+
+	dns.HandleFunc("vendor.pins.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`vendor.pins.example. 0 IN TXT "v=spf1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("vendor.pins.example.")
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	ip := net.ParseIP("10.0.0.1")
+
+	tests := []struct {
+		name   string
+		pin    *Pin
+		want   Result
+		spf    string
+		events int
+	}{
+		{"no pins", nil, Fail, "v=spf1 include:vendor.pins.example -all", 0},
+		{"record", &Pin{Domain: "vendor.pins.example", Record: "v=spf1 ip4:10.0.0.0/24 -all"}, Pass, "v=spf1 include:vendor.pins.example -all", 1},
+		{"result", &Pin{Domain: "pins.example.", Result: Neutral, Record: "v=spf1 -all"}, Neutral, "", 1},
+		{"expired", &Pin{Domain: "vendor.pins.example", Result: Pass, Expires: now}, Fail, "v=spf1 include:vendor.pins.example -all", 0},
+		{"not yet expired", &Pin{Domain: "vendor.pins.example", Result: Pass, Expires: now.Add(time.Second)}, Pass, "v=spf1 include:vendor.pins.example -all", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pins := NewPins()
+			if tt.pin != nil {
+				pins.Pin(*tt.pin)
+			}
+			l := &pinListener{}
+			r, _, spf, err := CheckHost(ip, "pins.example", "pins.example",
+				WithResolver(testResolver),
+				WithListener(l),
+				WithPins(pins),
+				EvaluatedOn(now),
+			)
+			if r != tt.want || err != nil {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, tt.want)
+			}
+			if spf != tt.spf {
+				t.Errorf("CheckHost() spf = %q; want %q", spf, tt.spf)
+			}
+			if got := l.filter("Pinned"); len(got) != tt.events {
+				t.Errorf("Pinned events = %q; want %d", got, tt.events)
+			}
+		})
+	}
+}
+
+func TestPins_Lookup(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	pins := NewPins()
+	pins.Pin(Pin{Domain: "Example.COM.", Result: Pass})
+	pins.Pin(Pin{Domain: "expired.example.com", Result: Pass, Expires: now})
+
+	if _, ok := pins.Lookup("example.com", now); !ok {
+		t.Error("Lookup(example.com) found no pin")
+	}
+	if _, ok := pins.Lookup("expired.example.com", now); ok {
+		t.Error("Lookup(expired.example.com) found expired pin")
+	}
+	pins.Purge(now)
+	if len(pins.m) != 1 {
+		t.Errorf("Purge() left %d pins; want 1", len(pins.m))
+	}
+	pins.Unpin("EXAMPLE.com")
+	if _, ok := pins.Lookup("example.com", now); ok {
+		t.Error("Lookup(example.com) found removed pin")
+	}
+	var nilPins *Pins
+	if _, ok := nilPins.Lookup("example.com", now); ok {
+		t.Error("nil Pins found a pin")
+	}
+}
+
+func TestPin_String(t *testing.T) {
+	tests := []struct {
+		pin  Pin
+		want string
+	}{
+		{Pin{Domain: "example.com", Result: Fail}, "example.com pinned to fail"},
+		{Pin{Domain: "example.com", Record: "v=spf1 -all", Reason: "incident"}, `example.com pinned to "v=spf1 -all": incident`},
+		{Pin{Domain: "example.com", Result: Pass, Expires: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)}, "example.com pinned to pass until 2026-10-17T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		if got := tt.pin.String(); got != tt.want {
+			t.Errorf("String() = %q; want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package spf
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PrewarmOption sets an optional parameter of Prewarm.
+type PrewarmOption func(*prewarmer)
+
+// PrewarmRefresh keeps Prewarm running until the context is done, walking
+// policy of each domain again when the shortest TTL of the responses it
+// required expires, but not more often than every min.
+func PrewarmRefresh(min time.Duration) PrewarmOption {
+	return func(w *prewarmer) {
+		w.refresh = true
+		if min > 0 {
+			w.min = min
+		}
+	}
+}
+
+// PrewarmOnError sets the function called with the error of each policy
+// failed to walk, useful with PrewarmRefresh as errors are not returned then.
+func PrewarmOnError(f func(domain string, err error)) PrewarmOption {
+	return func(w *prewarmer) {
+		w.onError = f
+	}
+}
+
+// PrewarmClock makes Prewarm schedule refreshes by the time of c, SystemClock
+// by default. Waits of clocks other than SystemClock are not interrupted by
+// the context, it is checked once they return.
+func PrewarmClock(c Clock) PrewarmOption {
+	return func(w *prewarmer) {
+		if c == nil {
+			return
+		}
+		w.clock = c
+	}
+}
+
+type prewarmer struct {
+	resolver Resolver
+	refresh  bool
+	min      time.Duration
+	clock    Clock
+	onError  func(domain string, err error)
+}
+
+// Prewarm makes the lookups SPF policies of the domains require, e.g. of
+// _spf.google.com or spf.protection.outlook.com, so a caching Resolver (see
+// MiekgDNSCache) has the responses by the time checks need them. Policies
+// are walked regardless of the checked IP address, like CompilePolicy does;
+// terms using macros are not looked up.
+//
+// Without PrewarmRefresh, Prewarm returns once every policy is walked, the
+// errors of the failed ones are returned as ErrorList. With it, Prewarm
+// returns the error of the context once it is done.
+func Prewarm(ctx context.Context, domains []string, r Resolver, opts ...PrewarmOption) error {
+	w := &prewarmer{resolver: r, min: time.Minute, clock: SystemClock}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	next := make([]time.Time, len(domains))
+	var errs ErrorList
+	for {
+		now := w.clock.Now()
+		soonest := time.Time{}
+		for i, domain := range domains {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if now.Before(next[i]) {
+				if soonest.IsZero() || next[i].Before(soonest) {
+					soonest = next[i]
+				}
+				continue
+			}
+			ttl, err := w.walk(domain)
+			if err != nil {
+				if w.onError != nil {
+					w.onError(domain, err)
+				}
+				errs = append(errs, fmt.Errorf("%s: %w", domain, err))
+			}
+			if ttl < w.min {
+				ttl = w.min
+			}
+			next[i] = w.clock.Now().Add(ttl)
+			if soonest.IsZero() || next[i].Before(soonest) {
+				soonest = next[i]
+			}
+		}
+		if !w.refresh {
+			if len(errs) == 0 {
+				return nil
+			}
+			return errs
+		}
+		errs = nil
+		if soonest.IsZero() {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		if err := sleepContext(ctx, w.clock, soonest.Sub(w.clock.Now())); err != nil {
+			return err
+		}
+	}
+}
+
+// walk makes the lookups of the domain's policy and returns the shortest
+// TTL of the responses
+func (w *prewarmer) walk(domain string) (time.Duration, error) {
+	pw := newPolicyWalker(forDomain(w.resolver, domain))
+	_, err := pw.walk(NormalizeFQDN(domain))
+	if pw.extras == nil {
+		return 0, err
+	}
+	return pw.extras.TTL, err
+}
@@ -0,0 +1,128 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/miekg/dns"
+)
+
+func TestPrewarm(t *testing.T) {
+	var queries int32
+	counting := func(h dns.HandlerFunc) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, req *dns.Msg) {
+			atomic.AddInt32(&queries, 1)
+			h(w, req)
+		}
+	}
+	dns.HandleFunc("prewarm.example.", counting(zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`prewarm.example. 300 IN TXT "v=spf1 a include:inc.prewarm.example exists:%{i}.prewarm.example -all"`,
+		},
+		dns.TypeA: {
+			`prewarm.example. 300 IN A 10.0.0.1`,
+		},
+	})))
+	defer dns.HandleRemove("prewarm.example.")
+
+	dns.HandleFunc("inc.prewarm.example.", counting(zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.prewarm.example. 300 IN TXT "v=spf1 ip4:192.0.2.0/24 -all"`,
+		},
+	})))
+	defer dns.HandleRemove("inc.prewarm.example.")
+
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr, MiekgDNSCache(gcache.New(100).Simple().Build()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Prewarm(context.Background(), []string{"prewarm.example", "none.prewarm.example"}, r)
+	if !errors.Is(err, ErrSPFNotFound) {
+		t.Errorf("Prewarm() error = %v; want %v", err, ErrSPFNotFound)
+	}
+	warm := atomic.LoadInt32(&queries)
+	if warm == 0 {
+		t.Fatal("Prewarm() made no queries")
+	}
+
+	res, _, _, err := CheckHost(net.ParseIP("192.0.2.1"), "prewarm.example", "", WithResolver(r))
+	if res != Pass || err != nil {
+		t.Errorf("CheckHost() = %s, %v; want pass", res, err)
+	}
+	if n := atomic.LoadInt32(&queries); n != warm {
+		t.Errorf("CheckHost() made %d queries; want none", n-warm)
+	}
+}
+
+func TestPrewarm_Refresh(t *testing.T) {
+	var queries int32
+	dns.HandleFunc("refresh.example.", func(w dns.ResponseWriter, req *dns.Msg) {
+		atomic.AddInt32(&queries, 1)
+		zone(map[uint16][]string{
+			dns.TypeTXT: {
+				`refresh.example. 0 IN TXT "v=spf1 -all"`,
+			},
+		})(w, req)
+	})
+	defer dns.HandleRemove("refresh.example.")
+
+	var failed int32
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := Prewarm(ctx, []string{"refresh.example", "none.refresh.example"}, testResolver,
+		PrewarmRefresh(20*time.Millisecond),
+		PrewarmOnError(func(domain string, err error) {
+			if domain != "none.refresh.example" || !errors.Is(err, ErrSPFNotFound) {
+				t.Errorf("PrewarmOnError(%s, %v); want none.refresh.example, %v", domain, err, ErrSPFNotFound)
+			}
+			atomic.AddInt32(&failed, 1)
+		}))
+	if err != context.DeadlineExceeded {
+		t.Errorf("Prewarm() error = %v; want %v", err, context.DeadlineExceeded)
+	}
+	// both domains are walked every 20ms
+	if n := atomic.LoadInt32(&queries); n < 6 {
+		t.Errorf("Prewarm() made %d queries; want refreshes", n)
+	}
+	if n := atomic.LoadInt32(&failed); n < 3 {
+		t.Errorf("PrewarmOnError called %d times; want on each refresh", n)
+	}
+}
+
+func TestPrewarm_Clock(t *testing.T) {
+	dns.HandleFunc("clock.prewarm.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`clock.prewarm.example. 0 IN TXT "v=spf1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("clock.prewarm.example.")
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var walks []time.Time
+	err := Prewarm(ctx, []string{"clock.prewarm.example", "none.clock.prewarm.example"}, testResolver,
+		PrewarmRefresh(time.Minute),
+		PrewarmClock(clock),
+		PrewarmOnError(func(domain string, err error) {
+			walks = append(walks, clock.Now())
+			if len(walks) == 3 {
+				cancel()
+			}
+		}))
+	if err != context.Canceled {
+		t.Errorf("Prewarm() error = %v; want %v", err, context.Canceled)
+	}
+	// the failed domain is walked again every minute
+	want := []time.Time{start, start.Add(time.Minute), start.Add(2 * time.Minute)}
+	if !reflect.DeepEqual(walks, want) {
+		t.Errorf("walks at %v; want %v", walks, want)
+	}
+}
@@ -0,0 +1,205 @@
+package printer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/redsift/spf"
+)
+
+// OutputFormat selects how Printer renders the evaluation.
+type OutputFormat int
+
+const (
+	// Text is the indented human-readable trace, used by default
+	Text OutputFormat = iota
+	// JSON writes every event as a JSON object on its own line (JSON lines),
+	// "depth" of the objects gives nesting of the evaluation tree
+	JSON
+	// DOT writes the tree of evaluated domains in Graphviz DOT language
+	// once the check is done, edges are labeled with the mechanism the
+	// domain is reached through
+	DOT
+)
+
+func (f OutputFormat) String() string {
+	switch f {
+	case Text:
+		return "text"
+	case JSON:
+		return "json"
+	case DOT:
+		return "dot"
+	default:
+		return "unknown"
+	}
+}
+
+// Option sets an optional parameter of Printer.
+type Option func(*Printer)
+
+// Format sets the output format, Text by default.
+func Format(f OutputFormat) Option {
+	return func(p *Printer) {
+		p.format = f
+	}
+}
+
+// Verbosity selects the events Printer writes in Text and JSON formats.
+type Verbosity int
+
+const (
+	// Quiet writes checked domains, their records, directives and results
+	Quiet Verbosity = iota
+	// Normal adds lookups and comparisons of matching IP addresses, it is
+	// used by default
+	Normal
+	// Debug adds matches and non-matches of directives and lookups answered
+	// from the resolver's cache (see spf.ResponseExtras.CacheHits)
+	Debug
+)
+
+func (v Verbosity) String() string {
+	switch v {
+	case Quiet:
+		return "quiet"
+	case Normal:
+		return "normal"
+	case Debug:
+		return "debug"
+	default:
+		return "unknown"
+	}
+}
+
+// Verbose sets the verbosity, Normal by default.
+func Verbose(v Verbosity) Option {
+	return func(p *Printer) {
+		p.verbosity = v
+	}
+}
+
+// event is a line of JSON output
+type event struct {
+	Event          string `json:"event"`
+	Depth          int    `json:"depth"`
+	IP             string `json:"ip,omitempty"`
+	Domain         string `json:"domain,omitempty"`
+	Sender         string `json:"sender,omitempty"`
+	Record         string `json:"record,omitempty"`
+	Unused         bool   `json:"unused,omitempty"`
+	Kind           string `json:"kind,omitempty"`
+	Qualifier      string `json:"qualifier,omitempty"`
+	Mechanism      string `json:"mechanism,omitempty"`
+	Value          string `json:"value,omitempty"`
+	EffectiveValue string `json:"effectiveValue,omitempty"`
+	Type           string `json:"type,omitempty"`
+	Name           string `json:"name,omitempty"`
+	Host           string `json:"host,omitempty"`
+	Network        string `json:"network,omitempty"`
+	Match          *bool  `json:"match,omitempty"`
+	CacheHits      int    `json:"cacheHits,omitempty"`
+	Queries        int    `json:"queries,omitempty"`
+	Result         string `json:"result,omitempty"`
+	Explanation    string `json:"explanation,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+func (p *Printer) emit(e event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	_, _ = p.w.Write(b)
+}
+
+// dotNode is an evaluated domain
+type dotNode struct {
+	domain string
+	result string
+	parent int    // index of the node the domain is reached from, -1 for the checked one
+	via    string // mechanism the domain is reached through
+}
+
+// dotGraph collects the tree of evaluated domains
+type dotGraph struct {
+	nodes []dotNode
+	stack []int
+	via   string
+}
+
+func (g *dotGraph) enter(domain string) {
+	n := dotNode{domain: domain, parent: -1, via: g.via}
+	if l := len(g.stack); l > 0 {
+		n.parent = g.stack[l-1]
+	}
+	g.via = ""
+	g.nodes = append(g.nodes, n)
+	g.stack = append(g.stack, len(g.nodes)-1)
+}
+
+// exit sets the result of the current domain and returns true once
+// the checked domain is done
+func (g *dotGraph) exit(result string) bool {
+	l := len(g.stack)
+	if l == 0 {
+		return false
+	}
+	g.nodes[g.stack[l-1]].result = result
+	g.stack = g.stack[:l-1]
+	return l == 1
+}
+
+func (g *dotGraph) write(p *Printer) {
+	var b strings.Builder
+	b.WriteString("digraph spf {\n")
+	for i, n := range g.nodes {
+		fmt.Fprintf(&b, "  n%d [label=\"%s\\n%s\"];\n", i, dotEscape(n.domain), n.result)
+	}
+	for i, n := range g.nodes {
+		if n.parent < 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "  n%d -> n%d [label=%q];\n", n.parent, i, n.via)
+	}
+	b.WriteString("}\n")
+	_, _ = p.w.Write([]byte(b.String()))
+	g.nodes, g.stack = nil, nil
+}
+
+// dotEscape escapes the string to be used in a quoted DOT ID
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// EnterInclude implements spf.NestingListener
+func (p *Printer) EnterInclude(domain string, depth int) {
+	p.enter("include", domain, depth)
+}
+
+// EnterRedirect implements spf.NestingListener
+func (p *Printer) EnterRedirect(domain string, depth int) {
+	p.enter("redirect", domain, depth)
+}
+
+func (p *Printer) enter(mechanism, domain string, depth int) {
+	p.send(func() {
+		switch p.format {
+		case JSON:
+			p.emit(event{Event: "enter", Depth: depth, Mechanism: mechanism, Domain: domain})
+		case DOT:
+			p.dot.via = mechanism
+		}
+	})
+}
+
+// Exit implements spf.NestingListener
+func (p *Printer) Exit(domain string, depth int, r spf.Result) {
+	p.send(func() {
+		if p.format == JSON {
+			p.emit(event{Event: "exit", Depth: depth, Domain: domain, Result: r.String()})
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package printer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/redsift/spf"
+)
+
+// txtResolver answers TXT lookups from the map, other lookups find nothing
+type txtResolver map[string]string
+
+func (r txtResolver) LookupTXT(name string) ([]string, *spf.ResponseExtras, error) {
+	if txt, ok := r[name]; ok {
+		return []string{txt}, &spf.ResponseExtras{Answers: 1}, nil
+	}
+	return nil, &spf.ResponseExtras{Void: true}, nil
+}
+
+func (r txtResolver) LookupTXTStrict(name string) ([]string, *spf.ResponseExtras, error) {
+	if txt, ok := r[name]; ok {
+		return []string{txt}, &spf.ResponseExtras{Answers: 1}, nil
+	}
+	return nil, &spf.ResponseExtras{Void: true}, spf.ErrDNSPermerror
+}
+
+func (r txtResolver) Exists(string) (bool, *spf.ResponseExtras, error) {
+	return false, &spf.ResponseExtras{Void: true}, nil
+}
+
+func (r txtResolver) MatchIP(string, spf.IPMatcherFunc) (bool, *spf.ResponseExtras, error) {
+	return false, &spf.ResponseExtras{Void: true}, nil
+}
+
+func (r txtResolver) MatchMX(string, spf.IPMatcherFunc) (bool, *spf.ResponseExtras, error) {
+	return false, &spf.ResponseExtras{Void: true}, nil
+}
+
+var formatZone = txtResolver{
+	"example.com.":       "v=spf1 include:_spf.example.com redirect=other.example.com",
+	"_spf.example.com.":  "v=spf1 ip4:192.0.2.0/24 -all",
+	"other.example.com.": "v=spf1 ~all",
+}
+
+func checkWithFormat(t *testing.T, f OutputFormat) string {
+	t.Helper()
+	var b bytes.Buffer
+	p := New(&b, formatZone, Format(f))
+	r, _, _, err := spf.CheckHost(net.ParseIP("198.51.100.1"), "example.com", "john@example.com",
+		spf.WithResolver(p),
+		spf.WithListener(p),
+	)
+	if r != spf.Softfail || err != nil {
+		t.Fatalf("CheckHost() = %s, %v; want softfail", r, err)
+	}
+	p.Close()
+	return b.String()
+}
+
+func TestPrinter_JSON(t *testing.T) {
+	out := checkWithFormat(t, JSON)
+
+	type line struct {
+		Event  string `json:"event"`
+		Depth  int    `json:"depth"`
+		Domain string `json:"domain"`
+		Result string `json:"result"`
+	}
+	var got []line
+	s := bufio.NewScanner(bytes.NewBufferString(out))
+	for s.Scan() {
+		var l line
+		if err := json.Unmarshal(s.Bytes(), &l); err != nil {
+			t.Fatalf("invalid line %q: %v", s.Text(), err)
+		}
+		if l.Event == "checkHost" || l.Event == "enter" || l.Event == "exit" || l.Event == "result" {
+			got = append(got, l)
+		}
+	}
+	want := []line{
+		{"checkHost", 0, "example.com.", ""},
+		{"enter", 1, "_spf.example.com.", ""},
+		{"checkHost", 1, "_spf.example.com.", ""},
+		{"result", 1, "", "fail"},
+		{"exit", 1, "_spf.example.com.", "fail"},
+		{"enter", 1, "other.example.com.", ""},
+		{"checkHost", 1, "other.example.com.", ""},
+		{"result", 1, "", "softfail"},
+		{"exit", 1, "other.example.com.", "softfail"},
+		{"result", 0, "", "softfail"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("events:\n%s", out)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %+v; want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPrinter_DOT(t *testing.T) {
+	got := checkWithFormat(t, DOT)
+	want := `digraph spf {
+  n0 [label="example.com.\nsoftfail"];
+  n1 [label="_spf.example.com.\nfail"];
+  n2 [label="other.example.com.\nsoftfail"];
+  n0 -> n1 [label="include"];
+  n0 -> n2 [label="redirect"];
+}
+`
+	if got != want {
+		t.Errorf("DOT output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrinter_Verbose(t *testing.T) {
+	r := cachedResolver(t,
+		`example.com. 300 IN TXT "v=spf1 a:mail.example.com include:_spf.example.com -all"`,
+		`_spf.example.com. 300 IN TXT "v=spf1 ip4:192.0.2.0/24 -all"`,
+		`mail.example.com. 300 IN A 198.51.100.1`,
+	)
+	tests := []struct {
+		verbosity Verbosity
+		want      []string
+		wantNot   []string
+	}{
+		{Quiet, []string{"CHECK_HOST(", "SPF: ", "include:_spf.example.com", "= fail"},
+			[]string{"lookup(", "MATCH", "cached("}},
+		{Normal, []string{"lookup(TXT:strict) example.com.", "lookup(a:mail.example.com.)"},
+			[]string{"MATCH", "cached("}},
+		{Debug, []string{"lookup(TXT:strict) example.com.", "NON-MATCH: none, <nil>", "MATCH: fail",
+			"cached(TXT:strict) _spf.example.com.: 1 of 1", "cached(ip) mail.example.com.: 2 of 2"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.verbosity.String(), func(t *testing.T) {
+			var b bytes.Buffer
+			p := New(&b, r, Verbose(tt.verbosity))
+			res, _, _, err := spf.CheckHost(net.ParseIP("203.0.113.1"), "example.com", "john@example.com",
+				spf.WithResolver(p),
+				spf.WithListener(p),
+			)
+			p.Close()
+			if res != spf.Fail || err != nil {
+				t.Fatalf("CheckHost() = %s, %v; want fail", res, err)
+			}
+			out := b.String()
+			for _, s := range tt.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("output has no %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.wantNot {
+				if strings.Contains(out, s) {
+					t.Errorf("output has %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestPrinter_Modifiers(t *testing.T) {
+	zone := txtResolver{
+		"example.com.":       "v=spf1 ra=postmaster ip4:192.0.2.0/24 redirect=other.example.com",
+		"other.example.com.": "v=spf1 ~all",
+	}
+	for _, tt := range []struct {
+		format OutputFormat
+		want   []string
+	}{
+		{Text, []string{"\n  ra=postmaster\n", "\n  redirect=other.example.com (other.example.com.)\n", "\n  v=spf1\n"}},
+		{JSON, []string{`"kind":"unknown-modifier","mechanism":"ra","value":"postmaster"`,
+			`"kind":"modifier","mechanism":"redirect","value":"other.example.com"`,
+			`"kind":"mechanism","qualifier":"+","mechanism":"ip4"`}},
+	} {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			var b bytes.Buffer
+			p := New(&b, zone, Format(tt.format))
+			spf.CheckHost(net.ParseIP("198.51.100.1"), "example.com", "", spf.WithResolver(p), spf.WithListener(p))
+			p.Close()
+			for _, s := range tt.want {
+				if !strings.Contains(b.String(), s) {
+					t.Errorf("output has no %q:\n%s", s, b.String())
+				}
+			}
+		})
+	}
+}
@@ -5,115 +5,309 @@ import (
 	"io"
 	"net"
 	"strings"
-	"sync/atomic"
-
 	"sync"
+	"sync/atomic"
 
 	"github.com/redsift/spf"
 )
 
-func New(w io.Writer, r spf.Resolver) *Printer {
-	return &Printer{
-		w: w,
-		r: r,
+// New returns Printer writing evaluation events to w and making lookups with
+// r. Events are written by a goroutine of the Printer in the order they were
+// received: call Flush to wait for them to be written and Close once the
+// Printer is not needed anymore.
+func New(w io.Writer, r spf.Resolver, opts ...Option) *Printer {
+	p := &Printer{
+		w:         w,
+		r:         r,
+		verbosity: Normal,
+		events:    make(chan func(), 64),
+		stopped:   make(chan struct{}),
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	go p.run()
+	return p
 }
 
+// Printer is spf.Listener and spf.Resolver writing the evaluation trace.
+// It is safe for concurrent use, e.g. with matcher callbacks called in
+// parallel by resolver's MiekgDNSParallelism.
 type Printer struct {
-	sync.Mutex
-	w    io.Writer
+	w         io.Writer
+	r         spf.Resolver
+	lc        int64 // number of lookups, accessed atomically
+	format    OutputFormat
+	verbosity Verbosity
+
+	mu      sync.RWMutex // guards closed, no events are sent once closed
+	closed  bool
+	events  chan func()
+	stopped chan struct{}
+
+	// state of the output, accessed by the writer goroutine only
 	c    int
-	lc   int64
-	r    spf.Resolver
 	done bool
+	dot  dotGraph
+}
+
+// run writes the events until the Printer is closed
+func (p *Printer) run() {
+	defer close(p.stopped)
+	for e := range p.events {
+		e()
+	}
+}
+
+// send queues the event to be written
+func (p *Printer) send(e func()) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+	p.events <- e
+}
+
+// Flush waits for the events received so far to be written.
+func (p *Printer) Flush() {
+	flushed := make(chan struct{})
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		<-p.stopped
+		return
+	}
+	p.events <- func() { close(flushed) }
+	p.mu.RUnlock()
+	<-flushed
+}
+
+// Close writes the events received so far and stops the Printer,
+// events received afterwards are dropped.
+func (p *Printer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.events)
+	}
+	p.mu.Unlock()
+	<-p.stopped
+	return nil
 }
 
 func (p *Printer) LookupsCount() int {
 	// we deduct 1 for the very first lookup for root SPF policy
-	return int(p.lc) - 1
+	return int(atomic.LoadInt64(&p.lc)) - 1
+}
+
+func (p *Printer) indent() string {
+	return strings.Repeat("  ", p.c)
 }
 
 func (p *Printer) CheckHost(ip net.IP, domain, sender string) {
-	fmt.Fprintf(p.w, "%sCHECK_HOST(%q, %q, %q)\n", strings.Repeat("  ", p.c), ip, domain, sender)
-	p.c++
+	p.send(func() {
+		switch p.format {
+		case JSON:
+			p.emit(event{Event: "checkHost", Depth: p.c, IP: ip.String(), Domain: domain, Sender: sender})
+		case DOT:
+			p.dot.enter(domain)
+		default:
+			fmt.Fprintf(p.w, "%sCHECK_HOST(%q, %q, %q)\n", p.indent(), ip, domain, sender)
+		}
+		p.c++
+	})
 }
 
 func (p *Printer) SPFRecord(s string) {
-	fmt.Fprintf(p.w, "%sSPF: %s\n", strings.Repeat("  ", p.c), s)
+	p.send(func() {
+		switch p.format {
+		case JSON:
+			p.emit(event{Event: "spfRecord", Depth: p.c, Record: s})
+		case Text:
+			fmt.Fprintf(p.w, "%sSPF: %s\n", p.indent(), s)
+		}
+	})
 }
 
 func (p *Printer) CheckHostResult(r spf.Result, explanation string, err error) {
-	p.Lock()
-	defer p.Unlock()
-	p.c--
-	p.done = p.c == 0
-	fmt.Fprintf(p.w, "%s= %s, %q, %v\n", strings.Repeat("  ", p.c), r, explanation, err)
+	p.send(func() {
+		p.c--
+		p.done = p.c == 0
+		switch p.format {
+		case JSON:
+			e := event{Event: "result", Depth: p.c, Result: r.String(), Explanation: explanation}
+			if err != nil {
+				e.Error = err.Error()
+			}
+			p.emit(e)
+		case DOT:
+			if p.dot.exit(r.String()) {
+				p.dot.write(p)
+			}
+		default:
+			fmt.Fprintf(p.w, "%s= %s, %q, %v\n", p.indent(), r, explanation, err)
+		}
+	})
 }
 
-func (p *Printer) Directive(unused bool, qualifier, mechanism, value, effectiveValue string) {
-	fmt.Fprintf(p.w, "%s", strings.Repeat("  ", p.c))
-	if qualifier == "+" {
-		qualifier = ""
-	}
-	if unused {
-		fmt.Fprint(p.w, "unused ")
-	}
-	fmt.Fprintf(p.w, "%s%s", qualifier, mechanism)
-	delimiter := ":"
-	if mechanism == "v" {
-		delimiter = "="
-	}
-	if value != "" {
-		fmt.Fprintf(p.w, "%s%s", delimiter, value)
-	}
-	if effectiveValue != "" {
-		fmt.Fprintf(p.w, " (%s)", effectiveValue)
-	}
-	fmt.Fprintln(p.w)
+// Directive implements spf.Listener, directives are written by DirectiveInfo.
+func (p *Printer) Directive(unused bool, qualifier, mechanism, value, effectiveValue string) {}
+
+// DirectiveInfo implements spf.DirectiveInfoListener
+func (p *Printer) DirectiveInfo(info spf.DirectiveInfo) {
+	p.send(func() {
+		switch p.format {
+		case JSON:
+			p.emit(event{Event: "directive", Depth: p.c, Unused: info.Unused, Kind: info.Kind.String(),
+				Qualifier: info.Qualifier, Mechanism: info.Key, Value: info.Value, EffectiveValue: info.EffectiveValue})
+			return
+		case DOT:
+			return
+		}
+		fmt.Fprintf(p.w, "%s", p.indent())
+		if info.Unused {
+			fmt.Fprint(p.w, "unused ")
+		}
+		qualifier := info.Qualifier
+		if qualifier == "+" {
+			qualifier = ""
+		}
+		fmt.Fprintf(p.w, "%s%s", qualifier, info.Key)
+		delimiter := ":"
+		if info.Kind != spf.TermMechanism {
+			delimiter = "="
+		}
+		if info.Value != "" || info.Kind == spf.TermUnknownModifier {
+			fmt.Fprintf(p.w, "%s%s", delimiter, info.Value)
+		}
+		if info.EffectiveValue != "" {
+			fmt.Fprintf(p.w, " (%s)", info.EffectiveValue)
+		}
+		fmt.Fprintln(p.w)
+	})
 }
 
 func (p *Printer) NonMatch(qualifier, mechanism, value string, result spf.Result, err error) {
-	//fmt.Fprintf(p.w, "%sNON-MATCH: %s, %v\n", strings.Repeat("  ", p.c), result, err)
+	if p.verbosity < Debug {
+		return
+	}
+	p.send(func() {
+		switch p.format {
+		case JSON:
+			e := event{Event: "nonMatch", Depth: p.c, Qualifier: qualifier, Mechanism: mechanism, Value: value,
+				Result: result.String()}
+			if err != nil {
+				e.Error = err.Error()
+			}
+			p.emit(e)
+		case Text:
+			fmt.Fprintf(p.w, "%sNON-MATCH: %s, %v\n", p.indent(), result, err)
+		}
+	})
 }
 
 func (p *Printer) Match(qualifier, mechanism, value string, result spf.Result, explanation string, err error) {
-	//fmt.Fprintf(p.w, "%sMATCH: %s, %q, %v\n", strings.Repeat("  ", p.c), result, explanation, err)
+	if p.verbosity < Debug {
+		return
+	}
+	p.send(func() {
+		switch p.format {
+		case JSON:
+			e := event{Event: "match", Depth: p.c, Qualifier: qualifier, Mechanism: mechanism, Value: value,
+				Result: result.String(), Explanation: explanation}
+			if err != nil {
+				e.Error = err.Error()
+			}
+			p.emit(e)
+		case Text:
+			fmt.Fprintf(p.w, "%sMATCH: %s, %q, %v\n", p.indent(), result, explanation, err)
+		}
+	})
 }
 
-func (p *Printer) LookupTXT(name string) ([]string, error) {
-	fmt.Fprintf(p.w, "%s  lookup(TXT) %s\n", strings.Repeat("  ", p.c), name)
+// lookup counts the lookup and writes it
+func (p *Printer) lookup(typ, name string) {
 	atomic.AddInt64(&p.lc, 1)
-	p.lc++
-	return p.r.LookupTXT(name)
+	if p.verbosity < Normal {
+		return
+	}
+	p.send(func() {
+		switch p.format {
+		case JSON:
+			p.emit(event{Event: "lookup", Depth: p.c, Type: typ, Name: name})
+		case Text:
+			fmt.Fprintf(p.w, "%s  lookup(%s) %s\n", p.indent(), typ, name)
+		}
+	})
 }
 
-func (p *Printer) LookupTXTStrict(name string) ([]string, error) {
-	fmt.Fprintf(p.w, "%s  lookup(TXT:strict) %s\n", strings.Repeat("  ", p.c), name)
-	atomic.AddInt64(&p.lc, 1)
-	return p.r.LookupTXTStrict(name)
+// cacheHits writes the number of queries of the lookup answered from cache
+func (p *Printer) cacheHits(typ, name string, extras *spf.ResponseExtras) {
+	if p.verbosity < Debug || extras == nil || extras.CacheHits == 0 {
+		return
+	}
+	p.send(func() {
+		switch p.format {
+		case JSON:
+			p.emit(event{Event: "cacheHits", Depth: p.c, Type: typ, Name: name, CacheHits: extras.CacheHits,
+				Queries: extras.Queries})
+		case Text:
+			fmt.Fprintf(p.w, "%s  cached(%s) %s: %d of %d\n", p.indent(), typ, name, extras.CacheHits, extras.Queries)
+		}
+	})
 }
 
-func (p *Printer) Exists(name string) (bool, error) {
-	fmt.Fprintf(p.w, "%s  lookup(A)\n", strings.Repeat("  ", p.c))
-	atomic.AddInt64(&p.lc, 1)
-	return p.r.Exists(name)
+func (p *Printer) LookupTXT(name string) ([]string, *spf.ResponseExtras, error) {
+	p.lookup("TXT", name)
+	txts, extras, err := p.r.LookupTXT(name)
+	p.cacheHits("TXT", name, extras)
+	return txts, extras, err
+}
+
+func (p *Printer) LookupTXTStrict(name string) ([]string, *spf.ResponseExtras, error) {
+	p.lookup("TXT:strict", name)
+	txts, extras, err := p.r.LookupTXTStrict(name)
+	p.cacheHits("TXT:strict", name, extras)
+	return txts, extras, err
+}
+
+func (p *Printer) Exists(name string) (bool, *spf.ResponseExtras, error) {
+	p.lookup("A", name)
+	found, extras, err := p.r.Exists(name)
+	p.cacheHits("A", name, extras)
+	return found, extras, err
 }
 
 func (p *Printer) MatchingIP(_, mechanism, _ string, fqdn string, ipn net.IPNet, host string, ip net.IP) {
-	p.Lock()
-	defer p.Unlock()
 	atomic.AddInt64(&p.lc, 1)
-	if p.done {
+	if p.verbosity < Normal {
 		return
 	}
-	n, _ := ipn.Mask.Size()
-	fmt.Fprintf(p.w, "%s  lookup(%s:%s) %s -> (%s/%d has? %s) = %t\n", strings.Repeat("  ", p.c), mechanism, fqdn, host, ipn.IP, n, ip, ipn.Contains(ip))
+	p.send(func() {
+		if p.done {
+			return
+		}
+		n, _ := ipn.Mask.Size()
+		switch p.format {
+		case JSON:
+			match := ipn.Contains(ip)
+			p.emit(event{Event: "matchingIP", Depth: p.c, Mechanism: mechanism, Name: fqdn, Host: host,
+				Network: fmt.Sprintf("%s/%d", ipn.IP, n), IP: ip.String(), Match: &match})
+		case Text:
+			fmt.Fprintf(p.w, "%s  lookup(%s:%s) %s -> (%s/%d has? %s) = %t\n", p.indent(), mechanism, fqdn, host, ipn.IP, n, ip, ipn.Contains(ip))
+		}
+	})
 }
 
-func (p *Printer) MatchIP(name string, matcher spf.IPMatcherFunc) (bool, error) {
-	return p.r.MatchIP(name, matcher)
+func (p *Printer) MatchIP(name string, matcher spf.IPMatcherFunc) (bool, *spf.ResponseExtras, error) {
+	found, extras, err := p.r.MatchIP(name, matcher)
+	p.cacheHits("ip", name, extras)
+	return found, extras, err
 }
 
-func (p *Printer) MatchMX(name string, matcher spf.IPMatcherFunc) (bool, error) {
-	return p.r.MatchMX(name, matcher)
+func (p *Printer) MatchMX(name string, matcher spf.IPMatcherFunc) (bool, *spf.ResponseExtras, error) {
+	found, extras, err := p.r.MatchMX(name, matcher)
+	p.cacheHits("MX", name, extras)
+	return found, extras, err
 }
@@ -1,13 +1,18 @@
 package printer
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"strings"
+	"testing"
+	"time"
 
 	"github.com/bluele/gcache"
+	"github.com/miekg/dns"
 	"github.com/redsift/spf"
 )
 
@@ -62,6 +67,7 @@ func ExamplePrinter() {
 	if err != nil {
 		log.Fatalf("%s %q %s", res, s, err)
 	}
+	p.Close()
 	fmt.Printf("## of lookups: %d\n", p.LookupsCount())
 
 	// Unordered output:
@@ -169,6 +175,7 @@ func ExamplePrinter_ipv6nil() {
 	if err != nil {
 		log.Fatalf("%s %q %s", res, s, err)
 	}
+	p.Close()
 
 	// Unordered output:
 	// CHECK_HOST("0.0.0.0", "q4press.com.", "aspmx.l.google.com")
@@ -193,3 +200,82 @@ func ExamplePrinter_ipv6nil() {
 	// = softfail, "", <nil>
 	//
 }
+
+// cachedResolver returns resolver answering from the records as if they
+// were cached, comparing addresses of MX hosts in parallel
+func cachedResolver(t *testing.T, records ...string) spf.Resolver {
+	t.Helper()
+	r, err := spf.NewMiekgDNSResolver("127.0.0.1:1",
+		spf.MiekgDNSCache(gcache.New(100).Build()),
+		spf.MiekgDNSMinSaneTTL(time.Hour),
+		spf.MiekgDNSParallelism(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := make(map[dns.Question]*dns.Msg)
+	add := func(name string, qtype uint16, rr dns.RR) {
+		q := dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET}
+		res, ok := responses[q]
+		if !ok {
+			res = new(dns.Msg)
+			res.SetQuestion(name, qtype)
+			responses[q] = res
+		}
+		if rr != nil {
+			res.Answer = append(res.Answer, rr)
+		}
+	}
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		add(rr.Header().Name, rr.Header().Rrtype, rr)
+		if rr.Header().Rrtype == dns.TypeA {
+			add(rr.Header().Name, dns.TypeAAAA, nil)
+		}
+	}
+	for _, res := range responses {
+		r.CacheResponse(res)
+	}
+	return r
+}
+
+func TestPrinter_parallel(t *testing.T) {
+	records := []string{
+		`example.com. 300 IN TXT "v=spf1 mx include:a.example.com include:b.example.com -all"`,
+		`a.example.com. 300 IN TXT "v=spf1 mx:example.com -all"`,
+		`b.example.com. 300 IN TXT "v=spf1 a:mx1.example.com a:mx2.example.com -all"`,
+	}
+	for i := 1; i <= 8; i++ {
+		records = append(records,
+			fmt.Sprintf(`example.com. 300 IN MX 10 mx%d.example.com.`, i),
+			fmt.Sprintf(`mx%d.example.com. 300 IN A 192.0.2.%d`, i, i),
+			fmt.Sprintf(`mx%d.example.com. 300 IN A 198.51.100.%d`, i, i))
+	}
+	r := cachedResolver(t, records...)
+
+	var b bytes.Buffer
+	p := New(&b, r)
+	for i := 0; i < 10; i++ {
+		res, _, _, err := spf.CheckHost(net.ParseIP("203.0.113.1"), "example.com", "john@example.com",
+			spf.WithResolver(p),
+			spf.WithListener(p),
+			spf.ConcurrentIncludes(2),
+		)
+		if res != spf.Fail || err != nil {
+			t.Fatalf("CheckHost() = %s, %v; want fail", res, err)
+		}
+	}
+	p.Close()
+
+	out := b.String()
+	if n := strings.Count(out, "\n= fail"); n != 10 {
+		t.Errorf("got %d results; want 10:\n%s", n, out)
+	}
+	// 3 records and 8 MX hosts with 2 addresses matched twice,
+	// 2 hosts with 2 addresses, per check
+	if got, want := p.LookupsCount(), 10*(3+2*8*2+2*2)-1; got != want {
+		t.Errorf("LookupsCount() = %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,268 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/redsift/spf/domainutil"
+)
+
+// Errors of names skipped by "ptr" mechanism
+var (
+	ErrPTRNotSupported = errors.New("PTR lookups are not supported")
+	ErrTooManyPTRNames = errors.New("too many PTR names")
+	ErrPTRNotConfirmed = errors.New("PTR name doesn't resolve to the address")
+)
+
+// PTRResolver is an optional interface a Resolver could implement to support
+// "ptr" mechanism, which never matches otherwise.
+type PTRResolver interface {
+	// LookupPTR returns names of PTR records of the ip
+	LookupPTR(ip net.IP) ([]string, *ResponseExtras, error)
+	// ConfirmPTR checks if A (for IPv4) or AAAA (for IPv6) records
+	// of the name include the ip
+	ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error)
+}
+
+func lookupPTR(r Resolver, ip net.IP) ([]string, *ResponseExtras, error) {
+	if p, ok := r.(PTRResolver); ok {
+		return p.LookupPTR(ip)
+	}
+	return nil, nil, ErrPTRNotSupported
+}
+
+func confirmPTR(r Resolver, name string, ip net.IP) (bool, *ResponseExtras, error) {
+	if p, ok := r.(PTRResolver); ok {
+		return p.ConfirmPTR(name, ip)
+	}
+	return false, nil, ErrPTRNotSupported
+}
+
+// ptrMemo keeps validated domain names of the checked IP for the duration
+// of the check, it is shared by all parsers of the check.
+type ptrMemo struct {
+	sync.Mutex
+	done  bool
+	names []string
+}
+
+// validatedNames returns validated domain names of p.ip, the names are
+// looked up once per check. Every call is accounted as a lookup.
+func (p *parser) validatedNames(t *token) ([]string, error) {
+	m := p.ptrMemo
+	if m == nil {
+		return p.lookupValidatedNames(t)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.done {
+		if l, ok := p.resolver.(*LimitedResolver); ok && !l.canLookup() {
+			return nil, ErrDNSLimitExceeded
+		}
+		return m.names, nil
+	}
+	names, err := p.lookupValidatedNames(t)
+	if err == nil {
+		m.done, m.names = true, names
+	}
+	return names, err
+}
+
+// lookupValidatedNames returns validated domain names of p.ip as defined by
+// RFC 7208, that is forward-confirmed names of its PTR records. Only the first
+// 10 names are validated, names skipped are reported to PTRListener.
+// https://tools.ietf.org/html/rfc7208#section-5.5
+func (p *parser) lookupValidatedNames(t *token) ([]string, error) {
+	start := p.now()
+	names, extras, err := lookupPTR(p.dns(), p.ip)
+	switch {
+	case errors.Is(err, ErrPTRNotSupported):
+		return nil, nil
+	case errors.Is(err, ErrDNSLimitExceeded):
+		p.fireLookupExtras(t, reverseName(p.ip), extras.spent(p.since(start)))
+		return nil, err
+	case err != nil:
+		// If a DNS error occurs while doing the PTR RR lookup,
+		// then this mechanism fails to match.
+		p.fireLookupExtras(t, reverseName(p.ip), extras.spent(p.since(start)))
+		return nil, nil
+	}
+	var validated []string
+	for i, name := range names {
+		name = NormalizeFQDN(name)
+		if i >= p.limits.PTRNames {
+			p.fireSkippedPTRName(t, name, ErrTooManyPTRNames)
+			continue
+		}
+		// If a DNS error occurs while doing an A RR lookup,
+		// then that domain name is skipped and the search continues.
+		ok, e, err := confirmPTR(p.dns(), name, p.ip)
+		extras = extras.merge(e)
+		switch {
+		case err != nil:
+			p.fireSkippedPTRName(t, name, err)
+		case !ok:
+			p.fireSkippedPTRName(t, name, ErrPTRNotConfirmed)
+		default:
+			validated = append(validated, name)
+		}
+	}
+	p.fireLookupExtras(t, reverseName(p.ip), extras.spent(p.since(start)))
+	return validated, nil
+}
+
+func (p *parser) parsePtr(t *token) (bool, Result, error) {
+	fqdn := domainSpec(t.value, p.domain)
+	fqdn, err := parseMacro(p, fqdn, false)
+	if err == nil {
+		fqdn, err = truncateFQDN(fqdn)
+	}
+	if err == nil && !p.domainProfile.valid(fqdn) {
+		err = newInvalidDomainError(fqdn)
+	}
+	fqdn = NormalizeFQDN(fqdn)
+	p.fireDirective(t, fqdn)
+	if err != nil {
+		return true, Permerror, SyntaxError{t, err}
+	}
+
+	result, _ := matchingResult(t.qualifier)
+	names, err := p.validatedNames(t)
+	if err != nil {
+		return true, Permerror, SyntaxError{t, err}
+	}
+	for _, name := range names {
+		if domainutil.IsSubdomainOf(name, fqdn) {
+			return true, result, nil
+		}
+	}
+	return false, result, nil
+}
+
+// validatedDomain returns the value of %{p} macro: the domain itself, if
+// validated, otherwise its validated subdomain or any validated name.
+// https://tools.ietf.org/html/rfc7208#section-7.3
+func (p *parser) validatedDomain() string {
+	names, err := p.validatedNames(nil)
+	if err != nil || len(names) == 0 {
+		return "unknown"
+	}
+	domain := NormalizeFQDN(p.domain)
+	for _, name := range names {
+		if name == domain {
+			return removeRoot(name)
+		}
+	}
+	for _, name := range names {
+		if domainutil.IsSubdomainOf(name, domain) {
+			return removeRoot(name)
+		}
+	}
+	return removeRoot(names[0])
+}
+
+// reverseName returns the name of PTR records of the ip
+func reverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	ip6 := ip.To16()
+	if ip6 == nil {
+		return ""
+	}
+	b := make([]byte, 0, len("x.")*2*net.IPv6len+len("ip6.arpa."))
+	for i := len(ip6) - 1; i >= 0; i-- {
+		b = append(b, hexDigit[ip6[i]&0xf], '.', hexDigit[ip6[i]>>4], '.')
+	}
+	return string(append(b, "ip6.arpa."...))
+}
+
+// LookupPTR returns names of PTR records of the ip.
+// Returns nil and ErrDNSLimitExceeded if total number of lookups made
+// by underlying resolver exceed the limit.
+func (r *LimitedResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	if !r.canLookup() {
+		return nil, nil, ErrDNSLimitExceeded
+	}
+	return lookupPTR(r.resolver, ip)
+}
+
+// ConfirmPTR checks if address records of the name include the ip, the lookup
+// is not counted, as "ptr" mechanism limits number of names it validates.
+func (r *LimitedResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	return confirmPTR(r.resolver, name, ip)
+}
+
+func (r *retryResolver) LookupPTR(ip net.IP) (v []string, extras *ResponseExtras, err error) {
+	r.retry(ip.String(), func(next Resolver) error {
+		v, extras, err = lookupPTR(next, ip)
+		return err
+	})
+	return
+}
+
+func (r *retryResolver) ConfirmPTR(name string, ip net.IP) (v bool, extras *ResponseExtras, err error) {
+	r.retry(name, func(next Resolver) error {
+		v, extras, err = confirmPTR(next, name, ip)
+		return err
+	})
+	return
+}
+
+func (r *deadlineResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	var (
+		names  []string
+		extras *ResponseExtras
+		err    error
+	)
+	if e := r.do(func() { names, extras, err = lookupPTR(r.resolver, ip) }); e != nil {
+		return nil, nil, e
+	}
+	return names, extras, err
+}
+
+func (r *deadlineResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	var (
+		found  bool
+		extras *ResponseExtras
+		err    error
+	)
+	if e := r.do(func() { found, extras, err = confirmPTR(r.resolver, name, ip) }); e != nil {
+		return false, nil, e
+	}
+	return found, extras, err
+}
+
+func (r *canceledResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	if r.canceled() {
+		return nil, nil, errCanceled
+	}
+	return lookupPTR(r.resolver, ip)
+}
+
+func (r *canceledResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	if r.canceled() {
+		return false, nil, errCanceled
+	}
+	return confirmPTR(r.resolver, name, ip)
+}
+
+func (r *PoolResolver) LookupPTR(ip net.IP) (v []string, extras *ResponseExtras, err error) {
+	err = ErrDNSTemperror
+	r.do(func(next Resolver) error {
+		v, extras, err = lookupPTR(next, ip)
+		return err
+	})
+	return
+}
+
+func (r *PoolResolver) ConfirmPTR(name string, ip net.IP) (v bool, extras *ResponseExtras, err error) {
+	err = ErrDNSTemperror
+	r.do(func(next Resolver) error {
+		v, extras, err = confirmPTR(next, name, ip)
+		return err
+	})
+	return
+}
@@ -0,0 +1,181 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type ptrListener struct {
+	recordingListener
+}
+
+func (l *ptrListener) SkippedPTRName(qualifier, mechanism, value, name string, err error) {
+	l.add("SkippedPTRName(%s%s:%s, %s, %v)", qualifier, mechanism, value, name, err)
+}
+
+func TestParsePtr(t *testing.T) {
+	testResolverCache.Purge()
+
+	ptrs := []string{
+		`1.0.0.10.in-addr.arpa. 0 IN PTR mail.ptr.example.`,
+		`2.0.0.10.in-addr.arpa. 0 IN PTR forged.ptr.example.`,
+	}
+	for i := 1; i <= 11; i++ {
+		// short names to fit the response in 512 bytes
+		ptrs = append(ptrs, fmt.Sprintf(`3.0.0.10.in-addr.arpa. 0 IN PTR h%d.p.x.`, i))
+	}
+	dns.HandleFunc("in-addr.arpa.", zone(map[uint16][]string{
+		dns.TypePTR: ptrs,
+	}))
+	defer dns.HandleRemove("in-addr.arpa.")
+
+	a := []string{`h11.p.x. 0 IN A 10.0.0.3`}
+	for i := 1; i <= 10; i++ {
+		a = append(a, fmt.Sprintf(`h%d.p.x. 0 IN A 10.0.0.9`, i))
+	}
+	dns.HandleFunc("p.x.", zone(map[uint16][]string{
+		dns.TypeA: a,
+	}))
+	defer dns.HandleRemove("p.x.")
+
+	dns.HandleFunc("ptr.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`mail.ptr.example. 0 IN A 10.0.0.1`,
+			`forged.ptr.example. 0 IN A 10.0.0.9`,
+		},
+		dns.TypeTXT: {
+			`ptr.example. 0 IN TXT "v=spf1 ptr ptr:x -all"`,
+			`other.ptr.example. 0 IN TXT "v=spf1 ptr:other.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("ptr.example.")
+
+	tests := []struct {
+		ip     string
+		domain string
+		r      Result
+		events []string
+	}{
+		{"10.0.0.1", "ptr.example", Pass, nil},
+		{"10.0.0.1", "other.ptr.example", Fail, nil},
+		{"10.0.0.2", "ptr.example", Fail,
+			// names are validated once per check
+			[]string{"SkippedPTRName(+ptr:, forged.ptr.example., PTR name doesn't resolve to the address)"}},
+		{"10.0.0.4", "ptr.example", Fail, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ip+"_"+test.domain, func(t *testing.T) {
+			l := &ptrListener{}
+			r, _, _, err := CheckHost(net.ParseIP(test.ip), test.domain, "", WithResolver(testResolver), WithListener(l))
+			if r != test.r || err != nil {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, test.r)
+			}
+			if got := l.filter("SkippedPTRName"); fmt.Sprint(got) != fmt.Sprint(test.events) {
+				t.Errorf("SkippedPTRName events:\n got=%q\nwant=%q", got, test.events)
+			}
+		})
+	}
+
+	t.Run("limit", func(t *testing.T) {
+		l := &ptrListener{}
+		r, _, _, _ := CheckHost(net.ParseIP("10.0.0.3"), "ptr.example", "", WithResolver(testResolver), WithListener(l))
+		if r != Fail {
+			t.Errorf("CheckHost() = %s; want %s", r, Fail)
+		}
+		events := l.filter("SkippedPTRName")
+		if len(events) != 11 || events[10] != "SkippedPTRName(+ptr:, h11.p.x., too many PTR names)" {
+			t.Errorf("SkippedPTRName events = %q; want 10 unconfirmed names and h11 over the limit", events)
+		}
+	})
+}
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.0.2.1", "1.2.0.192.in-addr.arpa."},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+	}
+	for _, test := range tests {
+		if got := reverseName(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("reverseName(%s) = %q; want %q", test.ip, got, test.want)
+		}
+		if want, _ := dns.ReverseAddr(test.ip); want != test.want {
+			t.Errorf("dns.ReverseAddr(%s) = %q; want %q", test.ip, want, test.want)
+		}
+	}
+}
+
+type countingPTRResolver struct {
+	Resolver
+	lookups, confirmations int
+}
+
+func (r *countingPTRResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	r.lookups++
+	return lookupPTR(r.Resolver, ip)
+}
+
+func (r *countingPTRResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	r.confirmations++
+	return confirmPTR(r.Resolver, name, ip)
+}
+
+func TestValidatedNamesMemo(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("in-addr.arpa.", zone(map[uint16][]string{
+		dns.TypePTR: {
+			`1.0.0.10.in-addr.arpa. 0 IN PTR mail.memo.example.`,
+			`1.0.0.10.in-addr.arpa. 0 IN PTR other.example.`,
+		},
+	}))
+	defer dns.HandleRemove("in-addr.arpa.")
+
+	dns.HandleFunc("memo.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`mail.memo.example. 0 IN A 10.0.0.1`,
+		},
+		dns.TypeTXT: {
+			`memo.example. 0 IN TXT "v=spf1 ptr:nomatch.example include:inc.memo.example -all"`,
+			`inc.memo.example. 0 IN TXT "v=spf1 ptr:nomatch.example exists:%{p} -all"`,
+		},
+	}))
+	defer dns.HandleRemove("memo.example.")
+
+	dns.HandleFunc("other.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			`other.example. 0 IN A 10.0.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("other.example.")
+
+	r := &countingPTRResolver{Resolver: testResolver}
+	res, _, _, err := CheckHost(net.ParseIP("10.0.0.1"), "memo.example", "",
+		WithResolver(NewLimitedResolver(r, 10, 10)))
+	if res != Pass || err != nil {
+		t.Errorf("CheckHost() = %s, %v; want %s", res, err, Pass)
+	}
+	// names are validated once for both "ptr" and %{p}
+	if r.lookups != 1 || r.confirmations != 2 {
+		t.Errorf("%d PTR lookups, %d confirmations; want 1, 2", r.lookups, r.confirmations)
+	}
+
+	p := newParser(WithResolver(r)).with("", "", "memo.example", net.ParseIP("10.0.0.1"))
+	if got := p.validatedDomain(); got != "mail.memo.example" {
+		t.Errorf("validatedDomain() = %q; want subdomain of the domain", got)
+	}
+	p.domain = "other.example"
+	if got := p.validatedDomain(); got != "other.example" {
+		t.Errorf("validatedDomain() = %q; want the domain itself", got)
+	}
+	p.ip = net.ParseIP("10.0.0.2")
+	if got := p.validatedDomain(); got != "unknown" {
+		t.Errorf("validatedDomain() = %q; want unknown", got)
+	}
+}
@@ -0,0 +1,130 @@
+package spf
+
+import (
+	"net"
+
+	"github.com/bluele/gcache"
+)
+
+// RecordCache keeps SPF records parsed by evaluation, with networks of their
+// "ip4" and "ip6" mechanisms, so repeated evaluations of the same records,
+// e.g. flattened ones with hundreds of networks, skip lexing and parsing of
+// addresses. Records are keyed by their text, so changes of DNS data never
+// make stale entries used. RecordCache is safe for concurrent use.
+type RecordCache struct {
+	c gcache.Cache
+}
+
+// NewRecordCache returns RecordCache keeping up to size recently used
+// records.
+func NewRecordCache(size int) *RecordCache {
+	return &RecordCache{gcache.New(size).LRU().Build()}
+}
+
+// WithRecordCache makes evaluation take parsed records from c.
+func WithRecordCache(c *RecordCache) Option {
+	return func(p *parser) {
+		p.records = c
+	}
+}
+
+// parsedRecord is a lexed record, its tokens must not be modified as they
+// are shared by evaluations
+type parsedRecord struct {
+	tokens   []*token
+	networks map[*token]ipNetwork
+}
+
+// ipNetwork is the network of "ip4" or "ip6" term, or the error it's
+// malformed with
+type ipNetwork struct {
+	n   net.IPNet
+	err error
+}
+
+// parse returns tokens of the record and networks of its "ip4" and "ip6"
+// terms, c may be nil
+func (c *RecordCache) parse(record string) ([]*token, map[*token]ipNetwork) {
+	if c == nil {
+		return lex(record), nil
+	}
+	if v, err := c.c.Get(record); err == nil {
+		r := v.(*parsedRecord)
+		return r.tokens, r.networks
+	}
+	r := &parsedRecord{tokens: lex(record)}
+	for _, t := range r.tokens {
+		if t.mechanism != tIP4 && t.mechanism != tIP6 {
+			continue
+		}
+		if r.networks == nil {
+			r.networks = make(map[*token]ipNetwork)
+		}
+		n, err := termNetwork(t)
+		r.networks[t] = ipNetwork{n, err}
+	}
+	_ = c.c.Set(record, r)
+	return r.tokens, r.networks
+}
+
+// matchNetwork returns true if the checked IP address is in the network of
+// "ip4" or "ip6" term
+func (p *parser) matchNetwork(t *token) (bool, error) {
+	if n, ok := p.networks[t]; ok {
+		return n.err == nil && n.n.Contains(p.ip), n.err
+	}
+	// parsed addresses don't escape here, unlike in termNetwork
+	notIP := ErrNotIPv4
+	if t.mechanism == tIP6 {
+		notIP = ErrNotIPv6
+	}
+	if ip, ipnet, err := net.ParseCIDR(t.value); err == nil {
+		if t.mechanism == tIP4 && ip.To4() == nil || ip.To16() == nil {
+			return false, notIP
+		}
+		return ipnet.Contains(p.ip), nil
+	}
+
+	ip := net.ParseIP(t.value)
+	if t.mechanism == tIP4 {
+		if ip = ip.To4(); ip == nil {
+			return false, notIP
+		}
+	} else if ip.To4() != nil || ip.To16() == nil {
+		return false, notIP
+	}
+	return ip.Equal(p.ip), nil
+}
+
+// Masks of single addresses
+var (
+	fullMask4 = net.CIDRMask(8*net.IPv4len, 8*net.IPv4len)
+	fullMask6 = net.CIDRMask(8*net.IPv6len, 8*net.IPv6len)
+)
+
+// termNetwork parses value of "ip4" or "ip6" term, single addresses are
+// returned as networks of the full length
+func termNetwork(t *token) (net.IPNet, error) {
+	notIP := ErrNotIPv4
+	if t.mechanism == tIP6 {
+		notIP = ErrNotIPv6
+	}
+	if ip, ipnet, err := net.ParseCIDR(t.value); err == nil {
+		if t.mechanism == tIP4 && ip.To4() == nil || ip.To16() == nil {
+			return net.IPNet{}, notIP
+		}
+		return *ipnet, nil
+	}
+
+	ip := net.ParseIP(t.value)
+	if t.mechanism == tIP4 {
+		if ip = ip.To4(); ip == nil {
+			return net.IPNet{}, notIP
+		}
+		return net.IPNet{IP: ip, Mask: fullMask4}, nil
+	}
+	if ip.To4() != nil || ip.To16() == nil {
+		return net.IPNet{}, notIP
+	}
+	return net.IPNet{IP: ip, Mask: fullMask6}, nil
+}
@@ -0,0 +1,70 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRecordCache(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("recordcache.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`recordcache.example. 300 IN TXT "v=spf1 ip4:10.0.0.1 ip4:10.1.0.0/16 ip6:2001:db8::1 ip6:2001:db8:1::/48 ~all"`,
+		},
+	}))
+	defer dns.HandleRemove("recordcache.example.")
+
+	dns.HandleFunc("bad4.recordcache.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`bad4.recordcache.example. 300 IN TXT "v=spf1 ip4:2001:db8::/32 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("bad4.recordcache.example.")
+
+	dns.HandleFunc("bad6.recordcache.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`bad6.recordcache.example. 300 IN TXT "v=spf1 ip6:10.0.0.1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("bad6.recordcache.example.")
+
+	tests := []struct {
+		ip     string
+		domain string
+		result Result
+	}{
+		{"10.0.0.1", "recordcache.example", Pass},
+		{"10.0.0.2", "recordcache.example", Softfail},
+		{"10.1.2.3", "recordcache.example", Pass},
+		{"2001:db8::1", "recordcache.example", Pass},
+		{"2001:db8::2", "recordcache.example", Softfail},
+		{"2001:db8:1::2", "recordcache.example", Pass},
+		{"::ffff:10.0.0.1", "recordcache.example", Pass},
+		{"10.0.0.1", "bad4.recordcache.example", Permerror},
+		{"10.0.0.1", "bad6.recordcache.example", Permerror},
+	}
+	c := NewRecordCache(10)
+	for _, tt := range tests {
+		t.Run(tt.ip+" "+tt.domain, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			want, _, _, wantErr := CheckHost(ip, tt.domain, "", WithResolver(testResolver))
+			if want != tt.result {
+				t.Fatalf("CheckHost() = %s, %v; want %s", want, wantErr, tt.result)
+			}
+			// the second check takes the record from the cache
+			for i := 0; i < 2; i++ {
+				r, _, _, err := CheckHost(ip, tt.domain, "", WithResolver(testResolver), WithRecordCache(c))
+				if r != want || fmt.Sprint(err) != fmt.Sprint(wantErr) {
+					t.Errorf("CheckHost(WithRecordCache) #%d = %s, %v; want %s, %v", i, r, err, want, wantErr)
+				}
+			}
+		})
+	}
+	if n := c.c.Len(false); n != 3 {
+		t.Errorf("cached %d records; want 3", n)
+	}
+}
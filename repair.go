@@ -0,0 +1,283 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RepairAction is what a Suggestion asks the domain owner to do.
+type RepairAction string
+
+// Actions of suggestions
+const (
+	RepairRemove  RepairAction = "remove"  // remove the term from the record
+	RepairReplace RepairAction = "replace" // replace the term, with Replacement if it is known
+	RepairSplit   RepairAction = "split"   // split the record to fit the limits of lookups
+	RepairMerge   RepairAction = "merge"   // merge SPF records of the domain into one
+)
+
+// Suggestion is a machine-actionable fix of a policy producing "permerror".
+type Suggestion struct {
+	Action      RepairAction `json:"action"`
+	Domain      string       `json:"domain"`                // domain which record to fix
+	Term        string       `json:"term,omitempty"`        // the faulty term as published, if any
+	Replacement string       `json:"replacement,omitempty"` // the term to publish instead, if known
+	Message     string       `json:"message"`               // the fix for humans, e.g. "fix CIDR /33"
+}
+
+func (s Suggestion) String() string {
+	if s.Term == "" {
+		return s.Domain + ": " + s.Message
+	}
+	return s.Domain + ": " + s.Term + ": " + s.Message
+}
+
+// SuggestRepairs returns suggestions fixing the errors found along the path,
+// nil if there are none it knows how to fix.
+func SuggestRepairs(p *Path) []Suggestion {
+	r := &repairs{root: p, seen: make(map[Suggestion]bool)}
+	r.walk(p)
+	return r.s
+}
+
+type repairs struct {
+	root *Path
+	s    []Suggestion
+	seen map[Suggestion]bool
+}
+
+func (r *repairs) add(s Suggestion) {
+	if r.seen[s] {
+		return
+	}
+	r.seen[s] = true
+	r.s = append(r.s, s)
+}
+
+func (r *repairs) walk(p *Path) {
+	if p == nil {
+		return
+	}
+	r.error(p, p.Err)
+	for _, s := range p.Steps {
+		r.error(p, s.Err)
+		r.walk(s.Path)
+	}
+}
+
+// error suggests fixes for the error of the record of the path, errors of
+// nested records are left to the nested paths
+func (r *repairs) error(p *Path, err error) {
+	if err == nil {
+		return
+	}
+	t, cause, ok := Unwrap(err)
+	if !ok {
+		r.recordError(p, err)
+		return
+	}
+	if _, nested := cause.(SyntaxError); nested || t == nil {
+		return
+	}
+	term := t.String()
+	suggest := func(a RepairAction, replacement, message string) {
+		r.add(Suggestion{Action: a, Domain: p.Domain, Term: term, Replacement: replacement, Message: message})
+	}
+	switch {
+	case errors.Is(cause, ErrNotIPv4), errors.Is(cause, ErrNotIPv6), errors.Is(cause, ErrInvalidCIDRLength):
+		if fixed, message := fixNetwork(t); fixed != "" {
+			suggest(RepairReplace, fixed, message)
+		} else {
+			suggest(RepairReplace, "", "fix the address")
+		}
+	case errors.Is(cause, ErrSPFNotFound):
+		suggest(RepairRemove, "", "the domain has no SPF record")
+	case errors.Is(cause, ErrLoopDetected):
+		suggest(RepairRemove, "", "the domain is already evaluated, it makes a loop")
+	case errors.Is(cause, ErrDuplicateAll):
+		suggest(RepairRemove, "", `remove duplicate "all"`)
+	case errors.Is(cause, ErrStrayPunctuation):
+		suggest(RepairReplace, strings.TrimRight(term, ",;"), "remove stray punctuation")
+	case errors.Is(cause, ErrInvalidCharacter):
+		suggest(RepairReplace, "", "use printable ASCII characters only")
+	case errors.Is(cause, ErrTooManyMXNames):
+		suggest(RepairReplace, "", fmt.Sprintf("replace mx with ip4 and ip6 ranges: more than %d MX names", MaxMXNames))
+	case errors.Is(cause, ErrTooManyVoidLookups):
+		r.voidLookups(r.root)
+	case errors.Is(cause, ErrDNSLimitExceeded), errors.Is(cause, ErrTooManyMechanisms), errors.Is(cause, ErrTooDeep):
+		r.split()
+	case errors.Is(cause, ErrSyntaxError), errors.Is(cause, ErrEmptyDomain):
+		if trimmed := strings.TrimRight(term, ",;"); trimmed != term && trimmed != "" {
+			suggest(RepairReplace, trimmed, "remove stray punctuation")
+		} else {
+			suggest(RepairReplace, "", "fix syntax of the term")
+		}
+	}
+}
+
+// recordError suggests fixes for the error of the record as a whole
+func (r *repairs) recordError(p *Path, err error) {
+	switch {
+	case errors.Is(err, ErrTooManySPFRecords):
+		r.add(Suggestion{Action: RepairMerge, Domain: p.Domain, Message: "publish a single SPF record"})
+	case errors.Is(err, ErrTooManyRedirects):
+		r.duplicates(p, tRedirect, `remove duplicate "redirect"`)
+	case errors.Is(err, ErrTooManyExps):
+		r.duplicates(p, tExp, `remove duplicate "exp"`)
+	}
+}
+
+// duplicates suggests removing every term of the type but the first one
+func (r *repairs) duplicates(p *Path, typ tokenType, message string) {
+	var seen bool
+	for _, t := range lex(p.Record) {
+		if t.mechanism != typ {
+			continue
+		}
+		if seen {
+			r.add(Suggestion{Action: RepairRemove, Domain: p.Domain, Term: t.String(), Message: message})
+		}
+		seen = true
+	}
+}
+
+// voidLookups suggests removing the terms which lookups found nothing
+func (r *repairs) voidLookups(p *Path) {
+	if p == nil {
+		return
+	}
+	for _, s := range p.Steps {
+		if s.Cost != nil && s.Cost.VoidLookups > 0 && s.Path == nil {
+			r.add(Suggestion{Action: RepairRemove, Domain: p.Domain, Term: s.Term,
+				Message: "the domain has no addresses, void lookups are limited to " + strconv.Itoa(MaxVoidLookups)})
+		}
+		r.voidLookups(s.Path)
+	}
+}
+
+// split suggests splitting the checked record and replacing "ptr"
+// mechanisms which are costly and discouraged. Lookups are counted in
+// the records evaluated, including the terms not reached.
+func (r *repairs) split() {
+	var (
+		n    int
+		walk func(p *Path)
+	)
+	walk = func(p *Path) {
+		if p == nil {
+			return
+		}
+		for _, t := range lex(p.Record) {
+			switch t.mechanism {
+			case tPTR:
+				r.add(Suggestion{Action: RepairReplace, Domain: p.Domain, Term: t.String(),
+					Message: "replace ptr with ip4 and ip6 ranges"})
+				fallthrough
+			case tA, tMX, tInclude, tExists, tRedirect:
+				n++
+			}
+		}
+		for _, s := range p.Steps {
+			walk(s.Path)
+		}
+	}
+	walk(r.root)
+	message := fmt.Sprintf("split record: more than %d lookups", MaxDNSLookups)
+	if n > MaxDNSLookups {
+		message = fmt.Sprintf("split record: %d lookups > %d", n, MaxDNSLookups)
+	}
+	r.add(Suggestion{Action: RepairSplit, Domain: r.root.Domain, Message: message})
+}
+
+// fixNetwork returns the term with CIDR lengths limited to the sizes of
+// addresses and the mechanism matching the address family, empty string
+// if the term can't be fixed
+func fixNetwork(t *token) (string, string) {
+	f := *t
+	switch t.mechanism {
+	case tIP4, tIP6:
+		addr, length := t.value, ""
+		if i := strings.IndexByte(addr, '/'); i >= 0 {
+			addr, length = addr[:i], addr[i+1:]
+		}
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return "", ""
+		}
+		f.mechanism, f.value = tIP6, addr
+		max := 128
+		if ip.To4() != nil && !strings.Contains(addr, ":") {
+			f.mechanism, max = tIP4, 32
+		}
+		var message string
+		if f.mechanism != t.mechanism {
+			message = fmt.Sprintf("use %s for %s", f.mechanism, addr)
+		}
+		if length != "" {
+			l, ok := fixCIDR(length, max)
+			if l != "" {
+				f.value += "/" + l
+			}
+			if !ok && message == "" {
+				message = fmt.Sprintf("fix CIDR /%s", length)
+			}
+		}
+		if message == "" {
+			return "", ""
+		}
+		return f.String(), message
+	case tA, tMX:
+		i := strings.IndexByte(t.value, '/')
+		if i < 0 {
+			return "", ""
+		}
+		domain, cidr4, cidr6 := t.value[:i], t.value[i:], ""
+		if j := strings.Index(cidr4, "//"); j >= 0 {
+			cidr4, cidr6 = cidr4[:j], cidr4[j+2:]
+		}
+		cidr4 = strings.TrimPrefix(cidr4, "/")
+		f.value = domain
+		var wrong []string
+		if cidr4 != "" {
+			l, ok := fixCIDR(cidr4, 32)
+			if l != "" {
+				f.value += "/" + l
+			}
+			if !ok {
+				wrong = append(wrong, "/"+cidr4)
+			}
+		}
+		if cidr6 != "" {
+			l, ok := fixCIDR(cidr6, 128)
+			if l != "" {
+				f.value += "//" + l
+			}
+			if !ok {
+				wrong = append(wrong, "//"+cidr6)
+			}
+		}
+		if len(wrong) == 0 {
+			return "", ""
+		}
+		return f.String(), "fix CIDR " + strings.Join(wrong, " ")
+	default:
+		return "", ""
+	}
+}
+
+// fixCIDR limits the length to max, the length is dropped if it's not
+// a number; it returns false if the length was fixed
+func fixCIDR(length string, max int) (string, bool) {
+	n, err := strconv.Atoi(length)
+	switch {
+	case err != nil || n < 0 || length[0] == '+' || length[0] == '-':
+		return "", false
+	case n > max:
+		return strconv.Itoa(max), false
+	default:
+		return length, true
+	}
+}
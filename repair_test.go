@@ -0,0 +1,91 @@
+package spf
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSuggestRepairs(t *testing.T) {
+	testResolverCache.Purge()
+
+	zones := map[string][]string{
+		"cidr.repair.example.":  {`"v=spf1 ip4:10.0.0.0/33 -all"`},
+		"a.repair.example.":     {`"v=spf1 a:host.repair.example/33//200 -all"`},
+		"ip6.repair.example.":   {`"v=spf1 ip4:2001:db8::/32 -all"`},
+		"redir.repair.example.": {`"v=spf1 redirect=a.repair.example redirect=cidr.repair.example"`},
+		"inc.repair.example.":   {`"v=spf1 include:none.repair.example -all"`},
+		"two.repair.example.":   {`"v=spf1 -all"`, `"v=spf1 +all"`},
+		"many.repair.example.":  {`"v=spf1 include:two.repair.example -all"`},
+		"void.repair.example.":  {`"v=spf1 a:v1.repair.example a:v2.repair.example a:v3.repair.example -all"`},
+		"stray.repair.example.": {`"v=spf1 a, -all"`},
+		"limit.repair.example.": {`"v=spf1 a:host.repair.example ptr include:l.repair.example include:l.repair.example ` +
+			`include:l.repair.example include:l.repair.example include:l.repair.example include:l.repair.example ` +
+			`include:l.repair.example include:l.repair.example include:l.repair.example include:l.repair.example -all"`},
+		"l.repair.example.": {`"v=spf1 ?all"`},
+	}
+	for name, txt := range zones {
+		var rr []string
+		for _, s := range txt {
+			rr = append(rr, name+" 0 IN TXT "+s)
+		}
+		dns.HandleFunc(name, zone(map[uint16][]string{dns.TypeTXT: rr}))
+		defer dns.HandleRemove(name)
+	}
+	dns.HandleFunc("host.repair.example.", zone(map[uint16][]string{
+		dns.TypeA: {"host.repair.example. 0 IN A 192.0.2.1"},
+	}))
+	defer dns.HandleRemove("host.repair.example.")
+
+	dns.HandleFunc("none.repair.example.", zone(map[uint16][]string{}))
+	defer dns.HandleRemove("none.repair.example.")
+
+	tests := []struct {
+		domain string
+		want   []Suggestion
+	}{
+		{"cidr.repair.example", []Suggestion{
+			{RepairReplace, "cidr.repair.example.", "ip4:10.0.0.0/33", "ip4:10.0.0.0/32", "fix CIDR /33"}}},
+		{"a.repair.example", []Suggestion{
+			{RepairReplace, "a.repair.example.", "a:host.repair.example/33//200", "a:host.repair.example/32//128",
+				"fix CIDR /33 //200"}}},
+		{"ip6.repair.example", []Suggestion{
+			{RepairReplace, "ip6.repair.example.", "ip4:2001:db8::/32", "ip6:2001:db8::/32", "use ip6 for 2001:db8::"}}},
+		{"redir.repair.example", []Suggestion{
+			{RepairRemove, "redir.repair.example.", "redirect=cidr.repair.example", "", `remove duplicate "redirect"`}}},
+		{"inc.repair.example", []Suggestion{
+			{RepairRemove, "inc.repair.example.", "include:none.repair.example", "", "the domain has no SPF record"}}},
+		{"many.repair.example", []Suggestion{
+			{RepairMerge, "two.repair.example.", "", "", "publish a single SPF record"}}},
+		{"void.repair.example", []Suggestion{
+			{RepairRemove, "void.repair.example.", "a:v1.repair.example", "", "the domain has no addresses, void lookups are limited to 2"},
+			{RepairRemove, "void.repair.example.", "a:v2.repair.example", "", "the domain has no addresses, void lookups are limited to 2"},
+			{RepairRemove, "void.repair.example.", "a:v3.repair.example", "", "the domain has no addresses, void lookups are limited to 2"}}},
+		{"stray.repair.example", []Suggestion{
+			{RepairReplace, "stray.repair.example.", "a,", "a", "remove stray punctuation"}}},
+		{"limit.repair.example", []Suggestion{
+			{RepairReplace, "limit.repair.example.", "ptr", "", "replace ptr with ip4 and ip6 ranges"},
+			{RepairSplit, "limit.repair.example.", "", "", "split record: 12 lookups > 10"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			r := CheckHostDetailed(net.ParseIP("203.0.113.1"), tt.domain, "john@"+tt.domain,
+				WithResolver(NewLimitedResolver(testResolver, 11, 10)))
+			if r.Result != Permerror {
+				t.Fatalf("Result = %s, %v; want permerror", r.Result, r.Err)
+			}
+			if !reflect.DeepEqual(r.Suggestions, tt.want) {
+				t.Errorf("Suggestions =\n%q\nwant\n%q", r.Suggestions, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestRepairs_pass(t *testing.T) {
+	p := &Path{Domain: "example.com.", Result: Pass, Steps: []*Step{{Term: "ip4:192.0.2.0/24", Matched: true, Result: Pass}}}
+	if got := SuggestRepairs(p); got != nil {
+		t.Errorf("SuggestRepairs() = %q; want nil", got)
+	}
+}
@@ -0,0 +1,199 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidReportModifier is returned when "ra", "rp" or "rr" modifier
+// of RFC 6652 is malformed.
+var ErrInvalidReportModifier = errors.New("invalid failure reporting modifier")
+
+// ReportType is a set of results the domain owner requested failure reports
+// for with "rr" modifier.
+// https://tools.ietf.org/html/rfc6652#section-3
+type ReportType uint8
+
+const (
+	ReportErrors   ReportType = 1 << iota // "e", permerror and temperror
+	ReportFail                            // "f", fail
+	ReportSoftfail                        // "s", softfail
+	ReportNeutral                         // "n", neutral and none
+
+	ReportAll = ReportErrors | ReportFail | ReportSoftfail | ReportNeutral // "all"
+)
+
+// ReportRequest is the failure reporting request published by the domain
+// owner with RFC 6652 modifiers.
+type ReportRequest struct {
+	Address    string     `json:"address"`    // where reports go, "ra" value at the domain
+	Percentage int        `json:"percentage"` // "rp", share of failures to report, 100 by default
+	Types      ReportType `json:"types"`      // "rr", ReportAll by default
+}
+
+// ParseReportRequest builds ReportRequest from modifiers of the SPF record of
+// the domain. It returns nil when the record doesn't ask for reports, that is
+// has no "ra" modifier.
+func ParseReportRequest(domain string, modifiers []Modifier) (*ReportRequest, error) {
+	var (
+		q    = &ReportRequest{Percentage: 100, Types: ReportAll}
+		ra   string
+		seen = make(map[string]bool)
+	)
+	for _, m := range modifiers {
+		switch m.Name {
+		case "ra", "rp", "rr":
+		default:
+			continue
+		}
+		if seen[m.Name] {
+			return nil, fmt.Errorf("%w: repeated %q", ErrInvalidReportModifier, m.Name)
+		}
+		seen[m.Name] = true
+
+		switch m.Name {
+		case "ra":
+			if m.Value == "" || strings.ContainsAny(m.Value, "@% \t") {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidReportModifier, m)
+			}
+			ra = m.Value
+		case "rp":
+			n, err := strconv.Atoi(m.Value)
+			if err != nil || n < 0 || n > 100 || m.Value[0] == '+' || m.Value[0] == '-' {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidReportModifier, m)
+			}
+			q.Percentage = n
+		case "rr":
+			q.Types = 0
+			for _, s := range strings.Split(m.Value, ":") {
+				t, ok := reportTypes[strings.ToLower(s)]
+				if !ok {
+					return nil, fmt.Errorf("%w: %s", ErrInvalidReportModifier, m)
+				}
+				q.Types |= t
+			}
+		}
+	}
+	if ra == "" {
+		return nil, nil
+	}
+	q.Address = ra + "@" + strings.TrimSuffix(NormalizeFQDN(domain), ".")
+	return q, nil
+}
+
+var reportTypes = map[string]ReportType{
+	"all": ReportAll,
+	"e":   ReportErrors,
+	"f":   ReportFail,
+	"s":   ReportSoftfail,
+	"n":   ReportNeutral,
+}
+
+// Wants returns true if reports for the result were requested.
+func (q *ReportRequest) Wants(r Result) bool {
+	if q == nil {
+		return false
+	}
+	switch r {
+	case Fail:
+		return q.Types&ReportFail != 0
+	case Softfail:
+		return q.Types&ReportSoftfail != 0
+	case Neutral, None:
+		return q.Types&ReportNeutral != 0
+	case Permerror, Temperror:
+		return q.Types&ReportErrors != 0
+	default:
+		return false
+	}
+}
+
+// FailureReport is a skeleton of RFC 6591 authentication failure report.
+// String renders machine readable "message/feedback-report" part of it;
+// composing and sending the whole message is up to the caller.
+type FailureReport struct {
+	To               string `json:"to"`                  // report recipient, see ReportRequest.Address
+	Percentage       int    `json:"percentage"`          // share of failures to report, sampling is up to the caller
+	UserAgent        string `json:"userAgent,omitempty"` // name of the reporting software
+	ReportedDomain   string `json:"reportedDomain"`      // domain which requested the report
+	Result           Result `json:"result"`              // the result
+	SourceIP         net.IP `json:"sourceIp,omitempty"`  // the IP address of the SMTP client
+	OriginalMailFrom string `json:"mailFrom,omitempty"`  // the envelope sender mailbox
+	Receiver         string `json:"receiver,omitempty"`  // the host name of the SPF verifier
+}
+
+// String renders the fields of the report. Control characters of the values
+// are replaced with spaces, as in "Received-SPF" field of Trace.
+func (f *FailureReport) String() string {
+	if f == nil {
+		return ""
+	}
+	var b strings.Builder
+	field := func(k, v string) {
+		if v == "" {
+			return
+		}
+		b.WriteString(k)
+		b.WriteString(": ")
+		// control characters, e.g. CR and LF of a forged sender, would
+		// inject fields
+		b.WriteString(escapeText(v, ""))
+		b.WriteString("\r\n")
+	}
+	ua := f.UserAgent
+	if ua == "" {
+		ua = "redsift-spf"
+	}
+	field("Feedback-Type", "auth-failure")
+	field("User-Agent", ua)
+	field("Version", "1")
+	field("Auth-Failure", "spf")
+	if f.OriginalMailFrom != "" {
+		field("Original-Mail-From", "<"+f.OriginalMailFrom+">")
+	}
+	if f.SourceIP != nil {
+		field("Source-IP", f.SourceIP.String())
+	}
+	field("Reported-Domain", f.ReportedDomain)
+
+	ar := "spf=" + f.Result.String()
+	if f.Receiver != "" {
+		ar = f.Receiver + "; " + ar
+	}
+	if f.OriginalMailFrom != "" {
+		ar += " smtp.mailfrom=" + f.OriginalMailFrom
+	}
+	field("Authentication-Results", ar)
+	return b.String()
+}
+
+// ReportRequest returns failure reporting request of the checked domain's
+// record, or nil when the record doesn't ask for reports.
+// Reporting modifiers of included records are not taken into account.
+func (r *CheckResult) ReportRequest() (*ReportRequest, error) {
+	if r.Path == nil {
+		return nil, nil
+	}
+	return ParseReportRequest(r.Path.Domain, r.Modifiers)
+}
+
+// FailureReport returns a skeleton of the report to send if the checked
+// domain requested reports for the result, nil otherwise.
+func (r *CheckResult) FailureReport() (*FailureReport, error) {
+	q, err := r.ReportRequest()
+	if err != nil || !q.Wants(r.Result) {
+		return nil, err
+	}
+	return &FailureReport{
+		To:               q.Address,
+		Percentage:       q.Percentage,
+		ReportedDomain:   strings.TrimSuffix(r.Path.Domain, "."),
+		Result:           r.Result,
+		SourceIP:         r.Trace.ClientIP,
+		OriginalMailFrom: r.Trace.EnvelopeFrom,
+		Receiver:         r.Trace.Receiver,
+	}, nil
+}
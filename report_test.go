@@ -0,0 +1,135 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseReportRequest(t *testing.T) {
+	tests := []struct {
+		modifiers []Modifier
+		want      *ReportRequest
+		err       bool
+	}{
+		{nil, nil, false},
+		{[]Modifier{{"rp", "10"}}, nil, false},
+		{[]Modifier{{"ra", "abuse"}}, &ReportRequest{"abuse@example.com", 100, ReportAll}, false},
+		{[]Modifier{{"ra", "abuse"}, {"rp", "0"}, {"rr", "e:F"}, {"foo", "bar"}}, &ReportRequest{"abuse@example.com", 0, ReportErrors | ReportFail}, false},
+		{[]Modifier{{"rr", "s"}, {"ra", "spf-reports"}}, &ReportRequest{"spf-reports@example.com", 100, ReportSoftfail}, false},
+		{[]Modifier{{"ra", ""}}, nil, true},
+		{[]Modifier{{"ra", "abuse@example.net"}}, nil, true},
+		{[]Modifier{{"ra", "%{l}"}}, nil, true},
+		{[]Modifier{{"ra", "abuse"}, {"ra", "postmaster"}}, nil, true},
+		{[]Modifier{{"ra", "abuse"}, {"rp", "101"}}, nil, true},
+		{[]Modifier{{"ra", "abuse"}, {"rp", "+5"}}, nil, true},
+		{[]Modifier{{"ra", "abuse"}, {"rp", ""}}, nil, true},
+		{[]Modifier{{"ra", "abuse"}, {"rr", "f:x"}}, nil, true},
+		{[]Modifier{{"ra", "abuse"}, {"rr", ""}}, nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseReportRequest("Example.COM.", test.modifiers)
+		if test.err != (err != nil) || test.err && !errors.Is(err, ErrInvalidReportModifier) {
+			t.Errorf("ParseReportRequest(%v) error = %v; want error %t", test.modifiers, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseReportRequest(%v) = %+v; want %+v", test.modifiers, got, test.want)
+		}
+	}
+}
+
+func TestReportRequest_Wants(t *testing.T) {
+	q := &ReportRequest{Types: ReportFail | ReportNeutral}
+	for r, want := range map[Result]bool{
+		Pass:      false,
+		Fail:      true,
+		Softfail:  false,
+		Neutral:   true,
+		None:      true,
+		Permerror: false,
+		Temperror: false,
+	} {
+		if got := q.Wants(r); got != want {
+			t.Errorf("Wants(%s) = %t; want %t", r, got, want)
+		}
+	}
+	if (*ReportRequest)(nil).Wants(Fail) {
+		t.Error("nil ReportRequest wants reports")
+	}
+}
+
+func TestCheckResult_FailureReport(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("report.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`report.example. 0 IN TXT "v=spf1 include:inc.report.example ip4:10.0.1.0/24 -all ra=spf-abuse rp=25 rr=f"`,
+		},
+	}))
+	defer dns.HandleRemove("report.example.")
+
+	dns.HandleFunc("inc.report.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.report.example. 0 IN TXT "v=spf1 ip4:10.0.0.0/24 ~all ra=inc-abuse"`,
+		},
+	}))
+	defer dns.HandleRemove("inc.report.example.")
+
+	check := func(ip string) *CheckResult {
+		return CheckHostDetailed(net.ParseIP(ip), "report.example", "john@report.example",
+			WithResolver(testResolver), ReceivingFQDN("mx.example.net"))
+	}
+
+	for _, ip := range []string{"10.0.0.1", "10.0.1.1"} {
+		if f, err := check(ip).FailureReport(); f != nil || err != nil {
+			t.Errorf("FailureReport() for %s = %v, %v; want nil", ip, f, err)
+		}
+	}
+
+	r := check("10.0.2.1")
+	if r.Result != Fail {
+		t.Fatalf("Result = %s; want fail", r.Result)
+	}
+	f, err := r.FailureReport()
+	if err != nil {
+		t.Fatalf("FailureReport() error = %v", err)
+	}
+	if f.To != "spf-abuse@report.example" || f.Percentage != 25 {
+		t.Errorf("FailureReport() = %+v", f)
+	}
+	want := "Feedback-Type: auth-failure\r\n" +
+		"User-Agent: redsift-spf\r\n" +
+		"Version: 1\r\n" +
+		"Auth-Failure: spf\r\n" +
+		"Original-Mail-From: <john@report.example>\r\n" +
+		"Source-IP: 10.0.2.1\r\n" +
+		"Reported-Domain: report.example\r\n" +
+		"Authentication-Results: mx.example.net; spf=fail smtp.mailfrom=john@report.example\r\n"
+	if got := f.String(); got != want {
+		t.Errorf("String() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFailureReport_String(t *testing.T) {
+	f := &FailureReport{
+		UserAgent:        "agent\r\nX-Injected: ua",
+		ReportedDomain:   "report.example\n",
+		Result:           Fail,
+		OriginalMailFrom: "john@report.example>\r\nX-Injected: from",
+		Receiver:         "mx.example.net\x00",
+	}
+	want := "Feedback-Type: auth-failure\r\n" +
+		"User-Agent: agent  X-Injected: ua\r\n" +
+		"Version: 1\r\n" +
+		"Auth-Failure: spf\r\n" +
+		"Original-Mail-From: <john@report.example>  X-Injected: from>\r\n" +
+		"Reported-Domain: report.example \r\n" +
+		"Authentication-Results: mx.example.net ; spf=fail smtp.mailfrom=john@report.example>  X-Injected: from\r\n"
+	if got := f.String(); got != want {
+		t.Errorf("String() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -11,6 +11,7 @@ type LimitedResolver struct {
 	lookupLimit    int32
 	mxQueriesLimit uint16
 	resolver       Resolver
+	shared         *LimitedResolver // the resolver charged for lookups, see WithContext
 }
 
 // NewLimitedResolver returns a resolver which will pass up to lookupLimit calls to r.
@@ -26,13 +27,30 @@ func NewLimitedResolver(r Resolver, lookupLimit, mxQueriesLimit uint16) Resolver
 	}
 }
 
+// LimitedResolverFactory returns the function creating a new LimitedResolver
+// of r for every call, to be used with WithResolverFactory so every check
+// gets the limits of its own.
+func LimitedResolverFactory(r Resolver, lookupLimit, mxQueriesLimit uint16) func() Resolver {
+	return func() Resolver {
+		return NewLimitedResolver(r, lookupLimit, mxQueriesLimit)
+	}
+}
+
 func (r *LimitedResolver) canLookup() bool {
-	return atomic.AddInt32(&r.lookupLimit, -1) > 0
+	return atomic.AddInt32(&r.limits().lookupLimit, -1) > 0
+}
+
+// limits returns the resolver keeping the limits of r
+func (r *LimitedResolver) limits() *LimitedResolver {
+	if r.shared != nil {
+		return r.shared
+	}
+	return r
 }
 
 // LookupTXT returns the DNS TXT records for the given domain name.
 // Used for "exp" modifier and do not cause DNS query.
-func (r *LimitedResolver) LookupTXT(name string) ([]string, error) {
+func (r *LimitedResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
 	return r.resolver.LookupTXT(name)
 }
 
@@ -41,9 +59,9 @@ func (r *LimitedResolver) LookupTXT(name string) ([]string, error) {
 // by underlying resolver exceed the limit.
 // It will also return ErrDNSPermerror upon DNS call return error NXDOMAIN
 // (RCODE 3)
-func (r *LimitedResolver) LookupTXTStrict(name string) ([]string, error) {
+func (r *LimitedResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
 	if !r.canLookup() {
-		return nil, ErrDNSLimitExceeded
+		return nil, nil, ErrDNSLimitExceeded
 	}
 	return r.resolver.LookupTXTStrict(name)
 }
@@ -53,9 +71,9 @@ func (r *LimitedResolver) LookupTXTStrict(name string) ([]string, error) {
 // mechanism matches.
 // Returns false and ErrDNSLimitExceeded if total number of lookups made
 // by underlying resolver exceed the limit.
-func (r *LimitedResolver) Exists(name string) (bool, error) {
+func (r *LimitedResolver) Exists(name string) (bool, *ResponseExtras, error) {
 	if !r.canLookup() {
-		return false, ErrDNSLimitExceeded
+		return false, nil, ErrDNSLimitExceeded
 	}
 	return r.resolver.Exists(name)
 }
@@ -66,9 +84,9 @@ func (r *LimitedResolver) Exists(name string) (bool, error) {
 // If any address matches, the mechanism matches
 // Returns false and ErrDNSLimitExceeded if total number of lookups made
 // by underlying resolver exceed the limit.
-func (r *LimitedResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, error) {
+func (r *LimitedResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
 	if !r.canLookup() {
-		return false, ErrDNSLimitExceeded
+		return false, nil, ErrDNSLimitExceeded
 	}
 	return r.resolver.MatchIP(name, matcher)
 }
@@ -85,9 +103,9 @@ func (r *LimitedResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, err
 //
 // Returns false and ErrDNSLimitExceeded if total number of lookups made
 // by underlying resolver exceed the limit.
-func (r *LimitedResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, error) {
+func (r *LimitedResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
 	if !r.canLookup() {
-		return false, ErrDNSLimitExceeded
+		return false, nil, ErrDNSLimitExceeded
 	}
 
 	limit := int32(r.mxQueriesLimit)
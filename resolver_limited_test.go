@@ -1,6 +1,7 @@
 package spf
 
 import (
+	"errors"
 	"net"
 	"testing"
 
@@ -38,22 +39,22 @@ func TestLimitedResolver(t *testing.T) {
 
 	{
 		r := NewLimitedResolver(testResolver, 2, 2)
-		a, err := r.LookupTXT("domain.")
+		a, _, err := r.LookupTXT("domain.")
 		if len(a) == 0 || err != nil {
 			t.Error("failed on 1st LookupTXT")
 		}
-		a, err = r.LookupTXT("domain.")
+		a, _, err = r.LookupTXT("domain.")
 		if len(a) == 1 && err != nil {
 			t.Errorf("failed on 2nd LookupTXT with %v", err)
 		}
 	}
 	{
 		r := NewLimitedResolver(testResolver, 2, 2)
-		b, err := r.Exists("domain.")
+		b, _, err := r.Exists("domain.")
 		if !b || err != nil {
 			t.Error("failed on 1st Exists")
 		}
-		b, err = r.Exists("domain.")
+		b, _, err = r.Exists("domain.")
 		if b || err != ErrDNSLimitExceeded {
 			t.Error("failed on 2nd Exists")
 		}
@@ -65,31 +66,71 @@ func TestLimitedResolver(t *testing.T) {
 	}
 	{
 		r := NewLimitedResolver(testResolver, 2, 2)
-		b, err := r.MatchIP("domain.", newMatcher(net.ParseIP("10.0.0.1")))
+		b, _, err := r.MatchIP("domain.", newMatcher(net.ParseIP("10.0.0.1")))
 		if !b || err != nil {
 			t.Error("failed on 1st MatchIP")
 		}
-		b, err = r.MatchIP("domain.", newMatcher(net.ParseIP("10.0.0.1")))
+		b, _, err = r.MatchIP("domain.", newMatcher(net.ParseIP("10.0.0.1")))
 		if b || err != ErrDNSLimitExceeded {
 			t.Error("failed on 2nd MatchIP")
 		}
 	}
 	{
 		r := NewLimitedResolver(testResolver, 2, 2)
-		b, err := r.MatchMX("domain.", newMatcher(net.ParseIP("10.0.0.1")))
+		b, _, err := r.MatchMX("domain.", newMatcher(net.ParseIP("10.0.0.1")))
 		if !b || err != nil {
 			t.Error("failed on 1st MatchMX")
 		}
-		b, err = r.MatchMX("domain.", newMatcher(net.ParseIP("10.0.0.1")))
+		b, _, err = r.MatchMX("domain.", newMatcher(net.ParseIP("10.0.0.1")))
 		if b || err != ErrDNSLimitExceeded {
 			t.Error("failed on 2nd MatchMX")
 		}
 	}
 	{
 		r := NewLimitedResolver(testResolver, 2, 2)
-		b, err := r.MatchMX("mxmustfail.", newMatcher(net.ParseIP("10.0.0.10")))
+		b, _, err := r.MatchMX("mxmustfail.", newMatcher(net.ParseIP("10.0.0.10")))
 		if b || err != ErrDNSLimitExceeded {
 			t.Errorf("MatchMX got: %v, %v; want false, ErrDNSLimitExceeded", b, err)
 		}
 	}
 }
+
+func TestWithResolverFactory(t *testing.T) {
+	r, err := NewOverlayResolver(testResolver, map[string][]string{
+		"limited.example":     {"v=spf1 include:inc.limited.example -all"},
+		"inc.limited.example": {"v=spf1 ip4:192.0.2.0/24 -all"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(opts ...Option) (Result, error) {
+		res, _, _, err := CheckHost(net.ParseIP("203.0.113.1"), "limited.example", "", opts...)
+		return res, err
+	}
+
+	// a limiter shared by the checks shares its limit
+	shared := WithResolver(NewLimitedResolver(r, 4, 10))
+	if res, err := check(shared); res != Fail || err != nil {
+		t.Errorf("1st check with shared limiter = %s, %v; want fail", res, err)
+	}
+	if res, err := check(shared); res != Permerror || !errors.Is(err, ErrDNSLimitExceeded) {
+		t.Errorf("2nd check with shared limiter = %s, %v; want permerror", res, err)
+	}
+
+	var calls int
+	factory := WithResolverFactory(func() Resolver {
+		calls++
+		return NewLimitedResolver(r, 4, 10)
+	})
+	for i := 0; i < 3; i++ {
+		if res, err := check(shared, factory); res != Fail || err != nil {
+			t.Errorf("check %d with factory = %s, %v; want fail", i, res, err)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("factory calls = %d; want 3", calls)
+	}
+	if res, err := check(WithResolverFactory(LimitedResolverFactory(r, 2, 10))); res != Permerror || err == nil {
+		t.Errorf("check with LimitedResolverFactory(2) = %s, %v; want permerror", res, err)
+	}
+}
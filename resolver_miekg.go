@@ -23,7 +23,20 @@ func MiekgDNSParallelism(n int) MiekgDNSResolverOption {
 	}
 }
 
+// MiekgDNSCache makes the resolver cache responses in gcache.Cache,
+// see MiekgDNSResponseCache.
 func MiekgDNSCache(c gcache.Cache) MiekgDNSResolverOption {
+	return func(r *miekgDNSResolver) {
+		if c == nil {
+			return
+		}
+		r.cache = GCacheDNSCache(c)
+	}
+}
+
+// MiekgDNSResponseCache makes the resolver cache responses in c for their
+// TTL (see MiekgDNSMinSaneTTL and MiekgDNSMaxSaneTTL).
+func MiekgDNSResponseCache(c DNSCache) MiekgDNSResolverOption {
 	return func(r *miekgDNSResolver) {
 		if c == nil {
 			return
@@ -44,6 +57,71 @@ func MiekgDNSClient(c *dns.Client) MiekgDNSResolverOption {
 	}
 }
 
+// MiekgDNSMinSaneTTL sets the minimal time responses are cached for, raising
+// lower TTLs, including zero ones. Responses with TTL 0 are not cached by
+// default.
+func MiekgDNSMinSaneTTL(d time.Duration) MiekgDNSResolverOption {
+	return func(r *miekgDNSResolver) {
+		if d < 0 {
+			return
+		}
+		r.minTTL = d
+	}
+}
+
+// MiekgDNSMaxSaneTTL sets the maximal time responses are cached for, lowering
+// higher TTLs. TTLs are not limited by default.
+func MiekgDNSMaxSaneTTL(d time.Duration) MiekgDNSResolverOption {
+	return func(r *miekgDNSResolver) {
+		if d <= 0 {
+			return
+		}
+		r.maxTTL = d
+	}
+}
+
+// MiekgDNSRefresh makes the resolver refresh cached responses of frequently
+// asked questions before they expire, so lookups of hot domains are served
+// from cache without waiting for the upstream: a response served from cache
+// at least hits times since it was cached is queried again in background by
+// the lookup finding less than ahead left to its expiry. Requires MiekgDNSCache.
+func MiekgDNSRefresh(hits int, ahead time.Duration) MiekgDNSResolverOption {
+	return func(r *miekgDNSResolver) {
+		if hits < 1 || ahead <= 0 {
+			return
+		}
+		r.refreshHits, r.refreshAhead = hits, ahead
+	}
+}
+
+// MiekgDNSClock makes the resolver track expiration of cached responses (see
+// MiekgDNSRefresh and SaveTo) by the time of c, SystemClock by default.
+// Expiration of responses in the cache itself is up to the cache, e.g.
+// gcache.Cache uses the Clock given to its builder.
+func MiekgDNSClock(c Clock) MiekgDNSResolverOption {
+	return func(r *miekgDNSResolver) {
+		if c == nil {
+			return
+		}
+		r.clock = c
+	}
+}
+
+// MiekgDNSMaxCNAMEChain limits the number of CNAME records followed to
+// reach the records of a name, 8 by default. Responses with longer chains
+// fail with ErrTooManyCNAMEs. Zero disables the limit.
+func MiekgDNSMaxCNAMEChain(n int) MiekgDNSResolverOption {
+	return func(r *miekgDNSResolver) {
+		if n < 0 {
+			return
+		}
+		r.maxCNAMEs = n
+	}
+}
+
+// defaultMaxCNAMEs is the default of MiekgDNSMaxCNAMEChain
+const defaultMaxCNAMEs = 8
+
 // NewMiekgDNSResolver returns new instance of Resolver with default dns.Client
 func NewMiekgDNSResolver(addr string, opts ...MiekgDNSResolverOption) (*miekgDNSResolver, error) {
 	if _, _, e := net.SplitHostPort(addr); e != nil {
@@ -56,31 +134,59 @@ func NewMiekgDNSResolver(addr string, opts ...MiekgDNSResolverOption) (*miekgDNS
 		},
 		serverAddr: addr,
 		cache:      nil,
+		clock:      SystemClock,
+		maxCNAMEs:  defaultMaxCNAMEs,
 	}
 	for _, opt := range opts {
 		opt(r)
 	}
+	if r.snapshot != nil && r.cache != nil {
+		if err := r.snapshot.start(r); err != nil {
+			return nil, err
+		}
+	}
 	return r, nil
 }
 
 // miekgDNSResolver implements Resolver using github.com/miekg/dns
 type miekgDNSResolver struct {
-	mu          sync.Mutex
-	dnsClients map[string]*dns.Client
-	cache       gcache.Cache
+	dnsClients  map[string]*dns.Client
+	cache       DNSCache
 	serverAddr  string
 	parallelism int
+	minTTL      time.Duration // see MiekgDNSMinSaneTTL
+	maxTTL      time.Duration // see MiekgDNSMaxSaneTTL
+
+	refreshHits  int           // see MiekgDNSRefresh
+	refreshAhead time.Duration // see MiekgDNSRefresh
+	snapshot     *snapshot     // see MiekgDNSSnapshot
+	clock        Clock
+	maxCNAMEs    int // see MiekgDNSMaxCNAMEChain
+
+	mu      sync.Mutex
+	flights map[dns.Question]*flight // exchanges in progress
+	usage   map[dns.Question]*usage  // cached responses, if refreshed
+	pruneAt int                      // size of usage to drop expired entries at
+}
+
+// flight is an exchange in progress, shared by identical requests
+type flight struct {
+	done chan struct{}
+	res  *dns.Msg
+	err  error
 }
 
 func (r *miekgDNSResolver) cachedResponse(req *dns.Msg) (*dns.Msg, bool) {
 	if r.cache == nil {
 		return nil, false
 	}
-	res, err := r.cache.Get(req.Question[0]) // dns.Question is comparable https://golang.org/ref/spec#Comparison_operators
-	if err != nil {
+	res, ok := r.cache.Get(req.Question[0])
+	if !ok {
+		r.forget(req.Question[0])
 		return nil, false
 	}
-	return res.(*dns.Msg), true
+	r.hit(req.Question[0])
+	return res, true
 }
 
 const maxUint32 = 1<<32 - 1
@@ -89,21 +195,57 @@ func (r *miekgDNSResolver) CacheResponse(res *dns.Msg) {
 	if r.cache == nil {
 		return
 	}
-	if len(res.Answer) == 0 {
-		// TODO get TTL from SOA and limit it between 60s and 3600s
-		_ = r.cache.SetWithExpire(res.Question[0], res, 60*time.Second)
+	if res.Rcode != dns.RcodeSuccess && res.Rcode != dns.RcodeNameError {
 		return
 	}
 	var ttl uint32 = maxUint32
+	if len(res.Answer) == 0 {
+		// void response: NXDOMAIN or NOERROR without answers
+		ttl = negativeTTL(res)
+	}
 	for _, a := range res.Answer {
 		if d := a.Header().Ttl; d < ttl {
 			ttl = d
 		}
 	}
-	if ttl == 0 {
+	d := r.saneTTL(time.Duration(ttl) * time.Second)
+	if d == 0 {
 		return
 	}
-	_ = r.cache.SetWithExpire(res.Question[0], res, time.Duration(ttl)*time.Second)
+	if r.cache.Set(res.Question[0], res, d) == nil {
+		r.cached(res.Question[0], d)
+	}
+}
+
+// defaultNegativeTTL is used for void responses without SOA record
+const defaultNegativeTTL = 60
+
+// negativeTTL returns TTL of the void response in seconds: the lower of TTL
+// and MINIMUM of SOA record in authority section as RFC 2308 defines.
+// https://tools.ietf.org/html/rfc2308#section-5
+func negativeTTL(res *dns.Msg) uint32 {
+	for _, rr := range res.Ns {
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+		if soa.Minttl < soa.Hdr.Ttl {
+			return soa.Minttl
+		}
+		return soa.Hdr.Ttl
+	}
+	return defaultNegativeTTL
+}
+
+// saneTTL clamps the TTL between MiekgDNSMinSaneTTL and MiekgDNSMaxSaneTTL
+func (r *miekgDNSResolver) saneTTL(d time.Duration) time.Duration {
+	if d < r.minTTL {
+		d = r.minTTL
+	}
+	if r.maxTTL > 0 && d > r.maxTTL {
+		d = r.maxTTL
+	}
+	return d
 }
 
 // If the DNS lookup returns a server failure (RCODE 2) or some other
@@ -117,12 +259,49 @@ func (r *miekgDNSResolver) CacheResponse(res *dns.Msg) {
 // server returns "Name Error" (RCODE 3), then evaluation of the
 // mechanism continues as if the server returned no error (RCODE 0) and
 // zero answer records.
-func (r *miekgDNSResolver) exchange(req *dns.Msg) (*dns.Msg, error) {
+//
+// exchange reports whether the response was served from cache.
+func (r *miekgDNSResolver) exchange(req *dns.Msg) (*dns.Msg, bool, error) {
+	res, cached, err := r.sharedExchange(req)
+	if err == nil && r.maxCNAMEs > 0 && len(cnameChain(res)) > r.maxCNAMEs {
+		return res, cached, ErrTooManyCNAMEs
+	}
+	return res, cached, err
+}
+
+// sharedExchange answers from cache or shares the exchange with identical
+// questions asked concurrently
+func (r *miekgDNSResolver) sharedExchange(req *dns.Msg) (*dns.Msg, bool, error) {
 	if res, found := r.cachedResponse(req); found {
-		return res, nil
+		return res, true, nil
 	}
+
+	// identical questions asked concurrently share the exchange
+	q := req.Question[0]
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	if f, ok := r.flights[q]; ok {
+		r.mu.Unlock()
+		<-f.done
+		return f.res, false, f.err
+	}
+	f := &flight{done: make(chan struct{})}
+	if r.flights == nil {
+		r.flights = make(map[dns.Question]*flight)
+	}
+	r.flights[q] = f
+	r.mu.Unlock()
+
+	f.res, f.err = r.query(req)
+
+	r.mu.Lock()
+	delete(r.flights, q)
+	r.mu.Unlock()
+	close(f.done)
+	return f.res, false, f.err
+}
+
+// query sends the request upstream, the response is cached
+func (r *miekgDNSResolver) query(req *dns.Msg) (*dns.Msg, error) {
 	var (
 		res *dns.Msg
 		err error
@@ -141,25 +320,83 @@ func (r *miekgDNSResolver) exchange(req *dns.Msg) (*dns.Msg, error) {
 	if err != nil {
 		return nil, ErrDNSTemperror
 	}
-	// RCODE 3
-	if res.Rcode == dns.RcodeNameError {
-		return res, nil
-	}
-	if res.Rcode != dns.RcodeSuccess {
-		return nil, ErrDNSTemperror
+	if res.Rcode != dns.RcodeSuccess && res.Rcode != dns.RcodeNameError {
+		// the response is kept so callers can report its extras
+		return res, ErrDNSTemperror
 	}
+	// NXDOMAIN (RCODE 3) is cached as well, the response keeps the RCODE,
+	// so voidness of the cached response is the same as of the received one
 	r.CacheResponse(res)
 	return res, nil
 }
 
+// responseExtras returns ResponseExtras of the response, nil if there is none.
+// Only NXDOMAIN and empty NOERROR responses are void.
+func responseExtras(res *dns.Msg, cached bool) *ResponseExtras {
+	if res == nil {
+		return nil
+	}
+	e := &ResponseExtras{
+		Void:       res.Rcode == dns.RcodeNameError || res.Rcode == dns.RcodeSuccess && len(res.Answer) == 0,
+		Answers:    len(res.Answer),
+		Authority:  len(res.Ns),
+		Additional: len(res.Extra),
+		Size:       res.Len(),
+		Queries:    1,
+		responses:  []*dns.Msg{res},
+	}
+	if e.Void {
+		e.VoidLookups = 1
+	}
+	e.CNAMEs = cnameChain(res)
+	if cached {
+		e.CacheHits = 1
+	}
+	var ttl uint32 = maxUint32
+	for _, a := range res.Answer {
+		if d := a.Header().Ttl; d < ttl {
+			ttl = d
+		}
+	}
+	if len(res.Answer) > 0 {
+		e.TTL = time.Duration(ttl) * time.Second
+	}
+	return e
+}
+
+// cnameChain returns targets of CNAME records followed from the name asked
+// to the name the answers belong to
+func cnameChain(res *dns.Msg) []string {
+	if len(res.Question) == 0 {
+		return nil
+	}
+	var chain []string
+	name := res.Question[0].Name
+	for len(chain) < len(res.Answer) {
+		next := ""
+		for _, a := range res.Answer {
+			if c, ok := a.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, name) {
+				next = c.Target
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		chain = append(chain, next)
+		name = next
+	}
+	return chain
+}
+
 // LookupTXT returns the DNS TXT records for the given domain name.
-func (r *miekgDNSResolver) LookupTXT(name string) ([]string, error) {
+func (r *miekgDNSResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
 	req := new(dns.Msg)
 	req.SetQuestion(name, dns.TypeTXT)
 
-	res, err := r.exchange(req)
+	res, cached, err := r.exchange(req)
 	if err != nil {
-		return nil, err
+		return nil, responseExtras(res, cached), err
 	}
 
 	txts := make([]string, 0, len(res.Answer))
@@ -168,23 +405,23 @@ func (r *miekgDNSResolver) LookupTXT(name string) ([]string, error) {
 			txts = append(txts, strings.Join(r.Txt, ""))
 		}
 	}
-	return txts, nil
+	return txts, responseExtras(res, cached), nil
 }
 
 // LookupTXTStrict returns DNS TXT records for the given name, however it
 // will return ErrDNSPermerror upon NXDOMAIN (RCODE 3)
-func (r *miekgDNSResolver) LookupTXTStrict(name string) ([]string, error) {
+func (r *miekgDNSResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
 
 	req := new(dns.Msg)
 	req.SetQuestion(name, dns.TypeTXT)
 
-	res, err := r.exchange(req)
+	res, cached, err := r.exchange(req)
 	if err != nil {
-		return nil, err
+		return nil, responseExtras(res, cached), err
 	}
 
 	if res.Rcode == dns.RcodeNameError {
-		return nil, ErrDNSPermerror
+		return nil, responseExtras(res, cached), ErrDNSPermerror
 	}
 
 	txts := make([]string, 0, len(res.Answer))
@@ -193,22 +430,94 @@ func (r *miekgDNSResolver) LookupTXTStrict(name string) ([]string, error) {
 			txts = append(txts, strings.Join(r.Txt, ""))
 		}
 	}
-	return txts, nil
+	return txts, responseExtras(res, cached), nil
+}
+
+// LookupSPFStrict returns DNS SPF (type 99) records for the given name,
+// however it will return ErrDNSPermerror upon NXDOMAIN (RCODE 3)
+func (r *miekgDNSResolver) LookupSPFStrict(name string) ([]string, *ResponseExtras, error) {
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypeSPF)
+
+	res, cached, err := r.exchange(req)
+	if err != nil {
+		return nil, responseExtras(res, cached), err
+	}
+
+	if res.Rcode == dns.RcodeNameError {
+		return nil, responseExtras(res, cached), ErrDNSPermerror
+	}
+
+	rrs := make([]string, 0, len(res.Answer))
+	for _, a := range res.Answer {
+		if r, ok := a.(*dns.SPF); ok {
+			rrs = append(rrs, strings.Join(r.Txt, ""))
+		}
+	}
+	return rrs, responseExtras(res, cached), nil
+}
+
+// LookupPTR returns names of PTR records of the ip
+func (r *miekgDNSResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	name, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	req := new(dns.Msg)
+	req.SetQuestion(name, dns.TypePTR)
+
+	res, cached, err := r.exchange(req)
+	if err != nil {
+		return nil, responseExtras(res, cached), err
+	}
+
+	if res.Rcode == dns.RcodeNameError {
+		return nil, responseExtras(res, cached), ErrDNSPermerror
+	}
+
+	names := make([]string, 0, len(res.Answer))
+	for _, a := range res.Answer {
+		if r, ok := a.(*dns.PTR); ok {
+			names = append(names, r.Ptr)
+		}
+	}
+	return names, responseExtras(res, cached), nil
+}
+
+// ConfirmPTR checks if A (for IPv4) or AAAA (for IPv6) records of the name
+// include the ip
+func (r *miekgDNSResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	qType := dns.TypeAAAA
+	if ip.To4() != nil {
+		qType = dns.TypeA
+	}
+	req := new(dns.Msg)
+	req.SetQuestion(name, qType)
+
+	res, cached, err := r.exchange(req)
+	if err != nil {
+		return false, responseExtras(res, cached), err
+	}
+
+	found, err := matchIP(res.Answer, func(a net.IP, _ string) (bool, error) {
+		return a.Equal(ip), nil
+	}, name)
+	return found, responseExtras(res, cached), err
 }
 
 // Exists is used for a DNS A RR lookup (even when the
 // connection type is IPv6).  If any A record is returned, this
 // mechanism matches.
-func (r *miekgDNSResolver) Exists(name string) (bool, error) {
+func (r *miekgDNSResolver) Exists(name string) (bool, *ResponseExtras, error) {
 	req := new(dns.Msg)
 	req.SetQuestion(name, dns.TypeA)
 
-	res, err := r.exchange(req)
+	res, cached, err := r.exchange(req)
 	if err != nil {
-		return false, err
+		return false, responseExtras(res, cached), err
 	}
 
-	return len(res.Answer) > 0, nil
+	return len(res.Answer) > 0, responseExtras(res, cached), nil
 }
 
 func matchIP(rrs []dns.RR, matcher IPMatcherFunc, name string) (bool, error) {
@@ -233,7 +542,7 @@ func matchIP(rrs []dns.RR, matcher IPMatcherFunc, name string) (bool, error) {
 // using the type of lookup (A or AAAA).
 // Then IPMatcherFunc used to compare checked IP to the returned address(es).
 // If any address matches, the mechanism matches
-func (r *miekgDNSResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, error) {
+func (r *miekgDNSResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
 	var wg sync.WaitGroup
 	qTypes := []uint16{dns.TypeA, dns.TypeAAAA}
 	hits := make(chan hit, len(qTypes))
@@ -245,16 +554,14 @@ func (r *miekgDNSResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, er
 
 			req := new(dns.Msg)
 			req.SetQuestion(name, qType)
-			res, err := r.exchange(req)
+			res, cached, err := r.exchange(req)
 			if err != nil {
-				hits <- hit{false, err}
+				hits <- hit{false, responseExtras(res, cached), err}
 				return
 			}
 
-			if m, e := matchIP(res.Answer, matcher, name); m || e != nil {
-				hits <- hit{m, e}
-				return
-			}
+			m, e := matchIP(res.Answer, matcher, name)
+			hits <- hit{m, responseExtras(res, cached), e}
 		}
 		if r.parallelism == 1 {
 			// 0 == unlimited, and only 2 types of lookup defined
@@ -269,26 +576,46 @@ func (r *miekgDNSResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, er
 		close(hits)
 	}()
 
+	var (
+		extras *ResponseExtras
+		err    error
+	)
 	for h := range hits {
-		if h.found || h.err != nil {
-			return h.found, h.err
+		extras = extras.merge(h.extras)
+		if h.found && err == nil {
+			return true, extras, nil
+		}
+		// keep merging extras of lookups already made, the first error wins
+		if h.err != nil && err == nil {
+			err = h.err
 		}
 	}
 
-	return false, nil
+	return false, extras, err
 }
 
 // MatchMX is similar to MatchIP but first performs an MX lookup on the
 // name.  Then it performs an address lookup on each MX name returned.
 // Then IPMatcherFunc used to compare checked IP to the returned address(es).
-// If any address matches, the mechanism matches
-func (r *miekgDNSResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, error) {
+// If any address matches, the mechanism matches.
+// More than 10 MX records produce ErrTooManyMXNames.
+func (r *miekgDNSResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
 	req := new(dns.Msg)
 	req.SetQuestion(name, dns.TypeMX)
 
-	res, err := r.exchange(req)
+	res, cached, err := r.exchange(req)
 	if err != nil {
-		return false, err
+		return false, responseExtras(res, cached), err
+	}
+
+	var n int
+	for _, rr := range res.Answer {
+		if _, ok := rr.(*dns.MX); ok {
+			n++
+		}
+	}
+	if n > MaxMXNames {
+		return false, responseExtras(res, cached), ErrTooManyMXNames
 	}
 
 	var wg sync.WaitGroup
@@ -310,8 +637,8 @@ func (r *miekgDNSResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, er
 		wg.Add(1)
 		match := func() {
 			name := <-names
-			found, err := r.MatchIP(name, matcher)
-			hits <- hit{found, err}
+			found, extras, err := r.MatchIP(name, matcher)
+			hits <- hit{found, extras, err}
 			wg.Done()
 		}
 		names <- mx.Mx
@@ -327,11 +654,20 @@ func (r *miekgDNSResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, er
 		close(hits)
 	}()
 
+	// voidness of MX lookup is defined by MX response only
+	extras := responseExtras(res, cached)
+	void := extras.Void
 	for h := range hits {
-		if h.found || h.err != nil {
-			return h.found, h.err
+		extras = extras.merge(h.extras)
+		extras.Void = void
+		if h.found && err == nil {
+			return true, extras, nil
+		}
+		// keep merging extras of lookups already made, the first error wins
+		if h.err != nil && err == nil {
+			err = h.err
 		}
 	}
 
-	return false, nil
+	return false, extras, err
 }
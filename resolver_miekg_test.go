@@ -2,6 +2,9 @@ package spf
 
 import (
 	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,7 +27,7 @@ func TestMiekgDNSResolver_LookupTXTStrict_Multiline(t *testing.T) {
 	}))
 	defer dns.HandleRemove("multiline.test.")
 
-	r, e := testResolver.LookupTXTStrict("multiline.test.")
+	r, _, e := testResolver.LookupTXTStrict("multiline.test.")
 
 	if e != nil {
 		t.Fatal(e)
@@ -45,7 +48,7 @@ func TestMiekgDNSResolver_Exists_Cached(t *testing.T) {
 	defer dns.HandleRemove("slow.test.")
 
 	start := time.Now()
-	found, e := testResolver.Exists("slow.test.")
+	found, extras, e := testResolver.Exists("slow.test.")
 	d := time.Since(start)
 
 	if !found {
@@ -59,14 +62,20 @@ func TestMiekgDNSResolver_Exists_Cached(t *testing.T) {
 	if d < latency {
 		t.Errorf("unexpected quick response: want=%v, got=%v", latency, d)
 	}
+	if extras.CacheHits != 0 {
+		t.Errorf("CacheHits = %d; want 0", extras.CacheHits)
+	}
 
 	start = time.Now()
-	_, e = testResolver.Exists("slow.test.")
+	_, extras, e = testResolver.Exists("slow.test.")
 	d = time.Since(start)
 
 	if e != nil {
 		t.Fatal(e)
 	}
+	if extras.CacheHits != 1 {
+		t.Errorf("CacheHits of cached response = %d; want 1", extras.CacheHits)
+	}
 
 	if d > latency {
 		t.Errorf("too slow response for cached response: want < %v, got=%v", latency, d)
@@ -74,7 +83,7 @@ func TestMiekgDNSResolver_Exists_Cached(t *testing.T) {
 
 	time.Sleep(2 * time.Second)
 	start = time.Now()
-	_, e = testResolver.Exists("slow.test.")
+	_, _, e = testResolver.Exists("slow.test.")
 	d = time.Since(start)
 
 	if d < latency {
@@ -90,7 +99,7 @@ func TestMiekgDNSResolver_LookupTXT_Multiline(t *testing.T) {
 	}))
 	defer dns.HandleRemove("multiline.test.")
 
-	r, e := testResolver.LookupTXT("multiline.test.")
+	r, _, e := testResolver.LookupTXT("multiline.test.")
 
 	if e != nil {
 		t.Fatal(e)
@@ -101,6 +110,46 @@ func TestMiekgDNSResolver_LookupTXT_Multiline(t *testing.T) {
 	}
 }
 
+func TestMiekgDNSResolver_ResponseExtras(t *testing.T) {
+	dns.HandleFunc("extras.test.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`extras.test. 600 IN TXT "v=spf1 -all"`,
+			`extras.test. 300 IN TXT "some other text"`,
+		},
+		dns.TypeA: {
+			`extras.test. 60 IN A 10.0.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("extras.test.")
+
+	_, extras, err := testResolver.LookupTXT("extras.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extras.Void || extras.Answers != 2 || extras.TTL != 300*time.Second || extras.Size == 0 {
+		t.Errorf("LookupTXT() extras=%+v; want 2 answers with TTL=5m", extras)
+	}
+
+	_, extras, err = testResolver.MatchIP("extras.test.", func(net.IP, string) (bool, error) { return false, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extras.Void || extras.Answers != 1 || extras.TTL != 60*time.Second {
+		t.Errorf("MatchIP() extras=%+v; want 1 answer with TTL=1m", extras)
+	}
+
+	// the second lookup is served from the cache
+	for i := 0; i < 2; i++ {
+		_, extras, err = testResolver.LookupTXT("nxdomain.extras.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !extras.Void || extras.Answers != 0 {
+			t.Errorf("LookupTXT() #%d extras=%+v; want void", i, extras)
+		}
+	}
+}
+
 func TestMiekgDNSResolver_CaseProd2(t *testing.T) {
 	dnsCache := gcache.New(10).LRU().Build()
 	client := new(dns.Client)
@@ -146,7 +195,7 @@ func TestMiekgDNSResolver_CaseProd1(t *testing.T) {
 		t.Fatal("Could not create resolver", err)
 	}
 
-	txts, err := resolver.LookupTXTStrict("thomsonreuters.com.")
+	txts, _, err := resolver.LookupTXTStrict("thomsonreuters.com.")
 	if err != nil {
 		t.Fatal("Could not query TXTs", err)
 	}
@@ -155,3 +204,178 @@ func TestMiekgDNSResolver_CaseProd1(t *testing.T) {
 		t.Error("No TXT records", txts)
 	}
 }
+
+func TestMiekgDNSResolver_ResponseExtras_Errors(t *testing.T) {
+	dns.HandleFunc("servfail.test.", func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Qtype == dns.TypeA {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			_ = w.WriteMsg(m)
+			return
+		}
+		zone(map[uint16][]string{
+			dns.TypeAAAA: {
+				`servfail.test. 120 IN AAAA 2001:db8::1`,
+			},
+		})(w, req)
+	})
+	defer dns.HandleRemove("servfail.test.")
+
+	_, extras, err := testResolver.MatchIP("servfail.test.", func(net.IP, string) (bool, error) { return false, nil })
+	if err != ErrDNSTemperror {
+		t.Errorf("MatchIP() err=%v; want %v", err, ErrDNSTemperror)
+	}
+	if extras == nil {
+		t.Fatal("MatchIP() extras=nil; want extras of both lookups")
+	}
+	if extras.Void || extras.Queries != 2 || extras.Answers != 1 || extras.TTL != 120*time.Second {
+		t.Errorf("MatchIP() extras=%+v; want 2 queries, 1 answer with TTL=2m", extras)
+	}
+
+	_, extras, err = testResolver.Exists("servfail.test.")
+	if err != ErrDNSTemperror {
+		t.Errorf("Exists() err=%v; want %v", err, ErrDNSTemperror)
+	}
+	if extras == nil || extras.Void || extras.Queries != 1 {
+		t.Errorf("Exists() extras=%+v; want non void extras of failed query", extras)
+	}
+}
+
+func TestMiekgDNSResolver_SharedExchange(t *testing.T) {
+	var queries int32
+	dns.HandleFunc("flight.test.", withLatency(func(w dns.ResponseWriter, req *dns.Msg) {
+		atomic.AddInt32(&queries, 1)
+		zone(map[uint16][]string{
+			dns.TypeA: {`flight.test. 0 IN A 10.0.0.1`},
+		})(w, req)
+	}, 50*time.Millisecond))
+	defer dns.HandleRemove("flight.test.")
+
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if found, _, err := r.Exists("flight.test."); !found || err != nil {
+				t.Errorf("Exists() = %t, %v; want true, nil", found, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Errorf("upstream got %d queries; want 1", n)
+	}
+	if len(r.flights) != 0 {
+		t.Errorf("flights = %v; want none left", r.flights)
+	}
+}
+
+func TestMiekgDNSResolver_SaneTTL(t *testing.T) {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	soa := rr(`sane.test. 600 IN SOA ns.sane.test. admin.sane.test. 1 3600 600 86400 300`)
+	tests := []struct {
+		name     string
+		opts     []MiekgDNSResolverOption
+		answer   []dns.RR
+		ns       []dns.RR
+		rcode    int
+		cached   []time.Duration // moments the response is still cached
+		expired  time.Duration   // moment the response is gone
+		uncached bool
+	}{
+		{"answer", nil, []dns.RR{rr(`sane.test. 120 IN A 10.0.0.1`)}, nil, dns.RcodeSuccess, []time.Duration{119 * time.Second}, 121 * time.Second, false},
+		{"zero ttl", nil, []dns.RR{rr(`sane.test. 0 IN A 10.0.0.1`)}, nil, dns.RcodeSuccess, nil, 0, true},
+		{"min raises zero ttl", []MiekgDNSResolverOption{MiekgDNSMinSaneTTL(30 * time.Second)}, []dns.RR{rr(`sane.test. 0 IN A 10.0.0.1`)}, nil, dns.RcodeSuccess, []time.Duration{29 * time.Second}, 31 * time.Second, false},
+		{"max lowers ttl", []MiekgDNSResolverOption{MiekgDNSMaxSaneTTL(time.Hour)}, []dns.RR{rr(`sane.test. 604800 IN A 10.0.0.1`)}, nil, dns.RcodeSuccess, []time.Duration{59 * time.Minute}, 61 * time.Minute, false},
+		{"negative default", nil, nil, nil, dns.RcodeNameError, []time.Duration{59 * time.Second}, 61 * time.Second, false},
+		{"negative soa", nil, nil, []dns.RR{soa}, dns.RcodeNameError, []time.Duration{299 * time.Second}, 301 * time.Second, false},
+		{"negative min", []MiekgDNSResolverOption{MiekgDNSMinSaneTTL(10 * time.Minute)}, nil, []dns.RR{soa}, dns.RcodeSuccess, []time.Duration{9 * time.Minute}, 11 * time.Minute, false},
+		{"negative max", []MiekgDNSResolverOption{MiekgDNSMaxSaneTTL(30 * time.Second)}, nil, nil, dns.RcodeNameError, []time.Duration{29 * time.Second}, 31 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := gcache.NewFakeClock()
+			cache := gcache.New(10).Simple().Clock(clock).Build()
+			r, err := NewMiekgDNSResolver("127.0.0.1:53", append(tt.opts, MiekgDNSCache(cache))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := new(dns.Msg)
+			res.SetQuestion("sane.test.", dns.TypeA)
+			res.Rcode = tt.rcode
+			res.Answer, res.Ns = tt.answer, tt.ns
+			r.CacheResponse(res)
+
+			if tt.uncached {
+				if cache.Len(false) != 0 {
+					t.Errorf("response is cached; want not")
+				}
+				return
+			}
+			var elapsed time.Duration
+			for _, d := range tt.cached {
+				clock.Advance(d - elapsed)
+				elapsed = d
+				if _, ok := r.cachedResponse(res); !ok {
+					t.Errorf("response is not cached after %s", d)
+				}
+			}
+			clock.Advance(tt.expired - elapsed)
+			if _, ok := r.cachedResponse(res); ok {
+				t.Errorf("response is cached after %s", tt.expired)
+			}
+		})
+	}
+}
+
+func TestMiekgDNSResolver_CNAMEChain(t *testing.T) {
+	dns.HandleFunc("cname.test.", func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		for _, s := range []string{
+			`cname.test. 0 IN CNAME c1.cname.test.`,
+			`c2.cname.test. 0 IN A 10.0.0.1`,
+			`c1.cname.test. 0 IN CNAME c2.cname.test.`,
+		} {
+			rr, _ := dns.NewRR(s)
+			m.Answer = append(m.Answer, rr)
+		}
+		_ = w.WriteMsg(m)
+	})
+	defer dns.HandleRemove("cname.test.")
+
+	addr := testResolver.(*miekgDNSResolver).serverAddr
+	r, err := NewMiekgDNSResolver(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, extras, err := r.MatchIP("cname.test.", func(ip net.IP, _ string) (bool, error) {
+		return ip.Equal(net.ParseIP("10.0.0.1")), nil
+	})
+	want := []string{"c1.cname.test.", "c2.cname.test."}
+	if !found || err != nil || !reflect.DeepEqual(extras.CNAMEs, want) {
+		t.Errorf("MatchIP() = %t, %+v, %v; want CNAMEs %q", found, extras, err, want)
+	}
+
+	r, err = NewMiekgDNSResolver(addr, MiekgDNSMaxCNAMEChain(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, extras, err = r.Exists("cname.test.")
+	if found || err != ErrTooManyCNAMEs || extras == nil || len(extras.CNAMEs) != 2 {
+		t.Errorf("Exists() = %t, %+v, %v; want %v", found, extras, err, ErrTooManyCNAMEs)
+	}
+	if !IsPolicyError(err) || ErrorCodeOf(err) != CodeTooManyCNAMEs {
+		t.Errorf("ErrTooManyCNAMEs is not a policy error with its code")
+	}
+}
@@ -0,0 +1,209 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// OverlayResolver answers lookups of some names from supplied records and
+// passes the rest to the wrapped Resolver, so the effect of publishing
+// records could be previewed before DNS is changed.
+type OverlayResolver struct {
+	resolver Resolver
+	zone     map[string][]dns.RR
+}
+
+// NewOverlayResolver returns a resolver answering lookups of the names in
+// overrides from their records and passing lookups of other names to r.
+//
+// Records are in presentation format of zone files, the owner name (fully
+// qualified) and TTL are optional: `TXT "v=spf1 -all"`, `A 192.0.2.1` and
+// `example.com. 300 IN MX 10 mail.example.com.` are all fine. A value which is
+// not a record is taken as text of a TXT record, e.g. "v=spf1 -all".
+// An overridden name has only the records given, lookups of other types find
+// nothing; a name with no records doesn't exist (NXDOMAIN).
+//
+// Overrides are not DNS lookups of their own: wrap the resolver with
+// NewLimitedResolver to enforce the limits.
+func NewOverlayResolver(r Resolver, overrides map[string][]string) (*OverlayResolver, error) {
+	o := &OverlayResolver{resolver: r, zone: make(map[string][]dns.RR, len(overrides))}
+	for name, values := range overrides {
+		name = NormalizeFQDN(name)
+		rrs := make([]dns.RR, 0, len(values))
+		for _, v := range values {
+			rr, err := overrideRR(name, v)
+			if err != nil {
+				return nil, err
+			}
+			rrs = append(rrs, rr)
+		}
+		o.zone[name] = append(o.zone[name], rrs...)
+	}
+	return o, nil
+}
+
+// overrideRR parses the record of the name
+func overrideRR(name, v string) (dns.RR, error) {
+	rr, err := dns.NewRR(name + " " + v)
+	if err != nil || rr == nil {
+		// a record with the owner name must have it fully qualified
+		if f := strings.Fields(v); len(f) > 0 && dns.IsFqdn(f[0]) {
+			rr, err = dns.NewRR(v)
+		}
+		if err != nil || rr == nil {
+			return &dns.TXT{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 3600},
+				Txt: []string{v},
+			}, nil
+		}
+	}
+	if owner := NormalizeFQDN(rr.Header().Name); owner != name {
+		return nil, fmt.Errorf("override of %s has record of %s: %q", name, owner, v)
+	}
+	if a, ok := rr.(*dns.A); ok {
+		// as received from DNS
+		a.A = a.A.To4()
+	}
+	return rr, nil
+}
+
+// response returns the synthesized response to the query, false if the name
+// is not overridden
+func (o *OverlayResolver) response(name string, qType uint16) (*dns.Msg, bool) {
+	rrs, ok := o.zone[NormalizeFQDN(name)]
+	if !ok {
+		return nil, false
+	}
+	res := new(dns.Msg)
+	res.SetQuestion(name, qType)
+	res.Response = true
+	if len(rrs) == 0 {
+		res.Rcode = dns.RcodeNameError
+		return res, true
+	}
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == qType {
+			res.Answer = append(res.Answer, rr)
+		}
+	}
+	return res, true
+}
+
+func txtStrings(res *dns.Msg) []string {
+	txts := make([]string, 0, len(res.Answer))
+	for _, a := range res.Answer {
+		if r, ok := a.(*dns.TXT); ok {
+			txts = append(txts, strings.Join(r.Txt, ""))
+		}
+	}
+	return txts
+}
+
+// LookupTXT returns the DNS TXT records for the given domain name.
+func (o *OverlayResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	res, ok := o.response(name, dns.TypeTXT)
+	if !ok {
+		return o.resolver.LookupTXT(name)
+	}
+	return txtStrings(res), responseExtras(res, false), nil
+}
+
+// LookupTXTStrict returns DNS TXT records for the given name, however it
+// will return ErrDNSPermerror upon NXDOMAIN (RCODE 3)
+func (o *OverlayResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	res, ok := o.response(name, dns.TypeTXT)
+	if !ok {
+		return o.resolver.LookupTXTStrict(name)
+	}
+	if res.Rcode == dns.RcodeNameError {
+		return nil, responseExtras(res, false), ErrDNSPermerror
+	}
+	return txtStrings(res), responseExtras(res, false), nil
+}
+
+// Exists is used for a DNS A RR lookup (even when the
+// connection type is IPv6).  If any A record is returned, this
+// mechanism matches.
+func (o *OverlayResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	res, ok := o.response(name, dns.TypeA)
+	if !ok {
+		return o.resolver.Exists(name)
+	}
+	return len(res.Answer) > 0, responseExtras(res, false), nil
+}
+
+// MatchIP provides an address lookup, which should be done on the name
+// using the type of lookup (A or AAAA).
+// Then IPMatcherFunc used to compare checked IP to the returned address(es).
+// If any address matches, the mechanism matches
+func (o *OverlayResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	if _, ok := o.zone[NormalizeFQDN(name)]; !ok {
+		return o.resolver.MatchIP(name, matcher)
+	}
+	var extras *ResponseExtras
+	for _, qType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		res, _ := o.response(name, qType)
+		extras = extras.merge(responseExtras(res, false))
+		if m, err := matchIP(res.Answer, matcher, name); m || err != nil {
+			return m, extras, err
+		}
+	}
+	return false, extras, nil
+}
+
+// MatchMX is similar to MatchIP but first performs an MX lookup on the
+// name.  Then it performs an address lookup on each MX name returned.
+// MX names of overridden names are looked up by the overlay, those of
+// other names by the wrapped resolver.
+// More than 10 MX records produce ErrTooManyMXNames.
+func (o *OverlayResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	res, ok := o.response(name, dns.TypeMX)
+	if !ok {
+		return o.resolver.MatchMX(name, matcher)
+	}
+	extras := responseExtras(res, false)
+	if len(res.Answer) > MaxMXNames {
+		return false, extras, ErrTooManyMXNames
+	}
+	// voidness of MX lookup is defined by MX response only
+	void := extras.Void
+	var err error
+	for _, rr := range res.Answer {
+		found, e, mErr := o.MatchIP(rr.(*dns.MX).Mx, matcher)
+		extras = extras.merge(e)
+		extras.Void = void
+		if found && err == nil {
+			return true, extras, nil
+		}
+		if mErr != nil && err == nil {
+			err = mErr
+		}
+	}
+	return false, extras, err
+}
+
+// LookupPTR returns names of PTR records of the ip, the lookup is passed
+// to the wrapped resolver.
+func (o *OverlayResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	return lookupPTR(o.resolver, ip)
+}
+
+// ConfirmPTR checks if A (for IPv4) or AAAA (for IPv6) records
+// of the name include the ip
+func (o *OverlayResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	qType := dns.TypeAAAA
+	if ip.To4() != nil {
+		qType = dns.TypeA
+	}
+	res, ok := o.response(name, qType)
+	if !ok {
+		return confirmPTR(o.resolver, name, ip)
+	}
+	found, err := matchIP(res.Answer, func(a net.IP, _ string) (bool, error) {
+		return a.Equal(ip), nil
+	}, name)
+	return found, responseExtras(res, false), err
+}
@@ -0,0 +1,97 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestOverlayResolver(t *testing.T) {
+	dns.HandleFunc("overlay.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`overlay.example. 0 IN TXT "v=spf1 include:_spf.overlay.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("overlay.example.")
+	dns.HandleFunc("_spf.overlay.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`_spf.overlay.example. 0 IN TXT "v=spf1 ip4:192.0.2.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("_spf.overlay.example.")
+	dns.HandleFunc("mail.overlay.example.", zone(map[uint16][]string{
+		dns.TypeA: {
+			"mail.overlay.example. 0 IN A 198.51.100.7",
+		},
+	}))
+	defer dns.HandleRemove("mail.overlay.example.")
+	testResolverCache.Purge()
+
+	o, err := NewOverlayResolver(testResolver, map[string][]string{
+		"overlay.example": {"v=spf1 mx a:new.overlay.example include:_spf.overlay.example -all"},
+		"overlay.example.": {
+			"MX 10 mail.overlay.example.",
+			"overlay.example. 300 IN MX 20 new.overlay.example.",
+		},
+		"new.overlay.example":  {"A 203.0.113.1", `TXT "v=spf1 -all"`},
+		"gone.overlay.example": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txts, extras, err := o.LookupTXTStrict("overlay.example.")
+	if err != nil || len(txts) != 1 || txts[0] != "v=spf1 mx a:new.overlay.example include:_spf.overlay.example -all" {
+		t.Errorf("LookupTXTStrict() = %q, %v", txts, err)
+	}
+	if extras == nil || extras.Answers != 1 || extras.Queries != 1 || extras.Void || extras.TTL != time.Hour {
+		t.Errorf("LookupTXTStrict() extras = %+v", extras)
+	}
+	if _, extras, err = o.LookupTXTStrict("gone.overlay.example."); !errors.Is(err, ErrDNSPermerror) || !extras.Void {
+		t.Errorf("LookupTXTStrict(gone) = %+v, %v; want void permerror", extras, err)
+	}
+	if found, extras, err := o.Exists("new.overlay.example."); !found || err != nil || extras.Void {
+		t.Errorf("Exists(new) = %t, %+v, %v", found, extras, err)
+	}
+	if found, extras, err := o.Exists("gone.overlay.example."); found || err != nil || !extras.Void {
+		t.Errorf("Exists(gone) = %t, %+v, %v", found, extras, err)
+	}
+
+	tests := []struct {
+		ip   string
+		want Result
+	}{
+		{"198.51.100.7", Pass}, // MX name answered by DNS
+		{"203.0.113.1", Pass},  // overridden MX name and "a"
+		{"192.0.2.1", Pass},    // include answered by DNS
+		{"198.51.100.8", Fail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			r, _, _, err := CheckHost(net.ParseIP(tt.ip), "overlay.example.", "john@overlay.example",
+				WithResolver(NewLimitedResolver(o, 10, 10)))
+			if r != tt.want || err != nil {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, tt.want)
+			}
+		})
+	}
+
+	// the record published in DNS is unaffected
+	r, _, _, err := CheckHost(net.ParseIP("203.0.113.1"), "overlay.example.", "john@overlay.example",
+		WithResolver(NewLimitedResolver(testResolver, 10, 10)))
+	if r != Fail || err != nil {
+		t.Errorf("CheckHost() without overlay = %s, %v; want fail", r, err)
+	}
+}
+
+func TestNewOverlayResolver_Error(t *testing.T) {
+	_, err := NewOverlayResolver(testResolver, map[string][]string{
+		"a.example": {"b.example. IN A 192.0.2.1"},
+	})
+	if err == nil {
+		t.Error("NewOverlayResolver() with record of another name succeeded")
+	}
+}
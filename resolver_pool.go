@@ -0,0 +1,267 @@
+package spf
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// PoolResolver balances lookups across upstream resolvers, keeping track of
+// their health. Lookups go to the healthy upstream with lower latency of two
+// picked at random, a lookup failed with ErrDNSTemperror is retried with
+// the other upstreams, each of them tried once. Upstreams failing several
+// lookups in a row are ejected for a while; when all of them are ejected,
+// lookups still go to them.
+type PoolResolver struct {
+	upstreams  []*upstream
+	ejectAfter int
+	ejectFor   time.Duration
+	clock      Clock
+}
+
+// PoolResolverOption sets an optional parameter of PoolResolver.
+type PoolResolverOption func(r *PoolResolver)
+
+// PoolEjectAfter sets the number of lookups in a row an upstream has to fail
+// to be ejected, 3 by default.
+func PoolEjectAfter(n int) PoolResolverOption {
+	return func(r *PoolResolver) {
+		if n <= 0 {
+			return
+		}
+		r.ejectAfter = n
+	}
+}
+
+// PoolEjectFor sets for how long a failing upstream is ejected, 30 seconds
+// by default. After that it gets lookups again and a single failure ejects it
+// once more.
+func PoolEjectFor(d time.Duration) PoolResolverOption {
+	return func(r *PoolResolver) {
+		if d <= 0 {
+			return
+		}
+		r.ejectFor = d
+	}
+}
+
+// PoolClock makes the resolver measure latency of lookups and ejection of
+// upstreams by c, SystemClock by default.
+func PoolClock(c Clock) PoolResolverOption {
+	return func(r *PoolResolver) {
+		if c == nil {
+			return
+		}
+		r.clock = c
+	}
+}
+
+// NewPoolResolver returns PoolResolver of the upstream resolvers.
+func NewPoolResolver(rr []Resolver, opts ...PoolResolverOption) *PoolResolver {
+	r := &PoolResolver{
+		upstreams:  make([]*upstream, len(rr)),
+		ejectAfter: 3,
+		ejectFor:   30 * time.Second,
+		clock:      SystemClock,
+	}
+	for i, u := range rr {
+		r.upstreams[i] = &upstream{resolver: u}
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// UpstreamStats is the health of an upstream of PoolResolver.
+type UpstreamStats struct {
+	Latency   time.Duration `json:"latency"`           // moving average of lookups latency
+	ErrorRate float64       `json:"errorRate"`         // moving average of share of lookups failed
+	Failures  int           `json:"failures"`          // number of lookups failed in a row
+	Ejected   bool          `json:"ejected,omitempty"` // the upstream gets no lookups for now
+}
+
+// Stats returns health of the upstreams in the order they were given.
+func (r *PoolResolver) Stats() []UpstreamStats {
+	now := r.clock.Now()
+	s := make([]UpstreamStats, len(r.upstreams))
+	for i, u := range r.upstreams {
+		u.Lock()
+		s[i] = UpstreamStats{
+			Latency:   u.latency,
+			ErrorRate: u.errorRate,
+			Failures:  u.failures,
+			Ejected:   now.Before(u.ejectedUntil),
+		}
+		u.Unlock()
+	}
+	return s
+}
+
+// Weights of the latest lookup in moving averages
+const (
+	latencyWeight   = 0.3
+	errorRateWeight = 0.1
+)
+
+type upstream struct {
+	sync.Mutex
+	resolver     Resolver
+	latency      time.Duration
+	errorRate    float64
+	failures     int
+	ejectedUntil time.Time
+}
+
+// record accounts the lookup made by the upstream
+func (u *upstream) record(d time.Duration, failed bool, r *PoolResolver) {
+	u.Lock()
+	defer u.Unlock()
+	u.latency += time.Duration(latencyWeight * float64(d-u.latency))
+	var e float64
+	if failed {
+		e = 1
+	}
+	u.errorRate += errorRateWeight * (e - u.errorRate)
+	if !failed {
+		u.failures = 0
+		return
+	}
+	u.failures++
+	if u.failures >= r.ejectAfter {
+		u.ejectedUntil = r.clock.Now().Add(r.ejectFor)
+	}
+}
+
+// pick returns the index of the upstream to make the lookup with, -1 if all
+// of them were tried
+func (r *PoolResolver) pick(tried []bool) int {
+	now := r.clock.Now()
+	var healthy, ejected []int
+	for i, u := range r.upstreams {
+		if tried[i] {
+			continue
+		}
+		u.Lock()
+		if now.Before(u.ejectedUntil) {
+			ejected = append(ejected, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+		u.Unlock()
+	}
+	switch len(healthy) {
+	case 0:
+		// the one to return soonest
+		best := -1
+		for _, i := range ejected {
+			if best < 0 || r.upstreams[i].until().Before(r.upstreams[best].until()) {
+				best = i
+			}
+		}
+		return best
+	case 1:
+		return healthy[0]
+	}
+	a := healthy[rand.Intn(len(healthy))]
+	b := healthy[rand.Intn(len(healthy)-1)]
+	if b == a {
+		b = healthy[len(healthy)-1]
+	}
+	if r.upstreams[b].score() < r.upstreams[a].score() {
+		return b
+	}
+	return a
+}
+
+func (u *upstream) until() time.Time {
+	u.Lock()
+	defer u.Unlock()
+	return u.ejectedUntil
+}
+
+func (u *upstream) score() time.Duration {
+	u.Lock()
+	defer u.Unlock()
+	return time.Duration(float64(u.latency) * (1 + u.errorRate))
+}
+
+// do makes the lookup with the upstreams until it doesn't fail with
+// ErrDNSTemperror or all of them were tried
+func (r *PoolResolver) do(lookup func(next Resolver) error) {
+	tried := make([]bool, len(r.upstreams))
+	for {
+		i := r.pick(tried)
+		if i < 0 {
+			return
+		}
+		tried[i] = true
+		start := r.clock.Now()
+		err := lookup(r.upstreams[i].resolver)
+		failed := errors.Is(err, ErrDNSTemperror)
+		r.upstreams[i].record(r.clock.Now().Sub(start), failed, r)
+		if !failed {
+			return
+		}
+	}
+}
+
+// LookupTXTStrict returns DNS TXT records for the given name, however it
+// will return ErrDNSPermerror upon NXDOMAIN (RCODE 3)
+func (r *PoolResolver) LookupTXTStrict(name string) (v []string, extras *ResponseExtras, err error) {
+	err = ErrDNSTemperror
+	r.do(func(next Resolver) error {
+		v, extras, err = next.LookupTXTStrict(name)
+		return err
+	})
+	return
+}
+
+// LookupTXT returns the DNS TXT records for the given domain name.
+func (r *PoolResolver) LookupTXT(name string) (v []string, extras *ResponseExtras, err error) {
+	err = ErrDNSTemperror
+	r.do(func(next Resolver) error {
+		v, extras, err = next.LookupTXT(name)
+		return err
+	})
+	return
+}
+
+// Exists is used for a DNS A RR lookup (even when the
+// connection type is IPv6).  If any A record is returned, this
+// mechanism matches.
+func (r *PoolResolver) Exists(name string) (v bool, extras *ResponseExtras, err error) {
+	err = ErrDNSTemperror
+	r.do(func(next Resolver) error {
+		v, extras, err = next.Exists(name)
+		return err
+	})
+	return
+}
+
+// MatchIP provides an address lookup, which should be done on the name
+// using the type of lookup (A or AAAA).
+// Then IPMatcherFunc used to compare checked IP to the returned address(es).
+// If any address matches, the mechanism matches
+func (r *PoolResolver) MatchIP(name string, matcher IPMatcherFunc) (v bool, extras *ResponseExtras, err error) {
+	err = ErrDNSTemperror
+	r.do(func(next Resolver) error {
+		v, extras, err = next.MatchIP(name, matcher)
+		return err
+	})
+	return
+}
+
+// MatchMX is similar to MatchIP but first performs an MX lookup on the
+// name.  Then it performs an address lookup on each MX name returned.
+// Then IPMatcherFunc used to compare checked IP to the returned address(es).
+// If any address matches, the mechanism matches
+func (r *PoolResolver) MatchMX(name string, matcher IPMatcherFunc) (v bool, extras *ResponseExtras, err error) {
+	err = ErrDNSTemperror
+	r.do(func(next Resolver) error {
+		v, extras, err = next.MatchMX(name, matcher)
+		return err
+	})
+	return
+}
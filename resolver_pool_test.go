@@ -0,0 +1,90 @@
+package spf
+
+import (
+	"testing"
+	"time"
+)
+
+// upstreamResolver answers Exists lookups with err, counting them
+type upstreamResolver struct {
+	Resolver
+	calls int
+	d     time.Duration
+	err   error
+}
+
+func (r *upstreamResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	r.calls++
+	time.Sleep(r.d)
+	return r.err == nil, nil, r.err
+}
+
+func TestPoolResolver_Failover(t *testing.T) {
+	// the bad upstream fails quickly, so it is preferred until ejected
+	bad := &upstreamResolver{err: ErrDNSTemperror}
+	good := &upstreamResolver{d: time.Millisecond}
+	r := NewPoolResolver([]Resolver{bad, good}, PoolEjectAfter(2), PoolEjectFor(50*time.Millisecond))
+
+	for i := 0; i < 10; i++ {
+		found, _, err := r.Exists("domain.")
+		if !found || err != nil {
+			t.Fatalf("Exists() = %t, %v; want true, nil", found, err)
+		}
+	}
+	if good.calls != 10 {
+		t.Errorf("good upstream got %d lookups; want 10", good.calls)
+	}
+	if bad.calls != 2 {
+		t.Errorf("bad upstream got %d lookups; want 2 before ejection", bad.calls)
+	}
+	stats := r.Stats()
+	if !stats[0].Ejected || stats[0].Failures != 2 || stats[0].ErrorRate == 0 {
+		t.Errorf("Stats()[0] = %+v; want ejected after 2 failures", stats[0])
+	}
+	if stats[1].Ejected || stats[1].Failures != 0 || stats[1].ErrorRate != 0 {
+		t.Errorf("Stats()[1] = %+v; want healthy", stats[1])
+	}
+
+	// the ejection ends and a single failure ejects the upstream again
+	time.Sleep(60 * time.Millisecond)
+	bad.calls = 0
+	for i := 0; i < 10; i++ {
+		_, _, _ = r.Exists("domain.")
+	}
+	if bad.calls != 1 {
+		t.Errorf("bad upstream got %d lookups after ejection ended; want 1", bad.calls)
+	}
+}
+
+func TestPoolResolver_AllFailing(t *testing.T) {
+	u := []*upstreamResolver{{err: ErrDNSTemperror}, {err: ErrDNSTemperror}, {err: ErrDNSTemperror}}
+	r := NewPoolResolver([]Resolver{u[0], u[1], u[2]}, PoolEjectAfter(1))
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.Exists("domain."); err != ErrDNSTemperror {
+			t.Errorf("Exists() err = %v; want %v", err, ErrDNSTemperror)
+		}
+	}
+	// every upstream is tried once per lookup, ejected ones as well
+	for i, u := range u {
+		if u.calls != 2 {
+			t.Errorf("upstream %d got %d lookups; want 2", i, u.calls)
+		}
+	}
+}
+
+func TestPoolResolver_Latency(t *testing.T) {
+	slow := &upstreamResolver{d: 20 * time.Millisecond}
+	fast := &upstreamResolver{}
+	r := NewPoolResolver([]Resolver{slow, fast})
+
+	for i := 0; i < 20; i++ {
+		_, _, _ = r.Exists("domain.")
+	}
+	if slow.calls > 2 {
+		t.Errorf("slow upstream got %d lookups; want at most 2", slow.calls)
+	}
+	if s := r.Stats(); s[0].Latency <= s[1].Latency {
+		t.Errorf("Stats() = %+v; want latency of the slow upstream higher", s)
+	}
+}
@@ -0,0 +1,311 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimitedResolver spreads lookups of many evaluations over time so they
+// don't overwhelm the upstream resolver they share, e.g. during bulk scanning
+// of domains: create one per upstream and give it to all the evaluations.
+// Lookups spend tokens of a bucket refilled at rate tokens per second and
+// holding up to burst of them; lookups made with no token left wait for one.
+// Waiting lookups take turns by the domain they are made for (see
+// ForDomain), so a domain requiring many lookups doesn't hold the others up.
+// Lookups making several queries, e.g. MatchMX, spend a token per query.
+type RateLimitedResolver struct {
+	resolver Resolver
+	clock    Clock
+	every    time.Duration // time to earn a token, zero if there is no limit
+	burst    float64
+
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time                // of the latest refill
+	queues      map[string][]*rateWaiter // waiting lookups by domain
+	turns       []string                 // domains with waiting lookups in the order of their turns
+	dispatching bool
+}
+
+// rateWaiter is a lookup waiting for a token
+type rateWaiter struct {
+	ready     chan struct{}
+	abandoned bool // the context of the lookup is done, guarded by mu
+}
+
+// RateLimitedResolverOption sets an optional parameter of
+// RateLimitedResolver.
+type RateLimitedResolverOption func(r *RateLimitedResolver)
+
+// RateLimitClock makes the resolver refill the bucket and wait for tokens by
+// c, SystemClock by default.
+func RateLimitClock(c Clock) RateLimitedResolverOption {
+	return func(r *RateLimitedResolver) {
+		if c == nil {
+			return
+		}
+		r.clock = c
+	}
+}
+
+// NewRateLimitedResolver returns RateLimitedResolver making at most rate
+// queries per second with r on average, up to burst of them at once. The
+// bucket starts full. Rate of zero or less lifts the limit.
+func NewRateLimitedResolver(r Resolver, rate float64, burst int, opts ...RateLimitedResolverOption) *RateLimitedResolver {
+	if burst < 1 {
+		burst = 1
+	}
+	rl := &RateLimitedResolver{
+		resolver: r,
+		clock:    SystemClock,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		queues:   make(map[string][]*rateWaiter),
+	}
+	if rate > 0 {
+		rl.every = time.Duration(float64(time.Second) / rate)
+	}
+	for _, opt := range opts {
+		opt(rl)
+	}
+	rl.last = rl.clock.Now()
+	return rl
+}
+
+// ForDomain returns the resolver making lookups of r on behalf of the
+// domain, e.g. for the check of the domain given with WithResolver. Lookups
+// made with r directly take turns as if made for an empty domain.
+func (r *RateLimitedResolver) ForDomain(domain string) Resolver {
+	return &rateLimitedView{r, NormalizeFQDN(domain), nil}
+}
+
+// forDomain returns r making lookups on behalf of the domain if r is
+// RateLimitedResolver, r otherwise
+func forDomain(r Resolver, domain string) Resolver {
+	if rl, ok := r.(*RateLimitedResolver); ok {
+		return rl.ForDomain(domain)
+	}
+	return r
+}
+
+// refill adds the tokens earned since the latest refill, mu must be held
+func (r *RateLimitedResolver) refill() {
+	now := r.clock.Now()
+	r.tokens += float64(now.Sub(r.last)) / float64(r.every)
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+}
+
+// acquire waits for a token for a lookup of the domain, it fails with
+// ErrDNSTemperror once ctx is done.
+func (r *RateLimitedResolver) acquire(ctx context.Context, domain string) error {
+	if r.every == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	r.refill()
+	if len(r.turns) == 0 && r.tokens >= 1 {
+		r.tokens--
+		r.mu.Unlock()
+		return nil
+	}
+	w := &rateWaiter{ready: make(chan struct{})}
+	if len(r.queues[domain]) == 0 {
+		r.turns = append(r.turns, domain)
+	}
+	r.queues[domain] = append(r.queues[domain], w)
+	if !r.dispatching {
+		r.dispatching = true
+		go r.dispatch()
+	}
+	r.mu.Unlock()
+
+	if ctx == nil {
+		<-w.ready
+		return nil
+	}
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		w.abandoned = true
+		r.mu.Unlock()
+		return ErrDNSTemperror
+	}
+}
+
+// dispatch hands out tokens to waiting lookups, a domain at a time, until
+// no lookup waits
+func (r *RateLimitedResolver) dispatch() {
+	for {
+		r.mu.Lock()
+		r.refill()
+		for r.tokens >= 1 && len(r.turns) > 0 {
+			domain := r.turns[0]
+			r.turns = r.turns[1:]
+			q := r.queues[domain]
+			w := q[0]
+			if len(q) > 1 {
+				r.queues[domain] = q[1:]
+				r.turns = append(r.turns, domain)
+			} else {
+				delete(r.queues, domain)
+			}
+			if w.abandoned {
+				continue
+			}
+			r.tokens--
+			close(w.ready)
+		}
+		if len(r.turns) == 0 {
+			r.dispatching = false
+			r.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - r.tokens) * float64(r.every))
+		r.mu.Unlock()
+		r.clock.Sleep(wait)
+	}
+}
+
+// spend takes the tokens of the queries made by the lookup beyond the one
+// acquired, the bucket may go into debt
+func (r *RateLimitedResolver) spend(extras *ResponseExtras) {
+	if r.every == 0 || extras == nil || extras.Queries <= 1 {
+		return
+	}
+	r.mu.Lock()
+	r.tokens -= float64(extras.Queries - 1)
+	r.mu.Unlock()
+}
+
+// LookupTXT implements Resolver
+func (r *RateLimitedResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	return r.ForDomain("").LookupTXT(name)
+}
+
+// LookupTXTStrict implements Resolver
+func (r *RateLimitedResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	return r.ForDomain("").LookupTXTStrict(name)
+}
+
+// Exists implements Resolver
+func (r *RateLimitedResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	return r.ForDomain("").Exists(name)
+}
+
+// MatchIP implements Resolver
+func (r *RateLimitedResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	return r.ForDomain("").MatchIP(name, matcher)
+}
+
+// MatchMX implements Resolver
+func (r *RateLimitedResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	return r.ForDomain("").MatchMX(name, matcher)
+}
+
+// LookupPTR implements PTRResolver
+func (r *RateLimitedResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	return r.ForDomain("").(PTRResolver).LookupPTR(ip)
+}
+
+// ConfirmPTR implements PTRResolver
+func (r *RateLimitedResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	return r.ForDomain("").(PTRResolver).ConfirmPTR(name, ip)
+}
+
+// WithContext implements ContextResolver, lookups waiting for a token fail
+// with ErrDNSTemperror once ctx is done.
+func (r *RateLimitedResolver) WithContext(ctx context.Context) Resolver {
+	return &rateLimitedView{r, "", ctx}
+}
+
+// rateLimitedView is RateLimitedResolver making lookups on behalf of
+// a domain
+type rateLimitedView struct {
+	limiter *RateLimitedResolver
+	domain  string
+	ctx     context.Context
+}
+
+func (v *rateLimitedView) resolver() Resolver {
+	return bindContext(v.ctx, v.limiter.resolver)
+}
+
+func (v *rateLimitedView) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	if err := v.limiter.acquire(v.ctx, v.domain); err != nil {
+		return nil, nil, err
+	}
+	txts, extras, err := v.resolver().LookupTXT(name)
+	v.limiter.spend(extras)
+	return txts, extras, err
+}
+
+func (v *rateLimitedView) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	if err := v.limiter.acquire(v.ctx, v.domain); err != nil {
+		return nil, nil, err
+	}
+	txts, extras, err := v.resolver().LookupTXTStrict(name)
+	v.limiter.spend(extras)
+	return txts, extras, err
+}
+
+func (v *rateLimitedView) Exists(name string) (bool, *ResponseExtras, error) {
+	if err := v.limiter.acquire(v.ctx, v.domain); err != nil {
+		return false, nil, err
+	}
+	found, extras, err := v.resolver().Exists(name)
+	v.limiter.spend(extras)
+	return found, extras, err
+}
+
+func (v *rateLimitedView) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	if err := v.limiter.acquire(v.ctx, v.domain); err != nil {
+		return false, nil, err
+	}
+	found, extras, err := v.resolver().MatchIP(name, matcher)
+	v.limiter.spend(extras)
+	return found, extras, err
+}
+
+func (v *rateLimitedView) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	if err := v.limiter.acquire(v.ctx, v.domain); err != nil {
+		return false, nil, err
+	}
+	found, extras, err := v.resolver().MatchMX(name, matcher)
+	v.limiter.spend(extras)
+	return found, extras, err
+}
+
+func (v *rateLimitedView) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	if _, ok := v.limiter.resolver.(PTRResolver); !ok {
+		return nil, nil, ErrPTRNotSupported
+	}
+	if err := v.limiter.acquire(v.ctx, v.domain); err != nil {
+		return nil, nil, err
+	}
+	names, extras, err := lookupPTR(v.resolver(), ip)
+	v.limiter.spend(extras)
+	return names, extras, err
+}
+
+func (v *rateLimitedView) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	if _, ok := v.limiter.resolver.(PTRResolver); !ok {
+		return false, nil, ErrPTRNotSupported
+	}
+	if err := v.limiter.acquire(v.ctx, v.domain); err != nil {
+		return false, nil, err
+	}
+	ok, extras, err := confirmPTR(v.resolver(), name, ip)
+	v.limiter.spend(extras)
+	return ok, extras, err
+}
+
+func (v *rateLimitedView) WithContext(ctx context.Context) Resolver {
+	return &rateLimitedView{v.limiter, v.domain, ctx}
+}
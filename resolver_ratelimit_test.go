@@ -0,0 +1,136 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// steppedClock is FakeClock which Sleep waits for a step of the test
+type steppedClock struct {
+	*FakeClock
+	steps chan struct{}
+}
+
+func (c *steppedClock) Sleep(d time.Duration) {
+	<-c.steps
+	c.Advance(d)
+}
+
+// orderResolver records names of TXT lookups in the order they are made
+type orderResolver struct {
+	Resolver
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *orderResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	r.mu.Lock()
+	r.names = append(r.names, name)
+	r.mu.Unlock()
+	return nil, &ResponseExtras{Queries: 1}, nil
+}
+
+func (r *orderResolver) lookups() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.names)
+}
+
+func (r *RateLimitedResolver) waiting() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	for _, q := range r.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// eventually waits for f to return true
+func eventually(t *testing.T, f func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !f(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+	}
+}
+
+func TestRateLimitedResolver_Fairness(t *testing.T) {
+	upstream := &orderResolver{}
+	clock := &steppedClock{NewFakeClock(time.Unix(0, 0)), make(chan struct{})}
+	r := NewRateLimitedResolver(upstream, 1, 1, RateLimitClock(clock))
+
+	// the token of the full bucket
+	if _, _, err := r.LookupTXTStrict("first."); err != nil {
+		t.Fatal(err)
+	}
+	lookups := []struct{ domain, name string }{
+		{"a.example", "a1."}, {"a.example", "a2."}, {"a.example", "a3."},
+		{"b.example", "b1."}, {"c.example", "c1."},
+	}
+	var wg sync.WaitGroup
+	for i, l := range lookups {
+		wg.Add(1)
+		go func(domain, name string) {
+			defer wg.Done()
+			if _, _, err := r.ForDomain(domain).LookupTXTStrict(name); err != nil {
+				t.Error(err)
+			}
+		}(l.domain, l.name)
+		eventually(t, func() bool { return r.waiting() == i+1 })
+	}
+	for i := range lookups {
+		clock.steps <- struct{}{}
+		eventually(t, func() bool { return upstream.lookups() == i+2 })
+	}
+	wg.Wait()
+
+	want := []string{"first.", "a1.", "b1.", "c1.", "a2.", "a3."}
+	if !reflect.DeepEqual(upstream.names, want) {
+		t.Errorf("lookups = %q; want %q", upstream.names, want)
+	}
+	if got, want := clock.Now(), time.Unix(5, 0); !got.Equal(want) {
+		t.Errorf("clock = %v; want %v", got, want)
+	}
+}
+
+func TestRateLimitedResolver_Context(t *testing.T) {
+	upstream := &orderResolver{}
+	clock := &steppedClock{NewFakeClock(time.Unix(0, 0)), make(chan struct{})}
+	r := NewRateLimitedResolver(upstream, 1, 1, RateLimitClock(clock))
+	r.LookupTXTStrict("first.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, _, err := r.ForDomain("a.example").(ContextResolver).WithContext(ctx).LookupTXTStrict("canceled.")
+		done <- err
+	}()
+	eventually(t, func() bool { return r.waiting() == 1 })
+	cancel()
+	if err := <-done; !errors.Is(err, ErrDNSTemperror) {
+		t.Errorf("LookupTXTStrict() = %v; want %v", err, ErrDNSTemperror)
+	}
+	clock.steps <- struct{}{} // the abandoned lookup spends no token
+	if _, _, err := r.LookupTXTStrict("second."); err != nil || upstream.lookups() != 2 {
+		t.Errorf("LookupTXTStrict() = %v, %d lookups; want a token left", err, upstream.lookups())
+	}
+}
+
+func TestRateLimitedResolver_Unlimited(t *testing.T) {
+	upstream := &orderResolver{}
+	r := NewRateLimitedResolver(upstream, 0, 1)
+	for i := 0; i < 100; i++ {
+		if _, _, err := r.LookupTXTStrict("unlimited."); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if upstream.lookups() != 100 {
+		t.Errorf("lookups = %d; want 100", upstream.lookups())
+	}
+}
@@ -0,0 +1,71 @@
+package spf
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// usage is the use of a cached response, see MiekgDNSRefresh. Expiration
+// of cached responses is tracked regardless of the option to save them
+// (see SaveTo).
+type usage struct {
+	hits       int
+	expires    time.Time
+	refreshing bool
+}
+
+// cached starts tracking use of the response to the question cached for d
+func (r *miekgDNSResolver) cached(q dns.Question, d time.Duration) {
+	now := r.clock.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.usage == nil {
+		r.usage = make(map[dns.Question]*usage)
+	}
+	r.usage[q] = &usage{expires: now.Add(d)}
+	if len(r.usage) < r.pruneAt {
+		return
+	}
+	// questions not asked again after their responses expired
+	for q, u := range r.usage {
+		if now.After(u.expires) {
+			delete(r.usage, q)
+		}
+	}
+	r.pruneAt = 2*len(r.usage) + 64
+}
+
+// forget stops tracking use of the response to the question gone from cache
+func (r *miekgDNSResolver) forget(q dns.Question) {
+	r.mu.Lock()
+	delete(r.usage, q)
+	r.mu.Unlock()
+}
+
+// hit accounts the response to the question served from cache and starts
+// its refresh if the question is hot and the response is about to expire
+func (r *miekgDNSResolver) hit(q dns.Question) {
+	if r.refreshHits == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.usage[q]
+	if !ok {
+		return
+	}
+	u.hits++
+	if u.refreshing || u.hits < r.refreshHits || u.expires.Sub(r.clock.Now()) > r.refreshAhead {
+		return
+	}
+	// the flag is reset by caching the refreshed response, a failed refresh
+	// is not retried until the response expires
+	u.refreshing = true
+	req := new(dns.Msg)
+	req.SetQuestion(q.Name, q.Qtype)
+	req.Question[0].Qclass = q.Qclass
+	go func() {
+		_, _ = r.query(req)
+	}()
+}
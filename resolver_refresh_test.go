@@ -0,0 +1,68 @@
+package spf
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/miekg/dns"
+)
+
+func TestMiekgDNSResolver_Refresh(t *testing.T) {
+	queries := map[string]*int32{"hot.refresh.test.": new(int32), "cold.refresh.test.": new(int32)}
+	dns.HandleFunc("refresh.test.", func(w dns.ResponseWriter, req *dns.Msg) {
+		atomic.AddInt32(queries[req.Question[0].Name], 1)
+		zone(map[uint16][]string{
+			dns.TypeA: {
+				`hot.refresh.test. 1 IN A 10.0.0.1`,
+				`cold.refresh.test. 1 IN A 10.0.0.1`,
+			},
+		})(w, req)
+	})
+	defer dns.HandleRemove("refresh.test.")
+
+	clock := NewFakeClock(time.Now())
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr,
+		MiekgDNSCache(gcache.New(10).Simple().Clock(clock).Build()),
+		MiekgDNSClock(clock),
+		MiekgDNSRefresh(3, 700*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(name string, want int32) {
+		t.Helper()
+		if found, _, err := r.Exists(name); !found || err != nil {
+			t.Fatalf("Exists(%s) = %t, %v; want true, nil", name, found, err)
+		}
+		// refresh is made in background, wait for its response being cached
+		q := dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET}
+		for i := 0; i < 1000 && r.refreshing(q); i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if n := atomic.LoadInt32(queries[name]); n != want {
+			t.Fatalf("upstream got %d queries of %s; want %d", n, name, want)
+		}
+	}
+
+	lookup("hot.refresh.test.", 1)
+	lookup("cold.refresh.test.", 1)
+	lookup("hot.refresh.test.", 1)
+	lookup("hot.refresh.test.", 1)
+	clock.Advance(400 * time.Millisecond)
+	// the third hit comes close to expiry
+	lookup("hot.refresh.test.", 2)
+	lookup("cold.refresh.test.", 1)
+	clock.Advance(700 * time.Millisecond)
+	// the refreshed response is still cached, the cold one has expired
+	lookup("hot.refresh.test.", 2)
+	lookup("cold.refresh.test.", 2)
+}
+
+// refreshing returns true if refresh of the response to q is in progress
+func (r *miekgDNSResolver) refreshing(q dns.Question) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.usage[q]
+	return ok && u.refreshing
+}
@@ -1,17 +1,22 @@
 package spf
 
 import (
+	"errors"
 	"math"
 	"math/rand"
 	"time"
 )
 
 type retryResolver struct {
-	min    time.Duration
-	max    time.Duration
-	factor float64
-	jitter bool
-	rr     []Resolver
+	min         time.Duration
+	max         time.Duration
+	factor      float64
+	jitter      bool
+	maxAttempts int
+	retryable   func(error) bool
+	onRetry     func(name string, attempt int, err error)
+	rr          []Resolver
+	clock       Clock
 }
 
 type RetryResolverOption func(r *retryResolver)
@@ -49,6 +54,56 @@ func BackoffTimeout(d time.Duration) RetryResolverOption {
 	}
 }
 
+// RetryOn sets the function deciding which errors are worth retrying, e.g.
+//
+//	spf.RetryOn(func(err error) bool {
+//		return errors.Is(err, spf.ErrDNSTemperror) || errors.Is(err, errTruncated)
+//	})
+//
+// Only ErrDNSTemperror is retried by default. Errors of NXDOMAIN
+// (ErrDNSPermerror) are never worth retrying.
+func RetryOn(f func(err error) bool) RetryResolverOption {
+	return func(r *retryResolver) {
+		if f == nil {
+			return
+		}
+		r.retryable = f
+	}
+}
+
+// OnRetry sets the function called before every retry, e.g. for logging.
+// The attempt is the number of the failed attempt, starting from 1, err is
+// its error.
+func OnRetry(f func(name string, attempt int, err error)) RetryResolverOption {
+	return func(r *retryResolver) {
+		r.onRetry = f
+	}
+}
+
+// MaxAttempts limits the number of attempts of a lookup, including the first
+// one, in addition to BackoffTimeout. Zero means no limit, which is the default.
+func MaxAttempts(n int) RetryResolverOption {
+	return func(r *retryResolver) {
+		if n < 0 {
+			return
+		}
+		r.maxAttempts = n
+	}
+}
+
+// RetryClock makes the resolver wait between retries and measure
+// BackoffTimeout by c, SystemClock by default. Jitter of the delays
+// is drawn from the source seeded with the time of c, so a FakeClock makes
+// retries fully deterministic.
+func RetryClock(c Clock) RetryResolverOption {
+	return func(r *retryResolver) {
+		if c == nil {
+			return
+		}
+		r.clock = c
+	}
+}
+
 // NewRetryResolver implements round-robin retry with backoff delay
 func NewRetryResolver(rr []Resolver, opts ...RetryResolverOption) Resolver {
 	resolver := &retryResolver{
@@ -56,7 +111,11 @@ func NewRetryResolver(rr []Resolver, opts ...RetryResolverOption) Resolver {
 		max:    2 * time.Second,
 		factor: 2,
 		jitter: true,
-		rr:     rr,
+		retryable: func(err error) bool {
+			return errors.Is(err, ErrDNSTemperror)
+		},
+		rr:    rr,
+		clock: SystemClock,
 	}
 
 	for _, opt := range opts {
@@ -67,87 +126,74 @@ func NewRetryResolver(rr []Resolver, opts ...RetryResolverOption) Resolver {
 
 // LookupTXTStrict returns DNS TXT records for the given name, however it
 // will return ErrDNSPermerror upon NXDOMAIN (RCODE 3)
-func (r *retryResolver) LookupTXTStrict(name string) ([]string, error) {
-	expired := r.expiredFunc()
-	for attempt := 0; ; attempt++ {
-		for _, next := range r.rr {
-			v, err := next.LookupTXTStrict(name)
-			if err != ErrDNSTemperror || expired() {
-				return v, err
-			}
-		}
-		time.Sleep(r.backoff(attempt))
-	}
+func (r *retryResolver) LookupTXTStrict(name string) (v []string, extras *ResponseExtras, err error) {
+	r.retry(name, func(next Resolver) error {
+		v, extras, err = next.LookupTXTStrict(name)
+		return err
+	})
+	return
 }
 
 // LookupTXT returns the DNS TXT records for the given domain name.
-func (r *retryResolver) LookupTXT(name string) ([]string, error) {
-	expired := r.expiredFunc()
-	for attempt := 0; ; attempt++ {
-		for _, next := range r.rr {
-			v, err := next.LookupTXT(name)
-			if err != ErrDNSTemperror || expired() {
-				return v, err
-			}
-		}
-		time.Sleep(r.backoff(attempt))
-	}
+func (r *retryResolver) LookupTXT(name string) (v []string, extras *ResponseExtras, err error) {
+	r.retry(name, func(next Resolver) error {
+		v, extras, err = next.LookupTXT(name)
+		return err
+	})
+	return
 }
 
 // Exists is used for a DNS A RR lookup (even when the
 // connection type is IPv6).  If any A record is returned, this
 // mechanism matches.
-func (r *retryResolver) Exists(name string) (bool, error) {
-	expired := r.expiredFunc()
-	for attempt := 0; ; attempt++ {
-		for _, next := range r.rr {
-			v, err := next.Exists(name)
-			if err != ErrDNSTemperror || expired() {
-				return v, err
-			}
-		}
-		time.Sleep(r.backoff(attempt))
-	}
+func (r *retryResolver) Exists(name string) (v bool, extras *ResponseExtras, err error) {
+	r.retry(name, func(next Resolver) error {
+		v, extras, err = next.Exists(name)
+		return err
+	})
+	return
 }
 
 // MatchIP provides an address lookup, which should be done on the name
 // using the type of lookup (A or AAAA).
 // Then IPMatcherFunc used to compare checked IP to the returned address(es).
 // If any address matches, the mechanism matches
-func (r *retryResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, error) {
-	expired := r.expiredFunc()
-	for attempt := 0; ; attempt++ {
-		for _, next := range r.rr {
-			v, err := next.MatchIP(name, matcher)
-			if err != ErrDNSTemperror || expired() {
-				return v, err
-			}
-		}
-		time.Sleep(r.backoff(attempt))
-	}
+func (r *retryResolver) MatchIP(name string, matcher IPMatcherFunc) (v bool, extras *ResponseExtras, err error) {
+	r.retry(name, func(next Resolver) error {
+		v, extras, err = next.MatchIP(name, matcher)
+		return err
+	})
+	return
 }
 
 // MatchMX is similar to MatchIP but first performs an MX lookup on the
 // name.  Then it performs an address lookup on each MX name returned.
 // Then IPMatcherFunc used to compare checked IP to the returned address(es).
 // If any address matches, the mechanism matches
-func (r *retryResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, error) {
-	expired := r.expiredFunc()
-	for attempt := 0; ; attempt++ {
+func (r *retryResolver) MatchMX(name string, matcher IPMatcherFunc) (v bool, extras *ResponseExtras, err error) {
+	r.retry(name, func(next Resolver) error {
+		v, extras, err = next.MatchMX(name, matcher)
+		return err
+	})
+	return
+}
+
+// retry makes the lookup with resolvers in round-robin until it succeeds,
+// fails with an error which isn't retryable or the limits are reached
+func (r *retryResolver) retry(name string, lookup func(next Resolver) error) {
+	start := r.clock.Now()
+	for attempt, round := 1, 0; ; round++ {
 		for _, next := range r.rr {
-			v, err := next.MatchMX(name, matcher)
-			if err != ErrDNSTemperror || expired() {
-				return v, err
+			err := lookup(next)
+			if err == nil || !r.retryable(err) || r.clock.Now().Sub(start) > r.max || r.maxAttempts > 0 && attempt >= r.maxAttempts {
+				return
+			}
+			if r.onRetry != nil {
+				r.onRetry(name, attempt, err)
 			}
+			attempt++
 		}
-		time.Sleep(r.backoff(attempt))
-	}
-}
-
-func (r *retryResolver) expiredFunc() func() bool {
-	start := time.Now()
-	return func() bool {
-		return time.Since(start) > r.max
+		r.clock.Sleep(r.backoff(round))
 	}
 }
 
@@ -164,7 +210,7 @@ func (r *retryResolver) backoff(attempt int) time.Duration {
 	minf := float64(r.min)
 	durf := minf * math.Pow(r.factor, float64(attempt))
 	if r.jitter {
-		durf = rand.Float64()*(durf-minf) + minf
+		durf = r.random()*(durf-minf) + minf
 	}
 	//ensure float64 wont overflow int64
 	if durf > maxInt64 {
@@ -179,3 +225,11 @@ func (r *retryResolver) backoff(attempt int) time.Duration {
 	}
 	return dur
 }
+
+// random returns a pseudo-random number in [0.0,1.0) for jitter
+func (r *retryResolver) random() float64 {
+	if r.clock == SystemClock {
+		return rand.Float64()
+	}
+	return rand.New(rand.NewSource(r.clock.Now().UnixNano())).Float64()
+}
@@ -2,6 +2,7 @@ package spf
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 )
@@ -23,24 +24,24 @@ func (r *brokenResolver) error() error {
 	return ErrDNSTemperror
 }
 
-func (r *brokenResolver) LookupTXTStrict(name string) ([]string, error) {
-	return nil, r.error()
+func (r *brokenResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	return nil, nil, r.error()
 }
 
-func (r *brokenResolver) LookupTXT(name string) ([]string, error) {
-	return nil, r.error()
+func (r *brokenResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	return nil, nil, r.error()
 }
 
-func (r *brokenResolver) Exists(name string) (bool, error) {
-	return false, r.error()
+func (r *brokenResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	return false, nil, r.error()
 }
 
-func (r *brokenResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, error) {
-	return false, r.error()
+func (r *brokenResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	return false, nil, r.error()
 }
 
-func (r *brokenResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, error) {
-	return false, r.error()
+func (r *brokenResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	return false, nil, r.error()
 }
 
 func TestRetryResolver_Exists(t *testing.T) {
@@ -69,7 +70,7 @@ func TestRetryResolver_Exists(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tries = 0
 			start := time.Now()
-			_, err := tt.r.Exists("domain.")
+			_, _, err := tt.r.Exists("domain.")
 			if err != tt.e {
 				t.Errorf("Exists() error = %v, wantErr %v", err, tt.e)
 				return
@@ -83,3 +84,46 @@ func TestRetryResolver_Exists(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryResolver_Policy(t *testing.T) {
+	errTruncated := errors.New("truncated")
+	fast := []RetryResolverOption{BackoffDelayMin(time.Millisecond), BackoffTimeout(time.Second)}
+
+	tests := []struct {
+		name    string
+		r       *brokenResolver
+		opts    []RetryResolverOption
+		e       error
+		retries []string
+	}{
+		{"max attempts", &brokenResolver{c: 5, e: nil}, []RetryResolverOption{MaxAttempts(3)},
+			ErrDNSTemperror, []string{"1 temporary DNS error", "2 temporary DNS error"}},
+		{"not retryable by default", &brokenResolver{c: 0, e: ErrDNSPermerror}, nil,
+			ErrDNSPermerror, nil},
+		{"custom error not retried by default", &brokenResolver{c: 1, e: errTruncated}, nil,
+			errTruncated, []string{"1 temporary DNS error"}},
+		{"custom retryable error", &brokenResolver{c: 1, e: errTruncated},
+			[]RetryResolverOption{MaxAttempts(3), RetryOn(func(err error) bool {
+				return errors.Is(err, ErrDNSTemperror) || errors.Is(err, errTruncated)
+			})},
+			errTruncated, []string{"1 temporary DNS error", "2 truncated"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var retries []string
+			opts := append(append(fast[:len(fast):len(fast)], tt.opts...), OnRetry(func(name string, attempt int, err error) {
+				if name != "domain." {
+					t.Errorf("OnRetry() name = %q; want %q", name, "domain.")
+				}
+				retries = append(retries, fmt.Sprintf("%d %v", attempt, err))
+			}))
+			_, _, err := NewRetryResolver([]Resolver{tt.r}, opts...).Exists("domain.")
+			if err != tt.e {
+				t.Errorf("Exists() error = %v; want %v", err, tt.e)
+			}
+			if fmt.Sprint(retries) != fmt.Sprint(tt.retries) {
+				t.Errorf("OnRetry() calls = %q; want %q", retries, tt.retries)
+			}
+		})
+	}
+}
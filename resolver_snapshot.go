@@ -0,0 +1,143 @@
+package spf
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// MiekgDNSSnapshot makes the resolver restore its cache from the file at
+// path, if there is one, and save the cache to the file every period until
+// the context is done, so restarts don't start from a cold cache. Nil ctx
+// stands for context.Background(). Errors of periodic saves are ignored; call
+// SaveTo on shutdown to save the latest responses and handle errors. Requires
+// MiekgDNSCache.
+func MiekgDNSSnapshot(ctx context.Context, path string, every time.Duration) MiekgDNSResolverOption {
+	return func(r *miekgDNSResolver) {
+		if path == "" || every <= 0 {
+			return
+		}
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		r.snapshot = &snapshot{ctx: ctx, path: path, every: every}
+	}
+}
+
+type snapshot struct {
+	ctx   context.Context
+	path  string
+	every time.Duration
+}
+
+// start restores the cache from the snapshot and starts saving it
+func (s *snapshot) start(r *miekgDNSResolver) error {
+	f, err := os.Open(s.path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		err = r.LoadFrom(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	go func() {
+		t := time.NewTicker(s.every)
+		defer t.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-t.C:
+				_ = s.save(r)
+			}
+		}
+	}()
+	return nil
+}
+
+// save replaces the file atomically
+func (s *snapshot) save(r *miekgDNSResolver) error {
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := r.SaveTo(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// SaveTo writes responses in the cache as JSON of CacheDump. TTLs of the
+// records are lowered to the time left till the responses expire, so
+// LoadFrom doesn't keep them longer than the upstream allows.
+func (r *miekgDNSResolver) SaveTo(w io.Writer) error {
+	if r.cache == nil {
+		return json.NewEncoder(w).Encode(CacheDump(nil))
+	}
+	now := r.clock.Now()
+	expires := make(map[dns.Question]time.Time)
+	r.mu.Lock()
+	for q, u := range r.usage {
+		expires[q] = u.expires
+	}
+	r.mu.Unlock()
+
+	dump := make(CacheDump, len(expires))
+	for q, e := range expires {
+		d := e.Sub(now)
+		if d < time.Second {
+			// expired or about to
+			continue
+		}
+		left := uint32(d / time.Second)
+		res, ok := r.cache.Get(q)
+		if !ok {
+			continue
+		}
+		dump[q] = withTTLAtMost(res, left)
+	}
+	return json.NewEncoder(w).Encode(dump)
+}
+
+// LoadFrom caches responses written by SaveTo (or any CacheDump encoded as
+// JSON) for their TTLs.
+func (r *miekgDNSResolver) LoadFrom(rd io.Reader) error {
+	var dump CacheDump
+	if err := json.NewDecoder(rd).Decode(&dump); err != nil {
+		return err
+	}
+	dump.ForEach(r.CacheResponse)
+	return nil
+}
+
+// withTTLAtMost returns a copy of the response with TTLs of records
+// lowered to ttl seconds
+func withTTLAtMost(res *dns.Msg, ttl uint32) *dns.Msg {
+	c := res.Copy()
+	for _, rrs := range [][]dns.RR{c.Answer, c.Ns} {
+		for _, rr := range rrs {
+			if h := rr.Header(); h.Ttl > ttl {
+				h.Ttl = ttl
+			}
+			if soa, ok := rr.(*dns.SOA); ok && soa.Minttl > ttl {
+				soa.Minttl = ttl
+			}
+		}
+	}
+	return c
+}
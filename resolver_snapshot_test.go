@@ -0,0 +1,129 @@
+package spf
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/miekg/dns"
+)
+
+func TestMiekgDNSResolver_SaveTo(t *testing.T) {
+	var queries int32
+	dns.HandleFunc("snapshot.test.", func(w dns.ResponseWriter, req *dns.Msg) {
+		atomic.AddInt32(&queries, 1)
+		zone(map[uint16][]string{
+			dns.TypeTXT: {
+				`snapshot.test. 300 IN TXT "v=spf1 -all"`,
+			},
+		})(w, req)
+	})
+	defer dns.HandleRemove("snapshot.test.")
+
+	newResolver := func(opts ...MiekgDNSResolverOption) *miekgDNSResolver {
+		t.Helper()
+		opts = append([]MiekgDNSResolverOption{MiekgDNSCache(gcache.New(10).Simple().Build())}, opts...)
+		r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	lookup := func(r *miekgDNSResolver, want int32) {
+		t.Helper()
+		if _, _, err := r.LookupTXT("snapshot.test."); err != nil {
+			t.Fatal(err)
+		}
+		if n := atomic.LoadInt32(&queries); n != want {
+			t.Fatalf("upstream got %d queries; want %d", n, want)
+		}
+	}
+
+	r := newResolver()
+	lookup(r, 1)
+	var buf bytes.Buffer
+	if err := r.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var dump CacheDump
+	if err := dump.UnmarshalJSON(buf.Bytes()); err != nil || len(dump) != 1 {
+		t.Fatalf("SaveTo() = %s, %v; want the response", buf.String(), err)
+	}
+	dump.ForEach(func(res *dns.Msg) {
+		if ttl := res.Answer[0].Header().Ttl; ttl == 0 || ttl > 300 {
+			t.Errorf("saved TTL = %d; want time left", ttl)
+		}
+	})
+
+	r = newResolver()
+	if err := r.LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lookup(r, 1)
+
+	// snapshots are saved periodically and loaded on start
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r = newResolver(MiekgDNSSnapshot(ctx, path, 10*time.Millisecond))
+	lookup(r, 2)
+	for i := 0; i < 100; i++ {
+		if b, err := ioutil.ReadFile(path); err == nil && strings.Contains(string(b), "snapshot.test.") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r = newResolver(MiekgDNSSnapshot(ctx, path, time.Hour))
+	lookup(r, 2)
+	// nil context saves until the process exits
+	r = newResolver(MiekgDNSSnapshot(nil, path, time.Hour))
+	lookup(r, 2)
+
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMiekgDNSResolver("127.0.0.1:53", MiekgDNSCache(gcache.New(10).Build()), MiekgDNSSnapshot(ctx, path, time.Hour)); err == nil {
+		t.Error("NewMiekgDNSResolver() with broken snapshot succeeded; want error")
+	}
+}
+
+func TestMiekgDNSResolver_SaveToExpired(t *testing.T) {
+	dns.HandleFunc("expired.snapshot.test.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`expired.snapshot.test. 300 IN TXT "v=spf1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("expired.snapshot.test.")
+
+	// the cache keeps time of its own, the response outlives its expiration
+	clock := NewFakeClock(time.Now())
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr,
+		MiekgDNSCache(gcache.New(10).Simple().Build()), MiekgDNSClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.LookupTXT("expired.snapshot.test."); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(301 * time.Second)
+	var buf bytes.Buffer
+	if err := r.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var dump CacheDump
+	if err := dump.UnmarshalJSON(buf.Bytes()); err != nil || len(dump) != 0 {
+		t.Errorf("SaveTo() = %s, %v; want no expired responses", buf.String(), err)
+	}
+}
@@ -1,12 +1,107 @@
 package spf
 
 import (
+	"context"
 	"net"
 	"sync"
+	"time"
 )
 
-// DNSResolver implements Resolver using local DNS
-type DNSResolver struct{}
+// DNSResolver implements Resolver using net.Resolver, the system resolver
+// by default. The zero value is ready to use.
+//
+// Responses of net.Resolver are limited to the records asked for, hence
+// ResponseExtras have no TTL, Size, Authority and Additional, and CNAME
+// chains are followed transparently.
+type DNSResolver struct {
+	resolver *net.Resolver
+	ctx      context.Context
+	timeout  time.Duration
+}
+
+// DNSResolverOption sets an optional parameter of DNSResolver.
+type DNSResolverOption func(r *DNSResolver)
+
+// DNSResolverAddr makes lookups go to the DNS server at addr ("host:port")
+// instead of those of the system, using network of the lookup: UDP with
+// fallback to TCP for truncated responses.
+func DNSResolverAddr(addr string) DNSResolverOption {
+	return DNSResolverDialer(&net.Dialer{}, "", addr)
+}
+
+// DNSResolverDialer sets the dialer connecting to the DNS server at addr,
+// the system one if addr is empty. Non-empty network ("udp" or "tcp") makes
+// all lookups use it.
+func DNSResolverDialer(d *net.Dialer, network, addr string) DNSResolverOption {
+	return func(r *DNSResolver) {
+		if d == nil {
+			d = &net.Dialer{}
+		}
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, n, a string) (net.Conn, error) {
+				if network != "" {
+					n = network
+				}
+				if addr != "" {
+					a = addr
+				}
+				return d.DialContext(ctx, n, a)
+			},
+		}
+	}
+}
+
+// DNSResolverResolver sets net.Resolver making the lookups.
+func DNSResolverResolver(nr *net.Resolver) DNSResolverOption {
+	return func(r *DNSResolver) {
+		r.resolver = nr
+	}
+}
+
+// DNSResolverContext sets the context of the lookups, context.Background()
+// by default.
+func DNSResolverContext(ctx context.Context) DNSResolverOption {
+	return func(r *DNSResolver) {
+		r.ctx = ctx
+	}
+}
+
+// DNSResolverTimeout limits duration of each lookup, failing with
+// ErrDNSTemperror when exceeded.
+func DNSResolverTimeout(d time.Duration) DNSResolverOption {
+	return func(r *DNSResolver) {
+		r.timeout = d
+	}
+}
+
+// NewDNSResolver returns DNSResolver with the options applied.
+func NewDNSResolver(opts ...DNSResolverOption) *DNSResolver {
+	r := &DNSResolver{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *DNSResolver) netResolver() *net.Resolver {
+	if r.resolver == nil {
+		return net.DefaultResolver
+	}
+	return r.resolver
+}
+
+// context returns the context of a lookup
+func (r *DNSResolver) context() (context.Context, context.CancelFunc) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
+	}
+	return context.WithCancel(ctx)
+}
 
 func errDNS(e error) error {
 	if e == nil {
@@ -31,10 +126,34 @@ func errDNS(e error) error {
 	return ErrDNSTemperror
 }
 
+// stdExtras returns ResponseExtras based on number of answers found and
+// queries made. Standard library does not expose TTLs and sizes of responses.
+func stdExtras(n, queries int) *ResponseExtras {
+	e := &ResponseExtras{Void: n == 0, Answers: n, Queries: queries}
+	if e.Void {
+		e.VoidLookups = 1
+	}
+	return e
+}
+
+// lookupIP returns addresses of the name, asking for both A and AAAA
+func (r *DNSResolver) lookupIP(name string) ([]net.IP, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	addrs, err := r.netResolver().LookupIPAddr(ctx, name)
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, err
+}
+
 // LookupTXTStrict returns DNS TXT records for the given name, however it
 // will return ErrDNSPermerror upon NXDOMAIN (RCODE 3)
-func (r *DNSResolver) LookupTXTStrict(name string) ([]string, error) {
-	txts, err := net.LookupTXT(name)
+func (r *DNSResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	txts, err := r.netResolver().LookupTXT(ctx, name)
 
 	if dnsErr, ok := err.(*net.DNSError); ok {
 		// That is the most reliable way I found to detect Permerror
@@ -49,71 +168,81 @@ func (r *DNSResolver) LookupTXTStrict(name string) ([]string, error) {
 		//  the mechanism continues as if the server returned no error (RCODE
 		//  0) and zero answer records.
 		if dnsErr.Err == "no such host" {
-			return nil, ErrDNSPermerror
+			return nil, stdExtras(0, 1), ErrDNSPermerror
 		}
 	}
 
 	err = errDNS(err)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return txts, nil
+	return txts, stdExtras(len(txts), 1), nil
 }
 
 // LookupTXT returns the DNS TXT records for the given domain name.
-func (r *DNSResolver) LookupTXT(name string) ([]string, error) {
-	txts, err := net.LookupTXT(name)
+func (r *DNSResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	txts, err := r.netResolver().LookupTXT(ctx, name)
 	err = errDNS(err)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return txts, nil
+	return txts, stdExtras(len(txts), 1), nil
 }
 
 // Exists is used for a DNS A RR lookup (even when the
 // connection type is IPv6).  If any A record is returned, this
 // mechanism matches.
-func (r *DNSResolver) Exists(name string) (bool, error) {
-	ips, err := net.LookupIP(name)
+func (r *DNSResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	ips, err := r.lookupIP(name)
 	err = errDNS(err)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
-	return len(ips) > 0, nil
+	return len(ips) > 0, stdExtras(len(ips), 2), nil
 }
 
 type hit struct {
-	found bool
-	err   error
+	found  bool
+	extras *ResponseExtras
+	err    error
 }
 
 // MatchIP provides an address lookup, which should be done on the name
 // using the type of lookup (A or AAAA).
 // Then IPMatcherFunc used to compare checked IP to the returned address(es).
 // If any address matches, the mechanism matches
-func (r *DNSResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, error) {
-	ips, err := net.LookupIP(name)
+func (r *DNSResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	ips, err := r.lookupIP(name)
 	err = errDNS(err)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
+	extras := stdExtras(len(ips), 2)
 	for _, ip := range ips {
 		if m, e := matcher(ip, name); m || e != nil {
-			return m, e
+			return m, extras, e
 		}
 	}
-	return false, nil
+	return false, extras, nil
 }
 
 // MatchMX is similar to MatchIP but first performs an MX lookup on the
 // name.  Then it performs an address lookup on each MX name returned.
 // Then IPMatcherFunc used to compare checked IP to the returned address(es).
-// If any address matches, the mechanism matches
-func (r *DNSResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, error) {
-	mxs, err := net.LookupMX(name)
+// If any address matches, the mechanism matches.
+// More than 10 MX records produce ErrTooManyMXNames.
+func (r *DNSResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	ctx, cancel := r.context()
+	mxs, err := r.netResolver().LookupMX(ctx, name)
+	cancel()
 	err = errDNS(err)
 	if err != nil {
-		return false, err
+		return false, nil, err
+	}
+	if len(mxs) > MaxMXNames {
+		return false, stdExtras(len(mxs), 1), ErrTooManyMXNames
 	}
 
 	var wg sync.WaitGroup
@@ -122,8 +251,8 @@ func (r *DNSResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, error)
 	for _, mx := range mxs {
 		wg.Add(1)
 		go func(name string) {
-			found, err := r.MatchIP(name, matcher)
-			hits <- hit{found, err}
+			found, extras, err := r.MatchIP(name, matcher)
+			hits <- hit{found, extras, err}
 			wg.Done()
 		}(mx.Host)
 	}
@@ -133,11 +262,37 @@ func (r *DNSResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, error)
 		close(hits)
 	}()
 
+	extras := stdExtras(len(mxs), 1)
 	for h := range hits {
-		if h.found || h.err != nil {
-			return h.found, h.err
+		extras = extras.merge(h.extras)
+		extras.Void = len(mxs) == 0
+		if h.found && err == nil {
+			return true, extras, nil
+		}
+		// keep merging extras of lookups already made, the first error wins
+		if h.err != nil && err == nil {
+			err = h.err
 		}
 	}
 
-	return false, nil
+	return false, extras, err
+}
+
+// LookupPTR returns names of PTR records of the ip
+func (r *DNSResolver) LookupPTR(ip net.IP) ([]string, *ResponseExtras, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+	names, err := r.netResolver().LookupAddr(ctx, ip.String())
+	err = errDNS(err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return names, stdExtras(len(names), 1), nil
+}
+
+// ConfirmPTR checks if address records of the name include the ip
+func (r *DNSResolver) ConfirmPTR(name string, ip net.IP) (bool, *ResponseExtras, error) {
+	return r.MatchIP(name, func(a net.IP, _ string) (bool, error) {
+		return a.Equal(ip), nil
+	})
 }
@@ -0,0 +1,56 @@
+package spf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestDNSResolver(t *testing.T) {
+	dns.HandleFunc("std.test.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`std.test. 0 IN TXT "v=spf1 -all"`,
+		},
+		dns.TypeA: {
+			`std.test. 0 IN A 10.0.0.1`,
+		},
+		dns.TypeMX: {
+			`std.test. 0 IN MX 10 std.test.`,
+		},
+	}))
+	defer dns.HandleRemove("std.test.")
+
+	addr := testResolver.(*miekgDNSResolver).serverAddr
+	r := NewDNSResolver(DNSResolverAddr(addr), DNSResolverTimeout(time.Second))
+
+	txts, extras, err := r.LookupTXTStrict("std.test.")
+	if err != nil || len(txts) != 1 || txts[0] != "v=spf1 -all" {
+		t.Errorf("LookupTXTStrict() = %q, %v; want the record", txts, err)
+	}
+	if extras.Void || extras.Answers != 1 || extras.Queries != 1 {
+		t.Errorf("LookupTXTStrict() extras = %+v; want 1 answer of 1 query", extras)
+	}
+
+	_, extras, err = r.LookupTXTStrict("nxdomain.std.")
+	if err != ErrDNSPermerror || !extras.Void || extras.VoidLookups != 1 {
+		t.Errorf("LookupTXTStrict() = %+v, %v; want void, %v", extras, err, ErrDNSPermerror)
+	}
+
+	match := func(ip net.IP, _ string) (bool, error) { return ip.Equal(net.IPv4(10, 0, 0, 1)), nil }
+	found, extras, err := r.MatchIP("std.test.", match)
+	if !found || err != nil || extras.Queries != 2 {
+		t.Errorf("MatchIP() = %t, %+v, %v; want match of 2 queries", found, extras, err)
+	}
+	found, _, err = r.MatchMX("std.test.", match)
+	if !found || err != nil {
+		t.Errorf("MatchMX() = %t, %v; want match", found, err)
+	}
+
+	// the local server doesn't listen on TCP
+	r = NewDNSResolver(DNSResolverDialer(nil, "tcp", addr), DNSResolverTimeout(time.Second))
+	if _, _, err = r.LookupTXT("std.test."); err != ErrDNSTemperror {
+		t.Errorf("LookupTXT() over TCP err = %v; want %v", err, ErrDNSTemperror)
+	}
+}
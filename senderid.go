@@ -0,0 +1,89 @@
+package spf
+
+import (
+	"strings"
+)
+
+// Scopes of Sender ID records
+// https://tools.ietf.org/html/rfc4406#section-3.1
+const (
+	ScopeMFrom = "mfrom"
+	ScopePRA   = "pra"
+)
+
+// EvaluateSenderID makes evaluation fall back to Sender ID record of
+// "mfrom" scope, e.g. "spf2.0/mfrom,pra", for domains having no SPF record.
+// Such records are evaluated as SPF records, their terms have the same
+// syntax and meaning. Records of "pra" scope only are ignored. Off by
+// default, as RFC 7208 doesn't take Sender ID records into account.
+// https://tools.ietf.org/html/rfc4406
+func EvaluateSenderID(v bool) Option {
+	return func(p *parser) {
+		p.senderID = v
+	}
+}
+
+// ParseSenderID returns scopes of Sender ID record, false if the record
+// isn't Sender ID record.
+func ParseSenderID(record string) (scopes []string, ok bool) {
+	version, _ := senderIDVersion(record)
+	if version == "" {
+		return nil, false
+	}
+	for _, s := range strings.Split(version[len("spf2.0/"):], ",") {
+		switch s = strings.ToLower(s); s {
+		case ScopeMFrom, ScopePRA:
+			scopes = append(scopes, s)
+		default:
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+// senderIDVersion returns version section of the record if it looks like
+// Sender ID record, along with the rest of the record
+func senderIDVersion(record string) (version, rest string) {
+	const prefix = "spf2.0/"
+	if len(record) <= len(prefix) || !strings.EqualFold(record[:len(prefix)], prefix) {
+		return "", ""
+	}
+	end := strings.IndexAny(record, " \t")
+	if end < 0 {
+		end = len(record)
+	}
+	return record[:end], record[end:]
+}
+
+// filterSenderID returns Sender ID record of "mfrom" scope, if there is one
+func filterSenderID(txt []string) (string, error) {
+	var records []string
+	for _, s := range txt {
+		scopes, _ := ParseSenderID(s)
+		for _, scope := range scopes {
+			if scope == ScopeMFrom {
+				records = append(records, s)
+				break
+			}
+		}
+	}
+	switch len(records) {
+	case 0:
+		return "", nil
+	case 1:
+		return records[0], nil
+	default:
+		return "", ErrTooManySPFRecords
+	}
+}
+
+// senderIDAsSPF returns Sender ID record with the version section replaced by
+// "v=spf1" padded with spaces, so positions of terms stay the same. Other
+// records are returned as is.
+func senderIDAsSPF(record string) string {
+	version, rest := senderIDVersion(record)
+	if version == "" {
+		return record
+	}
+	return "v=spf1" + strings.Repeat(" ", len(version)-len("v=spf1")) + rest
+}
@@ -0,0 +1,90 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseSenderID(t *testing.T) {
+	tests := []struct {
+		record string
+		scopes []string
+		ok     bool
+	}{
+		{"spf2.0/pra ip4:10.0.0.0/8 -all", []string{ScopePRA}, true},
+		{"spf2.0/mfrom,pra -all", []string{ScopeMFrom, ScopePRA}, true},
+		{"SPF2.0/MFROM", []string{ScopeMFrom}, true},
+		{"spf2.0/pra,helo -all", nil, false},
+		{"spf2.0/ -all", nil, false},
+		{"v=spf1 -all", nil, false},
+		{"spf2.0", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.record, func(t *testing.T) {
+			scopes, ok := ParseSenderID(tt.record)
+			if !reflect.DeepEqual(scopes, tt.scopes) || ok != tt.ok {
+				t.Errorf("ParseSenderID() = %v, %t; want %v, %t", scopes, ok, tt.scopes, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEvaluateSenderID(t *testing.T) {
+	testResolverCache.Purge()
+
+	zones := map[string][]string{
+		"mfrom.senderid.example.": {
+			`mfrom.senderid.example. 300 IN TXT "spf2.0/mfrom,pra ip4:10.0.0.0/8 -all"`,
+		},
+		"pra.senderid.example.": {
+			`pra.senderid.example. 300 IN TXT "spf2.0/pra ip4:10.0.0.0/8 -all"`,
+		},
+		"both.senderid.example.": {
+			`both.senderid.example. 300 IN TXT "spf2.0/mfrom ip4:10.0.0.0/8 -all"`,
+			`both.senderid.example. 300 IN TXT "v=spf1 -all"`,
+		},
+		"bad.senderid.example.": {
+			`bad.senderid.example. 300 IN TXT "spf2.0/mfrom ip4:10.0.0.300 ip4:10.0.0.0/8 -all"`,
+		},
+	}
+	for name, records := range zones {
+		dns.HandleFunc(name, zone(map[uint16][]string{dns.TypeTXT: records}))
+		defer dns.HandleRemove(name)
+	}
+
+	tests := []struct {
+		domain   string
+		senderID Result
+		spf      Result
+	}{
+		{"mfrom.senderid.example", Pass, None},
+		{"pra.senderid.example", None, None},
+		{"both.senderid.example", Fail, Fail},
+		{"bad.senderid.example", Permerror, None},
+	}
+	ip := net.ParseIP("10.0.0.1")
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			if r, _, _, err := CheckHost(ip, tt.domain, "", WithResolver(testResolver)); r != tt.spf {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, tt.spf)
+			}
+			if r, _, _, err := CheckHost(ip, tt.domain, "", WithResolver(testResolver), EvaluateSenderID(true)); r != tt.senderID {
+				t.Errorf("CheckHost(EvaluateSenderID) = %s, %v; want %s", r, err, tt.senderID)
+			}
+		})
+	}
+
+	// positions of terms refer to the published record
+	_, _, record, err := CheckHost(ip, "bad.senderid.example", "", WithResolver(testResolver), EvaluateSenderID(true))
+	var se SyntaxError
+	if !errors.As(err, &se) {
+		t.Fatalf("CheckHost() error = %v; want SyntaxError", err)
+	}
+	if start, end := se.Position(); record[start:end] != "ip4:10.0.0.300" {
+		t.Errorf("Position() = %d, %d: %q; want ip4:10.0.0.300", start, end, record[start:end])
+	}
+}
@@ -0,0 +1,80 @@
+package spf
+
+import (
+	"net"
+	"strings"
+)
+
+// SessionResult is the outcome of EvaluateSession
+type SessionResult struct {
+	Helo     *CheckResult `json:"helo,omitempty"`     // check of HELO identity, nil if not checked
+	MailFrom *CheckResult `json:"mailFrom,omitempty"` // check of MAIL FROM identity, nil if not checked
+	Trace    Trace        `json:"trace"`              // data for "Received-SPF" header field of the deciding check
+}
+
+// Result returns the result of the deciding check.
+func (r *SessionResult) Result() Result {
+	return r.Trace.Result
+}
+
+// EvaluateSession checks identities of SMTP session the way RFC 7208
+// sections 2.3 and 2.4 describe:
+//   - HELO identity is checked first, unless the name given is not a fully
+//     qualified domain name (e.g. an address literal);
+//   - "fail" of HELO identity, hardened one included (see WithHardening), is
+//     conclusive, MAIL FROM is not checked then;
+//   - MAIL FROM identity is checked otherwise, the null reverse-path
+//     (empty mailFrom or "<>") uses "postmaster@" and the HELO name,
+//     reusing the result of HELO check;
+//   - a reverse-path without local-part uses "postmaster".
+//
+// Trace of the result is of the deciding check: MAIL FROM identity if it was
+// checked, HELO identity otherwise.
+//
+// The options are applied to both checks, HeloDomain is set to helo.
+// Note that LimitedResolver given with WithResolver limits lookups of both
+// checks together.
+func EvaluateSession(ip net.IP, helo, mailFrom string, opts ...Option) *SessionResult {
+	helo = strings.TrimSuffix(helo, ".")
+	mailFrom = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(mailFrom), "<"), ">")
+	opts = append([]Option{HeloDomain(helo)}, opts...)
+
+	r := &SessionResult{}
+	if isHeloIdentity(helo) {
+		r.Helo = checkIdentity(ip, "helo", helo, "postmaster@"+helo, helo, mailFrom, opts)
+		if r.Helo.Trace.Result == Fail {
+			r.Trace = r.Helo.Trace
+			return r
+		}
+	}
+
+	switch {
+	case mailFrom == "" && r.Helo != nil:
+		r.MailFrom = r.Helo
+	case mailFrom == "":
+		r.Trace = Trace{Result: None, ClientIP: ip, Helo: helo, Identity: "helo"}
+		return r
+	default:
+		// https://tools.ietf.org/html/rfc7208#section-4.3
+		sender := ParseAddrSpec(mailFrom, "")
+		r.MailFrom = checkIdentity(ip, "mailfrom", sender.Domain, sender.String(), helo, mailFrom, opts)
+	}
+	r.Trace = r.MailFrom.Trace
+	return r
+}
+
+// checkIdentity evaluates the identity and fills in its Trace
+func checkIdentity(ip net.IP, identity, domain, sender, helo, mailFrom string, opts []Option) *CheckResult {
+	r := CheckHostDetailed(ip, domain, sender, opts...)
+	r.Trace.Identity = identity
+	r.Trace.Helo = helo
+	r.Trace.EnvelopeFrom = mailFrom
+	return r
+}
+
+// isHeloIdentity returns true if the name given in HELO could be checked
+// https://tools.ietf.org/html/rfc7208#section-2.3
+func isHeloIdentity(helo string) bool {
+	return strings.Contains(helo, ".") && !strings.HasPrefix(helo, "[") && net.ParseIP(helo) == nil &&
+		isDomainName(helo)
+}
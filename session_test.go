@@ -0,0 +1,108 @@
+package spf
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestEvaluateSession(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("session.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`session.example. 300 IN TXT "v=spf1 ip4:10.1.0.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("session.example.")
+
+	dns.HandleFunc("mx.session.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`mx.session.example. 300 IN TXT "v=spf1 ip4:10.1.0.1 ip4:10.2.0.1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("mx.session.example.")
+
+	tests := []struct {
+		name           string
+		ip             string
+		helo           string
+		mailFrom       string
+		heloResult     Result // result of HELO check, -1 if not checked
+		mailFromResult Result // result of MAIL FROM check, -1 if not checked
+		result         Result
+		identity       string
+	}{
+		{"both", "10.1.0.1", "mx.session.example", "john@session.example", Pass, Pass, Pass, "mailfrom"},
+		{"mailfrom decides", "10.2.0.1", "mx.session.example", "<john@session.example>", Pass, Fail, Fail, "mailfrom"},
+		{"helo fail", "10.1.0.2", "mx.session.example.", "john@session.example", Fail, -1, Fail, "helo"},
+		{"null reverse-path", "10.1.0.1", "mx.session.example", "<>", Pass, Pass, Pass, "helo"},
+		{"address literal", "10.1.0.2", "[10.1.0.2]", "john@session.example", -1, Pass, Pass, "mailfrom"},
+		{"no local-part", "10.1.0.2", "localhost", "session.example", -1, Pass, Pass, "mailfrom"},
+		{"quoted local-part", "10.1.0.2", "localhost", `"john@home"@session.example`, -1, Pass, Pass, "mailfrom"},
+		{"no identity", "10.1.0.2", "[10.1.0.2]", "", -1, -1, None, "helo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			r := EvaluateSession(ip, tt.helo, tt.mailFrom, WithResolver(testResolver))
+			check := func(name string, c *CheckResult, want Result) {
+				t.Helper()
+				switch {
+				case c == nil && want >= 0:
+					t.Errorf("%s not checked; want %s", name, want)
+				case c != nil && want < 0:
+					t.Errorf("%s checked with %s; want not checked", name, c.Result)
+				case c != nil && c.Result != want:
+					t.Errorf("%s = %s, %v; want %s", name, c.Result, c.Err, want)
+				}
+			}
+			check("HELO", r.Helo, tt.heloResult)
+			check("MAIL FROM", r.MailFrom, tt.mailFromResult)
+			if r.Result() != tt.result || r.Trace.Identity != tt.identity {
+				t.Errorf("Trace = %s, identity %q; want %s, %q", r.Result(), r.Trace.Identity, tt.result, tt.identity)
+			}
+			if !r.Trace.ClientIP.Equal(ip) {
+				t.Errorf("Trace.ClientIP = %v; want %v", r.Trace.ClientIP, ip)
+			}
+		})
+	}
+}
+
+func TestEvaluateSession_nullReversePathReusesHelo(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("mx.session.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`mx.session.example. 300 IN TXT "v=spf1 ip4:10.1.0.1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("mx.session.example.")
+
+	r := EvaluateSession(net.ParseIP("10.1.0.1"), "mx.session.example", "", WithResolver(testResolver))
+	if r.Helo == nil || r.MailFrom != r.Helo {
+		t.Fatalf("MailFrom = %p; want HELO check %p", r.MailFrom, r.Helo)
+	}
+	if r.Trace.EnvelopeFrom != "" || r.Trace.Helo != "mx.session.example" {
+		t.Errorf("Trace = %+v", r.Trace)
+	}
+}
+
+func TestEvaluateSession_hardenedHeloFail(t *testing.T) {
+	r, err := NewOverlayResolver(testResolver, map[string][]string{
+		"mx.hardened.session.example": {"v=spf1 ip4:10.1.0.1 ~all"},
+		"hardened.session.example":    {"v=spf1 ip4:10.1.0.0/24 -all"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := EvaluateSession(net.ParseIP("10.1.0.2"), "mx.hardened.session.example", "john@hardened.session.example",
+		WithResolver(r), WithHardening(Hardening{Softfail: Fail}))
+	if s.Helo == nil || s.MailFrom != nil {
+		t.Fatalf("Helo = %v, MailFrom = %v; want HELO checked only", s.Helo, s.MailFrom)
+	}
+	if s.Result() != Fail || s.Trace.Identity != "helo" {
+		t.Errorf("EvaluateSession() = %s, %q; want fail of helo", s.Result(), s.Trace.Identity)
+	}
+}
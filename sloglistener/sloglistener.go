@@ -0,0 +1,210 @@
+//go:build go1.21
+
+// Package sloglistener provides spf.Listener writing the evaluation to a
+// log/slog Logger: a record per evaluated directive and a record per checked
+// domain, with the attribute keys listed below.
+package sloglistener
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/redsift/spf"
+)
+
+// Messages of the records
+const (
+	CheckMessage     = "spf check"
+	DirectiveMessage = "spf directive"
+)
+
+// Attribute keys of the records
+const (
+	KeyIP             = "ip"              // checked IP, check records only
+	KeyDomain         = "domain"          // checked domain
+	KeySender         = "sender"          // checked sender, check records only
+	KeyDepth          = "depth"           // 0 for the checked domain, grows with every nested include or redirect
+	KeyRecord         = "record"          // SPF record of the domain, check records only
+	KeyQualifier      = "qualifier"       // directive records only
+	KeyMechanism      = "mechanism"       // directive records only
+	KeyValue          = "value"           // the value as published, directive records only
+	KeyEffectiveValue = "effective_value" // the value after macro expansion, directive records only
+	KeyUnused         = "unused"          // true for directives not evaluated, directive records only
+	KeyMatched        = "matched"         // the directive matched, directive records only
+	KeyResult         = "result"
+	KeyExplanation    = "explanation"
+	KeyError          = "error"
+)
+
+// Option sets an optional parameter of Listener.
+type Option func(*Listener)
+
+// CheckLevel sets the level of check records, slog.LevelInfo by default.
+func CheckLevel(l slog.Level) Option {
+	return func(s *Listener) {
+		s.checkLevel = l
+	}
+}
+
+// DirectiveLevel sets the level of directive records, slog.LevelDebug by
+// default.
+func DirectiveLevel(l slog.Level) Option {
+	return func(s *Listener) {
+		s.directiveLevel = l
+	}
+}
+
+// New returns Listener writing the records to the logger.
+func New(logger *slog.Logger, opts ...Option) *Listener {
+	s := &Listener{
+		logger:         logger,
+		checkLevel:     slog.LevelInfo,
+		directiveLevel: slog.LevelDebug,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Listener is spf.Listener writing the evaluation to slog.Logger.
+// It follows a single evaluation at a time, use a Listener per check.
+type Listener struct {
+	logger         *slog.Logger
+	checkLevel     slog.Level
+	directiveLevel slog.Level
+	checks         []check         // domains being evaluated, the innermost last
+	ctx            context.Context // given by CheckHostContext for the next check
+}
+
+// check is the state of a domain being evaluated
+type check struct {
+	ctx       context.Context
+	ip        net.IP
+	domain    string
+	sender    string
+	record    string
+	effective string // effective value of the directive being evaluated
+}
+
+func (s *Listener) top() *check {
+	if len(s.checks) == 0 {
+		return &check{ctx: context.Background()}
+	}
+	return &s.checks[len(s.checks)-1]
+}
+
+func (s *Listener) log(c *check, level slog.Level, msg string, attrs ...slog.Attr) {
+	s.logger.LogAttrs(c.ctx, level, msg, attrs...)
+}
+
+func (s *Listener) enabled(c *check, level slog.Level) bool {
+	return s.logger.Enabled(c.ctx, level)
+}
+
+// CheckHostContext implements spf.ContextListener, the records of the check
+// are logged with ctx.
+func (s *Listener) CheckHostContext(ctx context.Context, ip net.IP, domain, sender string) {
+	s.ctx = ctx
+}
+
+// CheckHost implements spf.Listener
+func (s *Listener) CheckHost(ip net.IP, domain, sender string) {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = s.top().ctx
+	}
+	s.ctx = nil
+	s.checks = append(s.checks, check{ctx: ctx, ip: ip, domain: domain, sender: sender})
+}
+
+// CheckHostResult implements spf.Listener
+func (s *Listener) CheckHostResult(r spf.Result, explanation string, err error) {
+	c := *s.top()
+	if len(s.checks) > 0 {
+		s.checks = s.checks[:len(s.checks)-1]
+	}
+	if !s.enabled(&c, s.checkLevel) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String(KeyIP, c.ip.String()),
+		slog.String(KeyDomain, c.domain),
+		slog.String(KeySender, c.sender),
+		slog.Int(KeyDepth, len(s.checks)),
+		slog.String(KeyRecord, c.record),
+		slog.String(KeyResult, r.String()),
+	}
+	s.log(&c, s.checkLevel, CheckMessage, appendOutcome(attrs, explanation, err)...)
+}
+
+// SPFRecord implements spf.Listener
+func (s *Listener) SPFRecord(record string) {
+	s.top().record = record
+}
+
+// Directive implements spf.Listener
+func (s *Listener) Directive(unused bool, qualifier, mechanism, value, effectiveValue string) {
+	c := s.top()
+	if !unused {
+		c.effective = effectiveValue
+		return
+	}
+	if !s.enabled(c, s.directiveLevel) {
+		return
+	}
+	s.log(c, s.directiveLevel, DirectiveMessage,
+		slog.String(KeyDomain, c.domain),
+		slog.Int(KeyDepth, len(s.checks)-1),
+		slog.String(KeyQualifier, qualifier),
+		slog.String(KeyMechanism, mechanism),
+		slog.String(KeyValue, value),
+		slog.Bool(KeyUnused, true),
+	)
+}
+
+// NonMatch implements spf.Listener
+func (s *Listener) NonMatch(qualifier, mechanism, value string, r spf.Result, err error) {
+	s.directive(false, qualifier, mechanism, value, r, "", err)
+}
+
+// Match implements spf.Listener
+func (s *Listener) Match(qualifier, mechanism, value string, r spf.Result, explanation string, err error) {
+	s.directive(true, qualifier, mechanism, value, r, explanation, err)
+}
+
+// MatchingIP implements spf.Listener
+func (s *Listener) MatchingIP(qualifier, mechanism, value string, fqdn string, ipn net.IPNet, host string, ip net.IP) {
+}
+
+func (s *Listener) directive(matched bool, qualifier, mechanism, value string, r spf.Result, explanation string, err error) {
+	c := s.top()
+	effective := c.effective
+	c.effective = ""
+	if !s.enabled(c, s.directiveLevel) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String(KeyDomain, c.domain),
+		slog.Int(KeyDepth, len(s.checks)-1),
+		slog.String(KeyQualifier, qualifier),
+		slog.String(KeyMechanism, mechanism),
+		slog.String(KeyValue, value),
+		slog.String(KeyEffectiveValue, effective),
+		slog.Bool(KeyMatched, matched),
+		slog.String(KeyResult, r.String()),
+	}
+	s.log(c, s.directiveLevel, DirectiveMessage, appendOutcome(attrs, explanation, err)...)
+}
+
+// appendOutcome adds explanation and error attributes when they are set
+func appendOutcome(attrs []slog.Attr, explanation string, err error) []slog.Attr {
+	if explanation != "" {
+		attrs = append(attrs, slog.String(KeyExplanation, explanation))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String(KeyError, err.Error()))
+	}
+	return attrs
+}
@@ -0,0 +1,133 @@
+//go:build go1.21
+
+package sloglistener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/redsift/spf"
+)
+
+func TestListener(t *testing.T) {
+	r, err := spf.NewOverlayResolver(nil, map[string][]string{
+		"slog.example":     {"v=spf1 ip4:192.0.2.1 include:inc.slog.example -all exp=exp.slog.example"},
+		"inc.slog.example": {"v=spf1 a:%{d} ?all", "A 192.0.2.2"},
+		"exp.slog.example": {`TXT "not %{i}"`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	res, _, _, _ := spf.CheckHost(net.ParseIP("192.0.2.3"), "slog.example", "john@slog.example",
+		spf.WithResolver(r), spf.WithListener(New(logger)))
+	if res != spf.Fail {
+		t.Fatalf("CheckHost() = %s; want fail", res)
+	}
+
+	var got []map[string]interface{}
+	for dec := json.NewDecoder(&buf); dec.More(); {
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		delete(m, "time")
+		got = append(got, m)
+	}
+	want := []map[string]interface{}{
+		{"level": "DEBUG", "msg": DirectiveMessage, KeyDomain: "slog.example.", KeyDepth: 0.,
+			KeyQualifier: "+", KeyMechanism: "v", KeyValue: "spf1", KeyEffectiveValue: "",
+			KeyMatched: false, KeyResult: "none"},
+		{"level": "DEBUG", "msg": DirectiveMessage, KeyDomain: "slog.example.", KeyDepth: 0.,
+			KeyQualifier: "+", KeyMechanism: "ip4", KeyValue: "192.0.2.1", KeyEffectiveValue: "192.0.2.1",
+			KeyMatched: false, KeyResult: "pass"},
+		{"level": "DEBUG", "msg": DirectiveMessage, KeyDomain: "inc.slog.example.", KeyDepth: 1.,
+			KeyQualifier: "+", KeyMechanism: "v", KeyValue: "spf1", KeyEffectiveValue: "",
+			KeyMatched: false, KeyResult: "none"},
+		{"level": "DEBUG", "msg": DirectiveMessage, KeyDomain: "inc.slog.example.", KeyDepth: 1.,
+			KeyQualifier: "+", KeyMechanism: "a", KeyValue: "%{d}", KeyEffectiveValue: "inc.slog.example.",
+			KeyMatched: false, KeyResult: "pass"},
+		{"level": "DEBUG", "msg": DirectiveMessage, KeyDomain: "inc.slog.example.", KeyDepth: 1.,
+			KeyQualifier: "?", KeyMechanism: "all", KeyValue: "", KeyEffectiveValue: "",
+			KeyMatched: true, KeyResult: "neutral"},
+		{"level": "INFO", "msg": CheckMessage, KeyIP: "192.0.2.3", KeyDomain: "inc.slog.example.",
+			KeySender: "john@slog.example", KeyDepth: 1., KeyRecord: "v=spf1 a:%{d} ?all", KeyResult: "neutral"},
+		{"level": "DEBUG", "msg": DirectiveMessage, KeyDomain: "slog.example.", KeyDepth: 0.,
+			KeyQualifier: "+", KeyMechanism: "include", KeyValue: "inc.slog.example", KeyEffectiveValue: "inc.slog.example.",
+			KeyMatched: false, KeyResult: "none"},
+		{"level": "DEBUG", "msg": DirectiveMessage, KeyDomain: "slog.example.", KeyDepth: 0.,
+			KeyQualifier: "-", KeyMechanism: "all", KeyValue: "", KeyEffectiveValue: "",
+			KeyMatched: true, KeyResult: "fail", KeyExplanation: "not 192.0.2.3"},
+		{"level": "INFO", "msg": CheckMessage, KeyIP: "192.0.2.3", KeyDomain: "slog.example.",
+			KeySender: "john@slog.example", KeyDepth: 0., KeyRecord: "v=spf1 ip4:192.0.2.1 include:inc.slog.example -all exp=exp.slog.example",
+			KeyResult: "fail", KeyExplanation: "not 192.0.2.3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestListener_Levels(t *testing.T) {
+	r, err := spf.NewOverlayResolver(nil, map[string][]string{
+		"slog.example": {"v=spf1 ip4:192.0.2.1 -all"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	l := New(logger, CheckLevel(slog.LevelWarn), DirectiveLevel(slog.LevelInfo))
+	spf.CheckHost(net.ParseIP("192.0.2.1"), "slog.example", "", spf.WithResolver(r), spf.WithListener(l))
+
+	var lines int
+	for _, b := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		lines++
+		if !bytes.Contains(b, []byte("level=WARN")) || !bytes.Contains(b, []byte(`msg="`+CheckMessage+`"`)) {
+			t.Errorf("unexpected record %s", b)
+		}
+	}
+	if lines != 1 {
+		t.Errorf("got %d records; want 1:\n%s", lines, buf.Bytes())
+	}
+}
+
+type ctxKey struct{}
+
+// contextHandler records the context value of ctxKey of every record
+type contextHandler struct {
+	slog.Handler
+	values *[]string
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	v, _ := ctx.Value(ctxKey{}).(string)
+	*h.values = append(*h.values, r.Message+" "+v)
+	return nil
+}
+
+func TestListener_Context(t *testing.T) {
+	r, err := spf.NewOverlayResolver(nil, map[string][]string{
+		"slog.example": {"v=spf1 -all"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values []string
+	h := contextHandler{slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelDebug}), &values}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req-1")
+	spf.CheckHost(net.ParseIP("192.0.2.1"), "slog.example", "",
+		spf.WithResolver(r), spf.WithListener(New(slog.New(h))), spf.WithContext(ctx))
+
+	want := []string{DirectiveMessage + " req-1", DirectiveMessage + " req-1", CheckMessage + " req-1"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("records = %q; want %q", values, want)
+	}
+}
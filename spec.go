@@ -0,0 +1,100 @@
+package spf
+
+import (
+	"errors"
+)
+
+// Errors of limits enforced depending on Spec
+var (
+	ErrTooManyVoidLookups = errors.New("too many void lookups")
+	ErrTooManyMechanisms  = errors.New("too many mechanisms")
+)
+
+// Spec selects the specification evaluation follows.
+type Spec int
+
+const (
+	// RFC7208 is the current specification, used by default.
+	// More than 2 void lookups (see ResponseExtras.Void) made by
+	// mechanisms and "redirect" produce "permerror".
+	// https://tools.ietf.org/html/rfc7208#section-4.6.4
+	RFC7208 Spec = iota
+	// RFC4408 replicates verifiers built after the obsoleted RFC 4408,
+	// helping to explain discrepancies with them:
+	//   - void lookups are not limited;
+	//   - every mechanism and "redirect" evaluated counts against
+	//     the limit of 10 terms per check, not only those causing DNS lookups,
+	//     exceeding the limit produces "permerror".
+	// https://tools.ietf.org/html/rfc4408#section-10.1
+	RFC4408
+)
+
+// maxTerms4408 is the limit of terms of RFC4408 Spec
+const maxTerms4408 = 10
+
+func (s Spec) String() string {
+	switch s {
+	case RFC7208:
+		return "RFC 7208"
+	case RFC4408:
+		return "RFC 4408"
+	default:
+		return "unknown"
+	}
+}
+
+// WithSpec makes evaluation follow the specification, RFC7208 by default.
+func WithSpec(s Spec) Option {
+	return func(p *parser) {
+		p.spec = s
+	}
+}
+
+// counters keeps track of evaluated terms and void lookups of the whole check.
+// Counting is done when events are fired, hence events of concurrently
+// evaluated includes are counted twice: by the evaluation itself and then by
+// the parser they are replayed to.
+type counters struct {
+	voids  int
+	terms  int
+	errors [numErrorKinds]int // errors of terms in walker mode, by kind
+}
+
+// countLookup accounts the lookup made for the term
+func (p *parser) countLookup(t *token, extras *ResponseExtras) {
+	if t == nil || t.mechanism == tExp || extras == nil || !extras.Void {
+		return
+	}
+	p.counters.voids++
+}
+
+// countTerm accounts evaluated term
+func (p *parser) countTerm(t *token) {
+	if t.mechanism.isMechanism() && t.mechanism != tVersion || t.mechanism == tRedirect {
+		p.counters.terms++
+	}
+}
+
+func (c counters) add(o counters) counters {
+	return counters{voids: c.voids + o.voids, terms: c.terms + o.terms}
+}
+
+// exceeded returns the error if the limits of the Spec are exceeded
+func (c counters) exceeded(s Spec, l Limits) error {
+	switch s {
+	case RFC4408:
+		if c.terms > maxTerms4408 {
+			return ErrTooManyMechanisms
+		}
+	default:
+		if c.voids > l.VoidLookups {
+			return ErrTooManyVoidLookups
+		}
+	}
+	return nil
+}
+
+// limitsError returns the error if the check exceeded limits of the Spec
+func (p *parser) limitsError() error {
+	return p.counters.exceeded(p.spec, p.limits)
+}
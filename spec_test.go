@@ -0,0 +1,87 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+func TestWithSpec(t *testing.T) {
+	testResolverCache.Purge()
+
+	records := map[string]string{
+		"two.voids.example.":   "v=spf1 a:void1.voids.example mx:void2.voids.example -all",
+		"three.voids.example.": "v=spf1 a:void1.voids.example mx:void2.voids.example exists:void3.voids.example -all",
+		"inc.voids.example.":   "v=spf1 a:void1.voids.example include:two.voids.example -all",
+		"terms.example.": "v=spf1 ip4:10.0.0.1 ip4:10.0.0.2 ip4:10.0.0.3 ip4:10.0.0.4 ip4:10.0.0.5 " +
+			"ip4:10.0.0.6 ip4:10.0.0.7 ip4:10.0.0.8 ip4:10.0.0.9 ip4:10.0.0.10 ip4:10.0.0.11 -all",
+		"redirect.terms.example.": "v=spf1 ip4:10.0.0.1 ip4:10.0.0.2 ip4:10.0.0.3 ip4:10.0.0.4 ip4:10.0.0.5 " +
+			"ip4:10.0.0.6 ip4:10.0.0.7 ip4:10.0.0.8 ip4:10.0.0.9 redirect=last.terms.example",
+		"last.terms.example.": "v=spf1 -all",
+	}
+	for name, record := range records {
+		dns.HandleFunc(name, zone(map[uint16][]string{
+			dns.TypeTXT: {fmt.Sprintf(`%s 0 IN TXT "%s"`, name, record)},
+		}))
+		defer dns.HandleRemove(name)
+	}
+
+	tests := []struct {
+		domain string
+		ip     string
+		spec   Spec
+		r      Result
+		err    error
+	}{
+		{"two.voids.example", "10.0.0.1", RFC7208, Fail, nil},
+		{"three.voids.example", "10.0.0.1", RFC7208, Permerror, SyntaxError{&token{tExists, qPlus, "void3.voids.example", 52, 78}, ErrTooManyVoidLookups}},
+		{"three.voids.example", "10.0.0.1", RFC4408, Fail, nil},
+		{"inc.voids.example", "10.0.0.1", RFC7208, Permerror, SyntaxError{&token{tInclude, qPlus, "two.voids.example", 29, 54},
+			SyntaxError{&token{tMX, qPlus, "void2.voids.example", 29, 51}, ErrTooManyVoidLookups}}},
+		{"terms.example", "10.0.0.5", RFC4408, Pass, nil},
+		{"terms.example", "10.0.0.11", RFC7208, Pass, nil},
+		{"terms.example", "10.0.0.11", RFC4408, Permerror, SyntaxError{&token{tIP4, qPlus, "10.0.0.11", 138, 151}, ErrTooManyMechanisms}},
+		{"redirect.terms.example", "10.0.0.1", RFC4408, Pass, nil},
+		{"redirect.terms.example", "192.168.0.1", RFC7208, Fail, nil},
+		{"redirect.terms.example", "192.168.0.1", RFC4408, Permerror, SyntaxError{&token{tAll, qMinus, "", 7, 11}, ErrTooManyMechanisms}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s_%s_%s", test.domain, test.ip, test.spec), func(t *testing.T) {
+			r, _, _, err := CheckHost(net.ParseIP(test.ip), test.domain, test.domain, WithResolver(testResolver), WithSpec(test.spec))
+			if r != test.r {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, test.r)
+			}
+			if diff := cmp.Diff(test.err, err, deepAllowUnexported(SyntaxError{}, token{}, errors.New(""))); diff != "" {
+				t.Errorf("CheckHost() errors differs: (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithSpec_CachedVoids(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("cached.voids.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`cached.voids.example. 0 IN TXT "v=spf1 a:void1.example mx:void2.example exists:void3.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("cached.voids.example.")
+
+	// the void names are NXDOMAIN, served from the cache by the second check
+	for i := 0; i < 2; i++ {
+		r, _, _, err := CheckHost(net.ParseIP("10.0.0.1"), "cached.voids.example", "", WithResolver(testResolver))
+		if r != Permerror || !errors.Is(err, ErrTooManyVoidLookups) {
+			t.Errorf("CheckHost() #%d = %s, %v; want %s, %v", i, r, err, Permerror, ErrTooManyVoidLookups)
+		}
+	}
+	for _, name := range []string{"void1.example.", "void3.example."} {
+		if _, err := testResolverCache.Get(dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET}); err != nil {
+			t.Errorf("NXDOMAIN of %s is not cached: %v", name, err)
+		}
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/miekg/dns"
+	"github.com/redsift/spf/domainutil"
 )
 
 // Errors could be used for root couse analysis
@@ -25,8 +28,15 @@ var (
 	ErrLoopDetected      = errors.New("infinite recursion detected")
 	ErrUnreliableResult  = errors.New("result is unreliable with IgnoreMatches option enabled")
 	ErrTooManyErrors     = errors.New("too many errors")
+	ErrTooManyMXNames    = errors.New("too many MX names")
+	ErrTooManyCNAMEs     = errors.New("CNAME chain too long")
+	ErrTooDeep           = errors.New("nesting too deep")
 )
 
+// defaultMaxDepth is the nesting of "include" and "redirect" allowed by
+// default, see WithMaxDepth.
+const defaultMaxDepth = 10
+
 // DomainError represents a domain check error
 type DomainError struct {
 	Err    string // description of the error
@@ -57,57 +67,142 @@ func newInvalidDomainError(domain string) error {
 // could be totally ignored by implementation.
 type IPMatcherFunc func(ip net.IP, name string) (bool, error)
 
-// Resolver provides abstraction for DNS layer
+// Resolver provides abstraction for DNS layer.
+// Every call returns ResponseExtras of the DNS response(s) it was based on,
+// errors included: extras of the responses received before the failure are
+// still returned along with the error.
+// Implementations unable to provide the data return nil extras.
 type Resolver interface {
 	// LookupTXT returns the DNS TXT records for the given domain name.
-	LookupTXT(string) ([]string, error)
+	LookupTXT(string) ([]string, *ResponseExtras, error)
 	// LookupTXTStrict returns DNS TXT records for the given name, however it
 	// will return ErrDNSPermerror upon returned NXDOMAIN (RCODE 3)
-	LookupTXTStrict(string) ([]string, error)
+	LookupTXTStrict(string) ([]string, *ResponseExtras, error)
 	// Exists is used for a DNS A RR lookup (even when the
 	// connection type is IPv6).  If any A record is returned, this
 	// mechanism matches.
-	Exists(string) (bool, error)
+	Exists(string) (bool, *ResponseExtras, error)
 	// MatchIP provides an address lookup, which should be done on the name
 	// using the type of lookup (A or AAAA).
 	// Then IPMatcherFunc used to compare checked IP to the returned address(es).
 	// If any address matches, the mechanism matches
-	MatchIP(string, IPMatcherFunc) (bool, error)
+	MatchIP(string, IPMatcherFunc) (bool, *ResponseExtras, error)
 	// MatchMX is similar to MatchIP but first performs an MX lookup on the
 	// name.  Then it performs an address lookup on each MX name returned.
 	// Then IPMatcherFunc used to compare checked IP to the returned address(es).
-	// If any address matches, the mechanism matches
-	MatchMX(string, IPMatcherFunc) (bool, error)
+	// If any address matches, the mechanism matches.
+	// More than 10 MX records returned must fail with ErrTooManyMXNames
+	// without address lookups made.
+	MatchMX(string, IPMatcherFunc) (bool, *ResponseExtras, error)
+}
+
+// ResponseExtras holds details of DNS response(s) which are not part of
+// the answer itself. When a single Resolver call needs several DNS queries
+// (like MatchIP or MatchMX do), the values are combined.
+type ResponseExtras struct {
+	// Void is true if the response was NXDOMAIN (RCODE 3) or NOERROR with
+	// no answers
+	Void bool `json:"void,omitempty"`
+	// TTL is the minimal TTL of the answer records
+	TTL time.Duration `json:"ttl,omitempty"`
+	// Answers is the number of records in the answer section
+	Answers int `json:"answers,omitempty"`
+	// Authority is the number of records in the authority section
+	Authority int `json:"authority,omitempty"`
+	// Additional is the number of records in the additional section
+	Additional int `json:"additional,omitempty"`
+	// Size is the wire size of the response in bytes
+	Size int `json:"size,omitempty"`
+	// Queries is the number of DNS queries made
+	Queries int `json:"queries,omitempty"`
+	// VoidLookups is the number of queries returned NXDOMAIN or no answers
+	VoidLookups int `json:"voidLookups,omitempty"`
+	// CacheHits is the number of queries answered from the resolver's cache
+	CacheHits int `json:"cacheHits,omitempty"`
+	// Duration is the time the lookup took, set by evaluation
+	Duration time.Duration `json:"duration,omitempty"`
+	// CNAMEs are targets of CNAME records followed to reach the answers,
+	// in order; the last one is the name the answers belong to
+	CNAMEs []string `json:"cnames,omitempty"`
+
+	responses []*dns.Msg // raw responses, see RawResponseListener
+}
+
+// merge combines extras of two responses, either of them could be nil.
+// The result is void only if both responses are void.
+func (e *ResponseExtras) merge(o *ResponseExtras) *ResponseExtras {
+	if e == nil {
+		return o
+	}
+	if o == nil {
+		return e
+	}
+	m := &ResponseExtras{
+		Void:        e.Void && o.Void,
+		TTL:         e.TTL,
+		Answers:     e.Answers + o.Answers,
+		Authority:   e.Authority + o.Authority,
+		Additional:  e.Additional + o.Additional,
+		Size:        e.Size + o.Size,
+		Queries:     e.Queries + o.Queries,
+		VoidLookups: e.VoidLookups + o.VoidLookups,
+		CacheHits:   e.CacheHits + o.CacheHits,
+		Duration:    e.Duration + o.Duration,
+		CNAMEs:      append(e.CNAMEs[:len(e.CNAMEs):len(e.CNAMEs)], o.CNAMEs...),
+		responses:   append(e.responses[:len(e.responses):len(e.responses)], o.responses...),
+	}
+	if e.Answers == 0 || o.Answers > 0 && o.TTL < e.TTL {
+		m.TTL = o.TTL
+	}
+	return m
 }
 
 // Option sets an optional parameter for the evaluating e-mail with regard to SPF
 type Option func(*parser)
 
-// PartialMacros triggers partial macro expansion. Currently it expands only %{d} with provided domain, if not empty.
-// Otherwise it keeps macro body. Escaped symbols like '%%,%-,%_' are not expanded.
+// PartialMacros triggers partial macro expansion. It expands %{s}, %{l}, %{o}, %{h}, %{d} and %{v} if their values
+// are provided, otherwise it keeps macro body as a placeholder; runtime dependent %{i}, %{c}, %{r}, %{t}
+// and %{p} are always kept. Escaped symbols like '%%,%-,%_' are not expanded, see ExpandEscapes.
+// See ExpandMacros for the list of placeholders left.
 func PartialMacros(v bool) Option {
 	return func(p *parser) {
 		p.partialMacros = v
 	}
 }
 
+// ExpandEscapes makes partial macro expansion (see PartialMacros) expand escapes "%%", "%_" and "%-" to
+// "%", " " and "%20" as full expansion does. By default they are kept and '%' of expanded values is escaped,
+// so the output remains a macro-string: expanding it fully later gives the same text as expanding the input
+// fully at once. With escapes expanded the output is the final text but for the placeholders left.
+func ExpandEscapes(v bool) Option {
+	return func(p *parser) {
+		p.expandEscapes = v
+	}
+}
+
+// IgnoreMatches makes evaluation visit every term instead of stopping at the
+// first match (walker mode), so listeners can observe the whole policy.
+// CheckHost doesn't produce a meaningful result in this mode and returns
+// ErrUnreliableResult, or ErrTooManyErrors when ErrorsThreshold is reached.
+// See InspectHost for the API built on top of it.
 func IgnoreMatches() Option {
 	return func(p *parser) {
 		p.ignoreMatches = true
 	}
 }
 
+// ErrorsThreshold stops evaluation in walker mode (see IgnoreMatches) after
+// n errors produced by terms.
 func ErrorsThreshold(n int) Option {
 	check := func(n int) bool { return !(n > 0) }
 	stopAtError := func(err error) bool {
 		if err == nil {
 			return check(n)
 		}
-		cause, _ := Cause(err)
-		if cause == ErrTooManyErrors {
+		if errors.Is(err, ErrTooManyErrors) {
 			return true
 		}
-		if cause == ErrUnreliableResult {
+		if errors.Is(err, ErrUnreliableResult) {
 			return check(n)
 		}
 		n--
@@ -120,12 +215,38 @@ func ErrorsThreshold(n int) Option {
 	}
 }
 
+// WithResolver makes the check use r for lookups. The lookup limits of RFC
+// 7208 section 4.6.4 must be enforced by r, e.g. with NewLimitedResolver.
+// Note that r is used as is by every check given the option: a
+// LimitedResolver shared by unrelated checks shares its limits too, use
+// WithResolverFactory to limit every check on its own.
 func WithResolver(r Resolver) Option {
 	return func(p *parser) {
 		p.resolver = r
 	}
 }
 
+// WithResolverFactory makes every check call f once to get the resolver for
+// its lookups, the nested evaluations of "include" and "redirect" use the
+// same resolver. The resolver from f takes precedence over WithResolver.
+// See LimitedResolverFactory.
+func WithResolverFactory(f func() Resolver) Option {
+	return func(p *parser) {
+		p.resolverFactory = f
+	}
+}
+
+// WithMaxDepth limits nesting of "include" and "redirect": domains reached
+// through more than n of them are not evaluated and the check fails with
+// Permerror and ErrTooDeep. Loop detection does not catch long chains of
+// distinct domains, which the lookup limits of resolvers do not prevent
+// either when they are lifted. The default is 10, n <= 0 removes the limit.
+func WithMaxDepth(n int) Option {
+	return func(p *parser) {
+		p.maxDepth = n
+	}
+}
+
 func WithListener(l Listener) Option {
 	return func(p *parser) {
 		p.listener = l
@@ -150,7 +271,7 @@ func ReceivingFQDN(s string) Option {
 
 func EvaluatedOn(t time.Time) Option {
 	return func(p *parser) {
-		p.evaluatedOn = t
+		p.evaluatedOn, p.evaluatedOnSet = t, true
 	}
 }
 
@@ -189,7 +310,8 @@ const (
 	// DNS operator intervention to be resolved.
 	Permerror
 
-	// unreliableResult replaces any other results when IgnoreMatches option enabled
+	// unreliableResult replaces any other results when IgnoreMatches option enabled,
+	// it is never returned by InspectHost
 	unreliableResult
 
 	internalError
@@ -269,7 +391,9 @@ func (r *Result) UnmarshalText(text []byte) error {
 // CheckHost returns result of verification, explanations as result of "exp=", raw discovered SPF policy
 // and error as the reason for the encountered problem.
 func CheckHost(ip net.IP, domain, sender string, opts ...Option) (Result, string, string, error) {
-	return newParser(opts...).checkHost(ip, NormalizeFQDN(domain), sender)
+	p := newParser(opts...)
+	defer p.release()
+	return p.checkHost(ip, NormalizeFQDN(domain), sender)
 }
 
 // Starting with the set of records that were returned by the lookup,
@@ -278,23 +402,31 @@ func CheckHost(ip net.IP, domain, sender string, opts ...Option) (Result, string
 // SP character or the end of the record.  As an example, a record with
 // a version section of "v=spf10" does not match and is discarded.
 func filterSPF(txt []string) (string, error) {
+	records := spfRecords(txt)
+	switch len(records) {
+	case 0:
+		return "", nil
+	case 1:
+		return records[0], nil
+	default:
+		return "", ErrTooManySPFRecords
+	}
+}
+
+// spfRecords returns the records which begin with version section "v=spf1"
+func spfRecords(txt []string) []string {
 	const (
 		v    = "v=spf1"
 		vLen = 6
 	)
-	var (
-		spf string
-		n   int
-	)
-
+	var records []string
 	for _, s := range txt {
 		if len(s) < vLen {
 			continue
 		}
 		if len(s) == vLen {
 			if s == v {
-				spf = s
-				n++
+				records = append(records, s)
 			}
 			continue
 		}
@@ -304,13 +436,9 @@ func filterSPF(txt []string) (string, error) {
 		if !strings.HasPrefix(s, v) {
 			continue
 		}
-		spf = s
-		n++
+		records = append(records, s)
 	}
-	if n > 1 {
-		return "", ErrTooManySPFRecords
-	}
-	return spf, nil
+	return records
 }
 
 // isDomainName checks if a string is a presentation-format domain name
@@ -328,7 +456,7 @@ func isDomainName(s string) bool {
 	// So our _effective_ maximum is 253, but 254 is not rejected if the last
 	// character is a dot.
 	l := len(s)
-	if l == 0 || l > 254 || l == 254 && s[l-1] != '.' {
+	if l == 0 || l > MaxDomainLen+1 || l == MaxDomainLen+1 && s[l-1] != '.' {
 		return false
 	}
 
@@ -373,13 +501,7 @@ func isDomainName(s string) bool {
 
 // NormalizeFQDN appends a root domain (a dot) to the FQDN.
 func NormalizeFQDN(name string) string {
-	if len(name) == 0 {
-		return ""
-	}
-	if name[len(name)-1] != '.' {
-		name = name + "."
-	}
-	return strings.ToLower(name)
+	return domainutil.Normalize(name)
 }
 
 // When the result of macro expansion is used in a domain name query, if
@@ -389,7 +511,7 @@ func NormalizeFQDN(name string) string {
 // the total length does not exceed 253 characters.
 func truncateFQDN(s string) (string, error) {
 	l := len(s)
-	if l < 254 || l == 254 && s[l-1] == '.' {
+	if l <= MaxDomainLen || l == MaxDomainLen+1 && s[l-1] == '.' {
 		if l == 1 {
 			return s, nil
 		}
@@ -404,7 +526,7 @@ func truncateFQDN(s string) (string, error) {
 	l = 0
 	i := len(s) - 1
 	labelLen := 0
-	for i >= 0 && l < 253 {
+	for i >= 0 && l < MaxDomainLen {
 		if s[i] == '.' {
 			if labelLen == 0 {
 				return "", newInvalidDomainError(s)
@@ -0,0 +1,104 @@
+package spf
+
+import (
+	"errors"
+)
+
+// ErrSPFRRNotSupported is returned when the resolver can't look up records
+// of SPF RR type
+var ErrSPFRRNotSupported = errors.New("SPF RR lookups are not supported")
+
+// SPFRRResolver is an optional interface a Resolver could implement to look
+// up records of the obsolete SPF RR type (99) defined by RFC 4408.
+type SPFRRResolver interface {
+	// LookupSPFStrict returns DNS SPF (type 99) records for the given name,
+	// however it will return ErrDNSPermerror upon NXDOMAIN (RCODE 3)
+	LookupSPFStrict(string) ([]string, *ResponseExtras, error)
+}
+
+// LookupSPFRR makes evaluation query SPF RR type (99) along with TXT when
+// looking up SPF record of a domain. SPF RR takes precedence if present;
+// published records of both types are expected to be identical, which is
+// checked and differences are reported to SPFRRListener.
+// https://tools.ietf.org/html/rfc4408#section-3.1.1
+//
+// The resolver should implement SPFRRResolver, otherwise only TXT records
+// are used. Off by default.
+func LookupSPFRR(v bool) Option {
+	return func(p *parser) {
+		p.spfRR = v
+	}
+}
+
+// lookupSPFStrict looks up SPF RR records with r if it's supported
+func lookupSPFStrict(r Resolver, name string) ([]string, *ResponseExtras, error) {
+	if s, ok := r.(SPFRRResolver); ok {
+		return s.LookupSPFStrict(name)
+	}
+	return nil, nil, ErrSPFRRNotSupported
+}
+
+// reconcileSPFRR returns SPF record of SPF RR type if the domain has one,
+// otherwise the record selected from TXT records is returned as is.
+// Failed lookups of SPF RR are ignored, as many servers mishandle them.
+func (p *parser) reconcileSPFRR(fqdn string, txt string, txtErr error) (string, error) {
+	start := p.now()
+	rrs, extras, err := lookupSPFStrict(p.dns(), fqdn)
+	if errors.Is(err, ErrSPFRRNotSupported) {
+		return txt, txtErr
+	}
+	p.fireLookupExtras(nil, fqdn, extras.spent(p.since(start)))
+	if err != nil {
+		return txt, txtErr
+	}
+	spf, err := filterSPF(rrs)
+	if spf == "" && err == nil {
+		return txt, txtErr
+	}
+	if spf != txt || err != txtErr {
+		p.fireSPFRRConflict(fqdn, rrs, txt)
+	}
+	return spf, err
+}
+
+// LookupSPFStrict returns the DNS SPF RR records for the given domain name,
+// the lookup is not counted, as it accompanies LookupTXTStrict.
+func (r *LimitedResolver) LookupSPFStrict(name string) ([]string, *ResponseExtras, error) {
+	return lookupSPFStrict(r.resolver, name)
+}
+
+func (r *retryResolver) LookupSPFStrict(name string) (v []string, extras *ResponseExtras, err error) {
+	r.retry(name, func(next Resolver) error {
+		v, extras, err = lookupSPFStrict(next, name)
+		return err
+	})
+	return
+}
+
+func (r *deadlineResolver) LookupSPFStrict(name string) ([]string, *ResponseExtras, error) {
+	var (
+		rrs    []string
+		extras *ResponseExtras
+		err    error
+	)
+	if e := r.do(func() { rrs, extras, err = lookupSPFStrict(r.resolver, name) }); e != nil {
+		return nil, nil, e
+	}
+	return rrs, extras, err
+}
+
+func (r *canceledResolver) LookupSPFStrict(name string) ([]string, *ResponseExtras, error) {
+	if r.canceled() {
+		return nil, nil, errCanceled
+	}
+	return lookupSPFStrict(r.resolver, name)
+}
+
+func (r *PoolResolver) LookupSPFStrict(name string) (v []string, extras *ResponseExtras, err error) {
+	err = ErrDNSTemperror
+	r.do(func(next Resolver) error {
+		v, extras, err = lookupSPFStrict(next, name)
+		return err
+	})
+	return
+}
@@ -0,0 +1,106 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+type spfRRListener struct {
+	recordingListener
+}
+
+func (l *spfRRListener) SPFRRConflict(domain string, rrs []string, txt string) {
+	l.add("SPFRRConflict(%s, %q, %s)", domain, rrs, txt)
+}
+
+func TestLookupSPFRR(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("both.spfrr.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`both.spfrr.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 -all"`,
+		},
+		dns.TypeSPF: {
+			`both.spfrr.example. 0 IN SPF "v=spf1 ip4:10.0.0.1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("both.spfrr.example.")
+
+	dns.HandleFunc("conflict.spfrr.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`conflict.spfrr.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 -all"`,
+		},
+		dns.TypeSPF: {
+			`conflict.spfrr.example. 0 IN SPF "v=spf1 ip4:10.0.0.2 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("conflict.spfrr.example.")
+
+	dns.HandleFunc("rronly.spfrr.example.", zone(map[uint16][]string{
+		dns.TypeSPF: {
+			`rronly.spfrr.example. 0 IN SPF "v=spf1 ip4:10.0.0.2 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("rronly.spfrr.example.")
+
+	dns.HandleFunc("txtonly.spfrr.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`txtonly.spfrr.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("txtonly.spfrr.example.")
+
+	tests := []struct {
+		domain string
+		spfRR  bool
+		r      Result
+		events []string
+	}{
+		{"both.spfrr.example", true, Pass, nil},
+		{"conflict.spfrr.example", false, Pass, nil},
+		{"conflict.spfrr.example", true, Fail,
+			[]string{`SPFRRConflict(conflict.spfrr.example., ["v=spf1 ip4:10.0.0.2 -all"], v=spf1 ip4:10.0.0.1 -all)`}},
+		{"rronly.spfrr.example", false, None, nil},
+		{"rronly.spfrr.example", true, Fail,
+			[]string{`SPFRRConflict(rronly.spfrr.example., ["v=spf1 ip4:10.0.0.2 -all"], )`}},
+		{"txtonly.spfrr.example", true, Pass, nil},
+	}
+
+	for no, test := range tests {
+		t.Run(fmt.Sprintf("%d_%s", no, test.domain), func(t *testing.T) {
+			l := &spfRRListener{}
+			r, _, _, err := CheckHost(net.ParseIP("10.0.0.1"), test.domain, "john@"+test.domain,
+				WithResolver(testResolver), WithListener(l), LookupSPFRR(test.spfRR))
+			if r != test.r {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, test.r)
+			}
+			if got := l.filter("SPFRRConflict"); fmt.Sprint(got) != fmt.Sprint(test.events) {
+				t.Errorf("SPFRRConflict events:\n got=%q\nwant=%q", got, test.events)
+			}
+		})
+	}
+}
+
+type txtOnlyResolver struct {
+	Resolver
+}
+
+func TestLookupSPFRR_NotSupported(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("rronly.spfrr.example.", zone(map[uint16][]string{
+		dns.TypeSPF: {
+			`rronly.spfrr.example. 0 IN SPF "v=spf1 ip4:10.0.0.2 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("rronly.spfrr.example.")
+
+	r, _, _, err := CheckHost(net.ParseIP("10.0.0.1"), "rronly.spfrr.example", "",
+		WithResolver(txtOnlyResolver{testResolver}), LookupSPFRR(true))
+	if r != None || err != ErrSPFNotFound {
+		t.Errorf("CheckHost() = %s, %v; want %s, %v", r, err, None, ErrSPFNotFound)
+	}
+}
@@ -0,0 +1,299 @@
+package spf
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SplitPlan is a restructuring of SPF policy exceeding the limit of DNS
+// lookups proposed by SplitPolicy.
+type SplitPlan struct {
+	Domain     string           `json:"domain"`
+	Lookups    int              `json:"lookups"`              // lookups of the published policy
+	Candidates []SplitCandidate `json:"candidates,omitempty"` // record sets replacing the policy, fewest flattened includes first
+}
+
+// SplitCandidate is a set of records replacing the published policy: some
+// of the included policies are flattened, that is replaced with the networks
+// they authorize, and the networks are published in intermediate records
+// chained with "include" behind the record of the domain.
+type SplitCandidate struct {
+	Flattened []string      `json:"flattened"`      // included domains replaced with their networks
+	Kept      []string      `json:"kept,omitempty"` // included domains left as they are
+	Records   []SplitRecord `json:"records"`        // the record of the domain followed by the intermediate ones
+	Lookups   int           `json:"lookups"`        // estimated lookups of the policy made of the records
+}
+
+// SplitRecord is a record of SplitCandidate to publish.
+type SplitRecord struct {
+	Domain string `json:"domain"`
+	Record string `json:"record"`
+}
+
+// SplitOption sets an optional parameter of SplitPolicy.
+type SplitOption func(*splitter)
+
+// SplitKeepIncludes prevents flattening of the included domains, e.g. of
+// vendors changing their networks frequently.
+func SplitKeepIncludes(domains ...string) SplitOption {
+	return func(s *splitter) {
+		for _, d := range domains {
+			s.keep[NormalizeFQDN(d)] = true
+		}
+	}
+}
+
+// SplitMaxRecordLength sets the length of intermediate records, 450 by
+// default as RFC 7208 section 3.4 recommends.
+func SplitMaxRecordLength(n int) SplitOption {
+	return func(s *splitter) {
+		s.maxLength = n
+	}
+}
+
+// SplitLimits sets the limits the candidates must fit into, those of RFC
+// 7208 by default. Only the DNS lookups limit is considered.
+func SplitLimits(l Limits) SplitOption {
+	return func(s *splitter) {
+		s.limits = l.normalized()
+	}
+}
+
+// maxSplitLookups limits the lookups SplitPolicy makes walking the policy
+const maxSplitLookups = 100
+
+// SplitPolicy walks SPF policy of the domain regardless of the lookup limit
+// and proposes how to restructure it to fit into the limit of 10 lookups, or
+// the one set with SplitLimits.
+// Candidates flatten the most expensive "include" mechanisms first, one more
+// by each candidate; only includes producing "pass" whose policies could be
+// fully enumerated (see AuthorizedNetworks) and have no terms producing other
+// results but the trailing "all" are flattened. Networks of each flattened
+// include are published in place of it at "_spf1.<domain>", "_spf2.<domain>"
+// and so on, so the order of terms is kept.
+//
+// Candidates fitting the limit are returned, or the one flattening everything
+// possible if none does; the plan has no candidates if the policy is within
+// the limit already. Flattened policies must be refreshed as the included
+// domains change them.
+func SplitPolicy(domain string, r Resolver, opts ...SplitOption) (*SplitPlan, error) {
+	domain = NormalizeFQDN(domain)
+	s := &splitter{domain: domain, keep: make(map[string]bool), maxLength: 450, limits: DefaultLimits()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	w := &policyWalker{
+		resolver: NewLimitedResolver(r, maxSplitLookups, MaxMXNames),
+		visited:  newStringsStack(),
+	}
+	tree, err := w.walk(domain)
+	if err != nil {
+		return nil, err
+	}
+	s.tree = tree
+	plan := &SplitPlan{Domain: domain, Lookups: tree.lookups()}
+	if plan.Lookups <= s.limits.DNSLookups {
+		return plan, nil
+	}
+
+	var includes []int // flattenable includes, the most expensive first
+	for i, t := range tree.terms {
+		if t.token.mechanism == tInclude && t.token.qualifier == qPlus && t.policy != nil &&
+			t.policy.bounded() && t.policy.passOnly() && !s.keep[t.policy.domain] {
+			includes = append(includes, i)
+		}
+	}
+	sort.SliceStable(includes, func(i, j int) bool {
+		return tree.terms[includes[i]].lookups() > tree.terms[includes[j]].lookups()
+	})
+	var last SplitCandidate
+	for k := 1; k <= len(includes); k++ {
+		last = s.candidate(includes[:k])
+		if last.Lookups <= s.limits.DNSLookups {
+			plan.Candidates = append(plan.Candidates, last)
+		}
+	}
+	if len(plan.Candidates) == 0 && len(includes) > 0 {
+		plan.Candidates = append(plan.Candidates, last)
+	}
+	return plan, nil
+}
+
+type splitter struct {
+	domain    string
+	keep      map[string]bool
+	maxLength int
+	limits    Limits
+	tree      *policyTree
+}
+
+// candidate flattens the terms of the policy at the positions, each of them
+// is replaced with the chain of intermediate records of its own
+func (s *splitter) candidate(flatten []int) SplitCandidate {
+	var (
+		c        SplitCandidate
+		records  []SplitRecord
+		seen     = make(map[string]bool)
+		included = make(map[int]string) // intermediate records replacing the terms at the offsets
+	)
+	for i, t := range s.tree.terms {
+		if !contains(flatten, i) {
+			c.Lookups += t.lookups()
+			if t.token.mechanism == tInclude && t.policy != nil {
+				c.Kept = append(c.Kept, t.policy.domain)
+			}
+			continue
+		}
+		c.Flattened = append(c.Flattened, t.policy.domain)
+		// networks of the earlier flattened includes pass before this one
+		var networks []string
+		for _, n := range t.policy.authorizedNetworks(nil, nil) {
+			if m := networkTerm(n.Network); !seen[m] {
+				seen[m] = true
+				networks = append(networks, m)
+			}
+		}
+		intermediate := s.intermediate(networks, len(records)+1)
+		if len(intermediate) > 0 {
+			included[t.token.start] = intermediate[0].Domain
+		} else {
+			included[t.token.start] = ""
+		}
+		records = append(records, intermediate...)
+	}
+	if s.tree.redirect != nil {
+		c.Lookups += s.tree.redirect.lookups()
+	}
+	c.Lookups += len(records)
+
+	var b strings.Builder
+	for _, t := range lex(s.tree.record) {
+		domain, ok := included[t.start]
+		if ok && domain == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		if ok {
+			b.WriteString("include:" + domain)
+			continue
+		}
+		b.WriteString(s.tree.record[t.start:t.end])
+	}
+	c.Records = append([]SplitRecord{{s.domain, b.String()}}, records...)
+	return c
+}
+
+// intermediate returns the chain of records publishing the networks, named
+// starting from "_spf<first>.<domain>"
+func (s *splitter) intermediate(networks []string, first int) []SplitRecord {
+	var records []SplitRecord
+	name := func(i int) string {
+		return "_spf" + strconv.Itoa(first+i) + "." + strings.TrimSuffix(s.domain, ".")
+	}
+	for len(networks) > 0 {
+		next := " include:" + name(len(records)+1)
+		b := strings.Builder{}
+		b.WriteString("v=spf1")
+		n := 0
+		for ; n < len(networks); n++ {
+			l := b.Len() + 1 + len(networks[n])
+			if n < len(networks)-1 {
+				l += len(next)
+			}
+			if n > 0 && l > s.maxLength {
+				break
+			}
+			b.WriteString(" " + networks[n])
+		}
+		networks = networks[n:]
+		if len(networks) > 0 {
+			b.WriteString(next)
+		}
+		records = append(records, SplitRecord{name(len(records)), b.String()})
+	}
+	return records
+}
+
+// networkTerm returns "ip4" or "ip6" mechanism matching the network
+func networkTerm(n *net.IPNet) string {
+	ones, bits := n.Mask.Size()
+	m := "ip6:"
+	if ip := n.IP.To4(); ip != nil && bits == 32 {
+		m = "ip4:"
+	}
+	if ones == bits {
+		return m + n.IP.String()
+	}
+	return fmt.Sprintf("%s%s/%d", m, n.IP, ones)
+}
+
+func contains(a []int, x int) bool {
+	for _, v := range a {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+// lookups returns the number of terms causing DNS lookups in the policy
+func (p *policyTree) lookups() int {
+	if p == nil {
+		return 0
+	}
+	var n int
+	for _, t := range p.terms {
+		n += t.lookups()
+	}
+	if p.redirect != nil {
+		n += p.redirect.lookups()
+	}
+	return n
+}
+
+func (t *policyTerm) lookups() int {
+	switch t.token.mechanism {
+	case tA, tMX, tPTR, tExists:
+		return 1
+	case tInclude, tRedirect:
+		return 1 + t.policy.lookups()
+	default:
+		return 0
+	}
+}
+
+// bounded returns true if networks of all the terms of the policy are known
+func (p *policyTree) bounded() bool {
+	for _, t := range p.terms {
+		if t.unbounded || t.policy != nil && !t.policy.bounded() {
+			return false
+		}
+	}
+	if r := p.redirect; r != nil && (r.unbounded || r.policy != nil && !r.policy.bounded()) {
+		return false
+	}
+	return true
+}
+
+// passOnly returns true if all the terms of the policy but the trailing "all"
+// produce "pass", so the policy matches the same addresses regardless of the
+// order of the terms
+func (p *policyTree) passOnly() bool {
+	for _, t := range p.terms {
+		if t.token.mechanism == tAll {
+			continue
+		}
+		if t.token.qualifier != qPlus || t.policy != nil && !t.policy.passOnly() {
+			return false
+		}
+	}
+	if r := p.redirect; r != nil && r.policy != nil && !r.policy.passOnly() {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package spf
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSplitPolicy(t *testing.T) {
+	testResolverCache.Purge()
+
+	zones := map[string][]string{
+		"split.example.": {`"v=spf1 ip4:192.0.2.0/24 include:big.split.example include:small.split.example ` +
+			`include:dyn.split.example -all"`},
+		"big.split.example.": {`"v=spf1 a:h1.split.example a:h2.split.example a:h3.split.example ` +
+			`a:h4.split.example/28 mx:h5.split.example -all"`},
+		"small.split.example.": {`"v=spf1 ip6:2001:db8::/32 a:h1.split.example a:h2.split.example ~all"`},
+		"dyn.split.example.":   {`"v=spf1 ip4:203.0.113.0/24 a:h1.split.example ?all"`},
+		"fits.split.example.":  {`"v=spf1 include:small.split.example -all"`},
+	}
+	for name, txt := range zones {
+		var rr []string
+		for _, s := range txt {
+			rr = append(rr, name+" 0 IN TXT "+s)
+		}
+		dns.HandleFunc(name, zone(map[uint16][]string{dns.TypeTXT: rr}))
+		defer dns.HandleRemove(name)
+	}
+	for i, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3", "198.51.100.20", "198.51.100.5"} {
+		name := "h" + string(rune('1'+i)) + ".split.example."
+		dns.HandleFunc(name, zone(map[uint16][]string{
+			dns.TypeA:  {name + " 0 IN A " + ip},
+			dns.TypeMX: {name + " 0 IN MX 10 " + name},
+		}))
+		defer dns.HandleRemove(name)
+	}
+
+	t.Run("candidates", func(t *testing.T) {
+		plan, err := SplitPolicy("split.example", testResolver, SplitKeepIncludes("dyn.split.example"))
+		if err != nil {
+			t.Fatalf("SplitPolicy() error = %v", err)
+		}
+		want := &SplitPlan{
+			Domain:  "split.example.",
+			Lookups: 11,
+			Candidates: []SplitCandidate{
+				{
+					Flattened: []string{"big.split.example."},
+					Kept:      []string{"small.split.example.", "dyn.split.example."},
+					Records: []SplitRecord{
+						{"split.example.", "v=spf1 ip4:192.0.2.0/24 include:_spf1.split.example " +
+							"include:small.split.example include:dyn.split.example -all"},
+						{"_spf1.split.example", "v=spf1 ip4:198.51.100.1 ip4:198.51.100.2 ip4:198.51.100.3 " +
+							"ip4:198.51.100.16/28 ip4:198.51.100.5"},
+					},
+					Lookups: 6,
+				},
+				{
+					Flattened: []string{"big.split.example.", "small.split.example."},
+					Kept:      []string{"dyn.split.example."},
+					Records: []SplitRecord{
+						{"split.example.", "v=spf1 ip4:192.0.2.0/24 include:_spf1.split.example " +
+							"include:_spf2.split.example include:dyn.split.example -all"},
+						{"_spf1.split.example", "v=spf1 ip4:198.51.100.1 ip4:198.51.100.2 ip4:198.51.100.3 " +
+							"ip4:198.51.100.16/28 ip4:198.51.100.5"},
+						{"_spf2.split.example", "v=spf1 ip6:2001:db8::/32"},
+					},
+					Lookups: 4,
+				},
+			},
+		}
+		if !reflect.DeepEqual(plan, want) {
+			t.Errorf("SplitPolicy() =\n%+v\nwant\n%+v", plan, want)
+		}
+	})
+
+	t.Run("chained", func(t *testing.T) {
+		plan, err := SplitPolicy("split.example", testResolver, SplitMaxRecordLength(70))
+		if err != nil {
+			t.Fatalf("SplitPolicy() error = %v", err)
+		}
+		c := plan.Candidates[0]
+		want := []SplitRecord{
+			{"split.example.", "v=spf1 ip4:192.0.2.0/24 include:_spf1.split.example " +
+				"include:small.split.example include:dyn.split.example -all"},
+			{"_spf1.split.example", "v=spf1 ip4:198.51.100.1 ip4:198.51.100.2 include:_spf2.split.example"},
+			{"_spf2.split.example", "v=spf1 ip4:198.51.100.3 include:_spf3.split.example"},
+			{"_spf3.split.example", "v=spf1 ip4:198.51.100.16/28 ip4:198.51.100.5"},
+		}
+		if !reflect.DeepEqual(c.Records, want) || c.Lookups != 8 {
+			t.Errorf("Candidates[0] = %+v; want records %q and 8 lookups", c, want)
+		}
+		for _, r := range c.Records[1:] {
+			if len(r.Record) > 70 {
+				t.Errorf("len(%q) = %d; want at most 70", r.Record, len(r.Record))
+			}
+		}
+	})
+
+	t.Run("fits", func(t *testing.T) {
+		plan, err := SplitPolicy("fits.split.example", testResolver)
+		if err != nil {
+			t.Fatalf("SplitPolicy() error = %v", err)
+		}
+		if plan.Lookups != 3 || plan.Candidates != nil {
+			t.Errorf("SplitPolicy() = %+v; want 3 lookups and no candidates", plan)
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		plan, err := SplitPolicy("fits.split.example", testResolver, SplitLimits(Limits{DNSLookups: 2}))
+		if err != nil {
+			t.Fatalf("SplitPolicy() error = %v", err)
+		}
+		if len(plan.Candidates) != 1 || plan.Candidates[0].Lookups > 2 {
+			t.Errorf("SplitPolicy() = %+v; want a candidate within 2 lookups", plan)
+		}
+	})
+}
+
+func TestSplitPolicy_Order(t *testing.T) {
+	testResolverCache.Purge()
+
+	zones := map[string]string{
+		"order.split.example.":   "v=spf1 include:v1.split.example -ip4:198.51.100.7 include:v2.split.example -all",
+		"v1.split.example.":      "v=spf1 -ip4:192.0.2.1 ip4:192.0.2.0/24 -all",
+		"v2.split.example.":      "v=spf1 ip4:198.51.100.0/24 ip4:192.0.2.1 -all",
+		"ordered.split.example.": "v=spf1 include:v2.split.example -ip4:192.0.2.2 include:v3.split.example ~all",
+		"v3.split.example.":      "v=spf1 ip4:192.0.2.0/24 include:v2.split.example ?all",
+	}
+	for name, txt := range zones {
+		dns.HandleFunc(name, zone(map[uint16][]string{dns.TypeTXT: {name + ` 0 IN TXT "` + txt + `"`}}))
+		defer dns.HandleRemove(name)
+	}
+
+	tests := []struct {
+		domain  string
+		lookups int
+		want    []SplitCandidate
+	}{
+		{"order.split.example", 1, []SplitCandidate{{
+			Flattened: []string{"v2.split.example."},
+			Kept:      []string{"v1.split.example."},
+			Records: []SplitRecord{
+				{"order.split.example.", "v=spf1 include:v1.split.example -ip4:198.51.100.7 " +
+					"include:_spf1.order.split.example -all"},
+				{"_spf1.order.split.example", "v=spf1 ip4:198.51.100.0/24 ip4:192.0.2.1"},
+			},
+			Lookups: 2,
+		}}},
+		{"ordered.split.example", 2, []SplitCandidate{
+			{
+				Flattened: []string{"v3.split.example."},
+				Kept:      []string{"v2.split.example."},
+				Records: []SplitRecord{
+					{"ordered.split.example.", "v=spf1 include:v2.split.example -ip4:192.0.2.2 " +
+						"include:_spf1.ordered.split.example ~all"},
+					{"_spf1.ordered.split.example", "v=spf1 ip4:192.0.2.0/24 ip4:198.51.100.0/24 ip4:192.0.2.1"},
+				},
+				Lookups: 2,
+			},
+			{
+				Flattened: []string{"v2.split.example.", "v3.split.example."},
+				Records: []SplitRecord{
+					{"ordered.split.example.", "v=spf1 include:_spf1.ordered.split.example -ip4:192.0.2.2 " +
+						"include:_spf2.ordered.split.example ~all"},
+					{"_spf1.ordered.split.example", "v=spf1 ip4:198.51.100.0/24 ip4:192.0.2.1"},
+					{"_spf2.ordered.split.example", "v=spf1 ip4:192.0.2.0/24"},
+				},
+				Lookups: 2,
+			},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.domain, func(t *testing.T) {
+			plan, err := SplitPolicy(test.domain, testResolver, SplitLimits(Limits{DNSLookups: test.lookups}))
+			if err != nil {
+				t.Fatalf("SplitPolicy() error = %v", err)
+			}
+			if !reflect.DeepEqual(plan.Candidates, test.want) {
+				t.Errorf("SplitPolicy() =\n%+v\nwant\n%+v", plan.Candidates, test.want)
+			}
+			// the records published evaluate the same way as the policy
+			for _, c := range plan.Candidates {
+				records := make(map[string][]string)
+				for _, r := range c.Records {
+					records[r.Domain] = []string{r.Record}
+				}
+				r, err := NewOverlayResolver(testResolver, records)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "198.51.100.7", "198.51.100.8", "203.0.113.1"} {
+					want, _, _, _ := CheckHost(net.ParseIP(ip), test.domain, "", WithResolver(testResolver))
+					got, _, _, _ := CheckHost(net.ParseIP(ip), test.domain, "", WithResolver(r))
+					if got != want {
+						t.Errorf("CheckHost(%s) = %s with %v; want %s", ip, got, c.Flattened, want)
+					}
+				}
+			}
+		})
+	}
+}
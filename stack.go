@@ -2,18 +2,76 @@ package spf
 
 import (
 	"errors"
+	"strings"
 )
 
+// Hop is a domain reached during evaluation along with the way it was
+// reached.
+type Hop struct {
+	Domain    string `json:"domain"`
+	Mechanism string `json:"mechanism,omitempty"` // "include" or "redirect", empty for the checked domain
+	Parent    string `json:"parent,omitempty"`    // domain which record has the term, empty for the checked domain
+}
+
+func (h Hop) String() string {
+	d := strings.TrimSuffix(h.Domain, ".")
+	if h.Mechanism == "" {
+		return d
+	}
+	return h.Mechanism + "→ " + d
+}
+
+// LoopError is ErrLoopDetected along with the chain of domains which forms
+// the loop. Use errors.As to get it, errors.Is(err, ErrLoopDetected) keeps
+// working as well.
+type LoopError struct {
+	Chain []Hop // domains from the checked one to the one reached again
+}
+
+func (e LoopError) Error() string {
+	s := make([]string, len(e.Chain))
+	for i, h := range e.Chain {
+		s[i] = h.String()
+	}
+	return ErrLoopDetected.Error() + ": " + strings.Join(s, " ")
+}
+
+func (e LoopError) Unwrap() error {
+	return ErrLoopDetected
+}
+
+type visit struct {
+	Hop
+	next string // mechanism of the record reaching the next domain
+}
+
+// stringsStack keeps domains being evaluated, from the checked one to the
+// current one, with their provenance
 type stringsStack struct {
-	s []string
+	s []visit
 }
 
 func newStringsStack() *stringsStack {
-	return &stringsStack{make([]string, 0, 20)}
+	return &stringsStack{make([]visit, 0, 20)}
+}
+
+func (s *stringsStack) clone() *stringsStack {
+	c := &stringsStack{make([]visit, len(s.s), cap(s.s))}
+	copy(c.s, s.s)
+	return c
+}
+
+// hop returns Hop of the domain if it's reached from the top of the stack
+func (s *stringsStack) hop(domain string) Hop {
+	h := Hop{Domain: domain}
+	if l := len(s.s); l > 0 {
+		h.Mechanism, h.Parent = s.s[l-1].next, s.s[l-1].Domain
+	}
+	return h
 }
 
 func (s *stringsStack) push(v string) {
-	s.s = append(s.s, v)
+	s.s = append(s.s, visit{Hop: s.hop(v)})
 }
 
 func (s *stringsStack) pop() (string, error) {
@@ -24,14 +82,30 @@ func (s *stringsStack) pop() (string, error) {
 
 	res := s.s[l-1]
 	s.s = s.s[:l-1]
-	return res, nil
+	return res.Domain, nil
+}
+
+// via sets the mechanism the domain pushed next is reached through
+func (s *stringsStack) via(mechanism tokenType) {
+	if l := len(s.s); l > 0 {
+		s.s[l-1].next = mechanism.String()
+	}
 }
 
 func (s *stringsStack) has(v string) bool {
-	for _, str := range s.s {
-		if v == str {
+	for _, h := range s.s {
+		if v == h.Domain {
 			return true
 		}
 	}
 	return false
 }
+
+// loop returns LoopError for the domain reached again
+func (s *stringsStack) loop(v string) error {
+	chain := make([]Hop, 0, len(s.s)+1)
+	for _, h := range s.s {
+		chain = append(chain, h.Hop)
+	}
+	return LoopError{append(chain, s.hop(v))}
+}
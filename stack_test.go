@@ -0,0 +1,89 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+)
+
+func TestLoopError(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("a.loop.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`a.loop.example. 0 IN TXT "v=spf1 include:b.loop.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("a.loop.example.")
+
+	dns.HandleFunc("b.loop.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`b.loop.example. 0 IN TXT "v=spf1 redirect=a.loop.example"`,
+		},
+	}))
+	defer dns.HandleRemove("b.loop.example.")
+
+	want := []Hop{
+		{Domain: "a.loop.example."},
+		{Domain: "b.loop.example.", Mechanism: "include", Parent: "a.loop.example."},
+		{Domain: "a.loop.example.", Mechanism: "redirect", Parent: "b.loop.example."},
+	}
+
+	for _, concurrency := range []int{0, 2} {
+		_, _, _, err := CheckHost(net.ParseIP("10.0.0.1"), "a.loop.example", "",
+			WithResolver(testResolver), ConcurrentIncludes(concurrency))
+		if !errors.Is(err, ErrLoopDetected) {
+			t.Fatalf("CheckHost() err=%v; want %v", err, ErrLoopDetected)
+		}
+		var loop LoopError
+		if !errors.As(err, &loop) {
+			t.Fatalf("CheckHost() err=%#v; want LoopError in the chain", err)
+		}
+		if diff := cmp.Diff(want, loop.Chain); diff != "" {
+			t.Errorf("LoopError.Chain differs (-want +got):\n%s", diff)
+		}
+		if got, want := loop.Error(), "infinite recursion detected: a.loop.example include→ b.loop.example redirect→ a.loop.example"; got != want {
+			t.Errorf("LoopError.Error() = %q; want %q", got, want)
+		}
+	}
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	// d0.depth.example includes d1.depth.example and so on, d12 passes
+	zone := make(map[string][]string)
+	for i := 0; i < 12; i++ {
+		zone[fmt.Sprintf("d%d.depth.example", i)] = []string{fmt.Sprintf("v=spf1 include:d%d.depth.example -all", i+1)}
+	}
+	zone["d12.depth.example"] = []string{"v=spf1 +all"}
+	r, err := NewOverlayResolver(testResolver, zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		domain string
+		opts   []Option
+		want   Result
+		err    error
+	}{
+		{"d0.depth.example", nil, Permerror, ErrTooDeep},
+		{"d2.depth.example", nil, Pass, nil},
+		{"d0.depth.example", []Option{WithMaxDepth(0)}, Pass, nil},
+		{"d10.depth.example", []Option{WithMaxDepth(1)}, Permerror, ErrTooDeep},
+		{"d10.depth.example", []Option{WithMaxDepth(2)}, Pass, nil},
+		{"d0.depth.example", []Option{WithMaxDepth(20), MemoizeIncludes()}, Pass, nil},
+	}
+	for _, tt := range tests {
+		res, _, _, err := CheckHost(net.ParseIP("192.0.2.1"), tt.domain, "", append(tt.opts, WithResolver(r))...)
+		if res != tt.want || !errors.Is(err, tt.err) || tt.err == nil && err != nil {
+			t.Errorf("CheckHost(%s, %d options) = %s, %v; want %s, %v", tt.domain, len(tt.opts), res, err, tt.want, tt.err)
+		}
+	}
+	if got := ErrorCodeOf(ErrTooDeep); got != CodeTooDeep {
+		t.Errorf("ErrorCodeOf() = %s; want %s", got, CodeTooDeep)
+	}
+}
@@ -0,0 +1,80 @@
+package spf
+
+// Term is a term of SPF record as evaluation sees it, see Tokenize.
+type Term struct {
+	Kind       TermKind `json:"kind"`
+	Qualifier  string   `json:"qualifier,omitempty"`  // "+", "-", "~" or "?" of mechanisms, "+" if omitted
+	Key        string   `json:"key,omitempty"`        // lowercased name of the mechanism or modifier, "v" of the version
+	Value      string   `json:"value,omitempty"`      // value as published, macros are not expanded
+	Text       string   `json:"text"`                 // the term as published
+	Start      int      `json:"start"`                // byte offset of the term in the record
+	End        int      `json:"end"`                  // byte offset right after the term
+	QueriesDNS bool     `json:"queriesDNS,omitempty"` // the term counts against the limit of DNS lookups
+}
+
+// Tokenize splits the record into terms the way evaluation does, so tools
+// like linters, formatters or differs see the record as evaluation does.
+// Terms with syntax errors are TermInvalid and reported as SyntaxError
+// wrapping ErrSyntaxError, the rest of the terms are returned anyway.
+func Tokenize(record string) ([]Term, error) {
+	var (
+		terms []Term
+		errs  ErrorList
+	)
+	for _, t := range lex(record) {
+		terms = append(terms, newTerm(t, record))
+		if t.isErr() {
+			errs = append(errs, SyntaxError{t, ErrSyntaxError})
+		}
+	}
+	if errs != nil {
+		return terms, errs
+	}
+	return terms, nil
+}
+
+// newTerm returns Term of the token lexed from the record
+func newTerm(t *token, record string) Term {
+	term := Term{
+		Kind:       t.kind(),
+		Key:        t.mechanism.String(),
+		Value:      t.value,
+		Text:       record[t.start:t.end],
+		Start:      t.start,
+		End:        t.end,
+		QueriesDNS: t.queriesDNS(),
+	}
+	switch term.Kind {
+	case TermInvalid:
+		term.Key, term.Value = "", ""
+	case TermMechanism:
+		term.Qualifier = t.qualifier.String()
+	case TermUnknownModifier:
+		term.Key, term.Value = t.modifier()
+	}
+	return term
+}
+
+// token returns the token of the term
+func (t Term) token() *token {
+	switch t.Kind {
+	case TermInvalid:
+		return &token{tErr, qErr, t.Text, t.Start, t.End}
+	case TermUnknownModifier:
+		return &token{tUnknownModifier, qPlus, t.Key + "=" + t.Value, t.Start, t.End}
+	}
+	q := qPlus
+	if t.Qualifier != "" {
+		if c, ok := qualifiers[rune(t.Qualifier[0])]; ok {
+			q = c
+		}
+	}
+	return &token{tokenTypeFromString(t.Key), q, t.Value, t.Start, t.End}
+}
+
+// String returns the canonical text of the term: names are lowercased, "+"
+// qualifier is omitted and "explanation" is spelled "exp". Terms with syntax
+// errors are returned as published.
+func (t Term) String() string {
+	return t.token().String()
+}
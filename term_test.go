@@ -0,0 +1,64 @@
+package spf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenize(t *testing.T) {
+	record := "v=spf1 -IP4:192.0.2.0/24 a/24//64 ~Include:_spf.example.com ra=Postmaster Explanation=exp.%{d} redirect=other.example.com"
+	terms, err := Tokenize(record)
+	if err != nil {
+		t.Fatalf("Tokenize() error = %v", err)
+	}
+	want := []Term{
+		{Kind: TermVersion, Key: "v", Value: "spf1", Text: "v=spf1", Start: 0, End: 6},
+		{Kind: TermMechanism, Qualifier: "-", Key: "ip4", Value: "192.0.2.0/24", Text: "-IP4:192.0.2.0/24", Start: 7, End: 24},
+		{Kind: TermMechanism, Qualifier: "+", Key: "a", Value: "/24//64", Text: "a/24//64", Start: 25, End: 33, QueriesDNS: true},
+		{Kind: TermMechanism, Qualifier: "~", Key: "include", Value: "_spf.example.com", Text: "~Include:_spf.example.com",
+			Start: 34, End: 59, QueriesDNS: true},
+		{Kind: TermUnknownModifier, Key: "ra", Value: "Postmaster", Text: "ra=Postmaster", Start: 60, End: 73},
+		{Kind: TermModifier, Key: "exp", Value: "exp.%{d}", Text: "Explanation=exp.%{d}", Start: 74, End: 94},
+		{Kind: TermModifier, Key: "redirect", Value: "other.example.com", Text: "redirect=other.example.com",
+			Start: 95, End: 121, QueriesDNS: true},
+	}
+	if diff := cmp.Diff(want, terms); diff != "" {
+		t.Errorf("Tokenize() (-want +got):\n%s", diff)
+	}
+
+	var canonical []string
+	for _, term := range terms {
+		canonical = append(canonical, term.String())
+	}
+	wantCanonical := []string{"v=spf1", "-ip4:192.0.2.0/24", "a/24//64", "~include:_spf.example.com",
+		"ra=Postmaster", "exp=exp.%{d}", "redirect=other.example.com"}
+	if diff := cmp.Diff(wantCanonical, canonical); diff != "" {
+		t.Errorf("String() (-want +got):\n%s", diff)
+	}
+}
+
+func TestTokenize_Errors(t *testing.T) {
+	terms, err := Tokenize("v=spf1 include: +-all  ~all")
+	want := []Term{
+		{Kind: TermVersion, Key: "v", Value: "spf1", Text: "v=spf1", Start: 0, End: 6},
+		{Kind: TermInvalid, Text: "include:", Start: 7, End: 15},
+		{Kind: TermInvalid, Text: "+-all", Start: 16, End: 21},
+		{Kind: TermMechanism, Qualifier: "~", Key: "all", Text: "~all", Start: 23, End: 27},
+	}
+	if diff := cmp.Diff(want, terms); diff != "" {
+		t.Errorf("Tokenize() (-want +got):\n%s", diff)
+	}
+	var errs ErrorList
+	if !errors.As(err, &errs) || len(errs) != 2 || !errors.Is(err, ErrSyntaxError) {
+		t.Fatalf("Tokenize() error = %v; want 2 syntax errors", err)
+	}
+	var se SyntaxError
+	if !errors.As(errs[1], &se) || se.TokenString() != "+-all" {
+		t.Errorf("error = %v; want the one of +-all", errs[1])
+	}
+	if got := terms[2].String(); got != "+-all" {
+		t.Errorf("String() = %q; want the term as published", got)
+	}
+}
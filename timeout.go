@@ -0,0 +1,179 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Errors returned (wrapped into SyntaxError of the mechanism overrun) when
+// evaluation takes too long, the result is Temperror in both cases
+var (
+	ErrMechanismTimeout = errors.New("mechanism timeout exceeded")
+	ErrDeadlineExceeded = errors.New("evaluation deadline exceeded")
+)
+
+// WithMechanismTimeout limits time of DNS lookups of each mechanism,
+// including evaluation of nested records of "include" and "redirect".
+func WithMechanismTimeout(d time.Duration) Option {
+	return func(p *parser) {
+		p.mechanismTimeout = d
+	}
+}
+
+// WithOverallDeadline limits time of the whole evaluation.
+func WithOverallDeadline(d time.Duration) Option {
+	return func(p *parser) {
+		p.overallTimeout = d
+	}
+}
+
+// deadline is the time lookups must finish by and the error to return
+// if they do not
+type deadline struct {
+	t   time.Time
+	err error
+}
+
+// earliest returns the earliest of deadlines, zero time means no deadline
+func earliest(a, b deadline) deadline {
+	if a.t.IsZero() || !b.t.IsZero() && b.t.Before(a.t) {
+		return b
+	}
+	return a
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, ErrMechanismTimeout) || errors.Is(err, ErrDeadlineExceeded)
+}
+
+// startMechanism sets the deadline for lookups of a mechanism
+func (p *parser) startMechanism() {
+	p.deadline = p.outerDeadline
+	if p.mechanismTimeout > 0 {
+		p.deadline = earliest(p.deadline, deadline{time.Now().Add(p.mechanismTimeout), ErrMechanismTimeout})
+	}
+}
+
+// dns returns the resolver with the current context and deadline applied
+func (p *parser) dns() Resolver {
+	r := bindContext(p.ctx, p.resolver)
+	if p.deadline.t.IsZero() {
+		return r
+	}
+	return &deadlineResolver{r, p.deadline}
+}
+
+// deadlineResolver abandons lookups not finished by the deadline
+type deadlineResolver struct {
+	resolver Resolver
+	deadline deadline
+}
+
+// do runs f and waits for it until the deadline
+func (r *deadlineResolver) do(f func()) error {
+	d := time.Until(r.deadline.t)
+	if d <= 0 {
+		return r.deadline.err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-t.C:
+		return r.deadline.err
+	}
+}
+
+// guard returns matcher which is not called any more after expire is called
+func (r *deadlineResolver) guard(matcher IPMatcherFunc) (guarded IPMatcherFunc, expire func()) {
+	var (
+		mu      sync.Mutex
+		expired bool
+	)
+	guarded = func(ip net.IP, name string) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if expired {
+			return false, r.deadline.err
+		}
+		return matcher(ip, name)
+	}
+	expire = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		expired = true
+	}
+	return guarded, expire
+}
+
+func (r *deadlineResolver) LookupTXT(name string) ([]string, *ResponseExtras, error) {
+	var (
+		txts   []string
+		extras *ResponseExtras
+		err    error
+	)
+	if e := r.do(func() { txts, extras, err = r.resolver.LookupTXT(name) }); e != nil {
+		return nil, nil, e
+	}
+	return txts, extras, err
+}
+
+func (r *deadlineResolver) LookupTXTStrict(name string) ([]string, *ResponseExtras, error) {
+	var (
+		txts   []string
+		extras *ResponseExtras
+		err    error
+	)
+	if e := r.do(func() { txts, extras, err = r.resolver.LookupTXTStrict(name) }); e != nil {
+		return nil, nil, e
+	}
+	return txts, extras, err
+}
+
+func (r *deadlineResolver) Exists(name string) (bool, *ResponseExtras, error) {
+	var (
+		found  bool
+		extras *ResponseExtras
+		err    error
+	)
+	if e := r.do(func() { found, extras, err = r.resolver.Exists(name) }); e != nil {
+		return false, nil, e
+	}
+	return found, extras, err
+}
+
+func (r *deadlineResolver) MatchIP(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	var (
+		found  bool
+		extras *ResponseExtras
+		err    error
+	)
+	guarded, expire := r.guard(matcher)
+	if e := r.do(func() { found, extras, err = r.resolver.MatchIP(name, guarded) }); e != nil {
+		expire()
+		return false, nil, e
+	}
+	return found, extras, err
+}
+
+func (r *deadlineResolver) MatchMX(name string, matcher IPMatcherFunc) (bool, *ResponseExtras, error) {
+	var (
+		found  bool
+		extras *ResponseExtras
+		err    error
+	)
+	guarded, expire := r.guard(matcher)
+	if e := r.do(func() { found, extras, err = r.resolver.MatchMX(name, guarded) }); e != nil {
+		expire()
+		return false, nil, e
+	}
+	return found, extras, err
+}
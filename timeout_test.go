@@ -0,0 +1,87 @@
+package spf
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestTimeouts(t *testing.T) {
+	const latency = 100 * time.Millisecond
+
+	dns.HandleFunc("timeout.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`timeout.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 mx:slow.timeout.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("timeout.example.")
+
+	dns.HandleFunc("include.timeout.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`include.timeout.example. 0 IN TXT "v=spf1 include:slow.timeout.example -all"`,
+		},
+	}))
+	defer dns.HandleRemove("include.timeout.example.")
+
+	dns.HandleFunc("redirect.timeout.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`redirect.timeout.example. 0 IN TXT "v=spf1 ip4:10.0.0.1 redirect=slow.timeout.example"`,
+		},
+	}))
+	defer dns.HandleRemove("redirect.timeout.example.")
+
+	dns.HandleFunc("slow.timeout.example.", withLatency(zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`slow.timeout.example. 0 IN TXT "v=spf1 a -all"`,
+		},
+		dns.TypeMX: {
+			`slow.timeout.example. 0 IN MX 10 slow.timeout.example.`,
+		},
+		dns.TypeA: {
+			`slow.timeout.example. 0 IN A 10.0.0.2`,
+		},
+	}), latency))
+	defer dns.HandleRemove("slow.timeout.example.")
+
+	tests := []struct {
+		name   string
+		domain string
+		ip     string
+		opts   []Option
+		want   Result
+		err    error
+		term   string
+	}{
+		{"no timeouts", "timeout.example", "10.0.0.2", nil, Pass, nil, ""},
+		{"fast mechanism", "timeout.example", "10.0.0.1", []Option{WithMechanismTimeout(latency / 2)}, Pass, nil, ""},
+		{"slow mx", "timeout.example", "10.0.0.2", []Option{WithMechanismTimeout(latency / 2)}, Temperror, ErrMechanismTimeout, "mx:slow.timeout.example"},
+		{"generous timeout", "timeout.example", "10.0.0.2", []Option{WithMechanismTimeout(10 * latency)}, Pass, nil, ""},
+		{"overall deadline", "timeout.example", "10.0.0.2", []Option{WithOverallDeadline(latency * 3 / 2)}, Temperror, ErrDeadlineExceeded, "mx:slow.timeout.example"},
+		{"slow include", "include.timeout.example", "10.0.0.2", []Option{WithMechanismTimeout(latency / 2)}, Temperror, ErrMechanismTimeout, "include:slow.timeout.example"},
+		{"slow redirect", "redirect.timeout.example", "10.0.0.2", []Option{WithMechanismTimeout(latency / 2)}, Temperror, ErrMechanismTimeout, "redirect=slow.timeout.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a resolver of its own, so exchanges abandoned by the previous
+			// test are not shared with identical questions of this one
+			resolver, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr, MiekgDNSParallelism(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			r, _, _, err := CheckHost(net.ParseIP(tt.ip), tt.domain, tt.domain, append(tt.opts, WithResolver(resolver))...)
+			if r != tt.want {
+				t.Errorf("CheckHost() = %s, %v; want %s", r, err, tt.want)
+			}
+			if cause, term := Cause(err); cause != tt.err || !strings.HasPrefix(term, tt.term) {
+				t.Errorf("CheckHost() error = %v (%q); want %v (%q)", err, term, tt.err, tt.term)
+			}
+			if tt.err != nil && time.Since(start) > 2*latency {
+				t.Errorf("CheckHost() took %s", time.Since(start))
+			}
+		})
+	}
+}
@@ -31,6 +31,8 @@ const (
 	tRedirect // redirect
 	tExp      // explanation
 
+	tUnknownModifier // any other name=value modifier, value keeps the whole term
+
 	modifierEnd
 
 	_ // qEmpty - deadcode, not used
@@ -73,6 +75,8 @@ func (tok tokenType) String() string {
 		return "exists"
 	case tExp:
 		return "exp"
+	case tUnknownModifier:
+		return "unknown-modifier"
 	case qPlus:
 		return "+"
 	case qMinus:
@@ -159,12 +163,27 @@ type token struct {
 	mechanism tokenType // all, include, a, mx, ptr, ip4, ip6, exists etc.
 	qualifier tokenType // +, -, ~, ?, defaults to +
 	value     string    // value for a mechanism
+	start     int       // byte offset of the term in the record
+	end       int       // byte offset right after the term in the record
+}
+
+// position returns byte offsets of the term in the record it was lexed from.
+// Nil token has no position and reports -1, -1.
+func (t *token) position() (start, end int) {
+	if t == nil {
+		return -1, -1
+	}
+	return t.start, t.end
 }
 
 func (t *token) isErr() bool {
 	return t.mechanism == tErr || t.qualifier == qErr
 }
 
+// String returns the canonical text of the term: names are lowercased,
+// "+" qualifier is omitted and "explanation" is spelled "exp". Lexing the
+// text produces the same term again, terms with syntax errors are returned
+// verbatim. Canonicalize and error messages rely on that.
 func (t *token) String() string {
 	if t == nil {
 		return ""
@@ -172,6 +191,10 @@ func (t *token) String() string {
 	if t.mechanism == tErr || t.qualifier == qErr {
 		return fmt.Sprint(t.value)
 	}
+	if t.mechanism == tUnknownModifier {
+		name, value := t.modifier()
+		return name + "=" + value
+	}
 	q := t.qualifier.String()
 	if t.qualifier == qPlus {
 		q = ""
@@ -180,10 +203,11 @@ func (t *token) String() string {
 		return fmt.Sprintf("%s%s", q, t.mechanism.String())
 	}
 	d := ":"
-	if t.mechanism == tVersion {
+	if t.mechanism == tVersion || t.mechanism.isModifier() {
 		d = "="
 	}
-	if t.value[0] == '/' {
+	if t.value[0] == '/' && t.mechanism.isMechanism() {
+		// dual-cidr-length right after the name, like "a/24//64"
 		d = ""
 	}
 	return fmt.Sprintf("%s%s%s%s", q, t.mechanism.String(), d, t.value)
@@ -1,6 +1,12 @@
 package spf
 
-import "testing"
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
 
 func TestTokenSyntaxValidation(t *testing.T) {
 	type TokenTestCase struct {
@@ -13,27 +19,27 @@ func TestTokenSyntaxValidation(t *testing.T) {
 		{nil, rune('='), false},
 		{
 			&token{
-				tInclude, qPlus, "matching.com",
+				tInclude, qPlus, "matching.com", 0, 0,
 			}, rune(':'), true,
 		},
 		{
 			&token{
-				tInclude, qPlus, "",
+				tInclude, qPlus, "", 0, 0,
 			}, rune(':'), false,
 		},
 		{
 			&token{
-				tErr, qErr, "",
+				tErr, qErr, "", 0, 0,
 			}, rune('='), true,
 		},
 		{
 			&token{
-				tAll, qMinus, "matching.com",
+				tAll, qMinus, "matching.com", 0, 0,
 			}, rune(':'), true,
 		},
 		{
 			&token{
-				tAll, qMinus, "matching.com",
+				tAll, qMinus, "matching.com", 0, 0,
 			}, rune('='), false,
 		},
 	}
@@ -51,3 +57,50 @@ func TestTokenSyntaxValidation(t *testing.T) {
 	}
 
 }
+
+// termText is a random SPF term made of pieces of real ones
+type termText string
+
+func (termText) Generate(r *rand.Rand, _ int) reflect.Value {
+	pick := func(s ...string) string { return s[r.Intn(len(s))] }
+	var b strings.Builder
+	b.WriteString(pick("", "", "+", "-", "~", "?", "++", "-~"))
+	b.WriteString(pick("a", "mx", "ptr", "ip4", "ip6", "include", "exists", "all",
+		"redirect", "exp", "explanation", "v", "A", "Mx", "INCLUDE", "Redirect", "ra", "Rp", "foo-bar", "1x", ""))
+	for n := r.Intn(4); n > 0; n-- {
+		b.WriteString(pick(":", "=", "/", "//", "example.com", "Example.COM", "10.0.0.1", "2001:db8::1",
+			"24", "64", "%{d}", "%{ir}.%{v}", "spf1", "_spf", ".", "-", "%", "\xff"))
+	}
+	if b.Len() == 0 {
+		b.WriteString("all")
+	}
+	return reflect.ValueOf(termText(b.String()))
+}
+
+func TestTokenString_RoundTrip(t *testing.T) {
+	roundTrip := func(s termText) bool {
+		tok := lex(string(s))[0]
+		c := tok.String()
+		tokens := lex(c)
+		if len(tokens) != 1 {
+			t.Logf("%q: %q lexes into %d terms", s, c, len(tokens))
+			return false
+		}
+		r := tokens[0]
+		same := r.mechanism == tok.mechanism && r.qualifier == tok.qualifier && r.String() == c
+		if tok.mechanism == tUnknownModifier {
+			rn, rv := r.modifier()
+			n, v := tok.modifier()
+			same = same && rn == n && rv == v
+		} else {
+			same = same && r.value == tok.value
+		}
+		if !same {
+			t.Logf("%q: {%s %s %q} -> %q -> {%s %s %q}", s, tok.qualifier, tok.mechanism, tok.value, c, r.qualifier, r.mechanism, r.value)
+		}
+		return same
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 20000}); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,7 +1,7 @@
 package spf
 
 import (
-	"fmt"
+	"encoding/json"
 	"net"
 	"strings"
 )
@@ -18,10 +18,100 @@ type Trace struct {
 	Problem      error  `json:"problem,omitempty"`      // if an error was returned, details about the error
 	Receiver     string `json:"receiver,omitempty"`     // the host name of the SPF verifier
 	Mechanism    string `json:"mechanism,omitempty"`    // the mechanism that matched
+	Pinned       string `json:"pinned,omitempty"`       // description of the pinned policy used, if any (see Pin.String)
 }
 
-func (r *Trace) ReceivedSPF() string {
-	// TODO (dmotylev) Should resulting string be wrapped/trimmed? https://tools.ietf.org/html/rfc5322#section-2.1.1
+// MarshalJSON implements json.Marshaler, Problem is rendered the way
+// SyntaxError.MarshalJSON does.
+func (r Trace) MarshalJSON() ([]byte, error) {
+	type trace Trace
+	return json.Marshal(struct {
+		trace
+		Problem *errorJSON `json:"problem,omitempty"`
+	}{trace(r), newErrorJSON(r.Problem)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *Trace) UnmarshalJSON(b []byte) error {
+	type trace Trace
+	var v struct {
+		trace
+		Problem *errorJSON `json:"problem,omitempty"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*r = Trace(v.trace)
+	r.Problem = v.Problem.error()
+	return nil
+}
+
+// ReceivedSPFOption sets an optional parameter of ReceivedSPFField.
+type ReceivedSPFOption func(*receivedSPF)
+
+// ReceivedSPFFoldWidth sets the length lines of the header field are folded
+// at where possible, 78 by default as RFC 5322 section 2.1.1 recommends.
+// Zero or negative width disables folding.
+func ReceivedSPFFoldWidth(n int) ReceivedSPFOption {
+	return func(f *receivedSPF) {
+		f.width = n
+	}
+}
+
+// ReceivedSPFKeyOrder makes the keys go first in the given order, the other
+// keys follow in the default order: client-ip, problem, identity, helo,
+// envelope-from, receiver, mechanism.
+func ReceivedSPFKeyOrder(keys ...string) ReceivedSPFOption {
+	return func(f *receivedSPF) {
+		f.order = keys
+	}
+}
+
+// ReceivedSPFCatalog sets the catalog wording the comment explaining
+// the result when there is no explanation, EnglishCatalog by default.
+func ReceivedSPFCatalog(c Catalog) ReceivedSPFOption {
+	return func(f *receivedSPF) {
+		if c != nil {
+			f.catalog = c
+		}
+	}
+}
+
+type receivedSPF struct {
+	width   int
+	order   []string
+	catalog Catalog
+}
+
+// defaultKeyOrder is the order of keys of the key-value list
+var defaultKeyOrder = []string{"client-ip", "problem", "identity", "helo", "envelope-from", "receiver", "mechanism"}
+
+// ReceivedSPF returns the value of "Received-SPF" header field on a single
+// line: comments are escaped and values which are not dot-atoms are quoted,
+// as RFC 7208 section 9.1 requires. See ReceivedSPFField for the folded
+// header field, ReceivedSPFFoldWidth has no effect here.
+func (r *Trace) ReceivedSPF(opts ...ReceivedSPFOption) string {
+	f := receivedSPF{catalog: EnglishCatalog{}}
+	for _, opt := range opts {
+		opt(&f)
+	}
+	return r.receivedSPF(f)
+}
+
+// ReceivedSPFField returns the whole "Received-SPF" header field, folded with
+// CRLF at 78 characters by default, without the trailing CRLF.
+func (r *Trace) ReceivedSPFField(opts ...ReceivedSPFOption) string {
+	if r == nil {
+		return ""
+	}
+	f := receivedSPF{width: 78, catalog: EnglishCatalog{}}
+	for _, opt := range opts {
+		opt(&f)
+	}
+	return fold("Received-SPF: "+r.receivedSPF(f), f.width)
+}
+
+func (r *Trace) receivedSPF(f receivedSPF) string {
 	if r == nil {
 		return ""
 	}
@@ -30,87 +120,165 @@ func (r *Trace) ReceivedSPF() string {
 	writeExp := func(s string) {
 		b.WriteString(" (")
 		if s != "" {
-			b.WriteString(r.Explanation)
+			b.WriteString(escapeComment(s))
 		} else {
 			// https://tools.ietf.org/html/rfc7208#section-9.1
 			// Received-SPF: pass (mybox.example.org: domain of
 			//    myname@example.com designates 192.0.2.1 as permitted sender)
 			//       receiver=mybox.example.org; client-ip=192.0.2.1;
 			//       envelope-from="myname@example.com"; helo=foo.example.com;
-			//
-			//   Received-SPF: fail (mybox.example.org: domain of
-			//                     myname@example.com does not designate
-			//                     192.0.2.1 as permitted sender)
-			//                     identity=mailfrom; client-ip=192.0.2.1;
-			//                     envelope-from="myname@example.com";
-			//
-			//
-			// Pass			The SPF record designates the host to be allowed to send
-			// Fail			The SPF record has designated the host as NOT being allowed to send
-			// SoftFail		The SPF record has designated the host as NOT being allowed to send but is in transition
-			// Neutral		The SPF record specifies explicitly that nothing can be said about validity
-			// None			The domain does not have an SPF record or the SPF record does not evaluate to a result
-			// PermError	A permanent error has occured (eg. badly formatted SPF record)
-			// TempError	A transient error has occured
+			var c strings.Builder
 			if r.Receiver != "" {
-				b.WriteString(r.Receiver)
-				b.WriteString(": ")
-			}
-			sender := "sender"
-			if r.EnvelopeFrom != "" {
-				sender = r.EnvelopeFrom
-			}
-			host := "the host"
-			if r.ClientIP != nil {
-				host = r.ClientIP.String()
-			}
-			switch r.Result {
-			case Pass:
-				fmt.Fprintf(&b, "domain of %s designates %s as permitted sender", sender, host)
-			case Fail:
-				fmt.Fprintf(&b, "domain of %s does not designate %s as permitted sender", sender, host)
-			case Softfail:
-				fmt.Fprintf(&b, "domain of %s does not designate %s as permitted sender but is in transition", sender, host)
-			case Neutral:
-				b.WriteString("nothing can be said about validity")
-			case None:
-				fmt.Fprintf(&b, "domain of %s does not have an SPF record or the SPF record does not evaluate to a result", sender)
-			case Permerror:
-				b.WriteString("a permanent error has occured")
-			case Temperror:
-				b.WriteString("a transient error has occured")
+				c.WriteString(r.Receiver)
+				c.WriteString(": ")
 			}
+			c.WriteString(f.catalog.Reason(r))
+			b.WriteString(escapeComment(c.String()))
 		}
 		b.WriteByte(')')
 	}
 
-	writeKV := func(sep bool, k, v string) bool {
+	b.WriteString(r.Result.String())
+	writeExp(r.Explanation)
+	if r.Pinned != "" {
+		b.WriteString(" (pinned: ")
+		b.WriteString(escapeComment(r.Pinned))
+		b.WriteByte(')')
+	}
+
+	values := make(map[string]string, len(defaultKeyOrder))
+	if r.ClientIP != nil {
+		values["client-ip"] = r.ClientIP.String()
+	}
+	if r.Problem != nil {
+		values["problem"] = r.Problem.Error()
+	}
+	values["identity"] = r.Identity
+	values["helo"] = r.Helo
+	values["envelope-from"] = r.EnvelopeFrom
+	values["receiver"] = r.Receiver
+	values["mechanism"] = r.Mechanism
+
+	var scol bool
+	writeKV := func(k string) {
+		v := values[k]
 		if v == "" {
-			return sep
+			return
 		}
-		if sep {
+		delete(values, k)
+		if scol {
 			b.WriteByte(';')
 		}
 		b.WriteByte(' ')
 		b.WriteString(k)
 		b.WriteByte('=')
-		b.WriteString(v)
-		return true
+		b.WriteString(keyValue(v))
+		scol = true
+	}
+	for _, k := range f.order {
+		writeKV(k)
+	}
+	for _, k := range defaultKeyOrder {
+		writeKV(k)
 	}
+	return b.String()
+}
 
-	b.WriteString(r.Result.String())
-	writeExp(r.Explanation)
-	var scol bool
-	if r.ClientIP != nil {
-		scol = writeKV(scol, "client-ip", r.ClientIP.String())
+// escapeComment makes the text safe to use in a comment of RFC 5322:
+// parentheses and backslashes are escaped as quoted pairs, control
+// characters are replaced with spaces
+func escapeComment(s string) string {
+	return escapeText(s, "()\\")
+}
+
+// keyValue returns the value as dot-atom if it is one and as quoted-string
+// otherwise
+func keyValue(v string) string {
+	if isDotAtom(v) {
+		return v
 	}
-	if r.Problem != nil {
-		scol = writeKV(scol, "problem", r.Problem.Error())
+	return `"` + escapeText(v, `"\`) + `"`
+}
+
+func escapeText(s, special string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c < ' ' || c == 0x7f:
+			b.WriteByte(' ')
+		case strings.ContainsRune(special, c):
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// isDotAtom returns true if s is dot-atom-text of RFC 5322
+func isDotAtom(s string) bool {
+	if s == "" || s[0] == '.' || s[len(s)-1] == '.' || strings.Contains(s, "..") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.':
+		case strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// fold breaks the header field into lines at most width characters long at
+// spaces outside of quoted strings, lines too long to be broken are kept
+func fold(field string, width int) string {
+	if width <= 0 {
+		return field
+	}
+	var (
+		b       strings.Builder
+		line    int  // length of the current line
+		quoted  bool // inside of a quoted string
+		comment int  // depth of nested comments
+		escaped bool // the previous character starts a quoted pair
+		word    strings.Builder
+	)
+	flush := func() {
+		if line > 0 && line+1+word.Len() > width {
+			b.WriteString("\r\n")
+			line = 0
+		}
+		if line > 0 || b.Len() > 0 {
+			b.WriteByte(' ')
+			line++
+		}
+		b.WriteString(word.String())
+		line += word.Len()
+		word.Reset()
+	}
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"' && comment == 0:
+			quoted = !quoted
+		case c == '(' && !quoted:
+			comment++
+		case c == ')' && !quoted && comment > 0:
+			comment--
+		case c == ' ' && !quoted:
+			flush()
+			continue
+		}
+		word.WriteByte(c)
 	}
-	scol = writeKV(scol, "identity", r.Identity)
-	scol = writeKV(scol, "helo", r.Helo)
-	scol = writeKV(scol, "envelope-from", r.EnvelopeFrom)
-	scol = writeKV(scol, "receiver", r.Receiver)
-	scol = writeKV(scol, "mechanism", r.Mechanism)
+	flush()
 	return b.String()
 }
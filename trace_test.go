@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"testing"
 )
 
@@ -26,20 +27,20 @@ func TestTrace_ReceivedSPF(t *testing.T) {
 				EnvelopeFrom: "john.doe@example.com",
 				ClientIP:     net.ParseIP("1:0000::1"),
 			},
-			"fail (example.net: domain of john.doe@example.com does not designate 1::1 as permitted sender) client-ip=1::1; envelope-from=john.doe@example.com; receiver=example.net"},
+			"fail (example.net: domain of john.doe@example.com does not designate 1::1 as permitted sender) client-ip=\"1::1\"; envelope-from=\"john.doe@example.com\"; receiver=example.net"},
 		{"permerror+ip",
 			&Trace{
 				Result:   Permerror,
 				ClientIP: net.ParseIP("1000::1"),
 			},
-			"permerror (a permanent error has occured) client-ip=1000::1"},
+			"permerror (a permanent error has occured) client-ip=\"1000::1\""},
 		{"permerror+ip+error",
 			&Trace{
 				Result:   Permerror,
 				ClientIP: net.ParseIP("1000::1"),
 				Problem:  errors.New("people afraid to use bicycles on the roads"),
 			},
-			"permerror (a permanent error has occured) client-ip=1000::1; problem=people afraid to use bicycles on the roads"},
+			"permerror (a permanent error has occured) client-ip=\"1000::1\"; problem=\"people afraid to use bicycles on the roads\""},
 		{"temperror+ip+mechanism+from",
 			&Trace{
 				Result:       Temperror,
@@ -47,7 +48,7 @@ func TestTrace_ReceivedSPF(t *testing.T) {
 				Mechanism:    "default",
 				EnvelopeFrom: "john.doe@example.com",
 			},
-			"temperror (a transient error has occured) client-ip=127.0.0.1; envelope-from=john.doe@example.com; mechanism=default"},
+			"temperror (a transient error has occured) client-ip=127.0.0.1; envelope-from=\"john.doe@example.com\"; mechanism=default"},
 		{"temperror+ip+error+explanation",
 			&Trace{
 				Result:      Temperror,
@@ -55,7 +56,27 @@ func TestTrace_ReceivedSPF(t *testing.T) {
 				Problem:     errors.New("people afraid to use bicycles on the roads"),
 				Explanation: "motorists either do not treat cyclist as equals or just can't spot them because of difference of speed",
 			},
-			"temperror (motorists either do not treat cyclist as equals or just can't spot them because of difference of speed) client-ip=1000::1; problem=people afraid to use bicycles on the roads"},
+			"temperror (motorists either do not treat cyclist as equals or just can't spot them because of difference of speed) client-ip=\"1000::1\"; problem=\"people afraid to use bicycles on the roads\""},
+		{"pass+pinned",
+			&Trace{
+				Result:   Pass,
+				ClientIP: net.ParseIP("1000::1"),
+				Pinned:   "example.com pinned to pass: vendor incident",
+			},
+			"pass (domain of sender designates 1000::1 as permitted sender) (pinned: example.com pinned to pass: vendor incident) client-ip=\"1000::1\""},
+		{"fail+hostile explanation",
+			&Trace{
+				Result:      Fail,
+				Explanation: "see (http://example.com/why) \\ \"quoted\"\r\nX-Injected: yes",
+			},
+			`fail (see \(http://example.com/why\) \\ "quoted"  X-Injected: yes)`},
+		{"pass+hostile from+helo",
+			&Trace{
+				Result:       Pass,
+				Helo:         "mail.example.com",
+				EnvelopeFrom: `"john) \doe"@example.com`,
+			},
+			`pass (domain of "john\) \\doe"@example.com designates the host as permitted sender) helo=mail.example.com; envelope-from="\"john) \\doe\"@example.com"`},
 	}
 
 	const wantTest = -1
@@ -72,3 +93,50 @@ func TestTrace_ReceivedSPF(t *testing.T) {
 		})
 	}
 }
+
+func TestTrace_ReceivedSPFField(t *testing.T) {
+	trace := &Trace{
+		Result:       Softfail,
+		ClientIP:     net.ParseIP("192.0.2.1"),
+		Identity:     "mailfrom",
+		Helo:         "mail.example.com",
+		EnvelopeFrom: "john.doe@example.com",
+		Receiver:     "mx.example.net",
+		Mechanism:    "~all",
+		Problem:      errors.New(`a "quoted" problem which is long enough to be kept on its own line`),
+	}
+	tests := []struct {
+		name string
+		opts []ReceivedSPFOption
+		want string
+	}{
+		{"default",
+			nil,
+			"Received-SPF: softfail (mx.example.net: domain of john.doe@example.com does\r\n" +
+				" not designate 192.0.2.1 as permitted sender but is in transition)\r\n" +
+				" client-ip=192.0.2.1;\r\n" +
+				` problem="a \"quoted\" problem which is long enough to be kept on its own line";` + "\r\n" +
+				" identity=mailfrom; helo=mail.example.com;\r\n" +
+				` envelope-from="john.doe@example.com"; receiver=mx.example.net; mechanism=~all`},
+		{"no folding+key order",
+			[]ReceivedSPFOption{ReceivedSPFFoldWidth(0), ReceivedSPFKeyOrder("receiver", "identity", "unknown")},
+			"Received-SPF: softfail (mx.example.net: domain of john.doe@example.com does not designate 192.0.2.1" +
+				" as permitted sender but is in transition) receiver=mx.example.net; identity=mailfrom; client-ip=192.0.2.1;" +
+				` problem="a \"quoted\" problem which is long enough to be kept on its own line"; helo=mail.example.com;` +
+				` envelope-from="john.doe@example.com"; mechanism=~all`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trace.ReceivedSPFField(tt.opts...)
+			if got != tt.want {
+				t.Errorf("ReceivedSPFField() got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			for _, l := range strings.Split(got, "\r\n") {
+				// the quoted problem can't be broken
+				if tt.opts == nil && len(l) > 78 && !strings.HasPrefix(l, " problem=") {
+					t.Errorf("line %q is longer than 78 characters", l)
+				}
+			}
+		})
+	}
+}
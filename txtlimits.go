@@ -0,0 +1,40 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTXTAnswerTooLarge is returned when a TXT answer exceeds the caps set with
+// WithTXTLimits, wrapped into an error describing the answer.
+var ErrTXTAnswerTooLarge = errors.New("TXT answer too large")
+
+// WithTXTLimits caps TXT answers the check processes: an answer of more than
+// maxRecords records or more than maxBytes bytes of text in total makes the
+// lookup of SPF record fail with Permerror and ErrTXTAnswerTooLarge before
+// any record is parsed; an oversized answer to the lookup of "exp=" leaves
+// the result without explanation, along with the error. Zero leaves the
+// respective cap off, both are off by default.
+func WithTXTLimits(maxRecords, maxBytes int) Option {
+	return func(p *parser) {
+		p.maxTXTRecords, p.maxTXTBytes = maxRecords, maxBytes
+	}
+}
+
+// checkTXTAnswer returns an error if txts exceed the caps of WithTXTLimits
+func (p *parser) checkTXTAnswer(fqdn string, txts []string) error {
+	if p.maxTXTRecords > 0 && len(txts) > p.maxTXTRecords {
+		return fmt.Errorf("%w: %s has %d records > %d", ErrTXTAnswerTooLarge, fqdn, len(txts), p.maxTXTRecords)
+	}
+	if p.maxTXTBytes <= 0 {
+		return nil
+	}
+	var n int
+	for _, txt := range txts {
+		n += len(txt)
+	}
+	if n > p.maxTXTBytes {
+		return fmt.Errorf("%w: %s has %d bytes > %d", ErrTXTAnswerTooLarge, fqdn, n, p.maxTXTBytes)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestWithTXTLimits(t *testing.T) {
+	long := strings.Repeat("x", 250)
+	r, err := NewOverlayResolver(testResolver, map[string][]string{
+		"txt.example": {"v=spf1 -all exp=exp.txt.example", long, long, long},
+		"exp.txt.example": {
+			`TXT "not ` + long + `" "` + long + `" "` + long + `" "` + long + `"`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		records   int
+		bytes     int
+		want      Result
+		err       error
+		explained bool
+	}{
+		{"no limits", 0, 0, Fail, nil, true},
+		{"within limits", 4, 2000, Fail, nil, true},
+		{"too many records", 3, 0, Permerror, ErrTXTAnswerTooLarge, false},
+		{"too many bytes", 0, 500, Permerror, ErrTXTAnswerTooLarge, false},
+		{"explanation too large", 0, 800, Fail, ErrTXTAnswerTooLarge, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, exp, _, err := CheckHost(net.ParseIP("192.0.2.1"), "txt.example", "",
+				WithResolver(r), WithTXTLimits(tt.records, tt.bytes))
+			if res != tt.want || !errors.Is(err, tt.err) || tt.err == nil && err != nil {
+				t.Errorf("CheckHost() = %s, %v; want %s, %v", res, err, tt.want, tt.err)
+			}
+			if explained := exp != ""; explained != tt.explained {
+				t.Errorf("CheckHost() explanation = %q; want explained %t", exp, tt.explained)
+			}
+		})
+	}
+	if _, _, _, err := CheckHost(net.ParseIP("192.0.2.1"), "txt.example", "", WithResolver(r), WithTXTLimits(3, 0)); err == nil ||
+		err.Error() != "TXT answer too large: txt.example. has 4 records > 3" {
+		t.Errorf("CheckHost() error = %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package spf
+
+import "strings"
+
+// SplitForTXT returns the RRset publishing the record: a single TXT record
+// of character-strings at most 255 bytes long each, as registrars and DNS
+// APIs take them. Terms are separated with a single space and strings are
+// split at term boundaries, right after the space, so joining them as RFC
+// 7208 section 3.3 requires restores the record. Terms longer than a string
+// are split outside of macros. Empty record returns nil.
+func SplitForTXT(record string) [][]string {
+	terms, _ := Tokenize(record)
+	var (
+		s      strings.Builder
+		starts []int // offsets of terms in s
+		unsafe = make(map[int]bool)
+	)
+	for _, t := range terms {
+		if t.Text == "" {
+			continue
+		}
+		if s.Len() > 0 {
+			s.WriteByte(' ')
+		}
+		starts = append(starts, s.Len())
+		for _, i := range macroOffsets(t.Text) {
+			unsafe[s.Len()+i] = true
+		}
+		s.WriteString(t.Text)
+	}
+	if s.Len() == 0 {
+		return nil
+	}
+	rec := s.String()
+
+	var txt []string
+	for len(rec) > maxTXTString {
+		cut := 0
+		for _, start := range starts {
+			if start > maxTXTString {
+				break
+			}
+			if start > 0 {
+				cut = start
+			}
+		}
+		if cut == 0 {
+			// the term doesn't fit a string
+			for cut = maxTXTString; cut > 1 && unsafe[cut]; cut-- {
+			}
+		}
+		txt = append(txt, rec[:cut])
+		rec = rec[cut:]
+		next := starts[:0]
+		for _, start := range starts {
+			if start >= cut {
+				next = append(next, start-cut)
+			}
+		}
+		starts = next
+		shifted := make(map[int]bool)
+		for i := range unsafe {
+			if i > cut {
+				shifted[i-cut] = true
+			}
+		}
+		unsafe = shifted
+	}
+	return [][]string{append(txt, rec)}
+}
+
+// macroOffsets returns offsets in the term splitting a macro-expand or
+// a macro escape, none if the term isn't a valid macro-string
+func macroOffsets(term string) []int {
+	ast, err := ParseMacroString(term)
+	if err != nil {
+		return nil
+	}
+	var offsets []int
+	for _, n := range ast.Nodes {
+		if n.Kind == MacroLiteral {
+			continue
+		}
+		for i := n.Start + 1; i < n.End; i++ {
+			offsets = append(offsets, i)
+		}
+	}
+	return offsets
+}
+
+// JoinTXT joins the character-strings of TXT record into SPF record as RFC
+// 7208 section 3.3 requires, that is without any separator, the inverse of
+// SplitForTXT. Strings longer than 255 bytes are reported as TXTStringError
+// and terms with characters other than printable ASCII as SyntaxError
+// wrapping CharacterError, see ValidateTXTStrings and ValidateRecord. The
+// joined record is returned anyway.
+func JoinTXT(txt []string) (string, error) {
+	record := strings.Join(txt, "")
+	errs := append(ValidateTXTStrings(txt), ValidateRecord(record)...)
+	if errs != nil {
+		return record, errs
+	}
+	return record, nil
+}
@@ -0,0 +1,69 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitForTXT(t *testing.T) {
+	var terms []string
+	for i := 0; i < 40; i++ {
+		terms = append(terms, fmt.Sprintf("ip4:192.0.%d.0/24", i))
+	}
+	long := "v=spf1 " + strings.Join(terms, " ") + " -all"
+
+	tests := []struct {
+		name   string
+		record string
+		want   [][]string
+	}{
+		{"empty", "  ", nil},
+		{"short", " v=spf1  mx -all ", [][]string{{"v=spf1 mx -all"}}},
+		{"exact", "v=spf1 a:" + strings.Repeat("a", 241) + " -all", [][]string{{"v=spf1 a:" + strings.Repeat("a", 241) + " -all"}}},
+		{"boundary", "v=spf1 a:" + strings.Repeat("a", 242) + " -all",
+			[][]string{{"v=spf1 a:" + strings.Repeat("a", 242) + " ", "-all"}}},
+		{"long term", "v=spf1 exp=" + strings.Repeat("a", 249) + "%{d}" + strings.Repeat("b", 10),
+			[][]string{{"v=spf1 ", "exp=" + strings.Repeat("a", 249), "%{d}" + strings.Repeat("b", 10)}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.want, SplitForTXT(test.record)); diff != "" {
+				t.Errorf("SplitForTXT() (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	rrs := SplitForTXT(long)
+	if len(rrs) != 1 || len(rrs[0]) < 3 {
+		t.Fatalf("SplitForTXT(long) = %q; want 1 record of 3 strings at least", rrs)
+	}
+	for i, s := range rrs[0] {
+		if len(s) > 255 {
+			t.Errorf("string %d is %d bytes long", i, len(s))
+		}
+		if i < len(rrs[0])-1 && !strings.HasSuffix(s, " ") {
+			t.Errorf("string %d = %q; want it split at a term boundary", i, s)
+		}
+	}
+	if got, err := JoinTXT(rrs[0]); got != long || err != nil {
+		t.Errorf("JoinTXT() = %q, %v; want %q", got, err, long)
+	}
+}
+
+func TestJoinTXT(t *testing.T) {
+	got, err := JoinTXT([]string{"v=spf1 a:" + strings.Repeat("a", 250), " a:é.example.com"})
+	if want := "v=spf1 a:" + strings.Repeat("a", 250) + " a:é.example.com"; got != want {
+		t.Errorf("JoinTXT() = %q; want %q", got, want)
+	}
+	var errs ErrorList
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("JoinTXT() error = %v; want 2 errors", err)
+	}
+	if !errors.Is(errs[0], ErrTXTStringTooLong) || !errors.Is(errs[1], ErrInvalidCharacter) {
+		t.Errorf("JoinTXT() error = %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package spf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors of records not fitting constraints of RFC 7208 section 3
+var (
+	ErrInvalidCharacter = errors.New("invalid character")
+	ErrTXTStringTooLong = errors.New("TXT string longer than 255 characters")
+)
+
+// maxTXTString is the maximum length of a character-string of TXT record
+const maxTXTString = 255
+
+// CharacterError is ErrInvalidCharacter along with the character found.
+// Terms of SPF records may consist of printable ASCII characters only.
+// Use errors.As to get it, errors.Is(err, ErrInvalidCharacter) keeps
+// working as well.
+type CharacterError struct {
+	Char   rune // utf8.RuneError for bytes which aren't valid UTF-8
+	Offset int  // byte offset of the character in the term
+}
+
+func (e CharacterError) Error() string {
+	return fmt.Sprintf("%s %q at %d", ErrInvalidCharacter, e.Char, e.Offset)
+}
+
+func (e CharacterError) Unwrap() error {
+	return ErrInvalidCharacter
+}
+
+// TXTStringError is ErrTXTStringTooLong along with the string exceeding
+// the limit.
+type TXTStringError struct {
+	Index  int // index of the string in the TXT record
+	Length int
+}
+
+func (e TXTStringError) Error() string {
+	return fmt.Sprintf("%s: string %d is %d characters long", ErrTXTStringTooLong, e.Index, e.Length)
+}
+
+func (e TXTStringError) Unwrap() error {
+	return ErrTXTStringTooLong
+}
+
+// ValidateRecord returns errors of the terms of the record having
+// characters other than printable ASCII, as SyntaxError wrapping
+// CharacterError, nil if there are none. Evaluation produces "permerror" for
+// such records in Strict mode and skips the terms in Lenient mode.
+// https://tools.ietf.org/html/rfc7208#section-12
+func ValidateRecord(record string) ErrorList {
+	var errs ErrorList
+	for _, t := range lex(record) {
+		if err := invalidCharacter(t); err != nil {
+			errs = append(errs, SyntaxError{t, err})
+		}
+	}
+	return errs
+}
+
+// ValidateTXTStrings returns errors of the character-strings of TXT record
+// longer than 255 characters, nil if there are none. Strings making up SPF
+// record published in DNS have to be split to fit the limit.
+// https://tools.ietf.org/html/rfc7208#section-3.3
+func ValidateTXTStrings(txt []string) ErrorList {
+	var errs ErrorList
+	for i, s := range txt {
+		if len(s) > maxTXTString {
+			errs = append(errs, TXTStringError{i, len(s)})
+		}
+	}
+	return errs
+}
+
+// invalidCharacter returns CharacterError of the first character of
+// the term which isn't printable ASCII
+func invalidCharacter(t *token) error {
+	for i := 0; i < len(t.value); i++ {
+		if c := t.value[i]; c < 0x21 && c != ' ' && c != '\t' || c > 0x7e {
+			r, _ := utf8.DecodeRuneInString(t.value[i:])
+			s := t.String()
+			return CharacterError{r, strings.LastIndex(s, t.value) + i}
+		}
+	}
+	return nil
+}
+
+// invalidCharacters returns SyntaxError of the first term which isn't made
+// of printable ASCII characters
+func invalidCharacters(tokens []*token) error {
+	for _, t := range tokens {
+		if err := invalidCharacter(t); err != nil {
+			return SyntaxError{t, err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package spf
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestValidateRecord(t *testing.T) {
+	tests := []struct {
+		record string
+		errs   []string
+	}{
+		{"v=spf1 ip4:10.0.0.0/8 -all", nil},
+		{"v=spf1\ta\t-all", nil},
+		{"v=spf1 a:exämple.com -all", []string{`a:exämple.com: invalid character 'ä' at 4`}},
+		{"v=spf1 a:ex\x00ample.com -all\x7f", []string{
+			`a:ex` + "\x00" + `ample.com: invalid character '\x00' at 4`,
+			`-all` + "\x7f" + `: invalid character '\x7f' at 4`,
+		}},
+		{"v=spf1 foo=\xffbar", []string{"foo=\xffbar: invalid character '�' at 4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.record, func(t *testing.T) {
+			var got []string
+			for _, err := range ValidateRecord(tt.record) {
+				var se SyntaxError
+				if !errors.As(err, &se) || !errors.Is(err, ErrInvalidCharacter) {
+					t.Errorf("ValidateRecord() error %v isn't SyntaxError of ErrInvalidCharacter", err)
+					continue
+				}
+				got = append(got, se.TokenString()+": "+se.Unwrap().Error())
+			}
+			if !reflect.DeepEqual(got, tt.errs) {
+				t.Errorf("ValidateRecord() = %q; want %q", got, tt.errs)
+			}
+		})
+	}
+
+	var ce CharacterError
+	if errs := ValidateRecord("v=spf1 foo=\xffbar"); len(errs) != 1 || !errors.As(errs[0], &ce) || ce.Char != utf8.RuneError {
+		t.Errorf("ValidateRecord() = %v; want CharacterError of utf8.RuneError", errs)
+	}
+}
+
+func TestValidateTXTStrings(t *testing.T) {
+	long := "v=spf1 " + strings.Repeat("a ", 130)
+	if errs := ValidateTXTStrings([]string{long[:255], long[255:]}); errs != nil {
+		t.Errorf("ValidateTXTStrings() = %v; want nil", errs)
+	}
+	errs := ValidateTXTStrings([]string{"v=spf1 ", long, "-all"})
+	var te TXTStringError
+	if len(errs) != 1 || !errors.As(errs[0], &te) || te.Index != 1 || te.Length != len(long) || !errors.Is(errs[0], ErrTXTStringTooLong) {
+		t.Errorf("ValidateTXTStrings() = %v; want error of string 1", errs)
+	}
+}
+
+func TestCheckHost_InvalidCharacters(t *testing.T) {
+	const record = "v=spf1 a:exämple.com ip4:10.0.0.0/8 -all"
+	policy := WithLocalPolicy(LocalPolicy{Before: func(string) string { return record }})
+	ip := net.ParseIP("10.0.0.1")
+
+	r, _, _, err := CheckHost(ip, "chars.example", "", WithResolver(testResolver), policy)
+	if r != Permerror || !errors.Is(err, ErrInvalidCharacter) || ErrorCodeOf(err) != CodeInvalidCharacter {
+		t.Errorf("CheckHost() = %s, %v; want %s, %v", r, err, Permerror, ErrInvalidCharacter)
+	}
+
+	l := &issueListener{}
+	r, _, _, err = CheckHost(ip, "chars.example", "", WithResolver(testResolver), policy,
+		WithParsingMode(Lenient), WithListener(l))
+	if r != Pass || err != nil {
+		t.Errorf("CheckHost(Lenient) = %s, %v; want %s", r, err, Pass)
+	}
+	want := []string{`Issue(a:exämple.com, invalid character 'ä' at 4)`}
+	if got := l.filter("Issue"); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,194 @@
+package spf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+)
+
+// Verdict is a compact outcome of SPF evaluation intended for queues and
+// storage.
+//
+// JSON encoding uses the field names below with TTL in whole seconds.
+// Binary encoding (MarshalBinary) is the protocol buffers wire format of
+// the following message, so verdicts could be consumed by any protobuf
+// implementation:
+//
+//	message Verdict {
+//	  int32  result    = 1; // value of Result
+//	  string domain    = 2;
+//	  bytes  ip        = 3; // 4 bytes for IPv4, 16 bytes for IPv6
+//	  string matched   = 4;
+//	  int64  timestamp = 5; // nanoseconds since Unix epoch
+//	  uint32 ttl       = 6; // seconds
+//	}
+type Verdict struct {
+	Result    Result        // result of evaluation
+	Domain    string        // evaluated domain
+	IP        net.IP        // evaluated IP address
+	Matched   string        // the term produced the result, empty if none
+	Timestamp time.Time     // time of evaluation
+	TTL       time.Duration // how long the verdict could be reused, zero if unknown
+}
+
+type verdictJSON struct {
+	Result    Result    `json:"result"`
+	Domain    string    `json:"domain"`
+	IP        net.IP    `json:"ip,omitempty"`
+	Matched   string    `json:"matched,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	TTL       uint32    `json:"ttl"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (v Verdict) MarshalJSON() ([]byte, error) {
+	return json.Marshal(verdictJSON{
+		Result:    v.Result,
+		Domain:    v.Domain,
+		IP:        v.IP,
+		Matched:   v.Matched,
+		Timestamp: v.Timestamp,
+		TTL:       uint32(v.TTL / time.Second),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (v *Verdict) UnmarshalJSON(b []byte) error {
+	var j verdictJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*v = Verdict{
+		Result:    j.Result,
+		Domain:    j.Domain,
+		IP:        j.IP,
+		Matched:   j.Matched,
+		Timestamp: j.Timestamp,
+		TTL:       time.Duration(j.TTL) * time.Second,
+	}
+	return nil
+}
+
+const (
+	wireVarint = 0
+	wire64bit  = 1
+	wireBytes  = 2
+	wire32bit  = 5
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler
+func (v Verdict) MarshalBinary() ([]byte, error) {
+	var b []byte
+	tmp := make([]byte, binary.MaxVarintLen64)
+	putVarint := func(field int, x uint64) {
+		if x == 0 {
+			return
+		}
+		n := binary.PutUvarint(tmp, uint64(field<<3|wireVarint))
+		b = append(b, tmp[:n]...)
+		n = binary.PutUvarint(tmp, x)
+		b = append(b, tmp[:n]...)
+	}
+	putBytes := func(field int, s []byte) {
+		if len(s) == 0 {
+			return
+		}
+		n := binary.PutUvarint(tmp, uint64(field<<3|wireBytes))
+		b = append(b, tmp[:n]...)
+		n = binary.PutUvarint(tmp, uint64(len(s)))
+		b = append(b, tmp[:n]...)
+		b = append(b, s...)
+	}
+
+	ip := v.IP.To4()
+	if ip == nil {
+		ip = v.IP.To16()
+	}
+	var ts int64
+	if !v.Timestamp.IsZero() {
+		ts = v.Timestamp.UnixNano()
+	}
+
+	putVarint(1, uint64(v.Result))
+	putBytes(2, []byte(v.Domain))
+	putBytes(3, ip)
+	putBytes(4, []byte(v.Matched))
+	putVarint(5, uint64(ts))
+	putVarint(6, uint64(uint32(v.TTL/time.Second)))
+	return b, nil
+}
+
+var errMalformedVerdict = errors.New("malformed verdict")
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler
+func (v *Verdict) UnmarshalBinary(b []byte) error {
+	*v = Verdict{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformedVerdict
+		}
+		b = b[n:]
+		var (
+			x uint64
+			s []byte
+		)
+		switch tag & 7 {
+		case wireVarint:
+			if x, n = binary.Uvarint(b); n <= 0 {
+				return errMalformedVerdict
+			}
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errMalformedVerdict
+			}
+			s, b = b[n:n+int(l)], b[n+int(l):]
+		case wire64bit, wire32bit:
+			l := 8
+			if tag&7 == wire32bit {
+				l = 4
+			}
+			if len(b) < l {
+				return errMalformedVerdict
+			}
+			b = b[l:]
+			continue
+		default:
+			return errMalformedVerdict
+		}
+		switch tag >> 3 {
+		case 1:
+			v.Result = Result(x)
+		case 2:
+			v.Domain = string(s)
+		case 3:
+			v.IP = append(net.IP(nil), s...)
+		case 4:
+			v.Matched = string(s)
+		case 5:
+			v.Timestamp = time.Unix(0, int64(x)).UTC()
+		case 6:
+			v.TTL = time.Duration(uint32(x)) * time.Second
+		}
+	}
+	return nil
+}
+
+// Verdict returns compact outcome of the evaluation.
+func (p *Path) Verdict() Verdict {
+	v := Verdict{
+		Result:    p.Result,
+		Domain:    p.Domain,
+		IP:        p.ip,
+		Timestamp: p.evaluatedOn,
+		TTL:       p.ttl,
+	}
+	if chain := p.Chain(); len(chain) > 0 {
+		v.Matched = chain[len(chain)-1].Term
+	}
+	return v
+}
@@ -0,0 +1,137 @@
+package spf
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func equalVerdicts(a, b Verdict) bool {
+	if !a.IP.Equal(b.IP) {
+		return false
+	}
+	a.IP, b.IP = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+func TestVerdict_Encoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		verdict Verdict
+		json    string
+	}{
+		{"empty",
+			Verdict{},
+			`{"result":"0","domain":"","timestamp":"0001-01-01T00:00:00Z","ttl":0}`},
+		{"ip4",
+			Verdict{
+				Result:    Pass,
+				Domain:    "example.com.",
+				IP:        net.ParseIP("192.0.2.1").To4(),
+				Matched:   "ip4:192.0.2.0/24",
+				Timestamp: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+				TTL:       300 * time.Second,
+			},
+			`{"result":"pass","domain":"example.com.","ip":"192.0.2.1","matched":"ip4:192.0.2.0/24","timestamp":"2026-10-16T12:00:00Z","ttl":300}`},
+		{"ip6",
+			Verdict{
+				Result:    Fail,
+				Domain:    "example.com.",
+				IP:        net.ParseIP("2001:db8::1"),
+				Matched:   "-all",
+				Timestamp: time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC),
+			},
+			`{"result":"fail","domain":"example.com.","ip":"2001:db8::1","matched":"-all","timestamp":"1969-12-31T00:00:00Z","ttl":0}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.verdict)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(b) != tt.json {
+				t.Errorf("json.Marshal() =\n%s\nwant\n%s", b, tt.json)
+			}
+			var fromJSON Verdict
+			if err := json.Unmarshal(b, &fromJSON); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if !equalVerdicts(fromJSON, tt.verdict) {
+				t.Errorf("json round trip = %+v; want %+v", fromJSON, tt.verdict)
+			}
+
+			b, err = tt.verdict.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary() error = %v", err)
+			}
+			var fromBinary Verdict
+			if err := fromBinary.UnmarshalBinary(b); err != nil {
+				t.Fatalf("UnmarshalBinary() error = %v", err)
+			}
+			if !equalVerdicts(fromBinary, tt.verdict) {
+				t.Errorf("binary round trip = %+v; want %+v", fromBinary, tt.verdict)
+			}
+		})
+	}
+}
+
+func TestVerdict_MarshalBinary(t *testing.T) {
+	v := Verdict{Result: Pass, Domain: "a.b", IP: net.IP{10, 0, 0, 1}, TTL: time.Minute}
+	want := []byte{
+		0x08, 0x03, // result
+		0x12, 0x03, 'a', '.', 'b', // domain
+		0x1a, 0x04, 10, 0, 0, 1, // ip
+		0x30, 0x3c, // ttl
+	}
+	got, _ := v.MarshalBinary()
+	if !bytes.Equal(got, want) {
+		t.Errorf("MarshalBinary() = % x; want % x", got, want)
+	}
+
+	// unknown fields must be skipped
+	got = append(got, 0x38, 0x01, 0x42, 0x01, 'x', 0x4d, 1, 2, 3, 4)
+	var u Verdict
+	if err := u.UnmarshalBinary(got); err != nil || !reflect.DeepEqual(u, v) {
+		t.Errorf("UnmarshalBinary() = %+v, %v; want %+v", u, err, v)
+	}
+
+	for _, b := range [][]byte{{0x08}, {0x12, 0x05, 'a'}, {0x0b}, {0x4d, 1}} {
+		if err := u.UnmarshalBinary(b); err == nil {
+			t.Errorf("UnmarshalBinary(% x) error = nil", b)
+		}
+	}
+}
+
+func TestPath_Verdict(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("verdict.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`verdict.example. 300 IN TXT "v=spf1 a -all"`,
+		},
+		dns.TypeA: {
+			`verdict.example. 60 IN A 10.0.0.1`,
+		},
+	}))
+	defer dns.HandleRemove("verdict.example.")
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	ip := net.ParseIP("10.0.0.1")
+	got := Explain(ip, "verdict.example", WithResolver(testResolver), EvaluatedOn(now)).Verdict()
+	want := Verdict{
+		Result:    Pass,
+		Domain:    "verdict.example.",
+		IP:        ip,
+		Matched:   "a",
+		Timestamp: now,
+		TTL:       time.Minute,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Verdict() = %+v; want %+v", got, want)
+	}
+}
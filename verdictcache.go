@@ -0,0 +1,202 @@
+package spf
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VerdictCache stores verdicts of SPF evaluation keyed by domain and the
+// network matched by the decisive ip4, ip6, a or mx mechanism, so
+// messages from the same sending network skip evaluation entirely.
+// Verdicts are kept for the minimal TTL of the lookups the result depends
+// on, Temperror is never cached and Permerror is cached for no longer
+// than the floor given to NewVerdictCache.
+// Results depending on macros, "ptr" or pinned policies are not cached.
+// VerdictCache is safe for concurrent use.
+type VerdictCache struct {
+	mu           sync.Mutex
+	domains      map[string][]*cachedVerdict
+	permerrorTTL time.Duration
+	clock        Clock
+}
+
+// VerdictCacheOption sets an optional parameter of VerdictCache.
+type VerdictCacheOption func(c *VerdictCache)
+
+// VerdictCacheClock makes CheckHost of the cache decide on expiration of
+// verdicts by the time of c, SystemClock by default. Pass the same Clock to
+// the evaluation with WithClock.
+func VerdictCacheClock(clk Clock) VerdictCacheOption {
+	return func(c *VerdictCache) {
+		if clk == nil {
+			return
+		}
+		c.clock = clk
+	}
+}
+
+type cachedVerdict struct {
+	network *net.IPNet
+	verdict Verdict
+	expires time.Time
+}
+
+// NewVerdictCache returns an empty cache which keeps Permerror verdicts
+// for no longer than permerrorTTL.
+func NewVerdictCache(permerrorTTL time.Duration, opts ...VerdictCacheOption) *VerdictCache {
+	c := &VerdictCache{
+		domains:      make(map[string][]*cachedVerdict),
+		permerrorTTL: permerrorTTL,
+		clock:        SystemClock,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// CheckHost returns cached verdict for the ip and the domain if any, it
+// evaluates SPF with CheckHostDetailed and caches the verdict otherwise.
+// The second value is true if the verdict was taken from the cache.
+func (c *VerdictCache) CheckHost(ip net.IP, domain, sender string, opts ...Option) (Verdict, bool) {
+	domain = NormalizeFQDN(domain)
+	now := c.clock.Now()
+	if v, ok := c.Get(ip, domain, now); ok {
+		return v, true
+	}
+	r := CheckHostDetailed(ip, domain, sender, opts...)
+	c.put(ip, domain, r, now)
+	return r.Verdict(), false
+}
+
+// Get returns the verdict cached for the ip and the domain not expired at
+// time t.
+func (c *VerdictCache) Get(ip net.IP, domain string, t time.Time) (Verdict, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domain = NormalizeFQDN(domain)
+	entries := c.domains[domain]
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if !t.Before(e.expires) {
+			entries = append(entries[:i], entries[i+1:]...)
+			i--
+			continue
+		}
+		if e.network.Contains(ip) {
+			c.domains[domain] = entries
+			return e.verdict, true
+		}
+	}
+	if len(entries) == 0 {
+		delete(c.domains, domain)
+	} else {
+		c.domains[domain] = entries
+	}
+	return Verdict{}, false
+}
+
+// Purge removes all the verdicts for the domain
+func (c *VerdictCache) Purge(domain string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.domains, NormalizeFQDN(domain))
+}
+
+func (c *VerdictCache) put(ip net.IP, domain string, r *CheckResult, t time.Time) {
+	ttl := r.Aggregate.TTL
+	switch r.Result {
+	case Temperror:
+		c.invalidate(ip, domain)
+		return
+	case Permerror:
+		if ttl > c.permerrorTTL {
+			ttl = c.permerrorTTL
+		}
+	}
+	if ttl <= 0 || r.Trace.Pinned != "" {
+		return
+	}
+	network, ok := r.Path.cacheNetwork(ip)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.domains[domain] = append(c.domains[domain], &cachedVerdict{
+		network: network,
+		verdict: r.Verdict(),
+		expires: t.Add(ttl),
+	})
+}
+
+// invalidate removes verdicts for the ip
+func (c *VerdictCache) invalidate(ip net.IP, domain string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := c.domains[domain][:0]
+	for _, e := range c.domains[domain] {
+		if !e.network.Contains(ip) {
+			entries = append(entries, e)
+		}
+	}
+	c.domains[domain] = entries
+}
+
+// cacheNetwork returns the network all addresses of which would produce
+// the same result as ip does. It is the network matched by the decisive
+// mechanism unless it overlaps with networks of the terms evaluated before,
+// the network of the ip itself is returned otherwise. It returns false if
+// the result depends on anything but the ip.
+func (p *Path) cacheNetwork(ip net.IP) (*net.IPNet, bool) {
+	network := hostNetwork(ip)
+	var decisive *Step
+	if chain := p.Chain(); len(chain) > 0 {
+		decisive = chain[len(chain)-1]
+		for _, n := range decisive.networks {
+			if n.Contains(ip) {
+				network = n
+				break
+			}
+		}
+	}
+
+	ok := true
+	p.walk(func(s *Step) {
+		if s.token == nil {
+			return
+		}
+		if s.token.mechanism == tPTR || strings.ContainsRune(s.token.value, '%') {
+			ok = false
+		}
+		if s == decisive || s.Path != nil {
+			return
+		}
+		for _, n := range s.networks {
+			if n.Contains(network.IP) || network.Contains(n.IP) {
+				network = hostNetwork(ip)
+			}
+		}
+	})
+	return network, ok
+}
+
+// walk calls f for every step in order of evaluation
+func (p *Path) walk(f func(*Step)) {
+	if p == nil {
+		return
+	}
+	for _, s := range p.Steps {
+		f(s)
+		s.Path.walk(f)
+	}
+}
+
+func hostNetwork(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
@@ -0,0 +1,94 @@
+package spf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestVerdictCache(t *testing.T) {
+	testResolverCache.Purge()
+
+	dns.HandleFunc("cache.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`cache.example. 300 IN TXT "v=spf1 -ip4:10.0.1.1 ip4:10.0.0.0/24 ip4:10.0.1.0/24 include:inc.cache.example ~all"`,
+		},
+	}))
+	defer dns.HandleRemove("cache.example.")
+
+	dns.HandleFunc("inc.cache.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`inc.cache.example. 300 IN TXT "v=spf1 a/28 -all"`,
+		},
+		dns.TypeA: {
+			`inc.cache.example. 60 IN A 192.0.2.1`,
+		},
+	}))
+	defer dns.HandleRemove("inc.cache.example.")
+
+	dns.HandleFunc("macro.cache.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`macro.cache.example. 300 IN TXT "v=spf1 exists:%{i}.cache.example ip4:10.0.0.0/24 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("macro.cache.example.")
+
+	dns.HandleFunc("broken.cache.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {
+			`broken.cache.example. 300 IN TXT "v=spf1 ip4:10.0.0.0/33 -all"`,
+		},
+	}))
+	defer dns.HandleRemove("broken.cache.example.")
+
+	c := NewVerdictCache(time.Minute)
+	check := func(ip, domain string, want Result, cached bool) {
+		t.Helper()
+		v, ok := c.CheckHost(net.ParseIP(ip), domain, domain, WithResolver(testResolver))
+		if v.Result != want || ok != cached {
+			t.Errorf("CheckHost(%s, %s) = %s, %t; want %s, %t", ip, domain, v.Result, ok, want, cached)
+		}
+	}
+
+	check("10.0.0.2", "cache.example", Pass, false)
+	check("10.0.0.3", "cache.example", Pass, true) // same /24
+	check("10.0.1.2", "cache.example", Pass, false)
+	check("10.0.1.3", "cache.example", Pass, false) // /24 overlaps with -ip4:10.0.1.1
+	check("10.0.1.1", "cache.example", Fail, false)
+	check("10.0.1.1", "cache.example", Fail, true)
+	check("192.0.2.2", "cache.example", Pass, false)
+	check("192.0.2.15", "cache.example", Pass, true) // same /28 through include
+	check("192.0.2.16", "cache.example", Softfail, false)
+	check("192.0.2.17", "cache.example", Softfail, false) // "all" is cached for the address only
+	check("192.0.2.16", "cache.example", Softfail, true)
+
+	check("10.0.0.2", "macro.cache.example", Pass, false)
+	check("10.0.0.2", "macro.cache.example", Pass, false) // depends on macros
+
+	check("10.0.0.2", "broken.cache.example", Permerror, false)
+	check("10.0.0.2", "broken.cache.example", Permerror, true)
+	if v, ok := c.Get(net.ParseIP("10.0.0.2"), "broken.cache.example", time.Now().Add(time.Minute)); ok {
+		t.Errorf("Get() = %+v; permerror cached longer than the floor", v)
+	}
+
+	if v, ok := c.Get(net.ParseIP("10.0.0.2"), "cache.example", time.Now().Add(301*time.Second)); ok {
+		t.Errorf("Get() = %+v; expired verdict returned", v)
+	}
+	c.Purge("cache.example")
+	check("10.0.0.2", "cache.example", Pass, false)
+}
+
+func TestVerdictCache_Temperror(t *testing.T) {
+	c := NewVerdictCache(time.Minute)
+	ip := net.ParseIP("10.0.0.1")
+	c.domains["temperror.example."] = []*cachedVerdict{{
+		network: hostNetwork(ip),
+		verdict: Verdict{Result: Pass},
+		expires: time.Now().Add(time.Hour),
+	}}
+	c.put(ip, "temperror.example.", &CheckResult{Result: Temperror, Aggregate: Aggregate{TTL: time.Hour}}, time.Now())
+	if v, ok := c.Get(ip, "temperror.example.", time.Now()); ok {
+		t.Errorf("Get() = %+v; want verdict invalidated by temperror", v)
+	}
+}
@@ -0,0 +1,254 @@
+package spf
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WatchEventKind tells what Watcher noticed about the policy of a domain.
+type WatchEventKind int
+
+const (
+	// WatchInitial is the first observation of the policy, Findings lists
+	// all the findings
+	WatchInitial WatchEventKind = iota + 1
+	// WatchChanged means the record of the domain changed, Changes lists
+	// the differences
+	WatchChanged
+	// WatchFindings means the policy has findings it didn't have before,
+	// Findings lists the new ones
+	WatchFindings
+	// WatchLookupsRegressed means the policy requires more DNS lookups than
+	// before, Previous is the former number
+	WatchLookupsRegressed
+	// WatchError means the policy could not be fetched because of
+	// a temporary error, Err is the error
+	WatchError
+)
+
+func (k WatchEventKind) String() string {
+	switch k {
+	case WatchInitial:
+		return "initial"
+	case WatchChanged:
+		return "changed"
+	case WatchFindings:
+		return "findings"
+	case WatchLookupsRegressed:
+		return "lookups-regressed"
+	case WatchError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// WatchEvent is a notification of Watcher.
+type WatchEvent struct {
+	Kind     WatchEventKind
+	Domain   string
+	Record   string       // the record published now, empty if there is none
+	Changes  []TermChange // differences with the previous record, see Diff
+	Findings []error      // problems of the policy: its errors, invalid terms and exceeded lookup limit
+	Lookups  int          // DNS lookups the policy requires now
+	Previous int          // DNS lookups the policy required before
+	Err      error        // temporary error of the lookups
+}
+
+// WatchOption sets an optional parameter of Watcher.
+type WatchOption func(*Watcher)
+
+// WatchMinInterval sets the shortest time between fetches of a policy,
+// a minute by default. Policies are fetched again once the shortest TTL of
+// the responses they required expires.
+func WatchMinInterval(d time.Duration) WatchOption {
+	return func(w *Watcher) {
+		if d > 0 {
+			w.min = d
+		}
+	}
+}
+
+// WatchLimits sets the limits policies are linted against, those of RFC 7208
+// by default. Only the DNS lookups limit is considered.
+func WatchLimits(l Limits) WatchOption {
+	return func(w *Watcher) {
+		w.limits = l.normalized()
+	}
+}
+
+// WatchClock makes Watcher schedule fetches by the time of c, SystemClock by
+// default. Waits of clocks other than SystemClock are not interrupted by
+// the context of Run, it is checked once they return.
+func WatchClock(c Clock) WatchOption {
+	return func(w *Watcher) {
+		if c != nil {
+			w.clock = c
+		}
+	}
+}
+
+// Watcher keeps fetching SPF policies of domains, linting them and
+// notifying about changes of the records, new findings and growing numbers
+// of DNS lookups.
+type Watcher struct {
+	domains  []string
+	resolver Resolver
+	min      time.Duration
+	limits   Limits
+	clock    Clock
+	events   chan WatchEvent
+	state    map[string]*watchState
+}
+
+// watchState is the last seen policy of a domain
+type watchState struct {
+	record   string
+	lookups  int
+	findings map[string]bool
+}
+
+// NewWatcher returns Watcher of policies of the domains making lookups
+// with r, call Run to start watching.
+func NewWatcher(domains []string, r Resolver, opts ...WatchOption) *Watcher {
+	w := &Watcher{
+		domains:  domains,
+		resolver: r,
+		min:      time.Minute,
+		limits:   DefaultLimits(),
+		clock:    SystemClock,
+		events:   make(chan WatchEvent, 16),
+		state:    make(map[string]*watchState, len(domains)),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Events returns the channel of notifications, it's closed when Run returns.
+// Run waits for the events to be received.
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Run watches the policies until the context is done, it returns the error
+// of the context. Run must be called once.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.events)
+	next := make([]time.Time, len(w.domains))
+	for {
+		now := w.clock.Now()
+		soonest := time.Time{}
+		for i, domain := range w.domains {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if now.Before(next[i]) {
+				if soonest.IsZero() || next[i].Before(soonest) {
+					soonest = next[i]
+				}
+				continue
+			}
+			ttl, err := w.poll(ctx, NormalizeFQDN(domain))
+			if err != nil {
+				return err
+			}
+			if ttl < w.min {
+				ttl = w.min
+			}
+			next[i] = w.clock.Now().Add(ttl)
+			if soonest.IsZero() || next[i].Before(soonest) {
+				soonest = next[i]
+			}
+		}
+
+		if err := sleepContext(ctx, w.clock, soonest.Sub(w.clock.Now())); err != nil {
+			return err
+		}
+	}
+}
+
+// poll fetches the policy of the domain, sends the events and returns
+// the shortest TTL of the responses
+func (w *Watcher) poll(ctx context.Context, domain string) (time.Duration, error) {
+	pw := &policyWalker{
+		resolver: NewLimitedResolver(forDomain(w.resolver, domain), maxSplitLookups, MaxMXNames),
+		visited:  newStringsStack(),
+	}
+	tree, err := pw.walk(domain)
+	var ttl time.Duration
+	if pw.extras != nil {
+		ttl = pw.extras.TTL
+	}
+	if err != nil && IsTemporary(err) {
+		return ttl, w.send(ctx, WatchEvent{Kind: WatchError, Domain: domain, Err: err})
+	}
+
+	cur := &watchState{findings: make(map[string]bool)}
+	var findings []error
+	if err != nil {
+		findings = append(findings, err)
+	}
+	if tree != nil {
+		cur.record, cur.lookups = tree.record, tree.lookups()
+		for _, e := range ValidateRecord(tree.record) {
+			findings = append(findings, e)
+		}
+	}
+	if cur.lookups > w.limits.DNSLookups {
+		findings = append(findings, fmt.Errorf("%w: %d lookups > %d", ErrDNSLimitExceeded, cur.lookups, w.limits.DNSLookups))
+	}
+
+	prev := w.state[domain]
+	w.state[domain] = cur
+	e := WatchEvent{Domain: domain, Record: cur.record, Lookups: cur.lookups}
+	if prev == nil {
+		for _, f := range findings {
+			cur.findings[f.Error()] = true
+		}
+		e.Kind, e.Findings = WatchInitial, findings
+		return ttl, w.send(ctx, e)
+	}
+
+	if cur.record != prev.record {
+		changed := e
+		changed.Kind, changed.Changes = WatchChanged, Diff(prev.record, cur.record)
+		if err := w.send(ctx, changed); err != nil {
+			return ttl, err
+		}
+	}
+	var added []error
+	for _, f := range findings {
+		m := f.Error()
+		if !prev.findings[m] && !cur.findings[m] {
+			added = append(added, f)
+		}
+		cur.findings[m] = true
+	}
+	if len(added) > 0 {
+		found := e
+		found.Kind, found.Findings = WatchFindings, added
+		if err := w.send(ctx, found); err != nil {
+			return ttl, err
+		}
+	}
+	if cur.lookups > prev.lookups {
+		regressed := e
+		regressed.Kind, regressed.Previous = WatchLookupsRegressed, prev.lookups
+		if err := w.send(ctx, regressed); err != nil {
+			return ttl, err
+		}
+	}
+	return ttl, nil
+}
+
+func (w *Watcher) send(ctx context.Context, e WatchEvent) error {
+	select {
+	case w.events <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,131 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestWatcher(t *testing.T) {
+	var record atomic.Value
+	record.Store(`"v=spf1 ip4:192.0.2.0/24 -all"`)
+	dns.HandleFunc("watch.example.", func(w dns.ResponseWriter, req *dns.Msg) {
+		zone(map[uint16][]string{
+			dns.TypeTXT: {"watch.example. 0 IN TXT " + record.Load().(string)},
+		})(w, req)
+	})
+	defer dns.HandleRemove("watch.example.")
+
+	dns.HandleFunc("inc.watch.example.", zone(map[uint16][]string{
+		dns.TypeTXT: {`inc.watch.example. 0 IN TXT "v=spf1 a:inc.watch.example ~all"`},
+		dns.TypeA:   {`inc.watch.example. 0 IN A 192.0.2.1`},
+	}))
+	defer dns.HandleRemove("inc.watch.example.")
+
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := NewWatcher([]string{"watch.example"}, r, WatchMinInterval(10*time.Millisecond))
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+
+	next := func() WatchEvent {
+		t.Helper()
+		select {
+		case e := <-w.Events():
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+			return WatchEvent{}
+		}
+	}
+
+	e := next()
+	if e.Kind != WatchInitial || e.Domain != "watch.example." || e.Record != "v=spf1 ip4:192.0.2.0/24 -all" ||
+		e.Lookups != 0 || len(e.Findings) != 0 {
+		t.Errorf("event = %+v; want initial", e)
+	}
+
+	record.Store(`"v=spf1 ip4:192.0.2.0/24 include:inc.watch.example ip4:10.0.0.0/33 -all"`)
+	e = next()
+	want := []TermChange{
+		{Kind: TermAdded, New: "include:inc.watch.example"},
+		{Kind: TermAdded, New: "ip4:10.0.0.0/33"},
+	}
+	if e.Kind != WatchChanged || len(e.Changes) != len(want) || e.Changes[0] != want[0] || e.Changes[1] != want[1] {
+		t.Errorf("event = %+v; want changed with %v", e, want)
+	}
+	e = next()
+	if e.Kind != WatchFindings || len(e.Findings) != 1 || !errors.Is(e.Findings[0], ErrNotIPv4) {
+		t.Errorf("event = %+v; want finding %v", e, ErrNotIPv4)
+	}
+	e = next()
+	if e.Kind != WatchLookupsRegressed || e.Lookups != 2 || e.Previous != 0 {
+		t.Errorf("event = %+v; want lookups regressed from 0 to 2", e)
+	}
+
+	// nothing is reported while the policy stays the same
+	select {
+	case e := <-w.Events():
+		t.Errorf("unexpected event %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v; want %v", err, context.Canceled)
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Error("Events() is not closed")
+	}
+}
+
+func TestWatcher_Clock(t *testing.T) {
+	var record atomic.Value
+	record.Store(`"v=spf1 ip4:192.0.2.0/24 -all"`)
+	dns.HandleFunc("clock.watch.example.", func(w dns.ResponseWriter, req *dns.Msg) {
+		zone(map[uint16][]string{
+			dns.TypeTXT: {"clock.watch.example. 0 IN TXT " + record.Load().(string)},
+		})(w, req)
+	})
+	defer dns.HandleRemove("clock.watch.example.")
+
+	r, err := NewMiekgDNSResolver(testResolver.(*miekgDNSResolver).serverAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := &steppedClock{NewFakeClock(start), make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := NewWatcher([]string{"clock.watch.example"}, r, WatchMinInterval(time.Minute), WatchClock(clock))
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+
+	if e := <-w.Events(); e.Kind != WatchInitial || !clock.Now().Equal(start) {
+		t.Errorf("event = %s at %v; want initial at %v", e.Kind, clock.Now(), start)
+	}
+	// the record is fetched again once the clock steps over the interval
+	record.Store(`"v=spf1 ip4:192.0.2.0/25 -all"`)
+	clock.steps <- struct{}{}
+	if e := <-w.Events(); e.Kind != WatchChanged || !clock.Now().Equal(start.Add(time.Minute)) {
+		t.Errorf("event = %s at %v; want changed at %v", e.Kind, clock.Now(), start.Add(time.Minute))
+	}
+
+	cancel()
+	clock.steps <- struct{}{}
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() = %v; want %v", err, context.Canceled)
+	}
+}